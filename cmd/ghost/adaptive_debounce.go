@@ -0,0 +1,50 @@
+package main
+
+import "time"
+
+const (
+	// adaptiveRateWindow is how far back an adaptive debounce looks when
+	// measuring the event rate.
+	adaptiveRateWindow = time.Second
+	// adaptiveCalmEvents is the most events per rate window that still count
+	// as ordinary editing and keep the base debounce.
+	adaptiveCalmEvents = 4
+)
+
+// adaptiveDebounce stretches a watcher's debounce window in proportion to the
+// recent event rate, so a branch switch or package install settles into one
+// run while a single saved file still fires after the base window.
+type adaptiveDebounce struct {
+	base   time.Duration
+	max    time.Duration
+	recent []time.Time
+}
+
+func newAdaptiveDebounce(base, max time.Duration) *adaptiveDebounce {
+	return &adaptiveDebounce{base: base, max: max}
+}
+
+// next records an event at now and returns the window to wait before firing.
+func (a *adaptiveDebounce) next(now time.Time) time.Duration {
+	cutoff := now.Add(-adaptiveRateWindow)
+	kept := a.recent[:0]
+	for _, at := range a.recent {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	a.recent = append(kept, now)
+
+	count := len(a.recent)
+	if count <= adaptiveCalmEvents || a.base <= 0 {
+		return a.base
+	}
+	window := a.base * time.Duration(count) / adaptiveCalmEvents
+	if window >= a.max {
+		// Past this point more events can't widen the window any further, so
+		// there's no need to remember them.
+		a.recent = a.recent[count-int(a.max*adaptiveCalmEvents/a.base):]
+		return a.max
+	}
+	return window
+}
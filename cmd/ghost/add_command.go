@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+)
+
+type addField struct {
+	key      string
+	prompt   string
+	value    *string
+	required bool
+}
+
+func runAddCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "watcher" && args[0] != "server") {
+		return errors.New("usage: ghost add watcher|server [config] [flags]")
+	}
+	kind := args[0]
+
+	flags := flag.NewFlagSet("add "+kind, flag.ContinueOnError)
+	name := flags.String("name", "", kind+" name")
+	command := flags.String("command", "", "command to run")
+	var path, cwd string
+	var match, ignore, dependsOn stringList
+	var fields []addField
+	if kind == "watcher" {
+		flags.StringVar(&path, "path", "", "directory or file to watch")
+		flags.Var(&match, "match", "glob the changed path must match (repeatable)")
+		flags.Var(&ignore, "ignore", "glob to skip (repeatable)")
+		fields = []addField{
+			{key: "name", prompt: "name", value: name, required: true},
+			{key: "path", prompt: "path to watch", value: &path, required: true},
+			{key: "command", prompt: "command to run on change", value: command, required: true},
+		}
+	} else {
+		flags.StringVar(&cwd, "cwd", "", "working directory")
+		flags.Var(&dependsOn, "depends-on", "server that must be ready first (repeatable)")
+		fields = []addField{
+			{key: "name", prompt: "name", value: name, required: true},
+			{key: "command", prompt: "command to run", value: command, required: true},
+			{key: "cwd", prompt: "working directory (optional)", value: &cwd},
+		}
+	}
+	paths, err := parseInterspersed(flags, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(paths) > 1 {
+		return fmt.Errorf("usage: ghost add %s [config] [flags]", kind)
+	}
+
+	var configPath string
+	if len(paths) == 1 {
+		configPath, err = resolvePath(paths[0])
+	} else {
+		configPath, err = determineConfigPath()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := promptMissing(fields, kind == "watcher" && len(match) == 0, &match); err != nil {
+		return err
+	}
+
+	block := &strings.Builder{}
+	fmt.Fprintf(block, "[[%ss]]\n", kind)
+	for _, field := range fields {
+		if *field.value != "" {
+			fmt.Fprintf(block, "%s = %s\n", field.key, tomlString(*field.value))
+		}
+	}
+	writeTOMLList(block, "match", match)
+	writeTOMLList(block, "ignore", ignore)
+	writeTOMLList(block, "depends_on", dependsOn)
+
+	if err := appendConfigBlock(configPath, kind, *name, block.String()); err != nil {
+		return err
+	}
+	fmt.Printf("added %s %q to %s\n", kind, *name, configPath)
+	return nil
+}
+
+func promptMissing(fields []addField, askMatch bool, match *stringList) error {
+	interactive := stdinIsTerminal()
+	reader := bufio.NewReader(os.Stdin)
+	for _, field := range fields {
+		if *field.value != "" {
+			continue
+		}
+		if !interactive {
+			if field.required {
+				return fmt.Errorf("-%s is required", field.key)
+			}
+			continue
+		}
+		for {
+			answer, ok := promptLine(reader, field.prompt)
+			if answer != "" || !field.required {
+				*field.value = answer
+				break
+			}
+			if !ok {
+				return fmt.Errorf("-%s is required", field.key)
+			}
+		}
+	}
+	if askMatch && interactive {
+		answer, _ := promptLine(reader, "match globs, space separated (optional)")
+		*match = append(*match, strings.Fields(answer)...)
+	}
+	return nil
+}
+
+func promptLine(reader *bufio.Reader, prompt string) (string, bool) {
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+	return strings.TrimSpace(line), err == nil
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+func appendConfigBlock(configPath, kind, name, block string) error {
+	original, err := os.ReadFile(configPath)
+	mode := fs.FileMode(0o644)
+	switch {
+	case err == nil:
+		if info, err := os.Stat(configPath); err == nil {
+			mode = info.Mode().Perm()
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+			return fmt.Errorf("create config directory: %w", err)
+		}
+	default:
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	updated := string(original)
+	if updated != "" {
+		if !strings.HasSuffix(updated, "\n") {
+			updated += "\n"
+		}
+		updated += "\n"
+	}
+	updated += block
+
+	temp, err := os.CreateTemp(filepath.Dir(configPath), "."+filepath.Base(configPath)+".add-*")
+	if err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	tempPath := temp.Name()
+	defer os.Remove(tempPath)
+	if _, err := temp.WriteString(updated); err != nil {
+		temp.Close()
+		return fmt.Errorf("write config: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	if err := os.Chmod(tempPath, mode); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+
+	cfg, err := readConfig(tempPath)
+	if err != nil {
+		var errs configcheck.Errors
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				if e.File == tempPath {
+					e.File = configPath
+				}
+			}
+			err = errs
+		}
+		return fmt.Errorf("%s was left unchanged, the new %s would not load:\n%w", configPath, kind, err)
+	}
+	count := 0
+	if kind == "watcher" {
+		for _, watcher := range cfg.Watchers {
+			if watcher.Name == name {
+				count++
+			}
+		}
+	} else {
+		for _, server := range cfg.Servers {
+			if server.Name == name {
+				count++
+			}
+		}
+	}
+	if count > 1 {
+		return fmt.Errorf("%s was left unchanged: a %s named %q already exists", configPath, kind, name)
+	}
+
+	if err := os.Rename(tempPath, configPath); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return nil
+}
+
+func writeTOMLList(builder *strings.Builder, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = tomlString(value)
+	}
+	fmt.Fprintf(builder, "%s = [%s]\n", key, strings.Join(quoted, ", "))
+}
+
+var tomlEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+func tomlString(value string) string {
+	return `"` + tomlEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiTokenName = "api-token"
+
+type APIConfig struct {
+	Enabled bool
+	Listen  string
+	Token   string
+}
+
+func normalizeAPI(raw rawAPI) (APIConfig, error) {
+	listen := strings.TrimSpace(raw.Listen)
+	cfg := APIConfig{
+		Enabled: valueOrDefaultBool(raw.Enabled, listen != ""),
+		Listen:  listen,
+		Token:   strings.TrimSpace(raw.Token),
+	}
+	if !cfg.Enabled {
+		return APIConfig{}, nil
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = "127.0.0.1:7717"
+	}
+	if _, _, err := net.SplitHostPort(cfg.Listen); err != nil {
+		return APIConfig{}, fmt.Errorf("api.listen: %w", err)
+	}
+	return cfg, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type APIController struct {
+	mu      sync.Mutex
+	cfg     APIConfig
+	handler http.Handler
+	server  *http.Server
+	done    chan struct{}
+}
+
+func NewAPIController(handler http.Handler) *APIController {
+	return &APIController{handler: handler}
+}
+
+func (c *APIController) Apply(cfg APIConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !cfg.Enabled {
+		if c.cfg.Enabled {
+			c.stopLocked()
+			logInfo("api disabled")
+		}
+		c.cfg = APIConfig{}
+		return nil
+	}
+
+	if c.cfg == cfg && c.server != nil {
+		return nil
+	}
+
+	c.stopLocked()
+	if err := c.startLocked(cfg); err != nil {
+		c.cfg = APIConfig{}
+		return err
+	}
+	c.cfg = cfg
+	return nil
+}
+
+func (c *APIController) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopLocked()
+	c.cfg = APIConfig{}
+}
+
+func (c *APIController) startLocked(cfg APIConfig) error {
+	token := cfg.Token
+	if token == "" {
+		var err error
+		if token, err = loadAPIToken(); err != nil {
+			return fmt.Errorf("api: token: %w", err)
+		}
+	}
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("api: listen on %s: %w", cfg.Listen, err)
+	}
+	server := &http.Server{
+		Handler:           requireToken(token, requireAPIRequest(cfg.Listen, c.handler)),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logError("api stopped: %v", err)
+		}
+	}()
+	c.server = server
+	c.done = done
+	logInfo("api listening on http://%s", listener.Addr())
+	return nil
+}
+
+func (c *APIController) stopLocked() {
+	if c.server == nil {
+		return
+	}
+	_ = c.server.Close()
+	<-c.done
+	c.server = nil
+	c.done = nil
+}
+
+// apiHandler is the part of the control API served over TCP: listing jobs,
+// triggering watchers, restarting servers and reloading the config.
+// Everything else (at jobs, attach, profiles, snapshots, config diffs) stays
+// on the control socket, which only ghost's own user can reach.
+func (d *GhostDaemon) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/servers", d.handleListServers)
+	mux.HandleFunc("GET /v1/watchers", d.handleListWatchers)
+	mux.HandleFunc("GET /v1/schedules", d.handleListSchedules)
+	mux.HandleFunc("POST /v1/watchers/{name}/trigger", d.handleTriggerWatcher)
+	mux.HandleFunc("POST /v1/servers/{name}/restart", d.handleRestartServer)
+	mux.HandleFunc("POST /v1/reload", d.handleReload)
+	return mux
+}
+
+// loadAPIToken reads <state dir>/api-token, creating it with a random token
+// first, for an [api] table without a token of its own.
+func loadAPIToken() (string, error) {
+	state := currentStateConfig()
+	path := filepath.Join(state.Dir, apiTokenName)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if err := os.MkdirAll(state.Dir, state.Permissions.DirMode); err != nil {
+		return "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(secret)
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	logInfo("generated api token in %s", path)
+	return token, nil
+}
+
+// requireAPIRequest turns away requests a web page could make: bodies that
+// aren't JSON (a form or text/plain POST skips the CORS preflight) and Host
+// headers other than the listen address, which is what DNS rebinding sends.
+func requireAPIRequest(listen string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !apiHostAllowed(listen, r.Host) {
+			writeControlError(w, http.StatusMisdirectedRequest, "host %q is not %s", r.Host, listen)
+			return
+		}
+		if r.ContentLength != 0 {
+			if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+				writeControlError(w, http.StatusUnsupportedMediaType, "request body must be application/json")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiHostAllowed accepts the listen address itself, localhost for a
+// loopback listener, and any IP address on the port for a wildcard one, since
+// a rebound DNS name never arrives as an IP literal.
+func apiHostAllowed(listen, host string) bool {
+	if strings.EqualFold(host, listen) {
+		return true
+	}
+	listenHost, listenPort, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	name, port, err := net.SplitHostPort(host)
+	if err != nil || port != listenPort {
+		return false
+	}
+	if ip := net.ParseIP(listenHost); listenHost == "" || (ip != nil && ip.IsUnspecified()) {
+		return net.ParseIP(name) != nil
+	}
+	return strings.EqualFold(name, "localhost") && isLoopbackHost(listenHost)
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	expected := []byte(token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := r.Header.Get("X-Ghost-Token")
+		if auth := r.Header.Get("Authorization"); provided == "" && strings.HasPrefix(auth, "Bearer ") {
+			provided = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ghost"`)
+			writeControlError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
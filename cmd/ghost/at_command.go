@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const atUsage = "usage: ghost at [-cwd dir] <time> [--] <command...> | ghost at -cancel <id> | ghost at"
+
+var (
+	atDateLayouts  = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+	atClockLayouts = []string{"15:04", "15:04:05", "3pm", "3:04pm", "3 pm", "3:04 pm"}
+)
+
+type atList []atInfo
+
+func runAtCommand(args []string) error {
+	fs := flag.NewFlagSet("at", flag.ContinueOnError)
+	cwd := fs.String("cwd", "", "directory to run the command in (default: the current directory)")
+	cancel := fs.String("cancel", "", "cancel the pending job with this id")
+	formatValue := formatFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	rest := fs.Args()
+
+	if *cancel != "" {
+		if len(rest) > 0 {
+			return errors.New(atUsage)
+		}
+		var info atInfo
+		if err := controlRequest("DELETE", "/v1/at/"+url.PathEscape(*cancel), nil, &info); err != nil {
+			return err
+		}
+		fmt.Printf("cancelled job %s: %s\n", info.ID, info.Command)
+		return nil
+	}
+
+	if len(rest) == 0 {
+		format, err := parseOutputFormat(*formatValue)
+		if err != nil {
+			return err
+		}
+		var list atList
+		if err := controlRequest("GET", "/v1/at", nil, &list); err != nil {
+			return err
+		}
+		if len(list) == 0 && format == formatTable {
+			fmt.Println("no one-shot jobs")
+			return nil
+		}
+		return writeOutput(os.Stdout, format, list, list.table)
+	}
+
+	now := time.Now()
+	at, err := parseAtTime(rest[0], now)
+	if err != nil {
+		return err
+	}
+	command := rest[1:]
+	if len(command) > 0 && command[0] == "--" {
+		command = command[1:]
+	}
+	if len(command) == 0 {
+		return errors.New(atUsage)
+	}
+
+	job := atRequest{At: at, Command: command, Cwd: *cwd}
+	if len(command) == 1 && strings.ContainsAny(command[0], " \t\n|&;<>()$`*?") {
+		job.Command, job.Shell = nil, command[0]
+	}
+	if job.Cwd == "" {
+		if job.Cwd, err = os.Getwd(); err != nil {
+			return err
+		}
+	} else if job.Cwd, err = resolvePath(job.Cwd); err != nil {
+		return err
+	}
+	if info, err := os.Stat(job.Cwd); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", job.Cwd)
+	}
+
+	var info atInfo
+	if err := controlRequest("POST", "/v1/at", job, &info); err != nil {
+		return err
+	}
+	fmt.Printf("job %s at %s (in %s): %s\n", info.ID, info.At.Local().Format(time.DateTime), formatAtDelay(info.At.Sub(now)), info.Command)
+	return nil
+}
+
+func parseAtTime(value string, now time.Time) (time.Time, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case value == "now":
+		return now, nil
+	case strings.HasPrefix(value, "+") || strings.HasPrefix(value, "in "):
+		delay, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(value, "+"), "in ")))
+		if err != nil || delay < 0 {
+			return time.Time{}, fmt.Errorf("invalid delay %q (use e.g. +10m or \"in 2h\")", value)
+		}
+		return now.Add(delay), nil
+	}
+
+	for _, layout := range atDateLayouts {
+		if at, err := time.ParseInLocation(layout, strings.ToUpper(value), now.Location()); err == nil {
+			if !at.After(now) {
+				return time.Time{}, fmt.Errorf("%s is in the past", at.Format(time.DateTime))
+			}
+			return at, nil
+		}
+	}
+
+	clock, tomorrow := strings.CutPrefix(value, "tomorrow ")
+	for _, layout := range atClockLayouts {
+		parsed, err := time.Parse(layout, strings.TrimSpace(clock))
+		if err != nil {
+			continue
+		}
+		at := time.Date(now.Year(), now.Month(), now.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, now.Location())
+		if tomorrow || !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use 17:30, 5pm, \"tomorrow 9:00\", 2006-01-02 15:04 or +10m)", value)
+}
+
+func formatAtDelay(delay time.Duration) string {
+	if delay < time.Minute {
+		return delay.Round(time.Second).String()
+	}
+	text := delay.Round(time.Minute).String()
+	return strings.TrimSuffix(text, "0s")
+}
+
+func (l atList) table() outputTable {
+	table := outputTable{header: []string{"ID", "AT", "STATE", "PID", "CWD", "COMMAND"}}
+	for _, info := range l {
+		table.rows = append(table.rows, []string{info.ID, info.At.Local().Format(time.DateTime), info.State, formatPID(info.PID), info.Cwd, info.Command})
+	}
+	return table
+}
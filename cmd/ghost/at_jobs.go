@@ -0,0 +1,406 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	atStoreVersion  = 1
+	atStoreFileName = "at.json"
+)
+
+type atJob struct {
+	ID        string    `json:"id"`
+	At        time.Time `json:"at"`
+	Command   []string  `json:"command"`
+	Display   string    `json:"display"`
+	Cwd       string    `json:"cwd"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// atRequest is the body of POST /v1/at. A shell command line goes in Shell
+// and runs through a login shell; otherwise Command is run as-is. What logs
+// and the audit show is derived from these, never sent by the client.
+type atRequest struct {
+	At      time.Time `json:"at"`
+	Command []string  `json:"command,omitempty"`
+	Shell   string    `json:"shell,omitempty"`
+	Cwd     string    `json:"cwd"`
+}
+
+type atStore struct {
+	Version int     `json:"version"`
+	NextID  int     `json:"next_id"`
+	Jobs    []atJob `json:"jobs"`
+}
+
+type atInfo struct {
+	ID      string    `json:"id"`
+	At      time.Time `json:"at"`
+	Command string    `json:"command"`
+	Cwd     string    `json:"cwd"`
+	State   string    `json:"state"`
+	PID     int       `json:"pid,omitempty"`
+}
+
+type AtScheduler struct {
+	mu      sync.Mutex
+	loaded  bool
+	closed  bool
+	nextID  int
+	jobs    []atJob
+	running map[string]*atRun
+	timer   *time.Timer
+	wg      sync.WaitGroup
+}
+
+type atRun struct {
+	job atJob
+	cmd *exec.Cmd
+}
+
+func atLog(id string) logger {
+	return logger{prefix: "ghost:at " + id, fields: logFields{Component: "at", Job: id}}
+}
+
+func (s *AtScheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	s.running = make(map[string]*atRun)
+
+	err := withStateDB(func(db *sql.DB) error {
+		var err error
+		s.nextID, s.jobs, err = loadAtJobs(db)
+		return err
+	})
+	if err != nil {
+		logWarn("ignoring one-shot jobs: %v", err)
+	}
+	if len(s.jobs) > 0 {
+		logInfo("loaded %d one-shot job(s)", len(s.jobs))
+	}
+	s.scheduleLocked()
+}
+
+func (s *AtScheduler) Add(req atRequest) (atJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded || s.closed {
+		return atJob{}, errors.New("one-shot jobs are not available")
+	}
+	job := atJob{At: req.At, Command: req.Command, Display: joinDisplayParts(req.Command), Cwd: req.Cwd}
+	switch {
+	case req.Shell != "" && len(req.Command) > 0:
+		return atJob{}, errors.New("command and shell are mutually exclusive")
+	case req.Shell != "":
+		job.Command = shellProfile{Mode: "login"}.command(req.Shell)
+		job.Display = req.Shell
+	case len(job.Command) == 0:
+		return atJob{}, errors.New("command must not be empty")
+	}
+	if job.At.IsZero() {
+		return atJob{}, errors.New("time is required")
+	}
+	if job.Cwd == "" {
+		job.Cwd = "."
+	}
+	s.nextID++
+	job.ID = strconv.Itoa(s.nextID)
+	job.CreatedAt = time.Now().UTC()
+	jobs := append(append([]atJob(nil), s.jobs...), job)
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].At.Before(jobs[j].At) })
+	if err := s.saveLocked(jobs); err != nil {
+		return atJob{}, err
+	}
+	s.jobs = jobs
+	atLog(job.ID).Info("scheduled %s at %s", job.Display, job.At.Local().Format(time.DateTime))
+	s.scheduleLocked()
+	return job, nil
+}
+
+func (s *AtScheduler) Cancel(id string) (atJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, job := range s.jobs {
+		if job.ID != id {
+			continue
+		}
+		jobs := append(s.jobs[:i:i], s.jobs[i+1:]...)
+		if err := s.saveLocked(jobs); err != nil {
+			return atJob{}, err
+		}
+		s.jobs = jobs
+		atLog(id).Info("cancelled %s", job.Display)
+		s.scheduleLocked()
+		return job, nil
+	}
+	if _, ok := s.running[id]; ok {
+		return atJob{}, fmt.Errorf("one-shot job %s is already running", id)
+	}
+	return atJob{}, fmt.Errorf("unknown one-shot job %q", id)
+}
+
+func (s *AtScheduler) Infos() []atInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]atInfo, 0, len(s.running)+len(s.jobs))
+	for _, run := range s.running {
+		info := run.job.info("running")
+		if run.cmd.Process != nil {
+			info.PID = run.cmd.Process.Pid
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].At.Before(infos[j].At) })
+	for _, job := range s.jobs {
+		infos = append(infos, job.info("pending"))
+	}
+	return infos
+}
+
+func (j atJob) info(state string) atInfo {
+	return atInfo{ID: j.ID, At: j.At, Command: j.Display, Cwd: j.Cwd, State: state}
+}
+
+func (s *AtScheduler) scheduleLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.closed || len(s.jobs) == 0 {
+		return
+	}
+	wait := time.Until(s.jobs[0].At)
+	if wait > scheduleRecheckInterval {
+		wait = scheduleRecheckInterval
+	}
+	s.timer = time.AfterFunc(wait, s.fireDue)
+}
+
+func (s *AtScheduler) fireDue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	now := time.Now()
+	var due []atJob
+	for len(s.jobs) > 0 && !s.jobs[0].At.After(now) {
+		due = append(due, s.jobs[0])
+		s.jobs = s.jobs[1:]
+	}
+	if len(due) > 0 {
+		if err := s.saveLocked(s.jobs); err != nil {
+			logError("failed to save one-shot jobs: %v", err)
+		}
+	}
+	for _, job := range due {
+		s.startLocked(job, now)
+	}
+	s.scheduleLocked()
+}
+
+func (s *AtScheduler) startLocked(job atJob, now time.Time) {
+	log := atLog(job.ID)
+	cause := "at " + job.At.Local().Format(time.DateTime)
+	if late := now.Sub(job.At); late > time.Minute {
+		cause += fmt.Sprintf(", %s late", late.Round(time.Second))
+	}
+	log.withTrigger(cause).Info("starting %s — %s", job.Display, cause)
+
+	cmd := exec.Command(job.Command[0], job.Command[1:]...)
+	cmd.Dir = job.Cwd
+	env := map[string]string{"GHOST_AT_ID": job.ID}
+	secrets := newSecretSet(env)
+	forward := newOutputForwarder("at:"+job.ID, secrets)
+	cmd.Stdout, cmd.Stderr = forward.wrap(os.Stdout, os.Stderr)
+	cmd.Env = buildEnvList(env)
+	setProcessGroup(cmd)
+	startedAt := time.Now()
+	if err := cmd.Start(); err != nil {
+		log.Error("failed to start command: %v", err)
+		return
+	}
+	trackProcessGroup(cmd)
+	auditStart("at", job.ID, "", cmd, env, secrets, cause)
+
+	s.running[job.ID] = &atRun{job: job, cmd: cmd}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := cmd.Wait()
+		forward.Flush()
+		auditExit("at", job.ID, "", cmd, secrets, startedAt, err)
+		s.mu.Lock()
+		delete(s.running, job.ID)
+		s.mu.Unlock()
+
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			log.withPID(cmd.Process.Pid).Info("finished in %s", time.Since(startedAt).Round(time.Millisecond))
+		case errors.As(err, &exitErr):
+			log.withPID(cmd.Process.Pid).Error("process exited with code %d", exitErr.ExitCode())
+		default:
+			log.withPID(cmd.Process.Pid).Error("process exited: %v", err)
+		}
+	}()
+}
+
+func (s *AtScheduler) Stop() {
+	s.mu.Lock()
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	processes := s.processesLocked()
+	s.mu.Unlock()
+
+	for _, process := range processes {
+		if err := signalProcess(process, syscall.SIGTERM, true); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			logError("failed to stop one-shot job: %v", err)
+		}
+	}
+	if len(processes) == 0 {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(defaultKillTimeout):
+		s.kill()
+		<-done
+	}
+}
+
+func (s *AtScheduler) kill() {
+	s.mu.Lock()
+	processes := s.processesLocked()
+	s.mu.Unlock()
+	for _, process := range processes {
+		_ = signalProcess(process, syscall.SIGKILL, true)
+	}
+}
+
+func (s *AtScheduler) processesLocked() []*os.Process {
+	var processes []*os.Process
+	for _, run := range s.running {
+		processes = append(processes, run.cmd.Process)
+	}
+	return processes
+}
+
+func (s *AtScheduler) saveLocked(jobs []atJob) error {
+	err := withStateDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := saveAtJobs(tx, s.nextID, jobs); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return fmt.Errorf("save one-shot jobs: %w", err)
+	}
+	return nil
+}
+
+// saveAtJobs replaces the stored one-shot jobs with jobs and records the
+// last ID handed out, so IDs aren't reused after a restart.
+func saveAtJobs(tx *sql.Tx, nextID int, jobs []atJob) error {
+	if _, err := tx.Exec(`DELETE FROM at_jobs`); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		command, err := json.Marshal(job.Command)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO at_jobs (id, run_at, command, display, cwd, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			job.ID, job.At.UTC(), string(command), job.Display, job.Cwd, job.CreatedAt.UTC()); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`INSERT INTO state_meta (key, value) VALUES ('at_next_id', ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`, strconv.Itoa(nextID))
+	return err
+}
+
+func loadAtJobs(db *sql.DB) (int, []atJob, error) {
+	var nextID int
+	var value string
+	err := db.QueryRow(`SELECT value FROM state_meta WHERE key = 'at_next_id'`).Scan(&value)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return 0, nil, err
+	default:
+		nextID, _ = strconv.Atoi(value)
+	}
+
+	rows, err := db.Query(`SELECT id, run_at, command, display, cwd, created_at FROM at_jobs ORDER BY run_at, id`)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+	var jobs []atJob
+	for rows.Next() {
+		var job atJob
+		var command string
+		if err := rows.Scan(&job.ID, &job.At, &command, &job.Display, &job.Cwd, &job.CreatedAt); err != nil {
+			return 0, nil, err
+		}
+		if err := json.Unmarshal([]byte(command), &job.Command); err != nil || len(job.Command) == 0 {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return nextID, jobs, rows.Err()
+}
+
+// readAtStore reads the at.json file one-shot jobs were kept in before the
+// state database; it is only used to import them.
+func readAtStore(path string) (atStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return atStore{}, err
+	}
+	var store atStore
+	if err := json.Unmarshal(data, &store); err != nil {
+		return atStore{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if store.Version < 1 || store.Version > atStoreVersion {
+		return atStore{}, fmt.Errorf("%s: unsupported version %d", path, store.Version)
+	}
+	jobs := store.Jobs[:0]
+	for _, job := range store.Jobs {
+		if job.ID == "" || len(job.Command) == 0 || job.At.IsZero() {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	store.Jobs = jobs
+	sort.SliceStable(store.Jobs, func(i, j int) bool { return store.Jobs[i].At.Before(store.Jobs[j].At) })
+	return store, nil
+}
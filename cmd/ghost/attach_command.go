@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+const attachDetachKey = 0x1d
+
+func runAttachCommand(args []string) error {
+	fs := flag.NewFlagSet("attach", flag.ContinueOnError)
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errors.New("usage: ghost attach <server>")
+	}
+	name := rest[0]
+
+	restore, err := makeRawTerminal()
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	conn, err := openAttach(name)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fmt.Fprintf(os.Stderr, "attached to %s, press ctrl-] to detach\r\n", name)
+
+	var writeMu sync.Mutex
+	send := func(kind byte, payload []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return writeAttachFrame(conn, kind, payload)
+	}
+	sendSize := func() {
+		if size, err := pty.GetsizeFull(os.Stdin); err == nil {
+			payload := make([]byte, 4)
+			binary.BigEndian.PutUint16(payload[:2], size.Rows)
+			binary.BigEndian.PutUint16(payload[2:], size.Cols)
+			_ = send(attachFrameSize, payload)
+		}
+	}
+	sendSize()
+	stopResize := watchTerminalResize(sendSize)
+	defer stopResize()
+
+	output := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(os.Stdout, conn)
+		output <- err
+	}()
+	detached := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				data, _, detach := bytes.Cut(buf[:n], []byte{attachDetachKey})
+				if len(data) > 0 {
+					if err := send(attachFrameInput, data); err != nil {
+						detached <- err
+						return
+					}
+				}
+				if detach {
+					detached <- nil
+					return
+				}
+			}
+			if err != nil {
+				detached <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-detached:
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "\r\ndetached from %s\r\n", name)
+	case <-output:
+		fmt.Fprintf(os.Stderr, "\r\nconnection to %s closed\r\n", name)
+	}
+	return nil
+}
+
+func openAttach(name string) (io.ReadWriteCloser, error) {
+	req, err := http.NewRequest("GET", "http://ghost/v1/servers/"+url.PathEscape(name)+"/attach", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", attachProtocol)
+	resp, err := newControlClient().Do(req)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, fmt.Errorf("ghost daemon is not running (no control socket at %s)", controlSocketPath())
+		}
+		return nil, fmt.Errorf("reach ghost daemon: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		var apiErr controlError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && apiErr.Error != "" {
+			return nil, errors.New(apiErr.Error)
+		}
+		return nil, fmt.Errorf("daemon returned %s", resp.Status)
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, errors.New("daemon did not hand over the connection")
+	}
+	return conn, nil
+}
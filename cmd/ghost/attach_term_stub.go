@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func makeRawTerminal() (func(), error) {
+	return nil, errors.New("ghost attach is not supported on this platform")
+}
+
+func watchTerminalResize(func()) func() {
+	return func() {}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type auditEntry struct {
+	Time     time.Time         `json:"time"`
+	Event    string            `json:"event"`
+	Kind     string            `json:"kind"`
+	Job      string            `json:"job"`
+	RunID    string            `json:"run_id,omitempty"`
+	PID      int               `json:"pid,omitempty"`
+	Argv     []string          `json:"argv"`
+	Cwd      string            `json:"cwd"`
+	Env      map[string]string `json:"env,omitempty"`
+	Cause    string            `json:"cause,omitempty"`
+	ExitCode *int              `json:"exit_code,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Duration string            `json:"duration,omitempty"`
+}
+
+var auditLog = componentLogger("audit", "audit:")
+
+const (
+	// auditLogLimit is how many entries audit_log keeps; older ones are
+	// deleted as new ones arrive.
+	auditLogLimit = 20000
+	// auditQueueLimit bounds the entries waiting for a slow or locked
+	// database. Past it the oldest are dropped.
+	auditQueueLimit = 10000
+)
+
+type queuedAuditEntry struct {
+	entry auditEntry
+	data  string
+}
+
+// auditWriter saves entries from a goroutine of its own, in order, so a
+// slow state database never holds up a job that is starting or stopping
+// under its lock.
+type auditWriter struct {
+	mu      sync.Mutex
+	idle    sync.Cond
+	pending []queuedAuditEntry
+	dropped int
+	running bool
+}
+
+var auditQueue = newAuditWriter()
+
+func newAuditWriter() *auditWriter {
+	w := &auditWriter{}
+	w.idle.L = &w.mu
+	return w
+}
+
+func (w *auditWriter) store(entry queuedAuditEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) >= auditQueueLimit {
+		w.pending = w.pending[1:]
+		w.dropped++
+	}
+	w.pending = append(w.pending, entry)
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+func (w *auditWriter) run() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.pending) > 0 {
+		batch, dropped := w.pending, w.dropped
+		w.pending, w.dropped = nil, 0
+		w.mu.Unlock()
+		if dropped > 0 {
+			auditLog.Error("dropped %d entries while the state database was unavailable", dropped)
+		}
+		if err := saveAuditEntries(batch); err != nil {
+			auditLog.Error("write %d entries: %v", len(batch), err)
+		}
+		w.mu.Lock()
+	}
+	w.running = false
+	w.idle.Broadcast()
+}
+
+// flush waits for every queued entry to be written.
+func (w *auditWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.running {
+		w.idle.Wait()
+	}
+}
+
+// writeAuditEntry queues entry for the audit log and returns right away.
+func writeAuditEntry(entry auditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		auditLog.Error("encode entry: %v", err)
+		return
+	}
+	auditQueue.store(queuedAuditEntry{entry: entry, data: string(data)})
+}
+
+// flushAuditLog waits until every queued entry is saved, for shutdown.
+func flushAuditLog() {
+	auditQueue.flush()
+}
+
+// saveAuditEntries writes batch in one transaction and trims audit_log to
+// auditLogLimit entries.
+func saveAuditEntries(batch []queuedAuditEntry) error {
+	return withStateDB(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for _, queued := range batch {
+			if err := insertAuditEntry(tx, queued.entry, queued.data); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM audit_log WHERE id <= (SELECT MAX(id) FROM audit_log) - ?`, auditLogLimit); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// insertAuditEntry stores entry along with its JSON encoding, which is what
+// ghost audit -json prints.
+func insertAuditEntry(db sqlExecer, entry auditEntry, data string) error {
+	_, err := db.Exec(`INSERT INTO audit_log (logged_at, event, kind, job, run_id, entry) VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.Time.UTC(), entry.Event, entry.Kind, entry.Job, nullIfEmpty(entry.RunID), data)
+	return err
+}
+
+func auditStart(kind, job, runID string, cmd *exec.Cmd, overrides map[string]string, secrets secretSet, cause string) {
+	entry := auditEntry{
+		Event: "start",
+		Kind:  kind,
+		Job:   job,
+		RunID: runID,
+		Argv:  secrets.redactArgs(cmd.Args),
+		Cwd:   cmd.Dir,
+		Env:   secrets.redactEnv(envDiff(overrides)),
+		Cause: cause,
+	}
+	if cmd.Process != nil {
+		entry.PID = cmd.Process.Pid
+	}
+	writeAuditEntry(entry)
+}
+
+func auditExit(kind, job, runID string, cmd *exec.Cmd, secrets secretSet, startedAt time.Time, waitErr error) {
+	entry := auditEntry{
+		Event:    "exit",
+		Kind:     kind,
+		Job:      job,
+		RunID:    runID,
+		Argv:     secrets.redactArgs(cmd.Args),
+		Cwd:      cmd.Dir,
+		Duration: time.Since(startedAt).Round(time.Millisecond).String(),
+	}
+	if cmd.Process != nil {
+		entry.PID = cmd.Process.Pid
+	}
+	code := 0
+	var timeout *runTimeoutError
+	if errors.As(waitErr, &timeout) {
+		entry.Error = timeout.Error()
+	}
+	if waitErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(waitErr, &exitErr) {
+			code = exitErr.ExitCode()
+		} else {
+			code = -1
+			entry.Error = waitErr.Error()
+		}
+	}
+	entry.ExitCode = &code
+	writeAuditEntry(entry)
+}
+
+func envDiff(overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return nil
+	}
+	diff := make(map[string]string, len(overrides))
+	for key, value := range overrides {
+		if current, ok := os.LookupEnv(key); ok && current == value {
+			continue
+		}
+		diff[key] = value
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return diff
+}
+
+func runAuditCommand(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	limit := fs.Int("n", 50, "show the last N entries (0 for all)")
+	job := fs.String("job", "", "only show entries for this job name")
+	run := fs.String("run", "", "only show entries for this run ID")
+	raw := fs.Bool("json", false, "print raw JSON lines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := `SELECT entry FROM audit_log WHERE 1 = 1`
+	var params []any
+	if *job != "" {
+		query += ` AND job = ?`
+		params = append(params, *job)
+	}
+	if *run != "" {
+		query += ` AND (run_id = ? OR run_id LIKE ?)`
+		params = append(params, *run, *run+"-%")
+	}
+	query += ` ORDER BY id DESC`
+	if *limit > 0 {
+		query += ` LIMIT ?`
+		params = append(params, *limit)
+	}
+
+	var lines []string
+	err := readStateDB(func(db *sql.DB) error {
+		rows, err := db.Query(query, params...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				return err
+			}
+			lines = append(lines, line)
+		}
+		return rows.Err()
+	})
+	if errors.Is(err, os.ErrNotExist) || missingTable(err) {
+		fmt.Println("no audit entries recorded yet")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read audit log: %w", err)
+	}
+	slices.Reverse(lines)
+
+	if *raw {
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		return nil
+	}
+
+	for _, line := range lines {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		fmt.Println(formatAuditEntry(entry))
+	}
+	return nil
+}
+
+func formatAuditEntry(entry auditEntry) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s %-5s %s:%s", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Event, entry.Kind, entry.Job)
+	if entry.RunID != "" {
+		fmt.Fprintf(&builder, " run=%s", entry.RunID)
+	}
+	if entry.PID != 0 {
+		fmt.Fprintf(&builder, " pid=%d", entry.PID)
+	}
+	switch entry.Event {
+	case "exit":
+		if entry.ExitCode != nil {
+			fmt.Fprintf(&builder, " code=%d", *entry.ExitCode)
+		}
+		if entry.Duration != "" {
+			fmt.Fprintf(&builder, " after %s", entry.Duration)
+		}
+		if entry.Error != "" {
+			fmt.Fprintf(&builder, " (%s)", entry.Error)
+		}
+	default:
+		fmt.Fprintf(&builder, " %s", joinDisplayParts(entry.Argv))
+		if entry.Cwd != "" {
+			fmt.Fprintf(&builder, " in %s", entry.Cwd)
+		}
+		if entry.Cause != "" {
+			fmt.Fprintf(&builder, " — %s", entry.Cause)
+		}
+		if len(entry.Env) > 0 {
+			keys := make([]string, 0, len(entry.Env))
+			for key := range entry.Env {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			fmt.Fprintf(&builder, " env=%s", strings.Join(keys, ","))
+		}
+	}
+	return builder.String()
+}
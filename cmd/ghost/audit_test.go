@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+func TestAuditLogIsWrittenInOrderAndTrimmed(t *testing.T) {
+	useTestState(t)
+	for i := range auditLogLimit + 5 {
+		writeAuditEntry(auditEntry{Event: "start", Kind: "watcher", Job: fmt.Sprintf("job-%d", i)})
+		if i%1000 == 0 {
+			flushAuditLog() // stay under auditQueueLimit
+		}
+	}
+	flushAuditLog()
+
+	var (
+		count       int
+		first, last string
+	)
+	err := withStateDB(func(db *sql.DB) error {
+		return db.QueryRow(`SELECT COUNT(*),
+			(SELECT job FROM audit_log ORDER BY id LIMIT 1),
+			(SELECT job FROM audit_log ORDER BY id DESC LIMIT 1) FROM audit_log`).Scan(&count, &first, &last)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != auditLogLimit || first != "job-5" || last != fmt.Sprintf("job-%d", auditLogLimit+4) {
+		t.Fatalf("audit_log has %d entries from %s to %s, want %d from job-5 to job-%d", count, first, last, auditLogLimit, auditLogLimit+4)
+	}
+}
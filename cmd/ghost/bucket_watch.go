@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type s3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+func parseBucketWatch(value string) (*RemoteWatch, error) {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid URL: %w", value, err)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("%q has no bucket", value)
+	}
+	remote := &RemoteWatch{Kind: "s3", Bucket: parsed.Host, Prefix: strings.Trim(parsed.Path, "/")}
+	if parsed.Scheme == "gs" {
+		remote.Kind = "gcs"
+	}
+	return remote, nil
+}
+
+func (r *RemoteWatch) bucketURL() string {
+	scheme := "s3"
+	if r.Kind == "gcs" {
+		scheme = "gs"
+	}
+	base := scheme + "://" + r.Bucket + "/"
+	if r.Prefix != "" {
+		base += r.Prefix + "/"
+	}
+	return base
+}
+
+func (r *RemoteWatch) bucketListCommand() (string, []string) {
+	if r.Kind == "gcs" {
+		return "gcloud", []string{"storage", "ls", "-l", r.bucketURL() + "**"}
+	}
+	args := []string{"s3api", "list-objects-v2", "--bucket", r.Bucket, "--output", "json",
+		"--query", "Contents[].{Key: Key, Size: Size, LastModified: LastModified}"}
+	if r.Prefix != "" {
+		args = append(args, "--prefix", r.Prefix+"/")
+	}
+	return "aws", args
+}
+
+func parseS3Listing(listing []byte, prefix string, add func(rel string, size int64, modTime time.Time)) error {
+	var objects []s3Object
+	if err := json.Unmarshal(listing, &objects); err != nil {
+		return fmt.Errorf("decode aws output: %w", err)
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	for _, object := range objects {
+		rel, ok := strings.CutPrefix(object.Key, prefix)
+		if !ok || rel == "" || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		add(rel, object.Size, object.LastModified)
+	}
+	return nil
+}
+
+func parseGCSListing(listing []byte, base string, add func(rel string, size int64, modTime time.Time)) error {
+	for _, line := range strings.Split(string(listing), "\n") {
+		sizeField, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+		dateField, name, _ := strings.Cut(strings.TrimLeft(rest, " "), " ")
+		rel, ok := strings.CutPrefix(strings.TrimLeft(name, " "), base)
+		if !ok || rel == "" || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		size, err := strconv.ParseInt(sizeField, 10, 64)
+		if err != nil {
+			continue
+		}
+		modTime, err := time.Parse(time.RFC3339, dateField)
+		if err != nil {
+			continue
+		}
+		add(rel, size, modTime)
+	}
+	return nil
+}
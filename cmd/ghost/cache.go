@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func (w NormalizedWatcher) inputHash() (string, error) {
+	var files []Trigger
+	for _, root := range w.Roots {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				return nil
+			}
+			if path == root {
+				return nil
+			}
+			rel, ok := relativeWatchPath(root, path)
+			if !ok {
+				return nil
+			}
+			if entry.IsDir() {
+				if w.ignored(rel) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.Type().IsRegular() && w.matches(rel) {
+				files = append(files, Trigger{Path: rel, Root: w.triggerRoot(root)})
+			}
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("scan inputs: %w", err)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Root != files[j].Root {
+			return files[i].Root < files[j].Root
+		}
+		return files[i].Path < files[j].Path
+	})
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%q\x00", w.Command)
+	for _, input := range files {
+		rel := input.displayPath()
+		file, err := os.Open(input.absPath(w.WatchRoot))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return "", fmt.Errorf("hash %s: %w", rel, err)
+		}
+		fmt.Fprintf(hash, "%s\x00", rel)
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("hash %s: %w", rel, err)
+		}
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func cacheFilePath(name string) string {
+	base := sanitizeFilename(name)
+	if base == "" {
+		base = "watcher"
+	}
+	return filepath.Join(currentStateConfig().Dir, "cache", base+".sha256")
+}
+
+func loadCachedHash(name string) string {
+	data, err := os.ReadFile(cacheFilePath(name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func storeCachedHash(name, hash string) error {
+	path := cacheFilePath(name)
+	perms := currentStateConfig().Permissions
+	if err := os.MkdirAll(filepath.Dir(path), perms.DirMode); err != nil {
+		return fmt.Errorf("create cache directory: %w", err)
+	}
+	return os.WriteFile(path, []byte(hash+"\n"), perms.FileMode)
+}
+
+func (j *watchJob) dropUnchanged(triggers []Trigger) []Trigger {
+	if j.contentHashes == nil {
+		j.contentHashes = make(map[string]string)
+	}
+	kept := triggers[:0:0]
+	for _, trigger := range triggers {
+		path := trigger.absPath(j.cfg.WatchRoot)
+		if trigger.Path == "" || (trigger.Event != "change" && trigger.Event != "add") {
+			if trigger.Event == "unlink" || trigger.Event == "rename" {
+				delete(j.contentHashes, path)
+			}
+			kept = append(kept, trigger)
+			continue
+		}
+		hash, err := fileContentHash(path)
+		if err != nil {
+			kept = append(kept, trigger)
+			continue
+		}
+		if j.contentHashes[path] == hash {
+			j.log().Debug("ignoring %s %s: content unchanged", trigger.Event, trigger.displayPath())
+			continue
+		}
+		j.contentHashes[path] = hash
+		kept = append(kept, trigger)
+	}
+	return kept
+}
+
+func fileContentHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+type cliCommand struct {
+	name    string
+	summary string
+	run     func(args []string) error
+	hidden  bool
+}
+
+var cliCommands = []cliCommand{
+	{name: "add", summary: "append a watcher or server to the config (add watcher, add server)", run: runAddCommand},
+	{name: "at", summary: "run a command once at a given time (at 17:30 -- make deploy)", run: runAtCommand},
+	{name: "attach", summary: "connect your terminal to a server's pty (ctrl-] detaches)", run: runAttachCommand},
+	{name: "audit", summary: "show the log of commands spawned by ghost", run: runAuditCommand},
+	{name: "debug", summary: "inspect daemon internals (debug watches)", run: runDebugCommand},
+	{name: "diff", summary: "preview what reloading the config would start, stop or restart", run: runDiffCommand},
+	{name: "gc", summary: "delete or archive logs of removed jobs, old logs and stale state", run: runGCCommand},
+	{name: "init", summary: "write a commented starter config to the default path", run: runInitCommand},
+	{name: "install", summary: "run the daemon as a launchd agent or systemd user service (-start-at-login)", run: runInstallCommand},
+	{name: "list", summary: "list the jobs defined in the config", run: runListCommand},
+	{name: "logs", summary: "print (and follow with -f) server and watcher logs", run: runLogsCommand},
+	{name: "pause", summary: "pause watchers, servers and schedules by name, glob or label", run: runPauseCommand},
+	{name: "profile", summary: "show or switch the active profile (profile switch work, profile off)", run: runProfileCommand},
+	{name: "reload", summary: "reload the config now, without waiting for the file watcher", run: runReloadCommand},
+	{name: "reload-history", summary: "show past config reloads and what each one changed (-job name)", run: runReloadHistoryCommand},
+	{name: "report", summary: "time per app from the window tracker (today, week, -from/-to)", run: runReportCommand},
+	{name: "resize", summary: "set the terminal size of a server's pty (resize web 160x48)", run: runResizeCommand},
+	{name: "restart", summary: "restart servers by name, glob or label (-l project=api)", run: runRestartCommand},
+	{name: "resume", summary: "resume paused jobs by name, glob or label", run: runResumeCommand},
+	{name: "run", summary: "trigger a watcher now, as if a file changed", run: runRunCommand},
+	{name: "selftest", summary: "run the daemon against a throwaway config and check every subsystem", run: runSelftestCommand, hidden: true},
+	{name: "simulate", summary: "run a watcher's pipeline for a synthetic file event", run: runSimulateCommand},
+	{name: "snapshot", summary: "save or restore paused jobs (snapshot save, snapshot restore)", run: runSnapshotCommand},
+	{name: "status", summary: "show the state of every running job", run: runStatusCommand},
+	{name: "uninstall", summary: "stop and remove the service set up by ghost install", run: runUninstallCommand},
+	{name: "validate", summary: "check the config and report every error at once", run: runValidateCommand},
+	{name: "windows", summary: "summarize or pause window tracker activity (windows report|pause|resume)", run: runWindowsCommand},
+}
+
+func runCLI(args []string) int {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return 0
+	}
+	for _, command := range cliCommands {
+		if command.name != name {
+			continue
+		}
+		loadCLIState()
+		if err := command.run(args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			fmt.Fprintf(os.Stderr, "ghost %s: %v\n", name, err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "ghost: unknown command %q\n\n", name)
+	printUsage()
+	return 2
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: ghost [command] [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Without a command ghost runs the daemon; ghost --profile <name> runs only that profile's jobs.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, command := range cliCommands {
+		if command.hidden {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", command.name, command.summary)
+	}
+}
+
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if rest[0] == "--" {
+			return append(positional, rest[1:]...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var commandPlaceholderPattern = regexp.MustCompile(`\{(path|relpath|paths|event|group)\}`)
+
+func commandPlaceholders(command []string) (templated bool, perFile bool, grouped bool) {
+	for _, part := range command {
+		for _, match := range commandPlaceholderPattern.FindAllStringSubmatch(part, -1) {
+			templated = true
+			switch match[1] {
+			case "paths":
+			case "group":
+				grouped = true
+			default:
+				perFile = true
+			}
+		}
+	}
+	return templated, perFile, grouped
+}
+
+func splitPerFileTriggers(triggers []Trigger) ([]Trigger, []Trigger) {
+	if len(triggers) == 0 {
+		return triggers, nil
+	}
+	first := triggers[0]
+	var current, rest []Trigger
+	for _, trigger := range triggers {
+		if trigger.Path == first.Path && trigger.Root == first.Root {
+			current = append(current, trigger)
+		} else {
+			rest = append(rest, trigger)
+		}
+	}
+	return current, rest
+}
+
+func expandCommandTemplate(command []string, root string, quote bool, triggers []Trigger) []string {
+	var (
+		event   string
+		relPath string
+		absPath string
+		paths   []string
+		groups  []string
+		seen    = make(map[string]struct{}, len(triggers))
+	)
+	for _, trigger := range triggers {
+		if event == "" {
+			event = trigger.Event
+		}
+		if trigger.Group != "" && !containsString(groups, trigger.Group) {
+			groups = append(groups, trigger.Group)
+		}
+		if trigger.Path == "" {
+			continue
+		}
+		path := trigger.absPath(root)
+		if relPath == "" {
+			relPath, absPath = trigger.Path, path
+		}
+		if _, ok := seen[path]; ok {
+			continue
+		}
+		seen[path] = struct{}{}
+		paths = append(paths, path)
+	}
+
+	values := map[string][]string{
+		"{path}":    {absPath},
+		"{relpath}": {relPath},
+		"{event}":   {event},
+		"{paths}":   paths,
+		"{group}":   groups,
+	}
+
+	result := make([]string, 0, len(command)+len(paths))
+	for _, part := range command {
+		if quote {
+			result = append(result, expandShellPlaceholders(part, values))
+			continue
+		}
+		if expanded, ok := values[part]; ok {
+			for _, value := range expanded {
+				if value != "" {
+					result = append(result, value)
+				}
+			}
+			continue
+		}
+		result = append(result, commandPlaceholderPattern.ReplaceAllStringFunc(part, func(match string) string {
+			return strings.Join(values[match], " ")
+		}))
+	}
+	return result
+}
+
+// expandShellPlaceholders fills the placeholders of a shell script built
+// with buildShellCommand. A placeholder can sit inside one of its quoted
+// words, so each value is quoted for the spot it lands in: the surrounding
+// quotes are closed around it, and a file name can never run as code.
+func expandShellPlaceholders(script string, values map[string][]string) string {
+	matches := commandPlaceholderPattern.FindAllStringIndex(script, -1)
+	if len(matches) == 0 {
+		return script
+	}
+	var (
+		builder                 strings.Builder
+		single, double, escaped bool
+		last, next              int
+	)
+	for i := 0; i < len(script); i++ {
+		if next < len(matches) && i == matches[next][0] {
+			start, end := matches[next][0], matches[next][1]
+			builder.WriteString(script[last:start])
+			builder.WriteString(quotePlaceholder(values[script[start:end]], single, double))
+			i, last = end-1, end
+			next++
+			continue
+		}
+		switch c := script[i]; {
+		case escaped:
+			escaped = false
+		case single:
+			single = c != '\''
+		case c == '\\':
+			escaped = true
+		case double:
+			double = c != '"'
+		case c == '\'':
+			single = true
+		case c == '"':
+			double = true
+		}
+	}
+	builder.WriteString(script[last:])
+	return builder.String()
+}
+
+// quotePlaceholder is what replaces a placeholder in a shell script. Inside
+// quotes the values stay one word, as the quotes promised; a bare {paths}
+// becomes one word per file.
+func quotePlaceholder(values []string, single, double bool) string {
+	switch {
+	case single:
+		return "'" + shellQuote(strings.Join(values, " ")) + "'"
+	case double:
+		return `"` + shellQuote(strings.Join(values, " ")) + `"`
+	}
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = shellQuote(value)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// commandStdin returns the reader stdin = "paths" or "paths0" connects to a
+// run's command, or nil to leave stdin closed.
+func (w NormalizedWatcher) commandStdin(triggers []Trigger) io.Reader {
+	switch w.Stdin {
+	case "paths":
+		return bytes.NewReader(w.stdinPaths(triggers, '\n'))
+	case "paths0":
+		return bytes.NewReader(w.stdinPaths(triggers, 0))
+	}
+	return nil
+}
+
+// stdinPaths is what stdin = "paths" (or "paths0") feeds the command: each
+// changed file once, relative to the command's working directory when it is
+// inside it and absolute otherwise, each followed by sep.
+func (w NormalizedWatcher) stdinPaths(triggers []Trigger, sep byte) []byte {
+	var out bytes.Buffer
+	seen := make(map[string]struct{}, len(triggers))
+	for _, trigger := range triggers {
+		if trigger.Path == "" {
+			continue
+		}
+		path := trigger.absPath(w.WatchRoot)
+		if _, ok := seen[path]; ok {
+			continue
+		}
+		seen[path] = struct{}{}
+		if rel, err := filepath.Rel(w.Cwd, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			path = rel
+		}
+		out.WriteString(path)
+		out.WriteByte(sep)
+	}
+	return out.Bytes()
+}
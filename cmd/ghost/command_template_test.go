@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestShellCommandTemplateQuotesHostileFilenames(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	t.Setenv("SHELL", "/bin/sh")
+	root := t.TempDir()
+	shell, profile := true, "none"
+	cfg, err := normalizeWatcher(rawWatcher{
+		Name:         "w",
+		Path:         root,
+		Command:      `printf '<%s>' 'changed: {path}' {relpath} "{event} {paths}" {paths}`,
+		Shell:        &shell,
+		ShellProfile: profile,
+	}, 0, rawDefaults{}, StateConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostile := "$(touch pwned).txt"
+	spaced := "it's a file.txt"
+	triggers := []Trigger{{Event: "change", Path: hostile}, {Event: "change", Path: spaced}}
+	command := expandCommandTemplate(cfg.Command, cfg.WatchRoot, cfg.UseShell, triggers)
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = root
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %v\n%s", command, err, out)
+	}
+
+	hostilePath, spacedPath := filepath.Join(root, hostile), filepath.Join(root, spaced)
+	want := strings.Join([]string{
+		"<changed: " + hostilePath + ">",
+		"<" + hostile + ">",
+		"<change " + hostilePath + " " + spacedPath + ">",
+		"<" + hostilePath + ">",
+		"<" + spacedPath + ">",
+	}, "")
+	if string(out) != want {
+		t.Errorf("output\n%s\nwant\n%s", out, want)
+	}
+	if _, err := os.Stat(filepath.Join(root, "pwned")); err == nil {
+		t.Fatal("a file name was run as a command")
+	}
+}
+
+func TestExpandShellPlaceholders(t *testing.T) {
+	values := map[string][]string{
+		"{path}":  {"/w/a b.txt"},
+		"{paths}": {"/w/a b.txt", "/w/c"},
+		"{event}": {"change"},
+		"{group}": nil,
+	}
+	tests := map[string]string{
+		`echo {path}`:           `echo '/w/a b.txt'`,
+		`echo 'saw {path}!'`:    `echo 'saw ''/w/a b.txt''!'`,
+		`echo "x {event}"`:      `echo "x "change""`,
+		`echo 'it'\''s {path}'`: `echo 'it'\''s ''/w/a b.txt'''`,
+		`ls {paths}`:            `ls '/w/a b.txt' /w/c`,
+		`ls 'all: {paths}'`:     `ls 'all: ''/w/a b.txt /w/c'''`,
+		`echo {group}`:          `echo `,
+		`echo \'{path}`:         `echo \''/w/a b.txt'`,
+	}
+	for script, want := range tests {
+		if got := expandShellPlaceholders(script, values); got != want {
+			t.Errorf("expandShellPlaceholders(%q) = %q, want %q", script, got, want)
+		}
+	}
+}
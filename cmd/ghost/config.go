@@ -6,11 +6,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
+	"github.com/nikiv/ghost/pkg/configcheck"
+	"github.com/nikiv/ghost/pkg/windows"
 	toml "github.com/pelletier/go-toml/v2"
 )
 
@@ -18,8 +22,14 @@ const (
 	defaultDebounce     = 150 * time.Millisecond
 	defaultRestartDelay = 200 * time.Millisecond
 	defaultKillTimeout  = 5 * time.Second
+	defaultWarmup       = 500 * time.Millisecond
+	defaultMaxDebounce  = 2 * time.Second
+
+	defaultShutdownTimeout = 10 * time.Second
 )
 
+var defaultIgnorePatterns = []string{".git", "node_modules", "*.swp", "*.swo", "*~", ".DS_Store"}
+
 var allowedEvents = map[string]struct{}{
 	"add":       {},
 	"addDir":    {},
@@ -31,52 +41,165 @@ var allowedEvents = map[string]struct{}{
 }
 
 type rawConfig struct {
-	Defaults      rawDefaults      `toml:"defaults"`
-	Watchers      []rawWatcher     `toml:"watchers"`
-	Servers       []rawServer      `toml:"servers"`
-	Streaming     rawStreaming     `toml:"streaming"`
-	WindowTracker rawWindowTracker `toml:"window_tracker"`
+	StateDir            string                `toml:"state_dir"`
+	LogFormat           string                `toml:"log_format"`
+	LogLevel            string                `toml:"log_level"`
+	Include             []string              `toml:"include"`
+	ShutdownTimeoutMs   *int64                `toml:"shutdown_timeout_ms"`
+	HeartbeatIntervalMs *int64                `toml:"heartbeat_interval_ms"`
+	WatchdogTimeoutMs   *int64                `toml:"watchdog_timeout_ms"`
+	Profile             string                `toml:"profile"`
+	Profiles            map[string]rawProfile `toml:"profiles"`
+	Defaults            rawDefaults           `toml:"defaults"`
+	Watchers            []rawWatcher          `toml:"watchers"`
+	Servers             []rawServer           `toml:"servers"`
+	Schedules           []rawSchedule         `toml:"schedules"`
+	Templates           []map[string]any      `toml:"templates"`
+	WatcherSets         []rawWatcherSet       `toml:"watcher_sets"`
+	Streaming           rawStreaming          `toml:"streaming"`
+	WindowTracker       rawWindowTracker      `toml:"window_tracker"`
+	API                 rawAPI                `toml:"api"`
+	Logging             rawLogging            `toml:"logging"`
+	Webhooks            []rawWebhook          `toml:"webhooks"`
+	GC                  rawGC                 `toml:"gc"`
 }
 
 type rawDefaults struct {
-	DebounceMs     *int64   `toml:"debounce_ms"`
-	RestartDelayMs *int64   `toml:"restart_delay_ms"`
-	KillTimeoutMs  *int64   `toml:"kill_timeout_ms"`
-	Events         []string `toml:"events"`
+	DebounceMs       *int64   `toml:"debounce_ms"`
+	AdaptiveDebounce *bool    `toml:"adaptive_debounce"`
+	MaxDebounceMs    *int64   `toml:"max_debounce_ms"`
+	RestartDelayMs   *int64   `toml:"restart_delay_ms"`
+	KillTimeoutMs    *int64   `toml:"kill_timeout_ms"`
+	Events           []string `toml:"events"`
+	Ignore           any      `toml:"ignore"`
+	SecretEnv        []string `toml:"secret_env"`
+	Umask            any      `toml:"umask"`
+	ProcessGroup     *bool    `toml:"process_group"`
+	PrefixOutput     *bool    `toml:"prefix_output"`
+	Stdout           string   `toml:"stdout"`
+	ShellProfile     string   `toml:"shell_profile"`
+	PollFallback     *bool    `toml:"poll_fallback"`
+	Backend          string   `toml:"backend"`
+	WarmupMs         *int64   `toml:"warmup_ms"`
+	Gitignore        *bool    `toml:"respect_gitignore"`
+	FileMode         any      `toml:"file_mode"`
+	DirMode          any      `toml:"dir_mode"`
 }
 
 type rawWatcher struct {
-	Name           string            `toml:"name"`
-	Path           any               `toml:"path"`
-	Directory      any               `toml:"directory"`
-	Command        any               `toml:"command"`
-	Args           any               `toml:"args"`
-	Cwd            any               `toml:"cwd"`
-	Env            map[string]any    `toml:"env"`
-	Match          any               `toml:"match"`
-	Matches        any               `toml:"matches"`
-	Events         []string          `toml:"events"`
-	Restart        *bool             `toml:"restart"`
-	RunOnStart     *bool             `toml:"run_on_start"`
-	DebounceMs     *int64            `toml:"debounce_ms"`
-	RestartDelayMs *int64            `toml:"restart_delay_ms"`
-	KillTimeoutMs  *int64            `toml:"kill_timeout_ms"`
-	Shell          *bool             `toml:"shell"`
-	EnvOverrides   map[string]string `toml:"-"`
+	Name               string            `toml:"name"`
+	Template           string            `toml:"template"`
+	Params             map[string]any    `toml:"params"`
+	Path               any               `toml:"path"`
+	Command            any               `toml:"command"`
+	Args               any               `toml:"args"`
+	Commands           any               `toml:"commands"`
+	Parallel           *bool             `toml:"parallel"`
+	Cwd                any               `toml:"cwd"`
+	Env                map[string]any    `toml:"env"`
+	EnvFile            any               `toml:"env_file"`
+	Match              any               `toml:"match"`
+	Matches            any               `toml:"matches"`
+	Ignore             any               `toml:"ignore"`
+	Ignores            any               `toml:"ignores"`
+	DefaultIgnores     *bool             `toml:"default_ignores"`
+	CaseSensitive      *bool             `toml:"case_sensitive"`
+	Gitignore          *bool             `toml:"respect_gitignore"`
+	Events             []string          `toml:"events"`
+	Restart            *bool             `toml:"restart"`
+	Concurrency        *int64            `toml:"concurrency"`
+	Queue              string            `toml:"queue"`
+	RunOnStart         *bool             `toml:"run_on_start"`
+	CatchUp            *bool             `toml:"catch_up"`
+	DebounceMs         *int64            `toml:"debounce_ms"`
+	AdaptiveDebounce   *bool             `toml:"adaptive_debounce"`
+	MaxDebounceMs      *int64            `toml:"max_debounce_ms"`
+	RestartDelayMs     *int64            `toml:"restart_delay_ms"`
+	KillTimeoutMs      *int64            `toml:"kill_timeout_ms"`
+	TimeoutMs          *int64            `toml:"timeout_ms"`
+	Shell              *bool             `toml:"shell"`
+	ShellProfile       string            `toml:"shell_profile"`
+	Nice               *int64            `toml:"nice"`
+	IONice             string            `toml:"ionice"`
+	IONiceLevel        *int64            `toml:"ionice_level"`
+	Sandbox            any               `toml:"sandbox"`
+	SandboxProfile     string            `toml:"sandbox_profile"`
+	User               string            `toml:"user"`
+	Group              string            `toml:"group"`
+	SecretEnv          []string          `toml:"secret_env"`
+	Umask              any               `toml:"umask"`
+	ProcessGroup       *bool             `toml:"process_group"`
+	Cache              *bool             `toml:"cache"`
+	SkipUnchanged      *bool             `toml:"skip_unchanged"`
+	Groups             map[string]any    `toml:"groups"`
+	GroupDepth         *int64            `toml:"group_depth"`
+	Transform          any               `toml:"transform"`
+	OnSuccess          any               `toml:"on_success"`
+	OnFailure          any               `toml:"on_failure"`
+	TransformTimeoutMs *int64            `toml:"transform_timeout_ms"`
+	LogPath            any               `toml:"log_path"`
+	PrefixOutput       *bool             `toml:"prefix_output"`
+	Stdout             string            `toml:"stdout"`
+	Stdin              string            `toml:"stdin"`
+	Clear              any               `toml:"clear"`
+	KeepAwake          any               `toml:"keep_awake"`
+	PollFallback       *bool             `toml:"poll_fallback"`
+	Backend            string            `toml:"backend"`
+	Remote             string            `toml:"remote"`
+	PollIntervalMs     *int64            `toml:"poll_interval_ms"`
+	WarmupMs           *int64            `toml:"warmup_ms"`
+	Labels             map[string]any    `toml:"labels"`
+	EnvOverrides       map[string]string `toml:"-"`
+	origin             string
 }
 
 type rawServer struct {
-	Name           string         `toml:"name"`
-	Command        any            `toml:"command"`
-	Args           any            `toml:"args"`
-	Cwd            any            `toml:"cwd"`
-	Env            map[string]any `toml:"env"`
-	Restart        *bool          `toml:"restart"`
-	RestartDelayMs *int64         `toml:"restart_delay_ms"`
-	KillTimeoutMs  *int64         `toml:"kill_timeout_ms"`
-	Shell          *bool          `toml:"shell"`
-	LogPath        any            `toml:"log_path"`
-	Pty            *bool          `toml:"pty"`
+	Name           string          `toml:"name"`
+	Template       string          `toml:"template"`
+	Params         map[string]any  `toml:"params"`
+	Command        any             `toml:"command"`
+	Args           any             `toml:"args"`
+	Cwd            any             `toml:"cwd"`
+	Env            map[string]any  `toml:"env"`
+	EnvFile        any             `toml:"env_file"`
+	OnSuccess      any             `toml:"on_success"`
+	OnFailure      any             `toml:"on_failure"`
+	Restart        *bool           `toml:"restart"`
+	RestartDelayMs *int64          `toml:"restart_delay_ms"`
+	KillTimeoutMs  *int64          `toml:"kill_timeout_ms"`
+	Shell          *bool           `toml:"shell"`
+	ShellProfile   string          `toml:"shell_profile"`
+	LogPath        any             `toml:"log_path"`
+	LogBufferKB    *int64          `toml:"log_buffer_kb"`
+	Pty            *bool           `toml:"pty"`
+	Standby        *bool           `toml:"standby"`
+	KeepAwake      any             `toml:"keep_awake"`
+	PtyRows        *int64          `toml:"pty_rows"`
+	PtyCols        *int64          `toml:"pty_cols"`
+	Record         string          `toml:"record"`
+	RecordDir      any             `toml:"record_dir"`
+	RecordKeep     *int64          `toml:"record_keep"`
+	Nice           *int64          `toml:"nice"`
+	IONice         string          `toml:"ionice"`
+	IONiceLevel    *int64          `toml:"ionice_level"`
+	MaxMemoryMB    *int64          `toml:"max_memory_mb"`
+	CPULimit       *int64          `toml:"cpu_limit"`
+	LimitAction    string          `toml:"limit_action"`
+	SecretEnv      []string        `toml:"secret_env"`
+	Umask          any             `toml:"umask"`
+	Sandbox        any             `toml:"sandbox"`
+	SandboxProfile string          `toml:"sandbox_profile"`
+	User           string          `toml:"user"`
+	Group          string          `toml:"group"`
+	ProcessGroup   *bool           `toml:"process_group"`
+	PrefixOutput   *bool           `toml:"prefix_output"`
+	Stdout         string          `toml:"stdout"`
+	HealthCheck    *rawHealthCheck `toml:"health_check"`
+	Watch          *rawServerWatch `toml:"watch"`
+	Sinks          []rawSink       `toml:"sinks"`
+	DependsOn      any             `toml:"depends_on"`
+	ReadyPattern   string          `toml:"ready_pattern"`
+	Labels         map[string]any  `toml:"labels"`
 }
 
 type rawWindowTracker struct {
@@ -84,25 +207,62 @@ type rawWindowTracker struct {
 	Applications   any    `toml:"applications"`
 	PollIntervalMs *int64 `toml:"poll_interval_ms"`
 	DBPath         string `toml:"db_path"`
+	TrackFocus     *bool  `toml:"track_focus"`
+	MinFocusMs     *int64 `toml:"min_focus_ms"`
+	RetentionDays  *int64 `toml:"retention_days"`
+	VacuumDays     *int64 `toml:"vacuum_interval_days"`
+	TitleTTLMs     *int64 `toml:"title_ttl_ms"`
+	CaptureURLs    *bool  `toml:"capture_urls"`
+	Browsers       any    `toml:"browsers"`
+	DomainOnly     *bool  `toml:"domain_only"`
+}
+
+type rawLogging struct {
+	SystemLog   *bool  `toml:"system_log"`
+	IncludeJobs *bool  `toml:"include_jobs"`
+	Subsystem   string `toml:"subsystem"`
+}
+
+type rawAPI struct {
+	Enabled *bool  `toml:"enabled"`
+	Listen  string `toml:"listen"`
+	Token   string `toml:"token"`
 }
 
 type rawStreaming struct {
-	Enabled             *bool  `toml:"enabled"`
-	ObsHost             string `toml:"obs_host"`
-	ObsPassword         string `toml:"obs_password"`
-	LiveScene           string `toml:"live_scene"`
-	PrivacyScene        string `toml:"privacy_scene"`
-	ExcludeApplications any    `toml:"exclude_applications"`
-	PollIntervalMs      *int64 `toml:"poll_interval_ms"`
-	AutoStart           *bool  `toml:"auto_start"`
-	PrivacyMode         string `toml:"privacy_mode"`
+	Enabled             *bool               `toml:"enabled"`
+	ObsHost             string              `toml:"obs_host"`
+	ObsPassword         string              `toml:"obs_password"`
+	LiveScene           string              `toml:"live_scene"`
+	PrivacyScene        string              `toml:"privacy_scene"`
+	ExcludeApplications any                 `toml:"exclude_applications"`
+	PollIntervalMs      *int64              `toml:"poll_interval_ms"`
+	AutoStart           *bool               `toml:"auto_start"`
+	PrivacyMode         string              `toml:"privacy_mode"`
+	ExcludeTitles       []rawTitleExclusion `toml:"exclude_titles"`
+	Rules               []rawStreamingRule  `toml:"rules"`
 }
 
 type NormalizedConfig struct {
-	Watchers      []NormalizedWatcher
-	Servers       []NormalizedServer
-	Streaming     StreamingConfig
-	WindowTracker WindowTrackerConfig
+	Watchers          []NormalizedWatcher
+	Servers           []NormalizedServer
+	Schedules         []NormalizedSchedule
+	Streaming         StreamingConfig
+	WindowTracker     WindowTrackerConfig
+	State             StateConfig
+	API               APIConfig
+	Logging           LoggingConfig
+	Webhooks          []WebhookConfig
+	GC                GCConfig
+	Log               LogSettings
+	WatcherSets       []WatcherSetConfig
+	Profile           string
+	Profiles          map[string]ProfileConfig
+	ShutdownTimeout   time.Duration
+	HeartbeatInterval time.Duration
+	WatchdogTimeout   time.Duration
+	Includes          []string
+	IncludedFiles     []string
 }
 
 type matcher struct {
@@ -115,23 +275,65 @@ func (m matcher) matches(value string) bool {
 }
 
 type NormalizedWatcher struct {
-	ID             string
-	Name           string
-	WatchRoot      string
-	WatchPattern   string
-	Command        []string
-	CommandDisplay string
-	Env            map[string]string
-	Cwd            string
-	Matchers       []matcher
-	Events         map[string]struct{}
-	Restart        bool
-	RunOnStart     bool
-	Debounce       time.Duration
-	RestartDelay   time.Duration
-	KillTimeout    time.Duration
-	UseShell       bool
-	SingleFile     string
+	ID               string
+	Name             string
+	WatchRoot        string
+	Roots            []string
+	WatchPatterns    []string
+	Command          []string
+	CommandDisplay   string
+	Env              map[string]string
+	EnvFiles         []string
+	Cwd              string
+	Matchers         []matcher
+	Ignores          []matcher
+	Gitignore        bool
+	CaseSensitive    bool
+	Events           map[string]struct{}
+	Restart          bool
+	Concurrency      int
+	Queue            string
+	RunOnStart       bool
+	CatchUp          bool
+	Debounce         time.Duration
+	AdaptiveDebounce bool
+	MaxDebounce      time.Duration
+	RestartDelay     time.Duration
+	KillTimeout      time.Duration
+	Timeout          time.Duration
+	UseShell         bool
+	SingleFile       string
+	Priority         ProcessPriority
+	Sandbox          []string
+	SandboxProfile   string
+	RunAs            *RunAs
+	Secrets          secretSet
+	Umask            os.FileMode
+	UmaskSet         bool
+	ProcessGroup     bool
+	Templated        bool
+	PerFile          bool
+	Cache            bool
+	SkipUnchanged    bool
+	Grouped          bool
+	Groups           []watchGroup
+	GroupDepth       int
+	Transform        []string
+	TransformTimeout time.Duration
+	Hooks            RunHooks
+	LogPath          string
+	LogPerms         FilePermissions
+	PrefixOutput     bool
+	Stdout           string
+	Stdin            string
+	Clear            string
+	KeepAwake        string
+	PollFallback     bool
+	Backend          string
+	Remote           *RemoteWatch
+	PollInterval     time.Duration
+	Warmup           time.Duration
+	Labels           map[string]string
 }
 
 type NormalizedServer struct {
@@ -140,21 +342,69 @@ type NormalizedServer struct {
 	Command        []string
 	CommandDisplay string
 	Env            map[string]string
+	EnvFiles       []string
 	Cwd            string
 	Restart        bool
 	RestartDelay   time.Duration
 	KillTimeout    time.Duration
 	UseShell       bool
 	UsePTY         bool
+	Standby        bool
+	KeepAwake      string
+	PTYRows        int
+	PTYCols        int
+	Record         string
+	RecordDir      string
+	RecordKeep     int
 	LogPath        string
+	LogPerms       FilePermissions
+	LogBufferSize  int
+	PrefixOutput   bool
+	Stdout         string
+	Priority       ProcessPriority
+	Limits         ResourceLimits
+	Secrets        secretSet
+	Umask          os.FileMode
+	UmaskSet       bool
+	Sandbox        []string
+	SandboxProfile string
+	RunAs          *RunAs
+	ProcessGroup   bool
+	HealthCheck    *HealthCheck
+	Watch          *NormalizedWatcher
+	Sinks          []SinkConfig
+	DependsOn      []string
+	ReadyPattern   string
+	Hooks          RunHooks
+	Labels         map[string]string
+}
+
+type ProcessPriority struct {
+	Nice    int
+	NiceSet bool
+	IOClass string
+	IOLevel int
+}
+
+func (p ProcessPriority) empty() bool {
+	return !p.NiceSet && p.IOClass == ""
 }
 
 type WindowTrackerConfig struct {
-	Enabled      bool
-	Applications []string
-	PollInterval time.Duration
-	DBPath       string
-	TrackAll     bool
+	Enabled        bool
+	Applications   []string
+	PollInterval   time.Duration
+	DBPath         string
+	TrackAll       bool
+	TrackFocus     bool
+	MinFocus       time.Duration
+	Retention      time.Duration
+	VacuumInterval time.Duration
+	TitleTTL       time.Duration
+	CaptureURLs    bool
+	Browsers       []string
+	DomainOnly     bool
+	DirMode        os.FileMode
 }
 
 type StreamingConfig struct {
@@ -169,6 +419,8 @@ type StreamingConfig struct {
 	PollInterval         time.Duration
 	AutoStart            bool
 	PrivacyMode          string
+	ExcludedTitles       []TitleExclusion
+	Rules                []StreamingRule
 }
 
 func (s StreamingConfig) active() bool {
@@ -178,6 +430,9 @@ func (s StreamingConfig) active() bool {
 type Trigger struct {
 	Event string
 	Path  string
+	Root  string
+	Group string
+	RunID string
 }
 
 func readConfig(path string) (NormalizedConfig, error) {
@@ -186,68 +441,193 @@ func readConfig(path string) (NormalizedConfig, error) {
 		return NormalizedConfig{}, fmt.Errorf("read config: %w", err)
 	}
 
-	var raw rawConfig
-	if err := toml.Unmarshal(data, &raw); err != nil {
-		return NormalizedConfig{}, fmt.Errorf("parse config: %w", err)
+	raw, source, err := decodeConfig(path, data)
+	if err != nil {
+		return NormalizedConfig{}, err
+	}
+	sources := []configSource{newConfigSource(path, source, raw, nil)}
+
+	includes, files, err := resolveIncludes(path, raw.Include)
+	if err != nil {
+		return NormalizedConfig{}, err
+	}
+	for _, file := range files {
+		included, source, err := readIncludedConfig(file)
+		if err != nil {
+			return NormalizedConfig{}, err
+		}
+		sources = append(sources, newConfigSource(file, source, included, &sources[len(sources)-1]))
+		raw.Watchers = append(raw.Watchers, included.Watchers...)
+		raw.Servers = append(raw.Servers, included.Servers...)
+		raw.Schedules = append(raw.Schedules, included.Schedules...)
+		raw.Templates = append(raw.Templates, included.Templates...)
+		raw.WatcherSets = append(raw.WatcherSets, included.WatcherSets...)
+	}
+
+	var cfg NormalizedConfig
+	sets, err := expandTemplates(&raw, sources)
+	if err == nil {
+		cfg, err = normalizeConfig(raw)
+	}
+	if err != nil {
+		var errs configcheck.Errors
+		if errors.As(err, &errs) {
+			relabelGeneratedWatcherErrors(errs, raw.Watchers)
+			locateConfigErrors(errs, sources)
+		}
+		return NormalizedConfig{}, err
+	}
+	cfg.WatcherSets = sets
+	cfg.Includes, cfg.IncludedFiles = includes, files
+	return cfg, nil
+}
+
+var configRenames = []configcheck.Rename{
+	{Old: "watchers[].directory", New: "watchers[].path"},
+	{Old: "servers[].ready_when", New: "servers[].ready_pattern"},
+}
+
+var loggedDeprecations sync.Map
+
+func decodeConfig(path string, data []byte) (rawConfig, []byte, error) {
+	source, deprecations, err := configcheck.RenameKeys(data, configRenames)
+	if err != nil {
+		var errs configcheck.Errors
+		errs.Add(err)
+		errs.Locate(path, data)
+		return rawConfig{}, nil, fmt.Errorf("parse config: %w", errs)
+	}
+	for _, deprecation := range deprecations {
+		if _, logged := loggedDeprecations.LoadOrStore(path+":"+deprecation.Old, true); !logged {
+			logWarn("%s:%d: %s is deprecated, use %s instead", path, deprecation.Line, deprecation.Old, deprecation.New)
+		}
 	}
 
-	return normalizeConfig(raw)
+	var raw rawConfig
+	if err := toml.Unmarshal(source, &raw); err != nil {
+		var errs configcheck.Errors
+		errs.Add(err)
+		errs.Locate(path, source)
+		return rawConfig{}, nil, fmt.Errorf("parse config: %w", errs)
+	}
+	return raw, source, nil
 }
 
 func normalizeConfig(raw rawConfig) (NormalizedConfig, error) {
 	defaults := raw.Defaults
+	var errs configcheck.Errors
 
 	if len(raw.Watchers) == 0 {
 		logInfo("config contains no watchers")
 	}
 
+	state, err := normalizeState(raw.StateDir, defaults)
+	if err != nil {
+		errs.Add(err)
+		state, _ = normalizeState("", rawDefaults{})
+	}
+
+	logOptions, err := normalizeLogSettings(raw.LogFormat, raw.LogLevel)
+	errs.Add(err)
+
+	if raw.ShutdownTimeoutMs != nil && *raw.ShutdownTimeoutMs <= 0 {
+		errs.Add(errors.New("shutdown_timeout_ms: must be greater than 0"))
+	}
+	if raw.HeartbeatIntervalMs != nil && *raw.HeartbeatIntervalMs < 0 {
+		errs.Add(errors.New("heartbeat_interval_ms: must not be negative"))
+	}
+	if raw.WatchdogTimeoutMs != nil && *raw.WatchdogTimeoutMs < 0 {
+		errs.Add(errors.New("watchdog_timeout_ms: must not be negative"))
+	}
+
 	result := NormalizedConfig{
-		Watchers: make([]NormalizedWatcher, 0, len(raw.Watchers)),
-		Servers:  make([]NormalizedServer, 0, len(raw.Servers)),
+		Watchers:          make([]NormalizedWatcher, 0, len(raw.Watchers)),
+		Servers:           make([]NormalizedServer, 0, len(raw.Servers)),
+		State:             state,
+		Log:               logOptions,
+		ShutdownTimeout:   chooseDuration(raw.ShutdownTimeoutMs, nil, defaultShutdownTimeout),
+		HeartbeatInterval: chooseDuration(raw.HeartbeatIntervalMs, nil, defaultHeartbeatInterval),
+		WatchdogTimeout:   chooseDuration(raw.WatchdogTimeoutMs, nil, 0),
 	}
 
 	for i, watcher := range raw.Watchers {
-		normalized, err := normalizeWatcher(watcher, i, defaults)
+		normalized, err := normalizeWatcher(watcher, i, defaults, state)
 		if err != nil {
-			return NormalizedConfig{}, err
+			errs.Add(err)
+			continue
 		}
 		result.Watchers = append(result.Watchers, normalized)
 	}
 
 	for i, server := range raw.Servers {
-		normalized, err := normalizeServer(server, i, defaults)
+		normalized, err := normalizeServer(server, i, defaults, state)
 		if err != nil {
-			return NormalizedConfig{}, err
+			errs.Add(err)
+			continue
 		}
 		result.Servers = append(result.Servers, normalized)
 	}
+	if len(result.Servers) == len(raw.Servers) {
+		errs.Add(checkServerDependencies(result.Servers))
+	}
 
-	streaming, err := normalizeStreaming(raw.Streaming)
-	if err != nil {
-		return NormalizedConfig{}, err
+	for i, schedule := range raw.Schedules {
+		normalized, err := normalizeSchedule(schedule, i, defaults)
+		if err != nil {
+			errs.Add(err)
+			continue
+		}
+		result.Schedules = append(result.Schedules, normalized)
 	}
+
+	streaming, err := normalizeStreaming(raw.Streaming)
+	errs.Add(err)
 	result.Streaming = streaming
 
-	tracker, err := normalizeWindowTracker(raw.WindowTracker)
-	if err != nil {
-		return NormalizedConfig{}, err
-	}
+	tracker, err := normalizeWindowTracker(raw.WindowTracker, state)
+	errs.Add(err)
 	result.WindowTracker = tracker
 
+	api, err := normalizeAPI(raw.API)
+	errs.Add(err)
+	result.API = api
+	result.Logging = normalizeLogging(raw.Logging)
+
+	gc, err := normalizeGC(raw.GC)
+	errs.Add(err)
+	result.GC = gc
+
+	profiles, err := normalizeProfiles(raw.Profiles, raw.Profile)
+	errs.Add(err)
+	result.Profile, result.Profiles = strings.TrimSpace(raw.Profile), profiles
+
+	for i, webhook := range raw.Webhooks {
+		normalized, err := normalizeWebhook(webhook)
+		if err != nil {
+			errs.Add(fmt.Errorf("webhooks[%d]: %w", i, err))
+			continue
+		}
+		result.Webhooks = append(result.Webhooks, normalized)
+	}
+	excludeOwnState(&result)
+
+	if err := errs.Err(); err != nil {
+		return NormalizedConfig{}, err
+	}
 	return result, nil
 }
 
-func normalizeWatcher(raw rawWatcher, index int, defaults rawDefaults) (NormalizedWatcher, error) {
+func normalizeWatcher(raw rawWatcher, index int, defaults rawDefaults, state StateConfig) (NormalizedWatcher, error) {
 	name := strings.TrimSpace(raw.Name)
 	if name == "" {
 		name = fmt.Sprintf("watcher-%d", index+1)
 	}
 
-	pathValue, err := choosePath(raw)
+	pathValues, err := choosePaths(raw)
 	if err != nil {
 		return NormalizedWatcher{}, fmt.Errorf("watchers[%d]: %w", index, err)
 	}
-	resolvedPath, err := resolvePath(pathValue)
+	resolvedPath, err := resolvePath(pathValues[0])
 	if err != nil {
 		return NormalizedWatcher{}, fmt.Errorf("watchers[%d]: resolve path: %w", index, err)
 	}
@@ -281,32 +661,83 @@ func normalizeWatcher(raw rawWatcher, index int, defaults rawDefaults) (Normaliz
 	if !rootInfo.IsDir() {
 		return NormalizedWatcher{}, fmt.Errorf("watchers[%d]: watch root %s is not a directory", index, watchRoot)
 	}
-
-	commandParts, displayParts, err := parseCommandSpec(raw.Command, raw.Args)
+	roots, err := watchRoots(watchRoot, singleFile, pathValues[1:])
 	if err != nil {
 		return NormalizedWatcher{}, fmt.Errorf("watchers[%d]: %w", index, err)
 	}
-	if len(commandParts) == 0 {
-		return NormalizedWatcher{}, fmt.Errorf("watchers[%d]: command must not be empty", index)
+
+	var errs configcheck.Errors
+	commandParts, displayParts, err := parseCommandSpec(raw.Command, raw.Args)
+	pipeline := raw.Commands != nil
+	var steps [][]string
+	switch {
+	case err != nil:
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	case pipeline && len(commandParts) > 0:
+		errs.Add(fmt.Errorf("watchers[%d]: set either command or commands, not both", index))
+	case pipeline:
+		if steps, err = parseCommandSteps(raw.Commands); err != nil {
+			errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+		}
+	case len(commandParts) == 0:
+		errs.Add(fmt.Errorf("watchers[%d]: command must not be empty", index))
 	}
 
 	env, err := normalizeEnv(raw.Env)
 	if err != nil {
-		return NormalizedWatcher{}, fmt.Errorf("watchers[%d]: invalid env: %w", index, err)
+		errs.Add(fmt.Errorf("watchers[%d]: invalid env: %w", index, err))
+	}
+
+	labels, err := normalizeLabels(raw.Labels)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: labels: %w", index, err))
 	}
 
 	cwd := watchRoot
 	if str, ok := valueToString(raw.Cwd); ok {
 		resolved, err := resolvePath(str)
 		if err != nil {
-			return NormalizedWatcher{}, fmt.Errorf("watchers[%d]: resolve cwd: %w", index, err)
+			errs.Add(fmt.Errorf("watchers[%d]: resolve cwd: %w", index, err))
 		}
 		cwd = resolved
 	}
 
-	matchers, err := compileMatchers(raw, singleFile)
+	envFiles, err := resolveEnvFiles(raw.EnvFile, cwd)
 	if err != nil {
-		return NormalizedWatcher{}, fmt.Errorf("watchers[%d]: %w", index, err)
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	} else if fromFiles, err := loadEnvFiles(envFiles); err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	} else {
+		env = mergeEnv(fromFiles, env)
+	}
+
+	caseSensitive := valueOrDefaultBool(raw.CaseSensitive, defaultCaseSensitive())
+	matchers, err := compileMatchers(raw, singleFile, watchRoot, caseSensitive)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+
+	ignores, err := compileIgnores(raw, defaults, watchRoot, caseSensitive)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+
+	priority, err := normalizePriority(raw.Nice, raw.IONice, raw.IONiceLevel)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+
+	sandbox, err := normalizeSandbox(raw.Sandbox)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+	sandboxProfile, err := normalizeSandboxProfile(raw.SandboxProfile, sandbox)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+	runAs, err := normalizeRunAs(raw.User, raw.Group)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
 	}
 
 	restart := valueOrDefaultBool(raw.Restart, false)
@@ -316,67 +747,307 @@ func normalizeWatcher(raw rawWatcher, index int, defaults rawDefaults) (Normaliz
 	}
 
 	debounce := chooseDuration(raw.DebounceMs, defaults.DebounceMs, defaultDebounce)
+	adaptive := valueOrDefaultBool(raw.AdaptiveDebounce, valueOrDefaultBool(defaults.AdaptiveDebounce, false))
+	maxDebounce := chooseDuration(raw.MaxDebounceMs, defaults.MaxDebounceMs, max(defaultMaxDebounce, debounce))
+	if adaptive && maxDebounce < debounce {
+		errs.Add(fmt.Errorf("watchers[%d]: max_debounce_ms (%s) is shorter than debounce_ms (%s)", index, maxDebounce, debounce))
+	}
 	restartDelay := chooseDuration(raw.RestartDelayMs, defaults.RestartDelayMs, defaultRestartDelay)
 	killTimeout := chooseDuration(raw.KillTimeoutMs, defaults.KillTimeoutMs, defaultKillTimeout)
+	timeout := chooseDuration(raw.TimeoutMs, nil, 0)
 
 	events := normalizeEvents(raw.Events, defaults.Events, restart)
 
 	useShell := valueOrDefaultBool(raw.Shell, false)
-	commandDisplay := joinDisplayParts(displayParts)
+	profile, err := normalizeShellProfile(raw.ShellProfile, defaults.ShellProfile)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+	secrets := newSecretSet(env, defaults.SecretEnv, raw.SecretEnv)
+	commandDisplay := joinDisplayParts(secrets.redactArgs(displayParts))
 
 	commandExec := make([]string, len(commandParts))
 	copy(commandExec, commandParts)
 
 	if useShell {
-		commandDisplay = buildShellCommand(displayParts)
-		commandExec = []string{defaultShell(), "-lc", commandDisplay}
+		commandDisplay = buildShellCommand(secrets.redactArgs(displayParts))
+		commandExec = profile.command(buildShellCommand(displayParts))
+	}
+	parallel := valueOrDefaultBool(raw.Parallel, false)
+	if pipeline {
+		commandDisplay, commandExec = pipelineCommand(steps, parallel, useShell, profile, secrets)
+	} else if raw.Parallel != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: parallel only applies to commands", index))
+	}
+
+	commandExec, err = wrapSandboxCommand(commandExec, sandbox, sandboxProfile, cwd, watchRoot, runAs)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+
+	templated, perFile, grouped := commandPlaceholders(commandExec)
+
+	groups, err := compileGroups(raw.Groups, watchRoot, caseSensitive)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+	if (grouped || len(groups) > 0) && len(roots) > 1 {
+		errs.Add(fmt.Errorf("watchers[%d]: groups and {group} cannot be combined with several paths", index))
+	}
+	groupDepth := 1
+	if raw.GroupDepth != nil {
+		if *raw.GroupDepth < 1 {
+			errs.Add(fmt.Errorf("watchers[%d]: group_depth must be at least 1", index))
+		}
+		groupDepth = int(*raw.GroupDepth)
+	}
+
+	var transform []string
+	if raw.Transform != nil {
+		transformParts, _, err := parseCommandSpec(raw.Transform, nil)
+		if err != nil {
+			errs.Add(fmt.Errorf("watchers[%d]: transform: %w", index, err))
+		} else if len(transformParts) == 0 {
+			errs.Add(fmt.Errorf("watchers[%d]: transform must not be empty", index))
+		}
+		if useShell {
+			transformParts = profile.command(buildShellCommand(transformParts))
+		}
+		transform, err = wrapSandboxCommand(transformParts, sandbox, sandboxProfile, cwd, watchRoot, runAs)
+		if err != nil {
+			errs.Add(fmt.Errorf("watchers[%d]: transform: %w", index, err))
+		}
+	}
+	transformTimeout := chooseDuration(raw.TransformTimeoutMs, nil, defaultTransformTimeout)
+
+	hooks, err := normalizeRunHooks(raw.OnSuccess, raw.OnFailure, useShell, profile)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+	for _, hook := range []*[]string{&hooks.OnSuccess, &hooks.OnFailure} {
+		if len(*hook) == 0 {
+			continue
+		}
+		if *hook, err = wrapSandboxCommand(*hook, sandbox, sandboxProfile, cwd, watchRoot, runAs); err != nil {
+			errs.Add(fmt.Errorf("watchers[%d]: hook: %w", index, err))
+		}
+	}
+
+	var remote *RemoteWatch
+	backend := strings.ToLower(strings.TrimSpace(raw.Backend))
+	if strings.TrimSpace(raw.Remote) != "" {
+		if remote, err = parseRemoteWatch(raw.Remote); err != nil {
+			errs.Add(fmt.Errorf("watchers[%d]: remote: %w", index, err))
+		}
+		switch {
+		case remote == nil:
+		case backend != "" && backend != remote.Kind:
+			errs.Add(fmt.Errorf("watchers[%d]: remote %s uses backend = %q", index, remote, remote.Kind))
+		case !targetIsDir:
+			errs.Add(fmt.Errorf("watchers[%d]: remote watchers need path to be a local directory", index))
+		case len(roots) > 1:
+			errs.Add(fmt.Errorf("watchers[%d]: remote watchers take a single path", index))
+		case valueOrDefaultBool(raw.Cache, false):
+			errs.Add(fmt.Errorf("watchers[%d]: cache cannot be combined with remote", index))
+		case valueOrDefaultBool(raw.Gitignore, false):
+			errs.Add(fmt.Errorf("watchers[%d]: respect_gitignore cannot be combined with remote", index))
+		case valueOrDefaultBool(raw.CatchUp, false):
+			errs.Add(fmt.Errorf("watchers[%d]: catch_up cannot be combined with remote", index))
+		}
+		if remote != nil {
+			backend = remote.Kind
+		}
+	}
+	if backend == "" {
+		backend = strings.ToLower(strings.TrimSpace(defaults.Backend))
+	}
+	switch backend {
+	case "":
+		backend = "notify"
+	case "notify", "poll":
+	case "ssh", "s3", "gcs":
+		if strings.TrimSpace(raw.Remote) == "" {
+			errs.Add(fmt.Errorf("watchers[%d]: remote is required with backend = %q (\"[user@]host:/dir\", \"s3://bucket/prefix\" or \"gs://bucket/prefix\")", index, backend))
+		}
+	default:
+		errs.Add(fmt.Errorf("watchers[%d]: backend must be \"notify\", \"poll\", \"ssh\", \"s3\" or \"gcs\"", index))
+	}
+	pollInterval := chooseDuration(raw.PollIntervalMs, nil, defaultPollInterval)
+	minInterval := minPollInterval
+	if strings.TrimSpace(raw.Remote) != "" {
+		pollInterval = chooseDuration(raw.PollIntervalMs, nil, defaultRemotePollInterval)
+		minInterval = minRemotePollInterval
+	}
+	if pollInterval < minInterval {
+		errs.Add(fmt.Errorf("watchers[%d]: poll_interval_ms must be at least %d", index, minInterval.Milliseconds()))
+	}
+
+	cache := valueOrDefaultBool(raw.Cache, false)
+	if cache && restart {
+		errs.Add(fmt.Errorf("watchers[%d]: cache cannot be combined with restart", index))
+	}
+	if cache && (perFile || grouped) {
+		errs.Add(fmt.Errorf("watchers[%d]: cache cannot be combined with per-file or {group} placeholders", index))
+	}
+	concurrency := 1
+	if raw.Concurrency != nil {
+		concurrency = int(*raw.Concurrency)
+		switch {
+		case concurrency < 1:
+			errs.Add(fmt.Errorf("watchers[%d]: concurrency must be at least 1", index))
+		case concurrency > 1 && restart:
+			errs.Add(fmt.Errorf("watchers[%d]: concurrency cannot be combined with restart", index))
+		case concurrency > 1 && cache:
+			errs.Add(fmt.Errorf("watchers[%d]: concurrency cannot be combined with cache", index))
+		}
+	}
+	queue := strings.ToLower(strings.TrimSpace(raw.Queue))
+	switch queue {
+	case "":
+		queue = "all"
+	case "all", "latest", "drop":
+		if restart && queue != "all" {
+			errs.Add(fmt.Errorf("watchers[%d]: queue cannot be combined with restart, which always restarts with the latest changes", index))
+		}
+	default:
+		errs.Add(fmt.Errorf("watchers[%d]: queue must be \"all\", \"latest\" or \"drop\"", index))
+	}
+	skipUnchanged := valueOrDefaultBool(raw.SkipUnchanged, false)
+	if skipUnchanged && remote != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: skip_unchanged cannot be combined with remote", index))
+	}
+
+	umask, umaskSet, err := normalizeUmask(raw.Umask, defaults.Umask)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: umask: %w", index, err))
+	}
+	if umaskSet {
+		commandExec = wrapUmaskCommand(commandExec, umask)
+	}
+
+	processGroup := valueOrDefaultBool(raw.ProcessGroup, valueOrDefaultBool(defaults.ProcessGroup, true))
+
+	logPath, err := normalizeLogPath(raw.LogPath, state.Dir, "watchers", name)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+	stdout, err := normalizeStdoutMode(raw.Stdout, defaults.Stdout)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+	clearMode, err := normalizeClearMode(raw.Clear)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+	keepAwake, err := normalizeKeepAwake(raw.KeepAwake)
+	if err != nil {
+		errs.Add(fmt.Errorf("watchers[%d]: %w", index, err))
+	}
+	stdin := strings.ToLower(strings.TrimSpace(raw.Stdin))
+	switch stdin {
+	case "", "paths", "paths0":
+	case "null":
+		stdin = ""
+	default:
+		errs.Add(fmt.Errorf("watchers[%d]: stdin must be \"paths\", \"paths0\" or \"null\", got %q", index, raw.Stdin))
+	}
+
+	if err := errs.Err(); err != nil {
+		return NormalizedWatcher{}, err
 	}
 
 	return NormalizedWatcher{
-		ID:             fmt.Sprintf("watchers[%d]", index),
-		Name:           name,
-		WatchRoot:      watchRoot,
-		WatchPattern:   filepath.Join(watchRoot, "..."),
-		Command:        commandExec,
-		CommandDisplay: commandDisplay,
-		Env:            env,
-		Cwd:            cwd,
-		Matchers:       matchers,
-		Events:         events,
-		Restart:        restart,
-		RunOnStart:     runOnStart,
-		Debounce:       debounce,
-		RestartDelay:   restartDelay,
-		KillTimeout:    killTimeout,
-		UseShell:       useShell,
-		SingleFile:     singleFile,
+		ID:               fmt.Sprintf("watchers[%d]", index),
+		Name:             name,
+		WatchRoot:        watchRoot,
+		Roots:            roots,
+		WatchPatterns:    effectiveRootPatterns(roots, matchers),
+		Command:          commandExec,
+		CommandDisplay:   commandDisplay,
+		Env:              env,
+		EnvFiles:         envFiles,
+		Cwd:              cwd,
+		Matchers:         matchers,
+		Ignores:          ignores,
+		Gitignore:        remote == nil && valueOrDefaultBool(raw.Gitignore, valueOrDefaultBool(defaults.Gitignore, false)),
+		CaseSensitive:    caseSensitive,
+		Events:           events,
+		Restart:          restart,
+		Concurrency:      concurrency,
+		Queue:            queue,
+		RunOnStart:       runOnStart,
+		CatchUp:          valueOrDefaultBool(raw.CatchUp, false),
+		Debounce:         debounce,
+		AdaptiveDebounce: adaptive,
+		MaxDebounce:      maxDebounce,
+		RestartDelay:     restartDelay,
+		KillTimeout:      killTimeout,
+		Timeout:          timeout,
+		UseShell:         useShell || pipeline,
+		SingleFile:       singleFile,
+		Priority:         priority,
+		Sandbox:          sandbox,
+		SandboxProfile:   sandboxProfile,
+		RunAs:            runAs,
+		Secrets:          secrets,
+		Umask:            umask,
+		UmaskSet:         umaskSet,
+		ProcessGroup:     processGroup,
+		Templated:        templated,
+		PerFile:          perFile,
+		Cache:            cache,
+		SkipUnchanged:    skipUnchanged,
+		Grouped:          grouped,
+		Groups:           groups,
+		GroupDepth:       groupDepth,
+		Transform:        transform,
+		TransformTimeout: transformTimeout,
+		Hooks:            hooks,
+		LogPath:          logPath,
+		LogPerms:         state.Permissions,
+		PrefixOutput:     valueOrDefaultBool(raw.PrefixOutput, valueOrDefaultBool(defaults.PrefixOutput, false)),
+		Stdout:           stdout,
+		Stdin:            stdin,
+		Clear:            clearMode,
+		KeepAwake:        keepAwake,
+		PollFallback:     valueOrDefaultBool(raw.PollFallback, valueOrDefaultBool(defaults.PollFallback, false)),
+		Backend:          backend,
+		Remote:           remote,
+		PollInterval:     pollInterval,
+		Warmup:           chooseDuration(raw.WarmupMs, defaults.WarmupMs, defaultWarmup),
+		Labels:           labels,
 	}, nil
 }
 
-func normalizeServer(raw rawServer, index int, defaults rawDefaults) (NormalizedServer, error) {
+func normalizeServer(raw rawServer, index int, defaults rawDefaults, state StateConfig) (NormalizedServer, error) {
 	name := strings.TrimSpace(raw.Name)
 	if name == "" {
 		name = fmt.Sprintf("server-%d", index+1)
 	}
 
+	var errs configcheck.Errors
 	commandParts, displayParts, err := parseCommandSpec(raw.Command, raw.Args)
 	if err != nil {
-		return NormalizedServer{}, fmt.Errorf("servers[%d]: %w", index, err)
-	}
-	if len(commandParts) == 0 {
-		return NormalizedServer{}, fmt.Errorf("servers[%d]: command must not be empty", index)
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	} else if len(commandParts) == 0 {
+		errs.Add(fmt.Errorf("servers[%d]: command must not be empty", index))
 	}
 
 	env, err := normalizeEnv(raw.Env)
 	if err != nil {
-		return NormalizedServer{}, fmt.Errorf("servers[%d]: invalid env: %w", index, err)
+		errs.Add(fmt.Errorf("servers[%d]: invalid env: %w", index, err))
+	}
+
+	labels, err := normalizeLabels(raw.Labels)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: labels: %w", index, err))
 	}
 
 	cwd := ""
 	if str, ok := valueToString(raw.Cwd); ok && str != "" {
 		resolved, err := resolvePath(str)
 		if err != nil {
-			return NormalizedServer{}, fmt.Errorf("servers[%d]: resolve cwd: %w", index, err)
+			errs.Add(fmt.Errorf("servers[%d]: resolve cwd: %w", index, err))
 		}
 		cwd = resolved
 	} else {
@@ -387,37 +1058,163 @@ func normalizeServer(raw rawServer, index int, defaults rawDefaults) (Normalized
 		}
 	}
 
+	envFiles, err := resolveEnvFiles(raw.EnvFile, cwd)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	} else if fromFiles, err := loadEnvFiles(envFiles); err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	} else {
+		env = mergeEnv(fromFiles, env)
+	}
+
 	restart := valueOrDefaultBool(raw.Restart, true)
 
 	restartDelay := chooseDuration(raw.RestartDelayMs, defaults.RestartDelayMs, defaultRestartDelay)
 	killTimeout := chooseDuration(raw.KillTimeoutMs, defaults.KillTimeoutMs, defaultKillTimeout)
 
 	useShell := valueOrDefaultBool(raw.Shell, false)
-	usePTY := valueOrDefaultBool(raw.Pty, true)
+	profile, err := normalizeShellProfile(raw.ShellProfile, defaults.ShellProfile)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	standby := valueOrDefaultBool(raw.Standby, false)
+	usePTY := valueOrDefaultBool(raw.Pty, !standby && runtime.GOOS != "windows")
+	switch {
+	case usePTY && runtime.GOOS == "windows":
+		errs.Add(fmt.Errorf("servers[%d]: pty is not supported on windows", index))
+	case standby && usePTY:
+		errs.Add(fmt.Errorf("servers[%d]: standby needs pty = false", index))
+	case standby && runtime.GOOS == "windows":
+		errs.Add(fmt.Errorf("servers[%d]: standby is not supported on windows", index))
+	}
+	keepAwake, err := normalizeKeepAwake(raw.KeepAwake)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	ptyRows, err := normalizePTYDimension("pty_rows", raw.PtyRows, defaultPTYRows)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	ptyCols, err := normalizePTYDimension("pty_cols", raw.PtyCols, defaultPTYCols)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	record, recordDir, recordKeep, err := normalizeRecording(raw, usePTY, state.Dir, name)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
 
-	logPathInput := ""
-	if str, ok := valueToString(raw.LogPath); ok {
-		logPathInput = str
+	priority, err := normalizePriority(raw.Nice, raw.IONice, raw.IONiceLevel)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
 	}
-	if logPathInput == "" {
-		defaultPath, err := defaultServerLogPath(name)
-		if err != nil {
-			return NormalizedServer{}, fmt.Errorf("servers[%d]: %w", index, err)
-		}
-		logPathInput = defaultPath
+	limits, err := normalizeResourceLimits(raw.MaxMemoryMB, raw.CPULimit, raw.LimitAction)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
 	}
-	logPath, err := resolvePath(logPathInput)
+
+	logPath, err := normalizeLogPath(raw.LogPath, state.Dir, "servers", name)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	stdout, err := normalizeStdoutMode(raw.Stdout, defaults.Stdout)
 	if err != nil {
-		return NormalizedServer{}, fmt.Errorf("servers[%d]: resolve log path: %w", index, err)
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+
+	logBufferSize := defaultLogBufferSize
+	if raw.LogBufferKB != nil {
+		if *raw.LogBufferKB < 1 {
+			errs.Add(fmt.Errorf("servers[%d]: log_buffer_kb must be at least 1", index))
+		}
+		logBufferSize = int(*raw.LogBufferKB) << 10
 	}
 
-	commandDisplay := joinDisplayParts(displayParts)
+	secrets := newSecretSet(env, defaults.SecretEnv, raw.SecretEnv)
+	commandDisplay := joinDisplayParts(secrets.redactArgs(displayParts))
 	commandExec := make([]string, len(commandParts))
 	copy(commandExec, commandParts)
 
 	if useShell {
-		commandDisplay = buildShellCommand(displayParts)
-		commandExec = []string{defaultShell(), "-lc", commandDisplay}
+		commandDisplay = buildShellCommand(secrets.redactArgs(displayParts))
+		commandExec = profile.command(buildShellCommand(displayParts))
+	}
+
+	hooks, err := normalizeRunHooks(raw.OnSuccess, raw.OnFailure, useShell, profile)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+
+	runAs, err := normalizeRunAs(raw.User, raw.Group)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	sandbox, err := normalizeSandbox(raw.Sandbox)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	sandboxProfile, err := normalizeSandboxProfile(raw.SandboxProfile, sandbox)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	if commandExec, err = wrapSandboxCommand(commandExec, sandbox, sandboxProfile, cwd, cwd, runAs); err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	for _, hook := range []*[]string{&hooks.OnSuccess, &hooks.OnFailure} {
+		if len(*hook) == 0 {
+			continue
+		}
+		if *hook, err = wrapSandboxCommand(*hook, sandbox, sandboxProfile, cwd, cwd, runAs); err != nil {
+			errs.Add(fmt.Errorf("servers[%d]: hook: %w", index, err))
+		}
+	}
+
+	umask, umaskSet, err := normalizeUmask(raw.Umask, defaults.Umask)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: umask: %w", index, err))
+	}
+	if umaskSet {
+		commandExec = wrapUmaskCommand(commandExec, umask)
+	}
+
+	processGroup := valueOrDefaultBool(raw.ProcessGroup, valueOrDefaultBool(defaults.ProcessGroup, true))
+
+	healthCheck, err := normalizeHealthCheck(raw.HealthCheck)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+	if healthCheck != nil && healthCheck.Type == "command" {
+		if healthCheck.Command, err = wrapSandboxCommand(healthCheck.Command, sandbox, sandboxProfile, cwd, cwd, runAs); err != nil {
+			errs.Add(fmt.Errorf("servers[%d]: health_check: %w", index, err))
+		}
+		healthCheck.RunAs = runAs
+	}
+
+	watch, err := normalizeServerWatch(raw.Watch, name, cwd, index, defaults, state)
+	if err != nil {
+		errs.Add(err)
+	}
+
+	sinks, err := normalizeSinks(raw.Sinks, name)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: %w", index, err))
+	}
+
+	dependsOn, err := valueToStringSlice(raw.DependsOn)
+	if err != nil {
+		errs.Add(fmt.Errorf("servers[%d]: depends_on: %w", index, err))
+	}
+	dependsOn = continueIfEmpty(dependsOn)
+
+	readyPattern := strings.TrimSpace(raw.ReadyPattern)
+	if readyPattern != "" {
+		if _, err := regexp.Compile(readyPattern); err != nil {
+			errs.Add(fmt.Errorf("servers[%d]: ready_pattern: %w", index, err))
+		}
+	}
+
+	if err := errs.Err(); err != nil {
+		return NormalizedServer{}, err
 	}
 
 	return NormalizedServer{
@@ -426,18 +1223,46 @@ func normalizeServer(raw rawServer, index int, defaults rawDefaults) (Normalized
 		Command:        commandExec,
 		CommandDisplay: commandDisplay,
 		Env:            env,
+		EnvFiles:       envFiles,
 		Cwd:            cwd,
 		Restart:        restart,
 		RestartDelay:   restartDelay,
 		KillTimeout:    killTimeout,
 		UseShell:       useShell,
 		UsePTY:         usePTY,
+		Standby:        standby,
+		KeepAwake:      keepAwake,
+		PTYRows:        ptyRows,
+		PTYCols:        ptyCols,
+		Record:         record,
+		RecordDir:      recordDir,
+		RecordKeep:     recordKeep,
 		LogPath:        logPath,
+		LogPerms:       state.Permissions,
+		LogBufferSize:  logBufferSize,
+		PrefixOutput:   valueOrDefaultBool(raw.PrefixOutput, valueOrDefaultBool(defaults.PrefixOutput, false)),
+		Stdout:         stdout,
+		Priority:       priority,
+		Limits:         limits,
+		Secrets:        secrets,
+		Umask:          umask,
+		UmaskSet:       umaskSet,
+		Sandbox:        sandbox,
+		SandboxProfile: sandboxProfile,
+		RunAs:          runAs,
+		ProcessGroup:   processGroup,
+		HealthCheck:    healthCheck,
+		Watch:          watch,
+		Sinks:          sinks,
+		DependsOn:      dependsOn,
+		ReadyPattern:   readyPattern,
+		Hooks:          hooks,
+		Labels:         labels,
 	}, nil
 }
 
-func normalizeWindowTracker(raw rawWindowTracker) (WindowTrackerConfig, error) {
-	const defaultDB = "~/.db/ghost/windows.sqlite"
+func normalizeWindowTracker(raw rawWindowTracker, state StateConfig) (WindowTrackerConfig, error) {
+	defaultDB := filepath.Join(state.DataDir, "windows.sqlite")
 
 	appsRaw, err := valueToStringSlice(raw.Applications)
 	if err != nil {
@@ -462,12 +1287,43 @@ func normalizeWindowTracker(raw rawWindowTracker) (WindowTrackerConfig, error) {
 		return WindowTrackerConfig{}, fmt.Errorf("window_tracker.db_path: %w", err)
 	}
 
+	var retention time.Duration
+	if raw.RetentionDays != nil {
+		if *raw.RetentionDays < 0 {
+			return WindowTrackerConfig{}, errors.New("window_tracker.retention_days must not be negative")
+		}
+		retention = time.Duration(*raw.RetentionDays) * 24 * time.Hour
+	}
+	vacuumInterval := defaultVacuumInterval
+	if raw.VacuumDays != nil {
+		if *raw.VacuumDays < 0 {
+			return WindowTrackerConfig{}, errors.New("window_tracker.vacuum_interval_days must not be negative")
+		}
+		vacuumInterval = time.Duration(*raw.VacuumDays) * 24 * time.Hour
+	}
+	if raw.TitleTTLMs != nil && *raw.TitleTTLMs < 0 {
+		return WindowTrackerConfig{}, errors.New("window_tracker.title_ttl_ms must not be negative")
+	}
+	browsers, err := valueToStringSlice(raw.Browsers)
+	if err != nil {
+		return WindowTrackerConfig{}, fmt.Errorf("window_tracker.browsers: %w", err)
+	}
+
 	return WindowTrackerConfig{
-		Enabled:      enabled && (trackAll || len(apps) > 0),
-		Applications: apps,
-		PollInterval: pollInterval,
-		DBPath:       dbPath,
-		TrackAll:     trackAll,
+		Enabled:        enabled && (trackAll || len(apps) > 0),
+		Applications:   apps,
+		PollInterval:   pollInterval,
+		DBPath:         dbPath,
+		TrackAll:       trackAll,
+		TrackFocus:     valueOrDefaultBool(raw.TrackFocus, true),
+		MinFocus:       chooseDuration(raw.MinFocusMs, nil, 2*time.Second),
+		Retention:      retention,
+		VacuumInterval: vacuumInterval,
+		TitleTTL:       chooseDuration(raw.TitleTTLMs, nil, windows.DefaultTitleTTL),
+		CaptureURLs:    valueOrDefaultBool(raw.CaptureURLs, false),
+		Browsers:       normalizeAppList(browsers),
+		DomainOnly:     valueOrDefaultBool(raw.DomainOnly, false),
+		DirMode:        state.Permissions.DirMode,
 	}, nil
 }
 
@@ -531,6 +1387,15 @@ func normalizeStreaming(raw rawStreaming) (StreamingConfig, error) {
 		return StreamingConfig{}, fmt.Errorf("streaming.privacy_mode: unsupported value %q (use onscreen or frontmost)", mode)
 	}
 
+	titles, err := normalizeTitleExclusions(raw.ExcludeTitles)
+	if err != nil {
+		return StreamingConfig{}, err
+	}
+	rules, err := normalizeStreamingRules(raw.Rules, liveScene)
+	if err != nil {
+		return StreamingConfig{}, err
+	}
+
 	cfg := StreamingConfig{
 		Enabled:              valueOrDefaultBool(raw.Enabled, false),
 		OBSScheme:            scheme,
@@ -543,6 +1408,8 @@ func normalizeStreaming(raw rawStreaming) (StreamingConfig, error) {
 		PollInterval:         pollInterval,
 		AutoStart:            valueOrDefaultBool(raw.AutoStart, false),
 		PrivacyMode:          mode,
+		ExcludedTitles:       titles,
+		Rules:                rules,
 	}
 
 	for _, app := range apps {
@@ -555,14 +1422,54 @@ func normalizeStreaming(raw rawStreaming) (StreamingConfig, error) {
 	return cfg, nil
 }
 
-func choosePath(raw rawWatcher) (string, error) {
-	if str, ok := valueToString(raw.Directory); ok && str != "" {
-		return str, nil
+func normalizePriority(nice *int64, ioClass string, ioLevel *int64) (ProcessPriority, error) {
+	var priority ProcessPriority
+
+	if nice != nil {
+		if *nice < -20 || *nice > 19 {
+			return ProcessPriority{}, fmt.Errorf("nice must be between -20 and 19, got %d", *nice)
+		}
+		priority.Nice = int(*nice)
+		priority.NiceSet = true
+	}
+
+	class := strings.ToLower(strings.TrimSpace(ioClass))
+	switch class {
+	case "":
+	case "idle", "best-effort", "realtime":
+		priority.IOClass = class
+	case "besteffort", "be":
+		priority.IOClass = "best-effort"
+	case "rt":
+		priority.IOClass = "realtime"
+	default:
+		return ProcessPriority{}, fmt.Errorf("ionice: unsupported class %q (use idle, best-effort or realtime)", ioClass)
+	}
+
+	priority.IOLevel = 4
+	if ioLevel != nil {
+		if priority.IOClass == "" {
+			return ProcessPriority{}, errors.New("ionice_level requires ionice")
+		}
+		if *ioLevel < 0 || *ioLevel > 7 {
+			return ProcessPriority{}, fmt.Errorf("ionice_level must be between 0 and 7, got %d", *ioLevel)
+		}
+		priority.IOLevel = int(*ioLevel)
+	}
+
+	return priority, nil
+}
+
+func choosePaths(raw rawWatcher) ([]string, error) {
+	paths, err := valueToStringSlice(raw.Path)
+	if err != nil {
+		return nil, fmt.Errorf("path: %w", err)
 	}
-	if str, ok := valueToString(raw.Path); ok && str != "" {
-		return str, nil
+	paths = continueIfEmpty(paths)
+	if len(paths) == 0 {
+		return nil, errors.New(`"path" must be provided`)
 	}
-	return "", errors.New(`"path" must be provided`)
+	return paths, nil
 }
 
 func normalizeEnv(env map[string]any) (map[string]string, error) {
@@ -583,7 +1490,7 @@ func normalizeEnv(env map[string]any) (map[string]string, error) {
 	return result, nil
 }
 
-func compileMatchers(raw rawWatcher, singleFile string) ([]matcher, error) {
+func compileMatchers(raw rawWatcher, singleFile, watchRoot string, caseSensitive bool) ([]matcher, error) {
 	patterns, err := valueToStringSlice(raw.Match)
 	if err != nil {
 		return nil, fmt.Errorf("invalid match value: %w", err)
@@ -602,7 +1509,7 @@ func compileMatchers(raw rawWatcher, singleFile string) ([]matcher, error) {
 
 	matchers := make([]matcher, 0, len(patterns))
 	for _, pattern := range continueIfEmpty(patterns) {
-		re, err := globToRegexp(pattern)
+		re, err := globToRegexp(normalizeMatchPattern(pattern, watchRoot), caseSensitive)
 		if err != nil {
 			return nil, fmt.Errorf("compile match pattern %q: %w", pattern, err)
 		}
@@ -611,6 +1518,30 @@ func compileMatchers(raw rawWatcher, singleFile string) ([]matcher, error) {
 	return matchers, nil
 }
 
+func compileIgnores(raw rawWatcher, defaults rawDefaults, watchRoot string, caseSensitive bool) ([]matcher, error) {
+	var patterns []string
+	if valueOrDefaultBool(raw.DefaultIgnores, true) {
+		patterns = append(patterns, defaultIgnorePatterns...)
+	}
+	for _, value := range []any{defaults.Ignore, raw.Ignore, raw.Ignores} {
+		more, err := valueToStringSlice(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore value: %w", err)
+		}
+		patterns = append(patterns, more...)
+	}
+
+	ignores := make([]matcher, 0, len(patterns))
+	for _, pattern := range continueIfEmpty(patterns) {
+		re, err := ignoreToRegexp(normalizeMatchPattern(pattern, watchRoot), caseSensitive)
+		if err != nil {
+			return nil, fmt.Errorf("compile ignore pattern %q: %w", pattern, err)
+		}
+		ignores = append(ignores, matcher{raw: pattern, re: re})
+	}
+	return ignores, nil
+}
+
 func continueIfEmpty(patterns []string) []string {
 	result := make([]string, 0, len(patterns))
 	for _, pattern := range patterns {
@@ -693,7 +1624,7 @@ func normalizeEvents(
 			continue
 		}
 		if _, ok := allowedEvents[event]; !ok {
-			logError("ignoring unsupported event %q", event)
+			logWarn("ignoring unsupported event %q", event)
 			continue
 		}
 		result[event] = struct{}{}
@@ -871,6 +1802,11 @@ func valueToStringSlice(value any) ([]string, error) {
 	}
 }
 
+// hasHomePrefix reports whether input starts with ~/, or also ~\ on Windows.
+func hasHomePrefix(input string) bool {
+	return strings.HasPrefix(input, "~/") || os.PathSeparator == '\\' && strings.HasPrefix(input, `~\`)
+}
+
 func resolvePath(input string) (string, error) {
 	input = strings.TrimSpace(input)
 	if input == "" {
@@ -883,7 +1819,7 @@ func resolvePath(input string) (string, error) {
 		}
 		return filepath.Clean(home), nil
 	}
-	if strings.HasPrefix(input, "~/") {
+	if hasHomePrefix(input) {
 		home, err := os.UserHomeDir()
 		if err != nil {
 			return "", fmt.Errorf("resolve home: %w", err)
@@ -903,14 +1839,33 @@ func resolvePath(input string) (string, error) {
 	return filepath.Join(home, filepath.Clean(input)), nil
 }
 
-func globToRegexp(pattern string) (*regexp.Regexp, error) {
+func globToRegexp(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
 	pattern = strings.TrimSpace(pattern)
 	if pattern == "" {
 		return nil, errors.New("empty pattern")
 	}
+	return compileGlob("^", pattern, "$", caseSensitive)
+}
 
+func ignoreToRegexp(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+	if pattern == "" {
+		return nil, errors.New("empty pattern")
+	}
+	prefix := "^"
+	if !strings.Contains(pattern, "/") {
+		prefix = "^(?:.*/)?"
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	return compileGlob(prefix, pattern, "(?:/.*)?$", caseSensitive)
+}
+
+func compileGlob(prefix, pattern, suffix string, caseSensitive bool) (*regexp.Regexp, error) {
 	var builder strings.Builder
-	builder.WriteString("^")
+	if !caseSensitive {
+		builder.WriteString("(?i)")
+	}
+	builder.WriteString(prefix)
 
 	runes := []rune(pattern)
 	for i := 0; i < len(runes); i++ {
@@ -918,8 +1873,15 @@ func globToRegexp(pattern string) (*regexp.Regexp, error) {
 		switch r {
 		case '*':
 			if i+1 < len(runes) && runes[i+1] == '*' {
-				builder.WriteString(".*")
-				i++
+				// "**/" also matches no directory at all, so **/*.go
+				// covers main.go at the top as well as cmd/main.go.
+				if i+2 < len(runes) && runes[i+2] == '/' {
+					builder.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					builder.WriteString(".*")
+					i++
+				}
 			} else {
 				builder.WriteString("[^/]*")
 			}
@@ -933,7 +1895,7 @@ func globToRegexp(pattern string) (*regexp.Regexp, error) {
 		}
 	}
 
-	builder.WriteString("$")
+	builder.WriteString(suffix)
 	return regexp.Compile(builder.String())
 }
 
@@ -967,6 +1929,9 @@ func defaultShell() string {
 	if shell := strings.TrimSpace(os.Getenv("SHELL")); shell != "" {
 		return shell
 	}
+	if runtime.GOOS == "windows" {
+		return windowsShell()
+	}
 	return "/bin/sh"
 }
 
@@ -1027,6 +1992,9 @@ func (w NormalizedWatcher) allowsEvent(event string) bool {
 }
 
 func (w NormalizedWatcher) matches(path string) bool {
+	if w.ignored(path) {
+		return false
+	}
 	if len(w.Matchers) == 0 {
 		return true
 	}
@@ -1054,7 +2022,9 @@ func streamingConfigsEqual(a, b StreamingConfig) bool {
 		a.AutoStart != b.AutoStart {
 		return false
 	}
-	return stringSlicesEqual(a.ExcludedApplications, b.ExcludedApplications)
+	return stringSlicesEqual(a.ExcludedApplications, b.ExcludedApplications) &&
+		titleExclusionsEqual(a.ExcludedTitles, b.ExcludedTitles) &&
+		streamingRulesEqual(a.Rules, b.Rules)
 }
 
 func stringSlicesEqual(a, b []string) bool {
@@ -1069,24 +2039,75 @@ func stringSlicesEqual(a, b []string) bool {
 	return true
 }
 
-func defaultServerLogPath(name string) (string, error) {
-	dir, err := defaultServersDir()
-	if err != nil {
-		return "", err
+func normalizeLogPath(value any, stateDir, kind, name string) (string, error) {
+	if str, ok := valueToString(value); ok && str != "" {
+		if err := validateLogPathTemplate(str); err != nil {
+			return "", fmt.Errorf("log_path: %w", err)
+		}
+		resolved, err := resolvePath(str)
+		if err != nil {
+			return "", fmt.Errorf("resolve log path: %w", err)
+		}
+		return resolved, nil
 	}
-	base := sanitizeFilename(name)
-	if base == "" {
-		base = "server"
+	return defaultLogPath(stateDir, kind, name)
+}
+
+func normalizePTYDimension(key string, value *int64, fallback int) (int, error) {
+	if value == nil {
+		return fallback, nil
+	}
+	if *value < 1 || *value > maxPTYDimension {
+		return 0, fmt.Errorf("%s must be between 1 and %d", key, maxPTYDimension)
 	}
-	return filepath.Join(dir, base+".log"), nil
+	return int(*value), nil
 }
 
-func defaultServersDir() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("resolve home: %w", err)
+func normalizeStdoutMode(value, fallback string) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(value))
+	if mode == "" {
+		mode = strings.ToLower(strings.TrimSpace(fallback))
+	}
+	switch mode {
+	case "":
+		return "inherit", nil
+	case "inherit", "log-only", "null":
+		return mode, nil
+	}
+	return "", fmt.Errorf("stdout must be \"inherit\", \"log-only\" or \"null\", got %q", mode)
+}
+
+func normalizeClearMode(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case bool:
+		if v {
+			return "screen", nil
+		}
+		return "", nil
+	case string:
+		switch mode := strings.ToLower(strings.TrimSpace(v)); mode {
+		case "", "false", "off":
+			return "", nil
+		case "true", "screen":
+			return "screen", nil
+		case "separator":
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("clear must be true, false or \"separator\", got %v", value)
+}
+
+func defaultLogPath(stateDir, kind, name string) (string, error) {
+	if stateDir == "" {
+		return "", errors.New("state directory is empty")
+	}
+	base := sanitizeFilename(name)
+	if base == "" {
+		base = strings.TrimSuffix(kind, "s")
 	}
-	return filepath.Join(home, ".local", "state", "ghost", "servers"), nil
+	return filepath.Join(stateDir, kind, base+".log"), nil
 }
 
 func sanitizeFilename(input string) string {
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+)
+
+const controlSocketName = "ghost.sock"
+
+type controlServer struct {
+	path     string
+	listener net.Listener
+	server   *http.Server
+	done     chan struct{}
+}
+
+type serverInfo struct {
+	Name       string            `json:"name"`
+	Command    string            `json:"command"`
+	Cwd        string            `json:"cwd"`
+	LogPath    string            `json:"log_path"`
+	State      string            `json:"state"`
+	PID        int               `json:"pid,omitempty"`
+	Health     string            `json:"health,omitempty"`
+	Ready      bool              `json:"ready"`
+	WaitingFor string            `json:"waiting_for,omitempty"`
+	StandbyPID int               `json:"standby_pid,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+
+	LastStart   *time.Time `json:"last_start,omitempty"`
+	LastResult  string     `json:"last_result,omitempty"`
+	LastTrigger string     `json:"last_trigger,omitempty"`
+	Restarts    int        `json:"restarts,omitempty"`
+}
+
+type watcherInfo struct {
+	Name    string            `json:"name"`
+	Command string            `json:"command"`
+	Root    string            `json:"root"`
+	Roots   []string          `json:"roots,omitempty"`
+	LogPath string            `json:"log_path"`
+	State   string            `json:"state"`
+	PID     int               `json:"pid,omitempty"`
+	RunID   string            `json:"run_id,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastResult  string     `json:"last_result,omitempty"`
+	LastTrigger string     `json:"last_trigger,omitempty"`
+}
+
+type triggerRequest struct {
+	Path string `json:"path,omitempty"`
+}
+
+type controlError struct {
+	Error  string             `json:"error"`
+	Errors configcheck.Errors `json:"errors,omitempty"`
+}
+
+func controlSocketPath() string {
+	return filepath.Join(currentStateConfig().Dir, controlSocketName)
+}
+
+func startControlServer(d *GhostDaemon) (*controlServer, error) {
+	path := controlSocketPath()
+	if err := os.MkdirAll(filepath.Dir(path), currentStateConfig().Permissions.DirMode); err != nil {
+		return nil, fmt.Errorf("create control socket directory: %w", err)
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("restrict control socket: %w", err)
+	}
+
+	server := &controlServer{
+		path:     path,
+		listener: listener,
+		server:   &http.Server{Handler: d.controlHandler(), ReadHeaderTimeout: 5 * time.Second},
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(server.done)
+		if err := server.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logError("control socket stopped: %v", err)
+		}
+	}()
+	return server, nil
+}
+
+func (s *controlServer) Close() {
+	if s == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = s.server.Shutdown(ctx)
+	<-s.done
+	_ = os.Remove(s.path)
+}
+
+func removeStaleSocket(path string) error {
+	if _, err := os.Lstat(path); err != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", path, 500*time.Millisecond)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("another ghost daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove stale control socket: %w", err)
+	}
+	return nil
+}
+
+func (d *GhostDaemon) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/servers", d.handleListServers)
+	mux.HandleFunc("GET /v1/watchers", d.handleListWatchers)
+	mux.HandleFunc("GET /v1/schedules", d.handleListSchedules)
+	mux.HandleFunc("POST /v1/schedules/{name}/run", func(w http.ResponseWriter, r *http.Request) {
+		if err := d.schedules.Run(r.PathValue("name")); err != nil {
+			writeControlError(w, http.StatusNotFound, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+	})
+	mux.HandleFunc("GET /v1/at", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.at.Infos())
+	})
+	mux.HandleFunc("POST /v1/at", func(w http.ResponseWriter, r *http.Request) {
+		var body atRequest
+		if !decodeOptionalJSON(w, r, &body) {
+			return
+		}
+		job, err := d.at.Add(body)
+		if err != nil {
+			writeControlError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, job.info("pending"))
+	})
+	mux.HandleFunc("DELETE /v1/at/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := d.at.Cancel(r.PathValue("id"))
+		if err != nil {
+			writeControlError(w, http.StatusNotFound, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job.info("cancelled"))
+	})
+	mux.HandleFunc("GET /v1/debug/watches", func(w http.ResponseWriter, r *http.Request) {
+		jobs := d.manager.Jobs()
+		infos := make([]watchDebugInfo, 0, len(jobs))
+		for _, job := range jobs {
+			infos = append(infos, job.debugInfo())
+		}
+		writeJSON(w, http.StatusOK, infos)
+	})
+	mux.HandleFunc("POST /v1/watchers/{name}/trigger", d.handleTriggerWatcher)
+	mux.HandleFunc("POST /v1/servers/{name}/restart", d.handleRestartServer)
+	mux.HandleFunc("POST /v1/servers/{name}/resize", func(w http.ResponseWriter, r *http.Request) {
+		var body resizeRequest
+		if !decodeOptionalJSON(w, r, &body) {
+			return
+		}
+		if err := d.resizeServer(r.PathValue("name"), body.Rows, body.Cols); err != nil {
+			writeControlError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, body)
+	})
+	mux.HandleFunc("GET /v1/servers/{name}/attach", d.handleAttach)
+	mux.HandleFunc("POST /v1/jobs/{action}", func(w http.ResponseWriter, r *http.Request) {
+		var body jobsRequest
+		if !decodeOptionalJSON(w, r, &body) {
+			return
+		}
+		result, err := d.applyJobAction(r.PathValue("action"), body)
+		if err != nil {
+			writeControlError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /v1/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.captureSnapshot())
+	})
+	mux.HandleFunc("POST /v1/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		var body runtimeSnapshot
+		if !decodeOptionalJSON(w, r, &body) {
+			return
+		}
+		result, err := d.restoreSnapshot(body)
+		if err != nil {
+			writeControlError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /v1/config/diff", func(w http.ResponseWriter, r *http.Request) {
+		diff, err := d.configDiff(r.URL.Query().Get("config"))
+		if err != nil {
+			var errs configcheck.Errors
+			errors.As(err, &errs)
+			writeJSON(w, http.StatusUnprocessableEntity, controlError{Error: err.Error(), Errors: errs})
+			return
+		}
+		writeJSON(w, http.StatusOK, diff)
+	})
+	mux.HandleFunc("GET /v1/profile", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.profileInfo())
+	})
+	mux.HandleFunc("PUT /v1/profile", func(w http.ResponseWriter, r *http.Request) {
+		var body profileRequest
+		if !decodeOptionalJSON(w, r, &body) {
+			return
+		}
+		info, err := d.switchProfile(strings.TrimSpace(body.Name))
+		if err != nil {
+			var errs configcheck.Errors
+			errors.As(err, &errs)
+			writeJSON(w, http.StatusUnprocessableEntity, controlError{Error: err.Error(), Errors: errs})
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	})
+	mux.HandleFunc("GET /v1/windows/tracker", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, trackerState{Paused: d.trackerPaused()})
+	})
+	mux.HandleFunc("POST /v1/windows/tracker/{action}", func(w http.ResponseWriter, r *http.Request) {
+		switch action := r.PathValue("action"); action {
+		case "pause", "resume":
+			writeJSON(w, http.StatusOK, d.pauseTracker(action == "pause"))
+		default:
+			writeControlError(w, http.StatusNotFound, "unknown tracker action %q", action)
+		}
+	})
+	mux.HandleFunc("POST /v1/reload", d.handleReload)
+	return mux
+}
+
+// The handlers below are served by both the control socket and the HTTP API.
+
+func (d *GhostDaemon) handleListServers(w http.ResponseWriter, r *http.Request) {
+	selector, ok := querySelector(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, d.serverInfos(selector))
+}
+
+func (d *GhostDaemon) handleListWatchers(w http.ResponseWriter, r *http.Request) {
+	selector, ok := querySelector(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, d.watcherInfos(selector))
+}
+
+func (d *GhostDaemon) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	selector, ok := querySelector(w, r)
+	if !ok {
+		return
+	}
+	jobs := d.schedules.Jobs()
+	infos := make([]scheduleInfo, 0, len(jobs))
+	for _, job := range jobs {
+		if selector.matches(job.cfg.Labels) {
+			infos = append(infos, job.info())
+		}
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (d *GhostDaemon) handleTriggerWatcher(w http.ResponseWriter, r *http.Request) {
+	var body triggerRequest
+	if !decodeOptionalJSON(w, r, &body) {
+		return
+	}
+	if err := d.manager.Trigger(r.PathValue("name"), body.Path); err != nil {
+		writeControlError(w, http.StatusNotFound, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
+}
+
+func (d *GhostDaemon) handleRestartServer(w http.ResponseWriter, r *http.Request) {
+	if err := d.restartServer(r.PathValue("name")); err != nil {
+		writeControlError(w, http.StatusNotFound, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "restarted"})
+}
+
+func (d *GhostDaemon) handleReload(w http.ResponseWriter, r *http.Request) {
+	record, err := d.reload("api")
+	if err != nil {
+		var errs configcheck.Errors
+		errors.As(err, &errs)
+		writeJSON(w, http.StatusUnprocessableEntity, controlError{Error: fmt.Sprintf("reload failed: %v", err), Errors: errs})
+		return
+	}
+	logInfo("reloaded config")
+	writeJSON(w, http.StatusOK, reloadResult{Status: "reloaded", reloadRecord: record})
+}
+
+func (d *GhostDaemon) configDiff(path string) (configDiff, error) {
+	if path == "" {
+		path = d.configPath
+	}
+	cfg, err := readConfig(path)
+	if err == nil {
+		cfg, err = d.applyProfile(cfg)
+	}
+	if err != nil {
+		return configDiff{}, err
+	}
+	diff := d.diffConfig(cfg)
+	diff.Config = path
+	return diff, nil
+}
+
+func (d *GhostDaemon) diffConfig(cfg NormalizedConfig) configDiff {
+	var applied, next []jobFields
+	for _, job := range d.manager.Jobs() {
+		applied = append(applied, fieldFingerprints(job.cfg.Name, job.cfg))
+	}
+	for _, watcher := range cfg.Watchers {
+		next = append(next, fieldFingerprints(watcher.Name, watcher))
+	}
+	diff := configDiff{Watchers: diffJobs(applied, next)}
+
+	applied, next = nil, nil
+	for _, job := range d.serverManager.Jobs() {
+		applied = append(applied, fieldFingerprints(job.cfg.Name, job.cfg))
+	}
+	for _, server := range cfg.Servers {
+		next = append(next, fieldFingerprints(server.Name, server))
+	}
+	diff.Servers = diffJobs(applied, next)
+
+	applied, next = nil, nil
+	for _, job := range d.schedules.Jobs() {
+		applied = append(applied, fieldFingerprints(job.cfg.Name, job.cfg))
+	}
+	for _, schedule := range cfg.Schedules {
+		next = append(next, fieldFingerprints(schedule.Name, schedule))
+	}
+	diff.Schedules = diffJobs(applied, next)
+	return diff
+}
+
+func (d *GhostDaemon) serverInfos(selector labelSelector) []serverInfo {
+	if d.serverManager == nil {
+		return []serverInfo{}
+	}
+	jobs := d.serverManager.Jobs()
+	infos := make([]serverInfo, 0, len(jobs))
+	for _, job := range jobs {
+		if selector.matches(job.cfg.Labels) {
+			infos = append(infos, job.info())
+		}
+	}
+	return infos
+}
+
+func (d *GhostDaemon) watcherInfos(selector labelSelector) []watcherInfo {
+	jobs := d.manager.Jobs()
+	infos := make([]watcherInfo, 0, len(jobs))
+	for _, job := range jobs {
+		if selector.matches(job.cfg.Labels) {
+			infos = append(infos, job.info())
+		}
+	}
+	return infos
+}
+
+func querySelector(w http.ResponseWriter, r *http.Request) (labelSelector, bool) {
+	selector, err := parseLabelSelector(r.URL.Query()["label"])
+	if err != nil {
+		writeControlError(w, http.StatusBadRequest, "%v", err)
+		return nil, false
+	}
+	return selector, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
+
+func writeControlError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, controlError{Error: fmt.Sprintf(format, args...)})
+}
+
+func decodeOptionalJSON(w http.ResponseWriter, r *http.Request, out any) bool {
+	if r.Body == nil || r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		writeControlError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return false
+	}
+	return true
+}
+
+func newControlClient() *http.Client {
+	path := controlSocketPath()
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+func controlRequest(method, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequest(method, "http://ghost"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := newControlClient().Do(req)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
+			return fmt.Errorf("ghost daemon is not running (no control socket at %s)", controlSocketPath())
+		}
+		return fmt.Errorf("reach ghost daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr controlError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("daemon returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -12,45 +12,112 @@ import (
 )
 
 type WatchManager struct {
+	rt   jobRuntime
 	mu   sync.Mutex
 	jobs []*watchJob
+	keys []string
 }
 
 func (m *WatchManager) Apply(cfg NormalizedConfig) {
-	oldJobs := m.swapJobs(nil)
-	for _, job := range oldJobs {
-		if job == nil {
+	m.mu.Lock()
+	oldJobs, oldKeys := m.jobs, m.keys
+	m.mu.Unlock()
+
+	existing := make(map[string]*watchJob, len(oldJobs))
+	for i, job := range oldJobs {
+		if job != nil {
+			existing[oldKeys[i]] = job
+		}
+	}
+
+	names := make([]string, len(cfg.Watchers))
+	for i, watcher := range cfg.Watchers {
+		names[i] = watcher.Name
+	}
+	keys := uniqueJobKeys(names)
+
+	var summary reloadSummary
+	kept := make(map[string]*watchJob, len(cfg.Watchers))
+	for i, watcher := range cfg.Watchers {
+		job, ok := existing[keys[i]]
+		if !ok {
 			continue
 		}
+		if watcherFingerprint(job.cfg) == watcherFingerprint(watcher) {
+			kept[keys[i]] = job
+			delete(existing, keys[i])
+		}
+	}
+
+	for key, job := range existing {
 		if err := job.Close(); err != nil {
 			logError("failed to stop watcher: %v", err)
 		}
+		if !containsString(keys, key) {
+			summary.removed++
+		}
 	}
 
 	newJobs := make([]*watchJob, 0, len(cfg.Watchers))
-	for _, watcher := range cfg.Watchers {
-		job, err := newWatchJob(watcher)
+	newKeys := make([]string, 0, len(cfg.Watchers))
+	for i, watcher := range cfg.Watchers {
+		if job, ok := kept[keys[i]]; ok {
+			summary.unchanged++
+			newJobs = append(newJobs, job)
+			newKeys = append(newKeys, keys[i])
+			continue
+		}
+		job, err := newWatchJob(watcher, m.rt)
 		if err != nil {
 			logError("failed to initialize watcher %q: %v", watcher.Name, err)
 			continue
 		}
+		if _, replaced := existing[keys[i]]; replaced {
+			summary.restarted++
+		} else {
+			summary.added++
+		}
 		newJobs = append(newJobs, job)
+		newKeys = append(newKeys, keys[i])
 	}
 
-	m.swapJobs(newJobs)
-	logInfo("loaded %d watcher(s)", len(newJobs))
+	m.mu.Lock()
+	m.jobs, m.keys = newJobs, newKeys
+	m.mu.Unlock()
+	logInfo("loaded %d watcher(s) (%s)", len(newJobs), summary)
+}
+
+func (m *WatchManager) Trigger(name, path string) error {
+	for _, job := range m.Jobs() {
+		if job.cfg.Name == name {
+			return job.Trigger(path)
+		}
+	}
+	return fmt.Errorf("unknown watcher %q", name)
+}
+
+func (m *WatchManager) Jobs() []*watchJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*watchJob(nil), m.jobs...)
 }
 
 func (m *WatchManager) StopAll() {
 	jobs := m.swapJobs(nil)
+	var wg sync.WaitGroup
 	for _, job := range jobs {
 		if job == nil {
 			continue
 		}
-		if err := job.Close(); err != nil {
-			logError("failed to stop watcher: %v", err)
-		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := job.Close(); err != nil {
+				logError("failed to stop watcher: %v", err)
+			}
+		}()
 	}
+	wg.Wait()
 }
 
 func (m *WatchManager) swapJobs(jobs []*watchJob) []*watchJob {
@@ -58,45 +125,102 @@ func (m *WatchManager) swapJobs(jobs []*watchJob) []*watchJob {
 	defer m.mu.Unlock()
 	old := m.jobs
 	m.jobs = jobs
+	m.keys = nil
 	return old
 }
 
 type GhostDaemon struct {
-	configPath    string
-	manager       *WatchManager
-	serverManager *ServerManager
-	streaming     *StreamingController
-	windowTracker *WindowTracker
-	watcher       *fsnotify.Watcher
-	watcherDone   chan struct{}
-	reloadMu      sync.Mutex
-	configFiles   map[string]struct{}
-	configDirs    map[string]struct{}
-	debounceTime  time.Duration
+	configPath      string
+	manager         *WatchManager
+	serverManager   *ServerManager
+	schedules       *ScheduleManager
+	at              *AtScheduler
+	streaming       *StreamingController
+	windowTracker   *WindowTracker
+	watcher         *fsnotify.Watcher
+	watcherDone     chan struct{}
+	control         *controlServer
+	api             *APIController
+	reloadMu        sync.Mutex
+	configMu        sync.Mutex
+	configFiles     map[string]struct{}
+	configDirs      map[string]struct{}
+	includes        []string
+	includedFiles   []string
+	envFiles        []string
+	watcherSets     []WatcherSetConfig
+	profile         string
+	profileChosen   bool
+	profiles        profileInfo
+	shutdownTimeout time.Duration
+	debounceTime    time.Duration
+	stateMigrated   bool
+	janitor         logJanitor
+	disk            *diskGuard
+	heartbeat       *heartbeatMonitor
 }
 
 func NewGhostDaemon(configPath string) *GhostDaemon {
-	return &GhostDaemon{
+	d := &GhostDaemon{
 		configPath:    configPath,
 		manager:       &WatchManager{},
 		serverManager: &ServerManager{},
+		schedules:     &ScheduleManager{},
+		at:            &AtScheduler{},
 		streaming:     NewStreamingController(),
 		windowTracker: NewWindowTracker(),
 		debounceTime:  150 * time.Millisecond,
 	}
+	d.heartbeat = newHeartbeatMonitor(d.probeLiveness, d.stopJobs)
+	d.disk = newDiskGuard(d.windowTracker)
+	return d
 }
 
 func (d *GhostDaemon) Start() error {
+	d.api = NewAPIController(d.apiHandler())
 	if _, err := os.Stat(d.configPath); err != nil {
 		return fmt.Errorf("config file not found at %s", d.configPath)
 	}
-	if err := d.reloadConfig(); err != nil {
+	if err := d.reloadConfig("startup"); err != nil {
+		return err
+	}
+	d.at.Start()
+	control, err := startControlServer(d)
+	if err != nil {
+		logWarn("control socket unavailable: %v", err)
+	} else {
+		d.control = control
+	}
+	if err := d.startConfigWatcher(); err != nil {
 		return err
 	}
-	return d.startConfigWatcher()
+	d.heartbeat.Ready()
+	return nil
+}
+
+// probeLiveness returns once the daemon's locks are free. Work holding
+// reloadMu counts as alive rather than waited for: a reload that stops
+// servers with a long kill_timeout_ms or waits on depends_on can take minutes.
+func (d *GhostDaemon) probeLiveness() {
+	if d.reloadMu.TryLock() {
+		d.reloadMu.Unlock()
+	}
+	d.configMu.Lock()
+	d.configMu.Unlock()
 }
 
 func (d *GhostDaemon) Stop() {
+	d.heartbeat.Stop()
+	if d.control != nil {
+		d.control.Close()
+		d.control = nil
+	}
+	if d.api != nil {
+		d.api.Stop()
+	}
+	d.saveSnapshot()
+	d.janitor.Stop()
+	d.disk.Stop()
 	if d.watcher != nil {
 		_ = d.watcher.Close()
 		if d.watcherDone != nil {
@@ -105,29 +229,164 @@ func (d *GhostDaemon) Stop() {
 		}
 		d.watcher = nil
 	}
-	d.manager.StopAll()
+	d.stopJobs()
+	flushJobHistory()
+	flushAuditLog()
+	webhooks.Stop()
+	closeSystemLog()
+}
+
+func (d *GhostDaemon) stopJobs() {
+	watchers, schedules := d.manager.Jobs(), d.schedules.Jobs()
+	abort := make(chan struct{})
+	var wg sync.WaitGroup
+	stop := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
+	stop(d.manager.StopAll)
+	stop(d.schedules.StopAll)
+	stop(d.at.Stop)
 	if d.serverManager != nil {
-		d.serverManager.StopAll()
+		stop(func() { d.serverManager.stopAll(abort) })
 	}
 	if d.streaming != nil {
-		d.streaming.Stop()
+		stop(d.streaming.Stop)
 	}
 	if d.windowTracker != nil {
-		d.windowTracker.Stop()
+		stop(d.windowTracker.Stop)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	d.configMu.Lock()
+	timeout := d.shutdownTimeout
+	d.configMu.Unlock()
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+	logWarn("jobs still running %s after shutdown began (shutdown_timeout_ms); killing them", timeout)
+	close(abort)
+	for _, job := range watchers {
+		if job != nil {
+			job.kill()
+		}
+	}
+	for _, job := range schedules {
+		job.kill()
+	}
+	d.at.kill()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		logWarn("giving up waiting for jobs to exit")
 	}
 }
 
-func (d *GhostDaemon) reloadConfig() error {
+func (d *GhostDaemon) restartServer(name string) error {
 	d.reloadMu.Lock()
 	defer d.reloadMu.Unlock()
+	if d.serverManager == nil {
+		return fmt.Errorf("unknown server %q", name)
+	}
+	return d.serverManager.Restart(name)
+}
+
+func (d *GhostDaemon) resizeServer(name string, rows, cols int) error {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+	if d.serverManager == nil {
+		return fmt.Errorf("unknown server %q", name)
+	}
+	return d.serverManager.Resize(name, rows, cols)
+}
+
+func (d *GhostDaemon) logStatus() {
+	for _, job := range d.manager.Jobs() {
+		logInfo("status: watcher %s %s", job.cfg.Name, job.state())
+	}
+	if d.serverManager != nil {
+		for _, job := range d.serverManager.Jobs() {
+			logInfo("status: server %s %s", job.cfg.Name, job.state())
+		}
+	}
+	for _, job := range d.schedules.Jobs() {
+		logInfo("status: schedule %s %s", job.cfg.Name, job.state())
+	}
+	for _, info := range d.at.Infos() {
+		logInfo("status: at %s %s, %s at %s", info.ID, info.Command, info.State, info.At.Local().Format(time.DateTime))
+	}
+}
+
+func (d *GhostDaemon) reloadConfig(reason string) error {
+	_, err := d.reload(reason)
+	return err
+}
+
+func (d *GhostDaemon) reloadNow(reason string) {
+	if err := d.reloadConfig(reason); err != nil {
+		logError("failed to reload config: %v", err)
+	} else {
+		logInfo("reloaded config")
+	}
+}
+
+func (d *GhostDaemon) reload(reason string) (record reloadRecord, err error) {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+	record = newReloadRecord(reason, d.configPath)
+	var included []string
+	defer func() {
+		if err != nil {
+			notifyWebhooks(webhookEvent{Event: "config.reload_failed", Message: err.Error()})
+			record.Error = err.Error()
+		}
+		record.OK = err == nil
+		record.Hash = configHash(d.configPath, included)
+		recordReload(record)
+	}()
 
 	cfg, err := readConfig(d.configPath)
 	if err != nil {
-		return err
+		return record, err
+	}
+	included = cfg.IncludedFiles
+	defaultProfile := cfg.Profile
+	// The janitor and disk guard see every job, so a profile that leaves one
+	// out doesn't make its logs look orphaned.
+	full := cfg
+	// The saved snapshot may pick the profile, so it is restored first.
+	if !d.stateMigrated {
+		setStateConfig(cfg.State)
+		migrateLegacyState(cfg.State, cfg.WindowTracker)
+		d.stateMigrated = true
+		d.restoreSavedSnapshot(sortedKeys(cfg.Profiles))
+	}
+	if cfg, err = d.applyProfile(cfg); err != nil {
+		return record, err
+	}
+	record.Profile = cfg.Profile
+	record.setDiff(d.diffConfig(cfg))
+	setLogSettings(cfg.Log)
+	setStateConfig(cfg.State)
+	if err := applyLogging(cfg.Logging); err != nil {
+		logError("%v", err)
 	}
+	webhooks.Apply(cfg.Webhooks)
 	if d.windowTracker != nil {
 		if err := d.windowTracker.Apply(cfg.WindowTracker); err != nil {
-			return err
+			return record, err
 		}
 	}
 	if d.serverManager != nil {
@@ -135,11 +394,101 @@ func (d *GhostDaemon) reloadConfig() error {
 	}
 	if d.streaming != nil {
 		if err := d.streaming.Apply(cfg.Streaming); err != nil {
-			return err
+			return record, err
 		}
 	}
 	d.manager.Apply(cfg)
-	return nil
+	d.schedules.Apply(cfg.Schedules)
+	d.janitor.Apply(full)
+	d.disk.Apply(full)
+	d.heartbeat.Apply(cfg)
+	if d.api != nil {
+		if err := d.api.Apply(cfg.API); err != nil {
+			logError("%v", err)
+		}
+	}
+
+	d.configMu.Lock()
+	d.includes, d.includedFiles = cfg.Includes, cfg.IncludedFiles
+	d.envFiles = cfg.envFiles()
+	d.watcherSets = cfg.WatcherSets
+	d.shutdownTimeout = cfg.ShutdownTimeout
+	if cfg.Profile != d.profiles.Active {
+		if cfg.Profile != "" {
+			logInfo("using profile %q: %d watcher(s), %d server(s), %d schedule(s)", cfg.Profile, len(cfg.Watchers), len(cfg.Servers), len(cfg.Schedules))
+		} else if d.profiles.Active != "" {
+			logInfo("profile %q turned off, running every job", d.profiles.Active)
+		}
+	}
+	d.profiles = profileInfo{Active: cfg.Profile, Default: defaultProfile, Profiles: sortedKeys(cfg.Profiles)}
+	d.configMu.Unlock()
+	if d.watcher != nil {
+		if err := d.watchConfigPaths(); err != nil {
+			logWarn("%v", err)
+		}
+	}
+	return record, nil
+}
+
+func (d *GhostDaemon) applyProfile(cfg NormalizedConfig) (NormalizedConfig, error) {
+	d.configMu.Lock()
+	name, chosen := d.profile, d.profileChosen
+	d.configMu.Unlock()
+	if !chosen {
+		name = cfg.Profile
+	}
+	cfg, err := cfg.withProfile(name)
+	cfg.Profile = name
+	return cfg, err
+}
+
+func (d *GhostDaemon) profileInfo() profileInfo {
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+	return d.profiles
+}
+
+func (d *GhostDaemon) switchProfile(name string) (profileInfo, error) {
+	d.configMu.Lock()
+	if name != "" && !containsString(d.profiles.Profiles, name) {
+		err := unknownProfileError(name, d.profiles.Profiles)
+		d.configMu.Unlock()
+		return profileInfo{}, err
+	}
+	previous, chosen := d.profile, d.profileChosen
+	d.profile, d.profileChosen = name, true
+	d.configMu.Unlock()
+
+	if err := d.reloadConfig("profile"); err != nil {
+		d.configMu.Lock()
+		d.profile, d.profileChosen = previous, chosen
+		d.configMu.Unlock()
+		return profileInfo{}, err
+	}
+	return d.profileInfo(), nil
+}
+
+// trackerPauseReason is why the window tracker is suspended after ghost
+// windows pause.
+const trackerPauseReason = "paused with ghost windows pause"
+
+type trackerState struct {
+	Paused bool `json:"paused"`
+}
+
+func (d *GhostDaemon) trackerPaused() bool {
+	return d.windowTracker != nil && d.windowTracker.Suspended(trackerPauseReason)
+}
+
+func (d *GhostDaemon) pauseTracker(paused bool) trackerState {
+	if d.windowTracker != nil {
+		if paused {
+			d.windowTracker.Suspend(trackerPauseReason)
+		} else {
+			d.windowTracker.Resume(trackerPauseReason)
+		}
+	}
+	return trackerState{Paused: d.trackerPaused()}
 }
 
 func (d *GhostDaemon) startConfigWatcher() error {
@@ -150,16 +499,31 @@ func (d *GhostDaemon) startConfigWatcher() error {
 
 	d.watcher = watcher
 	d.watcherDone = make(chan struct{})
-	d.configFiles = make(map[string]struct{})
-	d.configDirs = make(map[string]struct{})
+	if err := d.watchConfigPaths(); err != nil {
+		_ = watcher.Close()
+		return err
+	}
 
-	paths := d.collectConfigPaths()
-	for _, path := range paths {
-		if path == "" {
+	go d.runConfigWatcher()
+	return nil
+}
+
+func (d *GhostDaemon) watchConfigPaths() error {
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+	if d.configFiles == nil {
+		d.configFiles = make(map[string]struct{})
+		d.configDirs = make(map[string]struct{})
+	}
+
+	for _, path := range d.collectConfigPaths() {
+		if _, ok := d.configFiles[path]; ok {
+			continue
+		}
+		if _, ok := d.configDirs[path]; ok {
 			continue
 		}
-		if err := watcher.Add(path); err != nil {
-			_ = watcher.Close()
+		if err := d.watcher.Add(path); err != nil {
 			return fmt.Errorf("watch config path %s: %w", path, err)
 		}
 		info, err := os.Stat(path)
@@ -169,8 +533,6 @@ func (d *GhostDaemon) startConfigWatcher() error {
 			d.configFiles[path] = struct{}{}
 		}
 	}
-
-	go d.runConfigWatcher()
 	return nil
 }
 
@@ -211,11 +573,7 @@ func (d *GhostDaemon) runConfigWatcher() {
 			}
 			timer = nil
 			timerCh = nil
-			if err := d.reloadConfig(); err != nil {
-				logError("failed to reload config: %v", err)
-			} else {
-				logInfo("reloaded config")
-			}
+			d.reloadNow("file")
 		}
 	}
 }
@@ -224,6 +582,8 @@ func (d *GhostDaemon) shouldReloadForEvent(event fsnotify.Event) bool {
 	if event.Name == "" {
 		return false
 	}
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
 	if _, ok := d.configFiles[event.Name]; ok {
 		return true
 	}
@@ -233,8 +593,25 @@ func (d *GhostDaemon) shouldReloadForEvent(event fsnotify.Event) bool {
 		if target == event.Name {
 			return true
 		}
+		for _, pattern := range d.includes {
+			if matched, _ := filepath.Match(pattern, event.Name); matched {
+				return true
+			}
+		}
+		if containsString(d.envFiles, event.Name) {
+			return true
+		}
+	}
+	removed := event.Op&(fsnotify.Remove|fsnotify.Rename) != 0
+	if removed {
+		delete(d.configDirs, event.Name)
+	}
+	for _, set := range d.watcherSets {
+		if set.affectedBy(event.Name, removed) {
+			return true
+		}
 	}
-	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+	if removed {
 		base := filepath.Base(event.Name)
 		if base == filepath.Base(d.configPath) {
 			return true
@@ -253,6 +630,28 @@ func (d *GhostDaemon) collectConfigPaths() []string {
 		appendUniquePath(&paths, filepath.Dir(resolved))
 	}
 
+	for _, pattern := range d.includes {
+		if dir := filepath.Dir(pattern); !hasGlobMeta(dir) {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				appendUniquePath(&paths, dir)
+			}
+		}
+	}
+	for _, file := range d.includedFiles {
+		appendUniquePath(&paths, file)
+		appendUniquePath(&paths, filepath.Dir(file))
+	}
+	for _, file := range d.envFiles {
+		appendUniquePath(&paths, file)
+		appendUniquePath(&paths, filepath.Dir(file))
+	}
+	for _, set := range d.watcherSets {
+		appendUniquePath(&paths, set.Root)
+		for _, dir := range set.candidates() {
+			appendUniquePath(&paths, dir)
+		}
+	}
+
 	return paths
 }
 
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+func runDebugCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: ghost debug watches [name...] [-json]")
+	}
+	switch args[0] {
+	case "watches":
+		return runDebugWatches(args[1:])
+	default:
+		return fmt.Errorf("unknown debug topic %q (available: watches)", args[0])
+	}
+}
+
+func runDebugWatches(args []string) error {
+	fs := flag.NewFlagSet("debug watches", flag.ContinueOnError)
+	raw := fs.Bool("json", false, "print the raw JSON report")
+	names, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var infos []watchDebugInfo
+	if err := controlRequest("GET", "/v1/debug/watches", nil, &infos); err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		byName := make(map[string]watchDebugInfo, len(infos))
+		for _, info := range infos {
+			byName[info.Name] = info
+		}
+		selected := make([]watchDebugInfo, 0, len(names))
+		for _, name := range names {
+			info, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("unknown watcher %q", name)
+			}
+			selected = append(selected, info)
+		}
+		infos = selected
+	}
+
+	if *raw {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(infos)
+	}
+	if len(infos) == 0 {
+		fmt.Println("no watchers are configured")
+		return nil
+	}
+	for i, info := range infos {
+		if i > 0 {
+			fmt.Println()
+		}
+		printWatchDebugInfo(info)
+	}
+	return nil
+}
+
+func printWatchDebugInfo(info watchDebugInfo) {
+	fmt.Printf("watcher %s (%s)\n", info.Name, info.State)
+
+	root := info.Root
+	switch {
+	case !info.RootExists:
+		root += " (MISSING — no events arrive until it exists again and ghost restarts)"
+	case info.RootReplaced:
+		root += " (replaced since the watch started — restart ghost to watch the new directory)"
+	}
+	fmt.Printf("  %-14s %s\n", "root", root)
+
+	kind := info.Backend
+	switch info.Backend {
+	case "inotify":
+		kind = "inotify, one per directory"
+	case "kqueue":
+		kind = "kqueue, one per file and directory"
+	case "fsevents", "ReadDirectoryChangesW":
+		kind = info.Backend + ", recursive"
+	case "poll":
+		kind = "polling, no kernel watches"
+	case "ssh":
+		kind = "polling over ssh"
+	case "s3", "gcs":
+		kind = "polling the bucket listing"
+	}
+	fmt.Printf("  %-14s %d (%s) on %s\n", "subscriptions", info.Subscriptions, kind, strings.Join(info.Patterns, ", "))
+
+	matchers := "(everything)"
+	if len(info.Matchers) > 0 {
+		matchers = strings.Join(info.Matchers, ", ")
+	}
+	fmt.Printf("  %-14s %s\n", "matchers", matchers)
+	if len(info.Ignores) > 0 {
+		fmt.Printf("  %-14s %s\n", "ignores", strings.Join(info.Ignores, ", "))
+	}
+
+	fmt.Printf("  %-14s %d seen: %d matched, %d no matching pattern, %d ignored, %d event type not watched, %d outside root, %d during warm-up, %d while paused\n",
+		"events", info.Events, info.Matched, info.Unmatched, info.Ignored, info.Filtered, info.OutsideRoot, info.Warmup, info.Paused)
+	fmt.Printf("  %-14s %s\n", "last event", formatWatchEvent(info.LastEvent))
+	fmt.Printf("  %-14s %s\n", "last match", formatWatchEvent(info.LastMatch))
+	if info.Error != "" {
+		fmt.Printf("  %-14s %s\n", "error", info.Error)
+	}
+	if info.RootExists && info.Events == 0 {
+		fmt.Printf("  %-14s %s\n", "hint", "no events received since the watch started; check that files are saved under the root")
+	}
+}
+
+func formatWatchEvent(event *watchEventInfo) string {
+	if event == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s %s %s → %s (%s ago)",
+		event.Time.Local().Format("15:04:05"),
+		strings.Join(event.Events, ","),
+		event.Path,
+		event.Outcome,
+		time.Since(event.Time).Round(time.Second))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var jobChangeMarks = map[string]string{
+	"added":     "+",
+	"removed":   "-",
+	"restarted": "~",
+	"unchanged": "=",
+}
+
+func runDiffCommand(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	raw := fs.Bool("json", false, "print the raw JSON report")
+	all := fs.Bool("a", false, "also list jobs that would keep running untouched")
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) > 1 {
+		return errors.New("usage: ghost diff [config] [-a] [-json]")
+	}
+
+	endpoint := "/v1/config/diff"
+	if len(paths) == 1 {
+		configPath, err := resolvePath(paths[0])
+		if err != nil {
+			return err
+		}
+		endpoint += "?config=" + url.QueryEscape(configPath)
+	}
+	var diff configDiff
+	if err := controlRequest("GET", endpoint, nil, &diff); err != nil {
+		return err
+	}
+	if *raw {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+
+	changed := false
+	sections := []struct {
+		kind    string
+		changes []jobChange
+	}{
+		{"watchers", diff.Watchers},
+		{"servers", diff.Servers},
+		{"schedules", diff.Schedules},
+	}
+	for _, section := range sections {
+		var summary reloadSummary
+		var lines []string
+		for _, change := range section.changes {
+			switch change.Change {
+			case "added":
+				summary.added++
+			case "removed":
+				summary.removed++
+			case "restarted":
+				summary.restarted++
+			default:
+				summary.unchanged++
+				if !*all {
+					continue
+				}
+			}
+			line := fmt.Sprintf("  %s %s", jobChangeMarks[change.Change], change.Name)
+			if len(change.Fields) > 0 {
+				line += " (" + strings.Join(change.Fields, ", ") + ")"
+			}
+			lines = append(lines, line)
+		}
+		if len(section.changes) == 0 {
+			continue
+		}
+		if summary.added+summary.removed+summary.restarted > 0 {
+			changed = true
+		}
+		fmt.Printf("%s: %s\n", section.kind, summary)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	if !changed {
+		fmt.Printf("%s matches the running config; reloading would not start, stop or restart anything\n", diff.Config)
+	}
+	return nil
+}
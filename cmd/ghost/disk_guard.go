@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const diskCheckInterval = time.Minute
+
+// diskLowReason is why the window tracker is suspended while space is low.
+const diskLowReason = "low disk space"
+
+var diskLog = componentLogger("disk", "disk")
+
+// diskGuard watches free space on the volumes holding ghost's logs and
+// databases. Below gc.min_free_mb it compresses or deletes old logs, pauses
+// the window tracker and sends a disk.low webhook; once space is back it
+// resumes the tracker and sends disk.ok.
+type diskGuard struct {
+	tracker *WindowTracker
+
+	mu     sync.Mutex
+	cfg    NormalizedConfig
+	timer  *time.Timer
+	low    bool
+	failed map[string]bool
+}
+
+func newDiskGuard(tracker *WindowTracker) *diskGuard {
+	return &diskGuard{tracker: tracker, failed: make(map[string]bool)}
+}
+
+func (g *diskGuard) Apply(cfg NormalizedConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cfg = cfg
+	if cfg.GC.MinFree == 0 {
+		if g.timer != nil {
+			g.timer.Stop()
+			g.timer = nil
+		}
+		if g.low {
+			g.low = false
+			g.tracker.Resume(diskLowReason)
+		}
+		return
+	}
+	if g.timer == nil {
+		g.timer = time.AfterFunc(0, g.run)
+	}
+}
+
+func (g *diskGuard) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+}
+
+func (g *diskGuard) run() {
+	g.mu.Lock()
+	cfg, wasLow := g.cfg, g.low
+	g.mu.Unlock()
+
+	threshold := cfg.GC.MinFree
+	if wasLow {
+		// Don't flap around the threshold: recover only with some margin.
+		threshold += threshold / 10
+	}
+	var short []string
+	for _, dir := range diskGuardPaths(cfg) {
+		free, err := diskFree(dir)
+		if err != nil {
+			g.mu.Lock()
+			first := !g.failed[dir]
+			g.failed[dir] = true
+			g.mu.Unlock()
+			if first {
+				diskLog.Warn("cannot check free space on %s: %v", dir, err)
+			}
+			continue
+		}
+		if free < threshold {
+			short = append(short, fmt.Sprintf("%s (%s free)", dir, formatSize(int64(free))))
+		}
+	}
+
+	switch {
+	case len(short) > 0 && !wasLow:
+		message := fmt.Sprintf("low disk space: %s, below %s", strings.Join(short, ", "), formatSize(int64(cfg.GC.MinFree)))
+		diskLog.Error("%s; compressing old logs and pausing the window tracker", message)
+		g.setLow(true)
+		g.tracker.Suspend(diskLowReason)
+		notifyWebhooks(webhookEvent{Event: "disk.low", Message: message})
+		shrinkLogs(cfg)
+	case len(short) > 0:
+		shrinkLogs(cfg)
+	case wasLow:
+		diskLog.Info("disk space recovered; resuming the window tracker")
+		g.setLow(false)
+		g.tracker.Resume(diskLowReason)
+		notifyWebhooks(webhookEvent{Event: "disk.ok"})
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.timer != nil {
+		g.timer.Reset(diskCheckInterval)
+	}
+}
+
+func (g *diskGuard) setLow(low bool) {
+	g.mu.Lock()
+	g.low = low
+	g.mu.Unlock()
+}
+
+// shrinkLogs is the janitor's pass with no retention: every log a job isn't
+// currently writing is gzipped into the archive, or deleted when
+// gc.stale_logs = "delete".
+func shrinkLogs(cfg NormalizedConfig) {
+	archive := cfg.GC.StaleLogs != "delete"
+	for _, item := range collectGarbage(cfg, 0, time.Now()) {
+		if !item.Log {
+			continue
+		}
+		dest, err := removeGarbage(item, archive, cfg.State)
+		switch {
+		case err != nil:
+			diskLog.Error("shrink %s: %v", item.Path, err)
+		case dest != "":
+			diskLog.Info("compressed %s to %s", item.Path, dest)
+		default:
+			diskLog.Info("deleted %s", item.Path)
+		}
+	}
+}
+
+// diskGuardPaths lists the directories whose volumes the guard checks: the
+// state directory, every job's log directory and the tracker database's.
+// Directories that don't exist yet are checked through their nearest parent.
+func diskGuardPaths(cfg NormalizedConfig) []string {
+	candidates := []string{cfg.State.Dir}
+	for _, watcher := range cfg.Watchers {
+		if watcher.LogPath != "" {
+			candidates = append(candidates, filepath.Dir(watcher.LogPath))
+		}
+	}
+	for _, server := range cfg.Servers {
+		if server.LogPath != "" {
+			candidates = append(candidates, filepath.Dir(server.LogPath))
+		}
+	}
+	if cfg.WindowTracker.active() {
+		candidates = append(candidates, filepath.Dir(cfg.WindowTracker.DBPath))
+	}
+
+	seen := make(map[string]bool, len(candidates))
+	var paths []string
+	for _, dir := range candidates {
+		dir = existingAncestor(dir)
+		if dir == "" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		paths = append(paths, dir)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func existingAncestor(dir string) string {
+	for dir != "" {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+	return ""
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !openbsd && !windows
+
+package main
+
+import "errors"
+
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("free space is not available on this platform")
+}
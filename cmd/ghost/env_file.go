@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveEnvFiles turns an env_file value (a path or a list of paths) into
+// absolute paths. Relative paths are taken from the job's working directory,
+// which is where a project keeps its .env.
+func resolveEnvFiles(value any, cwd string) ([]string, error) {
+	entries, err := valueToStringSlice(value)
+	if err != nil {
+		return nil, fmt.Errorf("env_file: %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !filepath.IsAbs(entry) && entry != "~" && !hasHomePrefix(entry) {
+			entry = filepath.Join(cwd, entry)
+		}
+		path, err := resolvePath(entry)
+		if err != nil {
+			return nil, fmt.Errorf("env_file %q: %w", entry, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// loadEnvFiles reads each dotenv file in order. Later files override earlier
+// ones, and a file can reference variables set by the files before it.
+func loadEnvFiles(paths []string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("env_file: %w", err)
+		}
+		if err := parseEnvFile(data, env); err != nil {
+			return nil, fmt.Errorf("env_file %s: %w", path, err)
+		}
+	}
+	return env, nil
+}
+
+// mergeEnv layers the TOML env table over values loaded from env files.
+func mergeEnv(fromFiles, env map[string]string) map[string]string {
+	if len(fromFiles) == 0 {
+		return env
+	}
+	merged := make(map[string]string, len(fromFiles)+len(env))
+	for key, value := range fromFiles {
+		merged[key] = value
+	}
+	for key, value := range env {
+		merged[key] = value
+	}
+	return merged
+}
+
+// envFiles lists every env_file the config's jobs read, so the daemon can
+// reload when one of them changes.
+func (cfg NormalizedConfig) envFiles() []string {
+	var files []string
+	for _, watcher := range cfg.Watchers {
+		for _, file := range watcher.EnvFiles {
+			appendUniquePath(&files, file)
+		}
+	}
+	for _, server := range cfg.Servers {
+		for _, file := range server.EnvFiles {
+			appendUniquePath(&files, file)
+		}
+	}
+	return files
+}
+
+// parseEnvFile parses dotenv syntax into env: KEY=value lines with an
+// optional "export " prefix, # comments, single-quoted literals, and
+// double-quoted or bare values where $VAR and ${VAR} expand from earlier
+// lines and then the daemon's environment. Double-quoted values may span
+// lines and understand \n, \t, \" and \\.
+func parseEnvFile(data []byte, env map[string]string) error {
+	lookup := func(name string) string {
+		if value, ok := env[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		start := lineNo
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validEnvName(key) {
+			return fmt.Errorf("line %d: expected KEY=value", start)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated single quote", start)
+			}
+			env[key] = value[1 : end+1]
+		case strings.HasPrefix(value, `"`):
+			body := value[1:]
+			for closingQuote(body) < 0 {
+				if !scanner.Scan() {
+					return fmt.Errorf("line %d: unterminated double quote", start)
+				}
+				lineNo++
+				body += "\n" + scanner.Text()
+			}
+			env[key] = expandEnvValue(unescapeDoubleQuoted(body[:closingQuote(body)]), lookup)
+		default:
+			if index := strings.Index(value, " #"); index >= 0 {
+				value = value[:index]
+			} else if index := strings.Index(value, "\t#"); index >= 0 {
+				value = value[:index]
+			}
+			env[key] = expandEnvValue(strings.TrimSpace(value), lookup)
+		}
+	}
+	return scanner.Err()
+}
+
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		case r == '.' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func closingQuote(body string) int {
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDoubleQuoted(value string) string {
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			out.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case '"', '\\':
+			out.WriteByte(value[i])
+		case '$':
+			// Keep the escape so expandEnvValue leaves a literal dollar.
+			out.WriteString(`\$`)
+		default:
+			out.WriteByte('\\')
+			out.WriteByte(value[i])
+		}
+	}
+	return out.String()
+}
+
+// expandEnvValue substitutes $VAR and ${VAR}; ${VAR:-default} falls back when
+// VAR is unset or empty, and \$ is a literal dollar sign.
+func expandEnvValue(value string, lookup func(string) string) string {
+	if !strings.Contains(value, "$") {
+		return value
+	}
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '\\' && i+1 < len(value) && value[i+1] == '$' {
+			out.WriteByte('$')
+			i++
+			continue
+		}
+		if c != '$' || i+1 == len(value) {
+			out.WriteByte(c)
+			continue
+		}
+		if value[i+1] == '{' {
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 {
+				out.WriteString(value[i:])
+				break
+			}
+			expr := value[i+2 : i+2+end]
+			name, fallback, hasFallback := strings.Cut(expr, ":-")
+			resolved := lookup(name)
+			if resolved == "" && hasFallback {
+				resolved = fallback
+			}
+			out.WriteString(resolved)
+			i += end + 2
+			continue
+		}
+		j := i + 1
+		for j < len(value) && (value[j] == '_' || value[j] >= 'A' && value[j] <= 'Z' || value[j] >= 'a' && value[j] <= 'z' || j > i+1 && value[j] >= '0' && value[j] <= '9') {
+			j++
+		}
+		if j == i+1 {
+			out.WriteByte(c)
+			continue
+		}
+		out.WriteString(lookup(value[i+1 : j]))
+		i = j - 1
+	}
+	return out.String()
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFeedInterval = 15 * time.Minute
+	feedTimeout         = 30 * time.Second
+	feedMaxSize         = 16 << 20
+	feedSeenLimit       = 1000
+)
+
+type rawFeedTrigger struct {
+	URL   string `toml:"url"`
+	Title string `toml:"title"`
+}
+
+type FeedTrigger struct {
+	URL   string
+	Title string
+
+	title *regexp.Regexp
+}
+
+type feedEntry struct {
+	Feed      string `json:"feed"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Link      string `json:"link"`
+	Published string `json:"published,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	Enclosure string `json:"enclosure,omitempty"`
+}
+
+type feedDocument struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Description string `xml:"description"`
+	Enclosure   struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+}
+
+type atomEntry struct {
+	Title     string `xml:"title"`
+	ID        string `xml:"id"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Summary   string `xml:"summary"`
+	Links     []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+}
+
+type feedPoller struct {
+	etag         string
+	lastModified string
+}
+
+func normalizeFeedTrigger(raw *rawFeedTrigger) (*FeedTrigger, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	trigger := &FeedTrigger{URL: strings.TrimSpace(raw.URL), Title: raw.Title}
+	parsed, err := url.Parse(trigger.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("feed.url: %q is not an http(s) URL", raw.URL)
+	}
+	if strings.TrimSpace(raw.Title) != "" {
+		if trigger.title, err = regexp.Compile("(?i)" + raw.Title); err != nil {
+			return nil, fmt.Errorf("feed.title: %w", err)
+		}
+	}
+	return trigger, nil
+}
+
+func (t *FeedTrigger) describe() string {
+	return "feed " + t.URL
+}
+
+func (t *FeedTrigger) matches(entry feedEntry) bool {
+	return t.title == nil || t.title.MatchString(entry.Title)
+}
+
+func (e feedEntry) env() map[string]string {
+	return map[string]string{
+		"GHOST_FEED_URL":       e.Feed,
+		"GHOST_FEED_ID":        e.ID,
+		"GHOST_FEED_TITLE":     e.Title,
+		"GHOST_FEED_LINK":      e.Link,
+		"GHOST_FEED_PUBLISHED": e.Published,
+		"GHOST_FEED_ENCLOSURE": e.Enclosure,
+	}
+}
+
+func (e feedEntry) String() string {
+	return "new entry: " + e.Title
+}
+
+func (p feedPoller) fetch(t *FeedTrigger) ([]feedEntry, feedPoller, error) {
+	req, err := http.NewRequest(http.MethodGet, t.URL, nil)
+	if err != nil {
+		return nil, p, err
+	}
+	req.Header.Set("User-Agent", "ghost")
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	if p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	if p.lastModified != "" {
+		req.Header.Set("If-Modified-Since", p.lastModified)
+	}
+	resp, err := (&http.Client{Timeout: feedTimeout}).Do(req)
+	if err != nil {
+		return nil, p, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, p, nil
+	}
+	if resp.StatusCode >= 300 {
+		return nil, p, errors.New(resp.Status)
+	}
+	entries, err := parseFeed(io.LimitReader(resp.Body, feedMaxSize), t.URL)
+	if err != nil {
+		return nil, p, err
+	}
+	return entries, feedPoller{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}, nil
+}
+
+func parseFeed(r io.Reader, feedURL string) ([]feedEntry, error) {
+	var doc feedDocument
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse feed: %w", err)
+	}
+
+	var entries []feedEntry
+	for _, item := range append(doc.Channel.Items, doc.Items...) {
+		entry := feedEntry{
+			Feed:      feedURL,
+			ID:        strings.TrimSpace(item.GUID),
+			Title:     strings.TrimSpace(item.Title),
+			Link:      strings.TrimSpace(item.Link),
+			Published: strings.TrimSpace(item.PubDate),
+			Summary:   strings.TrimSpace(item.Description),
+			Enclosure: strings.TrimSpace(item.Enclosure.URL),
+		}
+		if entry.Published == "" {
+			entry.Published = strings.TrimSpace(item.Date)
+		}
+		entries = append(entries, entry)
+	}
+	for _, item := range doc.Entries {
+		entry := feedEntry{
+			Feed:      feedURL,
+			ID:        strings.TrimSpace(item.ID),
+			Title:     strings.TrimSpace(item.Title),
+			Published: strings.TrimSpace(item.Published),
+			Summary:   strings.TrimSpace(item.Summary),
+		}
+		if entry.Published == "" {
+			entry.Published = strings.TrimSpace(item.Updated)
+		}
+		for _, link := range item.Links {
+			switch link.Rel {
+			case "", "alternate":
+				if entry.Link == "" {
+					entry.Link = link.Href
+				}
+			case "enclosure":
+				entry.Enclosure = link.Href
+			}
+		}
+		entries = append(entries, entry)
+	}
+	for i := range entries {
+		if entries[i].ID == "" {
+			entries[i].ID = entries[i].Link
+		}
+		if entries[i].ID == "" {
+			entries[i].ID = entries[i].Title + "|" + entries[i].Published
+		}
+	}
+	return entries, nil
+}
+
+func feedSeenPath(name string) string {
+	base := sanitizeFilename(name)
+	if base == "" {
+		base = "schedule"
+	}
+	return filepath.Join(currentStateConfig().Dir, "cache", base+".feed")
+}
+
+func loadFeedSeen(name string) ([]string, bool) {
+	file, err := os.Open(feedSeenPath(name))
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+	var seen []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			seen = append(seen, line)
+		}
+	}
+	return seen, true
+}
+
+func storeFeedSeen(name string, seen []string) error {
+	if len(seen) > feedSeenLimit {
+		seen = seen[len(seen)-feedSeenLimit:]
+	}
+	path := feedSeenPath(name)
+	perms := currentStateConfig().Permissions
+	if err := os.MkdirAll(filepath.Dir(path), perms.DirMode); err != nil {
+		return fmt.Errorf("create cache directory: %w", err)
+	}
+	return os.WriteFile(path, []byte(strings.Join(seen, "\n")+"\n"), perms.FileMode)
+}
+
+func (j *scheduleJob) checkFeed() {
+	j.checkMu.Lock()
+	defer j.checkMu.Unlock()
+
+	trigger := j.cfg.Feed
+	entries, validators, err := j.feed.fetch(trigger)
+	if err != nil {
+		j.mu.Lock()
+		j.history.LastResult = "feed check failed"
+		j.mu.Unlock()
+		j.log().Error("%s: %v", trigger.describe(), err)
+		return
+	}
+	if entries == nil {
+		return
+	}
+
+	seen, known := loadFeedSeen(j.cfg.Name)
+	seenSet := make(map[string]struct{}, len(seen))
+	for _, id := range seen {
+		seenSet[id] = struct{}{}
+	}
+	var fresh []feedEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if _, ok := seenSet[entries[i].ID]; ok {
+			continue
+		}
+		seenSet[entries[i].ID] = struct{}{}
+		fresh = append(fresh, entries[i])
+	}
+	if !known {
+		for _, entry := range fresh {
+			seen = append(seen, entry.ID)
+		}
+		j.log().Info("watching %s (%d existing entries)", trigger.describe(), len(fresh))
+		if err := storeFeedSeen(j.cfg.Name, seen); err != nil {
+			j.log().Error("save feed position: %v", err)
+		}
+		j.feed = validators
+		return
+	}
+
+	for _, entry := range fresh {
+		if trigger.matches(entry) {
+			if !j.waitIdle() {
+				return
+			}
+			payload, _ := json.Marshal(entry)
+			j.launchWith(entry.String(), entry.env(), append(payload, '\n'))
+		} else {
+			j.log().Debug("skipping %s", entry)
+		}
+		seen = append(seen, entry.ID)
+		if err := storeFeedSeen(j.cfg.Name, seen); err != nil {
+			j.log().Error("save feed position: %v", err)
+		}
+	}
+	j.feed = validators
+}
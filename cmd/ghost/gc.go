@@ -0,0 +1,291 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultGCRetention = 14 * 24 * time.Hour
+	gcInterval         = 6 * time.Hour
+	gcTempAge          = time.Hour
+	gcArchiveDir       = "archive"
+)
+
+var gcLog = componentLogger("gc", "gc")
+
+type rawGC struct {
+	StaleLogs     string `toml:"stale_logs"`
+	RetentionDays *int64 `toml:"retention_days"`
+	MinFreeMB     *int64 `toml:"min_free_mb"`
+}
+
+type GCConfig struct {
+	StaleLogs string
+	Retention time.Duration
+	MinFree   uint64
+}
+
+type gcItem struct {
+	Path   string
+	Reason string
+	Size   int64
+	Log    bool
+}
+
+func normalizeGC(raw rawGC) (GCConfig, error) {
+	cfg := GCConfig{StaleLogs: strings.ToLower(strings.TrimSpace(raw.StaleLogs)), Retention: defaultGCRetention}
+	switch cfg.StaleLogs {
+	case "", "keep":
+		cfg.StaleLogs = ""
+	case "delete", "archive":
+	default:
+		return GCConfig{}, fmt.Errorf("gc.stale_logs: must be \"keep\", \"delete\" or \"archive\", got %q", raw.StaleLogs)
+	}
+	if raw.RetentionDays != nil {
+		if *raw.RetentionDays < 0 {
+			return GCConfig{}, errors.New("gc.retention_days: must not be negative")
+		}
+		cfg.Retention = time.Duration(*raw.RetentionDays) * 24 * time.Hour
+	}
+	if raw.MinFreeMB != nil {
+		if *raw.MinFreeMB < 0 {
+			return GCConfig{}, errors.New("gc.min_free_mb: must not be negative")
+		}
+		cfg.MinFree = uint64(*raw.MinFreeMB) << 20
+	}
+	return cfg, nil
+}
+
+func collectGarbage(cfg NormalizedConfig, retention time.Duration, now time.Time) []gcItem {
+	cutoff := now.Add(-retention)
+	days := formatRetention(retention)
+	var items []gcItem
+	add := func(path, reason string, info os.FileInfo, log bool) {
+		items = append(items, gcItem{Path: path, Reason: reason, Size: info.Size(), Log: log})
+	}
+
+	owned := make(map[string]bool)
+	var rotated []logTemplate
+	for _, watcher := range cfg.Watchers {
+		rotated = ownLogPath(owned, rotated, watcher.LogPath, watcher.Name)
+	}
+	for _, server := range cfg.Servers {
+		rotated = ownLogPath(owned, rotated, server.LogPath, server.Name)
+	}
+
+	for _, kind := range []string{"servers", "watchers"} {
+		dir := filepath.Join(cfg.State.Dir, kind)
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".log") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if owned[path] || matchesLogTemplate(rotated, path) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || info.ModTime().After(cutoff) {
+				continue
+			}
+			reason := fmt.Sprintf("no %s named %s in the config, unused for %s", strings.TrimSuffix(kind, "s"), strings.TrimSuffix(entry.Name(), ".log"), days)
+			add(path, reason, info, true)
+		}
+	}
+
+	for _, template := range rotated {
+		current := currentLogPath(template.path, template.name)
+		matches, _ := filepath.Glob(template.glob)
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if path == current || err != nil || info.IsDir() || info.ModTime().After(cutoff) {
+				continue
+			}
+			add(path, fmt.Sprintf("old log of %s, unused for %s", template.name, days), info, true)
+		}
+	}
+
+	watchers := make(map[string]bool, len(cfg.Watchers))
+	for _, watcher := range cfg.Watchers {
+		watchers[filepath.Base(cacheFilePath(watcher.Name))] = true
+	}
+	cacheDir := filepath.Join(cfg.State.Dir, "cache")
+	entries, _ := os.ReadDir(cacheDir)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sha256") || watchers[entry.Name()] {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			add(filepath.Join(cacheDir, entry.Name()), fmt.Sprintf("cached hash of watcher %s, no longer in the config", strings.TrimSuffix(entry.Name(), ".sha256")), info, false)
+		}
+	}
+
+	entries, _ = os.ReadDir(cfg.State.Dir)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "."+snapshotFileName+".") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && now.Sub(info.ModTime()) > gcTempAge {
+			add(filepath.Join(cfg.State.Dir, entry.Name()), "leftover temporary file from an interrupted snapshot", info, false)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	return items
+}
+
+type logTemplate struct {
+	path string
+	name string
+	glob string
+}
+
+func ownLogPath(owned map[string]bool, rotated []logTemplate, path, name string) []logTemplate {
+	if path == "" {
+		return rotated
+	}
+	if !logPathPlaceholder.MatchString(path) {
+		owned[path] = true
+		return rotated
+	}
+	return append(rotated, logTemplate{path: path, name: name, glob: logPathGlob(path, name)})
+}
+
+func matchesLogTemplate(templates []logTemplate, path string) bool {
+	for _, template := range templates {
+		if ok, _ := filepath.Match(template.glob, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func formatRetention(retention time.Duration) string {
+	days := int(retention / (24 * time.Hour))
+	if days == 1 {
+		return "1 day"
+	}
+	if days > 1 {
+		return fmt.Sprintf("%d days", days)
+	}
+	return retention.String()
+}
+
+func removeGarbage(item gcItem, archive bool, state StateConfig) (string, error) {
+	if !archive || !item.Log {
+		if err := os.Remove(item.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		return "", nil
+	}
+	rel, err := filepath.Rel(state.Dir, item.Path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Join(filepath.Base(filepath.Dir(item.Path)), filepath.Base(item.Path))
+	}
+	dest := filepath.Join(state.Dir, gcArchiveDir, rel+".gz")
+	if err := gzipFile(item.Path, dest, state.Permissions); err != nil {
+		return "", err
+	}
+	if err := os.Remove(item.Path); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+func gzipFile(src, dest string, perms FilePermissions) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dest), perms.DirMode); err != nil {
+		return fmt.Errorf("create archive directory: %w", err)
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_APPEND|os.O_WRONLY, perms.FileMode)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(src)
+	if info, err := in.Stat(); err == nil {
+		zw.ModTime = info.ModTime()
+	}
+	if _, err := io.Copy(zw, in); err != nil {
+		zw.Close()
+		out.Close()
+		return fmt.Errorf("archive %s: %w", src, err)
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return fmt.Errorf("archive %s: %w", src, err)
+	}
+	return out.Close()
+}
+
+type logJanitor struct {
+	mu    sync.Mutex
+	cfg   NormalizedConfig
+	timer *time.Timer
+}
+
+func (j *logJanitor) Apply(cfg NormalizedConfig) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cfg = cfg
+	if cfg.GC.StaleLogs == "" {
+		if j.timer != nil {
+			j.timer.Stop()
+			j.timer = nil
+		}
+		return
+	}
+	if j.timer == nil {
+		j.timer = time.AfterFunc(0, j.run)
+	}
+}
+
+func (j *logJanitor) Stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.timer != nil {
+		j.timer.Stop()
+		j.timer = nil
+	}
+}
+
+func (j *logJanitor) run() {
+	j.mu.Lock()
+	cfg := j.cfg
+	j.mu.Unlock()
+
+	archive := cfg.GC.StaleLogs == "archive"
+	for _, item := range collectGarbage(cfg, cfg.GC.Retention, time.Now()) {
+		if !item.Log {
+			continue
+		}
+		dest, err := removeGarbage(item, archive, cfg.State)
+		switch {
+		case err != nil:
+			gcLog.Error("clean up %s: %v", item.Path, err)
+		case dest != "":
+			gcLog.Info("archived %s to %s (%s)", item.Path, dest, item.Reason)
+		default:
+			gcLog.Info("deleted %s (%s)", item.Path, item.Reason)
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.timer != nil {
+		j.timer.Reset(gcInterval)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+func runGCCommand(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "list what would be removed without touching anything")
+	archive := fs.Bool("archive", false, "gzip logs into <state dir>/archive instead of deleting them (default with gc.stale_logs = \"archive\")")
+	days := fs.Int("days", -1, "remove logs unused for this many days (default: gc.retention_days, or 14)")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("usage: ghost gc [-dry-run] [-archive] [-days N]")
+	}
+
+	configPath, err := determineConfigPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := readConfig(configPath)
+	if err != nil {
+		return err
+	}
+	setStateConfig(cfg.State)
+	retention := cfg.GC.Retention
+	if *days >= 0 {
+		retention = time.Duration(*days) * 24 * time.Hour
+	}
+	if cfg.GC.StaleLogs == "archive" {
+		*archive = true
+	}
+
+	items := collectGarbage(cfg, retention, time.Now())
+	if len(items) == 0 {
+		fmt.Println("nothing to clean up")
+		return nil
+	}
+	var freed int64
+	failed := 0
+	for _, item := range items {
+		if *dryRun {
+			verb := "would delete"
+			if *archive && item.Log {
+				verb = "would archive"
+			}
+			fmt.Printf("%s %s (%s)\n", verb, item.Path, item.Reason)
+			freed += item.Size
+			continue
+		}
+		dest, err := removeGarbage(item, *archive, cfg.State)
+		switch {
+		case err != nil:
+			fmt.Printf("failed %s: %v\n", item.Path, err)
+			failed++
+			continue
+		case dest != "":
+			fmt.Printf("archived %s to %s (%s)\n", item.Path, dest, item.Reason)
+		default:
+			fmt.Printf("deleted %s (%s)\n", item.Path, item.Reason)
+		}
+		freed += item.Size
+	}
+	if *dryRun {
+		fmt.Printf("would free %s\n", formatSize(freed))
+	} else {
+		fmt.Printf("freed %s\n", formatSize(freed))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d item(s) could not be removed", failed)
+	}
+	return nil
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, suffix := float64(bytes)/unit, "KiB"
+	for _, next := range []string{"MiB", "GiB", "TiB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type gitignoreRule struct {
+	base    string
+	above   string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+type gitignoreMatcher struct {
+	caseSensitive bool
+	rules         []gitignoreRule
+	files         int
+}
+
+func loadGitignore(root string, caseSensitive bool) (*gitignoreMatcher, error) {
+	m := &gitignoreMatcher{caseSensitive: caseSensitive}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return m, nil
+	}
+	if err := m.loadAncestors(root); err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		if rel != "" && m.ignored(rel, true) {
+			return filepath.SkipDir
+		}
+		return m.loadFile(filepath.Join(path, ".gitignore"), rel, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *gitignoreMatcher) loadAncestors(root string) error {
+	var dirs []string
+	repo := ""
+	for dir := root; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			repo = dir
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+		dirs = append(dirs, dir)
+	}
+	if repo == "" {
+		return nil
+	}
+	above := func(dir string) string {
+		rel, _ := filepath.Rel(dir, root)
+		if rel == "." {
+			return ""
+		}
+		return filepath.ToSlash(rel)
+	}
+	if err := m.loadFile(filepath.Join(repo, ".git", "info", "exclude"), "", above(repo)); err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := m.loadFile(filepath.Join(dirs[i], ".gitignore"), "", above(dirs[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *gitignoreMatcher) loadFile(path, base, above string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.files++
+	for number, line := range strings.Split(string(data), "\n") {
+		rule, ok, err := parseGitignoreLine(line, m.caseSensitive)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, number+1, err)
+		}
+		if ok {
+			rule.base, rule.above = base, above
+			m.rules = append(m.rules, rule)
+		}
+	}
+	return nil
+}
+
+func (m *gitignoreMatcher) ignored(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		if part == ".git" {
+			return true
+		}
+		if m.excluded(strings.Join(parts[:i+1], "/"), isDir || i < len(parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *gitignoreMatcher) excluded(path string, isDir bool) bool {
+	excluded := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		sub := path
+		switch {
+		case rule.above != "":
+			sub = rule.above + "/" + path
+		case rule.base != "":
+			if !strings.HasPrefix(path, rule.base+"/") {
+				continue
+			}
+			sub = path[len(rule.base)+1:]
+		}
+		if rule.re.MatchString(sub) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+func parseGitignoreLine(line string, caseSensitive bool) (gitignoreRule, bool, error) {
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitignoreRule{}, false, nil
+	}
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+
+	var rule gitignoreRule
+	switch {
+	case strings.HasPrefix(line, "!"):
+		rule.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return gitignoreRule{}, false, nil
+	}
+
+	prefix := "^(?:.*/)?"
+	if strings.Contains(line, "/") {
+		prefix = "^"
+		line = strings.TrimPrefix(line, "/")
+	}
+	re, err := gitignoreRegexp(prefix, line, caseSensitive)
+	if err != nil {
+		return gitignoreRule{}, false, err
+	}
+	rule.re = re
+	return rule, true, nil
+}
+
+func gitignoreRegexp(prefix, pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	var builder strings.Builder
+	if !caseSensitive {
+		builder.WriteString("(?i)")
+	}
+	builder.WriteString(prefix)
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				if i+2 < len(runes) && runes[i+2] == '/' {
+					builder.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					builder.WriteString(".*")
+					i++
+				}
+			} else {
+				builder.WriteString("[^/]*")
+			}
+		case '?':
+			builder.WriteString("[^/]")
+		case '[':
+			end := -1
+			for k := i + 2; k < len(runes); k++ {
+				if runes[k] == ']' {
+					end = k
+					break
+				}
+			}
+			if end < 0 {
+				builder.WriteString(`\[`)
+				continue
+			}
+			builder.WriteRune('[')
+			for j, c := range runes[i+1 : end] {
+				switch {
+				case j == 0 && (c == '!' || c == '^'):
+					builder.WriteRune('^')
+				case c == '\\' || c == '[' || c == ']':
+					builder.WriteRune('\\')
+					builder.WriteRune(c)
+				default:
+					builder.WriteRune(c)
+				}
+			}
+			builder.WriteRune(']')
+			i = end
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				r = runes[i]
+			}
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	builder.WriteString("$")
+	return regexp.Compile(builder.String())
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type watchGroup struct {
+	Name     string
+	Matchers []matcher
+}
+
+func compileGroups(raw map[string]any, watchRoot string, caseSensitive bool) ([]watchGroup, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := make([]watchGroup, 0, len(names))
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("groups: group name must not be empty")
+		}
+		patterns, err := valueToStringSlice(raw[name])
+		if err != nil {
+			return nil, fmt.Errorf("groups.%s: %w", name, err)
+		}
+		if len(patterns) == 0 {
+			return nil, fmt.Errorf("groups.%s: at least one pattern is required", name)
+		}
+		group := watchGroup{Name: name}
+		for _, pattern := range patterns {
+			re, err := globToRegexp(normalizeMatchPattern(pattern, watchRoot), caseSensitive)
+			if err != nil {
+				return nil, fmt.Errorf("groups.%s: compile pattern %q: %w", name, pattern, err)
+			}
+			group.Matchers = append(group.Matchers, matcher{raw: pattern, re: re})
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func (w NormalizedWatcher) groupsFor(rel string) []string {
+	if len(w.Groups) > 0 {
+		var names []string
+		for _, group := range w.Groups {
+			for _, matcher := range group.Matchers {
+				if matcher.matches(rel) {
+					names = append(names, group.Name)
+					break
+				}
+			}
+		}
+		return names
+	}
+
+	dir := path.Dir(rel)
+	if dir == "." || dir == "" {
+		return nil
+	}
+	segments := strings.Split(dir, "/")
+	if len(segments) < w.GroupDepth {
+		return nil
+	}
+	return []string{strings.Join(segments[:w.GroupDepth], "/")}
+}
+
+func (w NormalizedWatcher) allGroups() []string {
+	if len(w.Groups) > 0 {
+		names := make([]string, 0, len(w.Groups))
+		for _, group := range w.Groups {
+			names = append(names, group.Name)
+		}
+		return names
+	}
+
+	var names []string
+	var walk func(rel string, depth int)
+	walk = func(rel string, depth int) {
+		entries, err := os.ReadDir(filepath.Join(w.WatchRoot, filepath.FromSlash(rel)))
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			child := path.Join(rel, entry.Name())
+			if w.ignored(child) {
+				continue
+			}
+			if depth == w.GroupDepth {
+				names = append(names, child)
+				continue
+			}
+			walk(child, depth+1)
+		}
+	}
+	walk("", 1)
+	return names
+}
+
+func (w NormalizedWatcher) ignored(rel string) bool {
+	for _, ignore := range w.Ignores {
+		if ignore.matches(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w NormalizedWatcher) assignGroups(triggers []Trigger) []Trigger {
+	result := make([]Trigger, 0, len(triggers))
+	for _, trigger := range triggers {
+		if trigger.Group != "" {
+			result = append(result, trigger)
+			continue
+		}
+		var groups []string
+		if trigger.Path == "" {
+			groups = w.allGroups()
+		} else {
+			groups = w.groupsFor(trigger.Path)
+		}
+		for _, group := range groups {
+			grouped := trigger
+			grouped.Group = group
+			result = append(result, grouped)
+		}
+	}
+	return result
+}
+
+func splitGroupTriggers(triggers []Trigger) ([]Trigger, []Trigger) {
+	if len(triggers) == 0 {
+		return triggers, nil
+	}
+	first := triggers[0].Group
+	var current, rest []Trigger
+	for _, trigger := range triggers {
+		if trigger.Group == first {
+			current = append(current, trigger)
+		} else {
+			rest = append(rest, trigger)
+		}
+	}
+	return current, rest
+}
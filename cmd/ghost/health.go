@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHealthInterval  = 10 * time.Second
+	defaultHealthTimeout   = 2 * time.Second
+	defaultHealthThreshold = 3
+)
+
+type rawHealthCheck struct {
+	Type             string `toml:"type"`
+	Address          string `toml:"address"`
+	URL              string `toml:"url"`
+	Command          any    `toml:"command"`
+	ExpectStatus     *int64 `toml:"expect_status"`
+	IntervalMs       *int64 `toml:"interval_ms"`
+	TimeoutMs        *int64 `toml:"timeout_ms"`
+	FailureThreshold *int64 `toml:"failure_threshold"`
+	StartPeriodMs    *int64 `toml:"start_period_ms"`
+}
+
+type HealthCheck struct {
+	Type           string
+	Address        string
+	URL            string
+	Command        []string
+	CommandDisplay string
+	ExpectStatus   int
+	Interval       time.Duration
+	Timeout        time.Duration
+	Threshold      int
+	StartPeriod    time.Duration
+	RunAs          *RunAs // the server's user, for command probes
+}
+
+func normalizeHealthCheck(raw *rawHealthCheck) (*HealthCheck, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	check := &HealthCheck{
+		Type:        strings.ToLower(strings.TrimSpace(raw.Type)),
+		Interval:    chooseDuration(raw.IntervalMs, nil, defaultHealthInterval),
+		Timeout:     chooseDuration(raw.TimeoutMs, nil, defaultHealthTimeout),
+		Threshold:   defaultHealthThreshold,
+		StartPeriod: chooseDuration(raw.StartPeriodMs, nil, 0),
+	}
+	if check.Type == "" {
+		switch {
+		case strings.TrimSpace(raw.URL) != "":
+			check.Type = "http"
+		case strings.TrimSpace(raw.Address) != "":
+			check.Type = "tcp"
+		case raw.Command != nil:
+			check.Type = "command"
+		}
+	}
+	if check.Interval <= 0 {
+		return nil, errors.New("health_check.interval_ms must be positive")
+	}
+	if check.Timeout <= 0 {
+		return nil, errors.New("health_check.timeout_ms must be positive")
+	}
+	if raw.FailureThreshold != nil {
+		if *raw.FailureThreshold < 1 {
+			return nil, errors.New("health_check.failure_threshold must be at least 1")
+		}
+		check.Threshold = int(*raw.FailureThreshold)
+	}
+
+	switch check.Type {
+	case "tcp":
+		address := strings.TrimSpace(raw.Address)
+		if address == "" {
+			return nil, errors.New("health_check.address is required for tcp probes")
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, fmt.Errorf("health_check.address: %w", err)
+		}
+		check.Address = address
+	case "http":
+		target := strings.TrimSpace(raw.URL)
+		if target == "" {
+			return nil, errors.New("health_check.url is required for http probes")
+		}
+		parsed, err := url.Parse(target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("health_check.url: %q is not an http(s) URL", target)
+		}
+		check.URL = target
+		if raw.ExpectStatus != nil {
+			if *raw.ExpectStatus < 100 || *raw.ExpectStatus > 599 {
+				return nil, fmt.Errorf("health_check.expect_status: %d is not an HTTP status", *raw.ExpectStatus)
+			}
+			check.ExpectStatus = int(*raw.ExpectStatus)
+		}
+	case "command":
+		parts, display, err := parseCommandSpec(raw.Command, nil)
+		if err != nil {
+			return nil, fmt.Errorf("health_check.command: %w", err)
+		}
+		if len(parts) == 0 {
+			return nil, errors.New("health_check.command must not be empty")
+		}
+		check.Command = parts
+		check.CommandDisplay = joinDisplayParts(display)
+	case "":
+		return nil, errors.New("health_check.type is required (tcp, http or command)")
+	default:
+		return nil, fmt.Errorf("health_check.type: unsupported value %q (use tcp, http or command)", check.Type)
+	}
+
+	return check, nil
+}
+
+func (h *HealthCheck) String() string {
+	switch h.Type {
+	case "tcp":
+		return "tcp " + h.Address
+	case "http":
+		return "http " + h.URL
+	default:
+		return "command " + h.CommandDisplay
+	}
+}
+
+func (h *HealthCheck) probe(ctx context.Context, cwd string, env map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	switch h.Type {
+	case "tcp":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", h.Address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "http":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if h.ExpectStatus != 0 {
+			if resp.StatusCode != h.ExpectStatus {
+				return fmt.Errorf("status %d (want %d)", resp.StatusCode, h.ExpectStatus)
+			}
+			return nil
+		}
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	default:
+		cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+		cmd.Dir = cwd
+		cmd.Env = buildEnvList(h.RunAs.env(env))
+		setRunAs(cmd, h.RunAs)
+		output, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %s", h.Timeout)
+		}
+		if err != nil {
+			if detail := strings.TrimSpace(string(output)); detail != "" {
+				return fmt.Errorf("%w: %s", err, lastLine(detail))
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+func lastLine(text string) string {
+	if index := strings.LastIndexByte(text, '\n'); index >= 0 {
+		return text[index+1:]
+	}
+	return text
+}
+
+func (j *serverJob) monitorHealth(cmd *exec.Cmd) func() {
+	check := j.cfg.HealthCheck
+	if check == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		j.runHealthChecks(ctx, check, cmd)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (j *serverJob) runHealthChecks(ctx context.Context, check *HealthCheck, cmd *exec.Cmd) {
+	j.setHealth("starting")
+	if check.StartPeriod > 0 {
+		timer := j.clock.NewTimer(check.StartPeriod)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+	}
+
+	ticker := j.clock.NewTicker(check.Interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		err := check.probe(ctx, j.cfg.Cwd, j.cfg.Env)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			if failures > 0 {
+				j.log().Info("health check recovered after %d failure(s)", failures)
+			}
+			failures = 0
+			j.setHealth("healthy")
+			if j.cfg.ReadyPattern == "" {
+				j.markReady("health check passed")
+			}
+		} else {
+			failures++
+			j.log().Warn("health check failed (%d/%d): %s: %v", failures, check.Threshold, check, j.cfg.Secrets.redactString(err.Error()))
+			if failures >= check.Threshold {
+				j.restartUnhealthy(cmd, err)
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+func (j *serverJob) restartUnhealthy(cmd *exec.Cmd, cause error) {
+	j.mu.Lock()
+	if j.closed || j.cmd != cmd {
+		j.mu.Unlock()
+		return
+	}
+	j.health = "unhealthy"
+	j.healthRestart = true
+	j.stopProcessLocked()
+	j.mu.Unlock()
+
+	j.log().Error("unhealthy after %d failed check(s), restarting", j.cfg.HealthCheck.Threshold)
+	entry := auditEntry{
+		Event: "unhealthy",
+		Kind:  "server",
+		Job:   j.cfg.Name,
+		Argv:  j.cfg.Secrets.redactArgs(cmd.Args),
+		Cwd:   cmd.Dir,
+		Cause: j.cfg.Secrets.redactString(cause.Error()),
+	}
+	if cmd.Process != nil {
+		entry.PID = cmd.Process.Pid
+	}
+	writeAuditEntry(entry)
+}
+
+func (j *serverJob) setHealth(state string) {
+	j.mu.Lock()
+	j.health = state
+	j.mu.Unlock()
+}
+
+func (j *serverJob) takeHealthRestart() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	restart := j.healthRestart
+	j.healthRestart = false
+	return restart
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHeartbeatInterval = 10 * time.Second
+	heartbeatFileName        = "heartbeat"
+	maxLivenessWait          = 5 * time.Second
+	unresponsiveWarnAfter    = 30 * time.Second
+	watchdogStopGrace        = 5 * time.Second
+)
+
+var heartbeatLog = componentLogger("heartbeat", "heartbeat:")
+
+type heartbeatMonitor struct {
+	probe    func()
+	stopJobs func()
+
+	mu        sync.Mutex
+	interval  time.Duration
+	watchdog  time.Duration
+	shutdown  time.Duration
+	path      string
+	perms     FilePermissions
+	reset     chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	pending   chan struct{}
+	lastAlive time.Time
+	lastBeat  time.Time
+	stuck     bool
+
+	notifySocket   string
+	notifyInterval time.Duration
+	notifyFailed   bool
+	readySent      bool
+	stopping       bool
+}
+
+// newHeartbeatMonitor checks the daemon with probe; stopJobs is what the
+// watchdog runs before exiting, so no job outlives the daemon.
+func newHeartbeatMonitor(probe, stopJobs func()) *heartbeatMonitor {
+	m := &heartbeatMonitor{probe: probe, stopJobs: stopJobs}
+	m.notifySocket, m.notifyInterval = systemdNotifyEnv()
+	return m
+}
+
+func systemdNotifyEnv() (string, time.Duration) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	watchdogPID, watchdogUsec := os.Getenv("WATCHDOG_PID"), os.Getenv("WATCHDOG_USEC")
+	for _, key := range []string{"NOTIFY_SOCKET", "WATCHDOG_PID", "WATCHDOG_USEC"} {
+		_ = os.Unsetenv(key)
+	}
+	if socket == "" {
+		return "", 0
+	}
+	if watchdogPID != "" && watchdogPID != strconv.Itoa(os.Getpid()) {
+		return socket, 0
+	}
+	usec, err := strconv.ParseInt(watchdogUsec, 10, 64)
+	if err != nil || usec <= 0 {
+		return socket, 0
+	}
+	return socket, time.Duration(usec) * time.Microsecond / 2
+}
+
+func (m *heartbeatMonitor) Apply(cfg NormalizedConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path := filepath.Join(cfg.State.Dir, heartbeatFileName)
+	if m.path != "" && (m.path != path || cfg.HeartbeatInterval == 0) {
+		_ = os.Remove(m.path)
+	}
+	m.interval, m.watchdog, m.perms = cfg.HeartbeatInterval, cfg.WatchdogTimeout, cfg.State.Permissions
+	m.shutdown = cfg.ShutdownTimeout
+	m.path = ""
+	if m.interval > 0 {
+		m.path = path
+	}
+	if m.period() == 0 {
+		m.stopLocked()
+		return
+	}
+	if m.stop == nil {
+		m.stop, m.done, m.reset = make(chan struct{}), make(chan struct{}), make(chan struct{}, 1)
+		m.lastAlive, m.lastBeat = time.Now(), time.Time{}
+		go m.run(m.stop, m.done, m.reset)
+		return
+	}
+	select {
+	case m.reset <- struct{}{}:
+	default:
+	}
+}
+
+func (m *heartbeatMonitor) period() time.Duration {
+	var period time.Duration
+	for _, candidate := range []time.Duration{m.interval, m.notifyInterval, m.watchdog / 4} {
+		if candidate > 0 && (period == 0 || candidate < period) {
+			period = candidate
+		}
+	}
+	if period > 0 && period < 100*time.Millisecond {
+		period = 100 * time.Millisecond
+	}
+	return period
+}
+
+func (m *heartbeatMonitor) Ready() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.readySent {
+		m.readySent = true
+		m.notifyLocked("READY=1")
+	}
+}
+
+func (m *heartbeatMonitor) Stop() {
+	m.mu.Lock()
+	if !m.stopping {
+		m.stopping = true
+		m.notifyLocked("STOPPING=1")
+	}
+	done := m.done
+	m.stopLocked()
+	if m.path != "" {
+		_ = os.Remove(m.path)
+		m.path = ""
+	}
+	m.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (m *heartbeatMonitor) stopLocked() {
+	if m.stop != nil {
+		close(m.stop)
+		m.stop, m.done, m.reset = nil, nil, nil
+	}
+}
+
+func (m *heartbeatMonitor) run(stop, done, reset chan struct{}) {
+	defer close(done)
+	m.mu.Lock()
+	period := m.period()
+	m.mu.Unlock()
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	m.tick()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-reset:
+			m.mu.Lock()
+			period = m.period()
+			m.mu.Unlock()
+			ticker.Reset(period)
+			m.tick()
+		case <-ticker.C:
+			m.tick()
+		}
+	}
+}
+
+func (m *heartbeatMonitor) tick() {
+	m.mu.Lock()
+	wait := min(m.period(), maxLivenessWait)
+	m.mu.Unlock()
+	alive := m.responsive(wait)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if !alive {
+		hung := now.Sub(m.lastAlive)
+		if !m.stuck && hung >= unresponsiveWarnAfter {
+			m.stuck = true
+			heartbeatLog.Warn("daemon unresponsive for %s; holding back the heartbeat", hung.Round(time.Second))
+		}
+		if m.watchdog > 0 && hung >= m.watchdog {
+			heartbeatLog.Error("daemon unresponsive for %s (watchdog_timeout_ms); stopping jobs and exiting so the service manager restarts it", hung.Round(time.Second))
+			_ = pprof.Lookup("goroutine").WriteTo(os.Stderr, 1)
+			m.stopJobsLocked()
+			os.Exit(1)
+		}
+		return
+	}
+	if m.stuck {
+		m.stuck = false
+		heartbeatLog.Info("daemon responsive again after %s", now.Sub(m.lastAlive).Round(time.Second))
+	}
+	m.lastAlive = now
+	if m.notifyInterval > 0 {
+		m.notifyLocked("WATCHDOG=1")
+	}
+	if m.path != "" && now.Sub(m.lastBeat) >= m.interval-m.interval/10 {
+		if err := m.writeLocked(now); err != nil {
+			heartbeatLog.Warn("write %s: %v", m.path, err)
+		} else {
+			m.lastBeat = now
+		}
+	}
+}
+
+// stopJobsLocked runs the shutdown of every job before the watchdog exits,
+// giving up after the shutdown timeout plus a grace period in case whatever
+// hung the daemon blocks that too.
+func (m *heartbeatMonitor) stopJobsLocked() {
+	if m.stopJobs == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		m.stopJobs()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(m.shutdown + watchdogStopGrace):
+		heartbeatLog.Error("jobs still running %s after the watchdog began stopping them; exiting anyway", m.shutdown+watchdogStopGrace)
+	}
+}
+
+func (m *heartbeatMonitor) responsive(wait time.Duration) bool {
+	m.mu.Lock()
+	pending := m.pending
+	if pending == nil {
+		pending = make(chan struct{})
+		m.pending = pending
+		go func() {
+			m.probe()
+			m.mu.Lock()
+			m.pending = nil
+			m.mu.Unlock()
+			close(pending)
+		}()
+	}
+	m.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-pending:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (m *heartbeatMonitor) writeLocked(now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(m.path), m.perms.DirMode); err != nil {
+		return err
+	}
+	content := fmt.Sprintf("%d %s\n", os.Getpid(), now.UTC().Format(time.RFC3339))
+	tempPath := m.path + ".tmp"
+	if err := os.WriteFile(tempPath, []byte(content), m.perms.FileMode); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, m.path)
+}
+
+func (m *heartbeatMonitor) notifyLocked(state string) {
+	if m.notifySocket == "" {
+		return
+	}
+	if err := sdNotify(m.notifySocket, state); err != nil && !m.notifyFailed {
+		m.notifyFailed = true
+		heartbeatLog.Warn("notify %s: %v", m.notifySocket, err)
+	}
+}
+
+func sdNotify(socket, state string) error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, err = conn.Write([]byte(state))
+	return err
+}
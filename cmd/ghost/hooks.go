@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const hookTimeout = 30 * time.Second
+
+// RunHooks are the commands a job runs after its main command exits,
+// picked by exit status.
+type RunHooks struct {
+	OnSuccess []string
+	OnFailure []string
+}
+
+func (h RunHooks) empty() bool {
+	return len(h.OnSuccess) == 0 && len(h.OnFailure) == 0
+}
+
+func normalizeRunHooks(onSuccess, onFailure any, useShell bool, profile shellProfile) (RunHooks, error) {
+	var hooks RunHooks
+	var err error
+	if hooks.OnSuccess, err = normalizeHookCommand("on_success", onSuccess, useShell, profile); err != nil {
+		return RunHooks{}, err
+	}
+	if hooks.OnFailure, err = normalizeHookCommand("on_failure", onFailure, useShell, profile); err != nil {
+		return RunHooks{}, err
+	}
+	return hooks, nil
+}
+
+func normalizeHookCommand(key string, value any, useShell bool, profile shellProfile) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	parts, _, err := parseCommandSpec(value, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%s must not be empty", key)
+	}
+	if useShell {
+		parts = profile.command(buildShellCommand(parts))
+	}
+	return parts, nil
+}
+
+// hookRun describes a finished run whose hook should fire.
+type hookRun struct {
+	Kind    string
+	Job     string
+	RunID   string
+	Cwd     string
+	Env     map[string]string
+	RunAs   *RunAs
+	Secrets secretSet
+	Stdout  string
+	Prefix  bool
+	Log     logger
+}
+
+// runExitHook runs on_success or on_failure, as the job's user, for a run
+// that ended with waitErr. The hook gets the job's environment plus
+// GHOST_JOB, GHOST_EXIT_CODE and, for watcher runs, GHOST_RUN_ID, and is
+// killed after hookTimeout so a stuck notifier can't pile up processes.
+func runExitHook(hooks RunHooks, run hookRun, waitErr error) {
+	command, name := hooks.OnSuccess, "on_success"
+	if waitErr != nil {
+		command, name = hooks.OnFailure, "on_failure"
+	}
+	if len(command) == 0 {
+		return
+	}
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if waitErr != nil {
+		code = -1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = run.Cwd
+	cmd.Env = append(buildEnvList(run.RunAs.env(run.Env)), "GHOST_JOB="+run.Job, "GHOST_EXIT_CODE="+strconv.Itoa(code))
+	if run.RunID != "" {
+		cmd.Env = append(cmd.Env, "GHOST_RUN_ID="+run.RunID)
+	}
+	var timeout *runTimeoutError
+	if errors.As(waitErr, &timeout) {
+		cmd.Env = append(cmd.Env, "GHOST_TIMED_OUT=1")
+	}
+	setRunAs(cmd, run.RunAs)
+	cmd.WaitDelay = time.Second
+	forward := newOutputForwarder(run.Job, run.Secrets)
+	cmd.Stdout, cmd.Stderr = forward.wrap(jobOutput(run.Job, run.Stdout, run.Prefix))
+
+	cause := fmt.Sprintf("%s (exit %d)", name, code)
+	startedAt := time.Now()
+	if err := cmd.Start(); err != nil {
+		run.Log.Error("%s failed to start: %v", name, err)
+		return
+	}
+	auditStart(run.Kind, run.Job, run.RunID, cmd, run.Env, run.Secrets, cause)
+	err := cmd.Wait()
+	forward.Flush()
+	auditExit(run.Kind, run.Job, run.RunID, cmd, run.Secrets, startedAt, err)
+	switch {
+	case ctx.Err() != nil:
+		run.Log.Error("%s timed out after %s", name, hookTimeout)
+	case err != nil:
+		run.Log.Error("%s failed: %v", name, err)
+	}
+}
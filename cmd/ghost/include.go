@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+var includableSections = map[string]struct{}{
+	"watchers":     {},
+	"servers":      {},
+	"schedules":    {},
+	"templates":    {},
+	"watcher_sets": {},
+}
+
+type configSource struct {
+	path   string
+	data   []byte
+	offset map[string]int
+	count  map[string]int
+}
+
+func newConfigSource(path string, data []byte, raw rawConfig, previous *configSource) configSource {
+	source := configSource{
+		path:   path,
+		data:   data,
+		offset: map[string]int{},
+		count: map[string]int{
+			"watchers":     len(raw.Watchers),
+			"servers":      len(raw.Servers),
+			"schedules":    len(raw.Schedules),
+			"templates":    len(raw.Templates),
+			"watcher_sets": len(raw.WatcherSets),
+		},
+	}
+	if previous != nil {
+		for section := range includableSections {
+			source.offset[section] = previous.offset[section] + previous.count[section]
+		}
+	}
+	return source
+}
+
+func resolveIncludes(configPath string, patterns []string) ([]string, []string, error) {
+	base := filepath.Dir(configPath)
+	seen := map[string]bool{configPath: true}
+	var resolved, files []string
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if !filepath.IsAbs(pattern) && pattern != "~" && !hasHomePrefix(pattern) {
+			pattern = filepath.Join(base, pattern)
+		}
+		expanded, err := resolvePath(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("include %q: %w", pattern, err)
+		}
+		matches, err := filepath.Glob(expanded)
+		if err != nil {
+			return nil, nil, fmt.Errorf("include %q: %w", pattern, err)
+		}
+		resolved = append(resolved, expanded)
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || info.IsDir() || seen[match] {
+				continue
+			}
+			seen[match] = true
+			files = append(files, match)
+		}
+	}
+	return resolved, files, nil
+}
+
+func readIncludedConfig(path string) (rawConfig, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rawConfig{}, nil, fmt.Errorf("read included config: %w", err)
+	}
+	raw, source, err := decodeConfig(path, data)
+	if err != nil {
+		return rawConfig{}, nil, err
+	}
+
+	var top map[string]any
+	if err := toml.Unmarshal(source, &top); err != nil {
+		return rawConfig{}, nil, fmt.Errorf("parse config: %w", err)
+	}
+	var errs configcheck.Errors
+	for key := range top {
+		if _, ok := includableSections[key]; !ok {
+			errs = append(errs, &configcheck.Error{Message: key + ": only [[watchers]], [[servers]], [[schedules]], [[templates]] and [[watcher_sets]] can be set in an included file"})
+		}
+	}
+	if len(errs) > 0 {
+		errs.Locate(path, source)
+		return rawConfig{}, nil, errs
+	}
+	return raw, source, nil
+}
+
+var jobIndexPrefix = regexp.MustCompile(`^(watchers|servers|schedules|templates|watcher_sets)\[(\d+)\]`)
+
+func locateConfigErrors(errs configcheck.Errors, sources []configSource) {
+	grouped := make([]configcheck.Errors, len(sources))
+	for _, err := range errs {
+		owner := 0
+		if match := jobIndexPrefix.FindStringSubmatch(err.Message); match != nil {
+			index, _ := strconv.Atoi(match[2])
+			for i, source := range sources {
+				local := index - source.offset[match[1]]
+				if local >= 0 && local < source.count[match[1]] {
+					owner = i
+					err.Message = fmt.Sprintf("%s[%d]", match[1], local) + err.Message[len(match[0]):]
+					break
+				}
+			}
+		}
+		grouped[owner] = append(grouped[owner], err)
+	}
+	for i, group := range grouped {
+		group.Locate(sources[i].path, sources[i].data)
+	}
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
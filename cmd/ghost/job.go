@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -15,37 +16,110 @@ import (
 )
 
 type watchJob struct {
+	jobRuntime
 	cfg NormalizedWatcher
 
-	events chan notify.EventInfo
-	stopCh chan struct{}
-	doneCh chan struct{}
+	events   chan notify.EventInfo
+	poller   *pollWatcher
+	onChange func([]Trigger)
+	warmup   time.Time
+	stopCh   chan struct{}
+	doneCh   chan struct{}
 
 	mu             sync.Mutex
 	closed         bool
-	running        bool
 	restartQueued  bool
-	cmd            *exec.Cmd
-	killTimer      *time.Timer
+	cmds           []*exec.Cmd
+	killTimers     map[*exec.Cmd]clockTimer
+	deadlines      map[*exec.Cmd]clockTimer
+	timedOut       map[*exec.Cmd]bool
 	pending        []Trigger
 	pendingRestart []Trigger
+	cachedHash     string
+	contentHashes  map[string]string
+	stats          watchStats
+	gitignore      map[string]*gitignoreMatcher
+	logPath        string
+	runID          string
+	runBase        string
+	runSeq         int
+	history        jobHistory
 }
 
-func newWatchJob(cfg NormalizedWatcher) (*watchJob, error) {
+func newWatchJob(cfg NormalizedWatcher, rt jobRuntime) (*watchJob, error) {
+	return startWatchJob(cfg, rt, nil)
+}
+
+// startWatchJob starts watching for cfg. With onChange set, each debounced
+// batch of changes goes to it instead of running the watcher's command.
+func startWatchJob(cfg NormalizedWatcher, rt jobRuntime, onChange func([]Trigger)) (*watchJob, error) {
+	rt = rt.withDefaults()
 	events := make(chan notify.EventInfo, 128)
-	if err := notify.Watch(cfg.WatchPattern, events, notify.All); err != nil {
-		return nil, fmt.Errorf("watch %s: %w", cfg.WatchPattern, err)
+	var poller *pollWatcher
+	patterns := cfg.WatchPatterns
+	if cfg.Backend == "poll" || cfg.Remote != nil {
+		poller = newPollWatcher(cfg, events)
+		patterns = nil
+	}
+	for _, pattern := range patterns {
+		err := notify.Watch(pattern, events, notify.All)
+		if err == nil {
+			continue
+		}
+		notify.Stop(events)
+		switch {
+		case isWatchUnsupportedError(err):
+			err = fmt.Errorf("watch %s: %s is not supported here: %w", pattern, notifyBackend(), err)
+		case isWatchLimitError(err):
+			err = watchLimitError(pattern, err)
+			if !cfg.PollFallback {
+				return nil, fmt.Errorf("%w; set poll_fallback = true to poll instead", err)
+			}
+		default:
+			return nil, fmt.Errorf("watch %s: %w", pattern, err)
+		}
+		watcherLog(cfg.Name).Warn("%v; polling every %s instead", err, cfg.PollInterval)
+		poller = newPollWatcher(cfg, events)
+		break
 	}
 
 	job := &watchJob{
-		cfg:    cfg,
-		events: events,
-		stopCh: make(chan struct{}),
-		doneCh: make(chan struct{}),
+		jobRuntime: rt,
+		cfg:        cfg,
+		events:     events,
+		poller:     poller,
+		warmup:     rt.clock.Now().Add(cfg.Warmup),
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+		onChange:   onChange,
+	}
+	if cfg.Cache {
+		job.cachedHash = loadCachedHash(cfg.Name)
+	}
+	if cfg.Gitignore {
+		for _, root := range cfg.Roots {
+			job.loadGitignore(root)
+		}
+	}
+	if info, err := os.Stat(cfg.WatchRoot); err == nil {
+		job.stats.rootInfo = info
+	}
+	if onChange == nil {
+		job.history = loadJobHistory("watcher", cfg.Name)
 	}
 
 	go job.run()
 
+	if cfg.CatchUp && !cfg.RunOnStart {
+		since := job.history.StoppedAt
+		if job.history.LastRun.After(since) {
+			since = job.history.LastRun
+		}
+		if !since.IsZero() {
+			go job.catchUp(since)
+		}
+	}
+
 	if cfg.RunOnStart {
 		go job.scheduleTriggers([]Trigger{{Event: "startup"}})
 	}
@@ -56,14 +130,21 @@ func newWatchJob(cfg NormalizedWatcher) (*watchJob, error) {
 func (j *watchJob) run() {
 	defer func() {
 		notify.Stop(j.events)
+		if j.poller != nil {
+			j.poller.Stop()
+		}
 		close(j.doneCh)
 	}()
 
 	var (
-		debounceTimer *time.Timer
+		debounceTimer clockTimer
 		debounceChan  <-chan time.Time
 		pending       []Trigger
+		adaptive      *adaptiveDebounce
 	)
+	if j.cfg.AdaptiveDebounce {
+		adaptive = newAdaptiveDebounce(j.cfg.Debounce, j.cfg.MaxDebounce)
+	}
 
 	for {
 		select {
@@ -83,14 +164,18 @@ func (j *watchJob) run() {
 				continue
 			}
 			pending = append(pending, triggers...)
+			window := j.cfg.Debounce
+			if adaptive != nil {
+				window = adaptive.next(j.clock.Now())
+			}
 			if debounceTimer == nil {
-				debounceTimer = time.NewTimer(j.cfg.Debounce)
-				debounceChan = debounceTimer.C
+				debounceTimer = j.clock.NewTimer(window)
+				debounceChan = debounceTimer.C()
 			} else {
 				if !debounceTimer.Stop() && debounceChan != nil {
 					<-debounceChan
 				}
-				debounceTimer.Reset(j.cfg.Debounce)
+				debounceTimer.Reset(window)
 			}
 		case <-debounceChan:
 			if debounceTimer != nil {
@@ -106,11 +191,102 @@ func (j *watchJob) run() {
 	}
 }
 
+// catchUp feeds in files under the watcher's roots that were modified after
+// since, once warmup is over, so changes made while ghost wasn't watching
+// still run the command. since is when the watcher last stopped or ran,
+// whichever is later, which also covers a daemon that crashed.
+func (j *watchJob) catchUp(since time.Time) {
+	if wait := j.warmup.Sub(j.clock.Now()); wait > 0 {
+		timer := j.clock.NewTimer(wait)
+		select {
+		case <-timer.C():
+		case <-j.stopCh:
+			timer.Stop()
+			return
+		}
+	}
+	var changed []string
+	for path, stamp := range scanWatchedFiles(j.cfg) {
+		if !stamp.mode.IsDir() && stamp.modTime.After(since) {
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	j.log().Info("%d file(s) changed since %s, catching up", len(changed), since.Local().Format(time.DateTime))
+	for _, path := range changed {
+		select {
+		case j.events <- polledEvent{event: notify.Write, path: path}:
+		case <-j.stopCh:
+			return
+		}
+	}
+}
+
+// saveHistoryLocked queues the watcher's run history to be saved. The
+// watch table of a server has none of its own.
+func (j *watchJob) saveHistoryLocked() {
+	if j.onChange == nil {
+		storeJobHistory("watcher", j.cfg.Name, j.history)
+	}
+}
+
+func (j *watchJob) Trigger(path string) error {
+	trigger := Trigger{Event: "manual"}
+	if path != "" {
+		rel := path
+		if filepath.IsAbs(path) {
+			root, inside, ok := j.cfg.locate(path)
+			if !ok {
+				return fmt.Errorf("%s is outside %s", path, joinRoots(j.cfg.WatchRoot, j.cfg.Roots))
+			}
+			rel, trigger.Root = inside, j.cfg.triggerRoot(root)
+		} else if !filepath.IsLocal(rel) {
+			return fmt.Errorf("%s is outside %s", path, joinRoots(j.cfg.WatchRoot, j.cfg.Roots))
+		}
+		trigger.Path = posixPath(filepath.Clean(rel))
+	}
+	trigger.RunID = newRunID()
+	j.log().withRun(trigger.RunID).Info("manual trigger")
+	j.scheduleTriggers([]Trigger{trigger})
+	return nil
+}
+
 func (j *watchJob) handleTriggers(triggers []Trigger) {
 	collapsed := dedupeTriggers(triggers)
 	if len(collapsed) == 0 {
 		return
 	}
+	runID := newRunID()
+	log := j.log().withRun(runID)
+	if j.cfg.SkipUnchanged {
+		changed := j.dropUnchanged(collapsed)
+		if len(changed) == 0 {
+			log.Info("content unchanged since the last run, skipping — %s", formatTriggers(collapsed))
+			return
+		}
+		collapsed = changed
+	}
+	if len(j.cfg.Transform) > 0 {
+		transformed, err := j.cfg.transformTriggers(collapsed)
+		switch {
+		case err != nil:
+			log.Error("transform failed, running with untransformed triggers: %v", err)
+		case len(transformed) == 0:
+			log.Info("transform dropped all triggers, skipping — %s", formatTriggers(collapsed))
+			return
+		default:
+			collapsed = dedupeTriggers(transformed)
+		}
+	}
+	for i := range collapsed {
+		collapsed[i].RunID = runID
+	}
+	if j.onChange != nil {
+		j.onChange(collapsed)
+		return
+	}
 	j.scheduleTriggers(collapsed)
 }
 
@@ -126,15 +302,16 @@ func (j *watchJob) scheduleTriggers(triggers []Trigger) {
 		return
 	}
 
+	log := j.log().withRun(triggerRunID(triggers))
 	if j.cfg.Restart {
 		j.pendingRestart = append(j.pendingRestart, triggers...)
-		if j.running {
+		if len(j.cmds) > 0 {
 			if !j.restartQueued {
 				j.restartQueued = true
-				logInfo("%s restart requested — %s", j.prefix(), formatTriggers(triggers))
+				log.Info("restart requested — %s", formatTriggers(triggers))
 				j.stopProcessLocked()
 			} else {
-				logInfo("%s coalesced restart — %s", j.prefix(), formatTriggers(triggers))
+				log.Info("coalesced restart — %s", formatTriggers(triggers))
 			}
 			return
 		}
@@ -144,71 +321,295 @@ func (j *watchJob) scheduleTriggers(triggers []Trigger) {
 		return
 	}
 
-	if j.running {
+	if len(j.cmds) >= j.cfg.Concurrency {
+		switch j.cfg.Queue {
+		case "drop":
+			log.Info("busy, dropping — %s", formatTriggers(triggers))
+			return
+		case "latest":
+			if len(j.pending) > 0 {
+				log.Info("replacing queued run — %s", formatTriggers(triggers))
+				j.pending = triggers
+				return
+			}
+		}
 		j.pending = append(j.pending, triggers...)
-		logInfo("%s queued run — %s", j.prefix(), formatTriggers(triggers))
+		log.Info("queued run — %s", formatTriggers(triggers))
 		return
 	}
 
 	j.launchLocked(triggers)
+	j.drainLocked()
 }
 
-func (j *watchJob) launchLocked(triggers []Trigger) {
+func (j *watchJob) drainLocked() {
+	for !j.closed && len(j.pending) > 0 && len(j.cmds) < j.cfg.Concurrency {
+		pending := j.pending
+		j.pending = nil
+		j.launchLocked(pending)
+	}
+}
+
+type runPlan struct {
+	Triggers []Trigger
+	Deferred []Trigger
+	Command  []string
+	Display  string
+	Hash     string
+	Skip     string
+}
+
+func (w NormalizedWatcher) planRun(triggers []Trigger, cachedHash string, log logger) runPlan {
 	if len(triggers) == 0 {
 		triggers = []Trigger{{Event: "manual"}}
 	}
+	plan := runPlan{Triggers: triggers}
+
+	if w.Cache {
+		hash, err := w.inputHash()
+		switch {
+		case err != nil:
+			log.Error("cache unavailable for this run: %v", err)
+		case hash == cachedHash:
+			plan.Skip = "cache hit, inputs unchanged since last successful run"
+			return plan
+		default:
+			plan.Hash = hash
+		}
+	}
+
+	if w.Grouped {
+		grouped := w.assignGroups(plan.Triggers)
+		if len(grouped) == 0 {
+			plan.Skip = "no affected group, skipping"
+			return plan
+		}
+		plan.Triggers = grouped
+		if !w.Restart {
+			plan.Triggers, plan.Deferred = splitGroupTriggers(plan.Triggers)
+		}
+	}
+	if w.PerFile && !w.Restart {
+		var rest []Trigger
+		plan.Triggers, rest = splitPerFileTriggers(plan.Triggers)
+		plan.Deferred = append(rest, plan.Deferred...)
+	}
 
-	summary := formatTriggers(triggers)
-	logInfo("%s starting %s — %s", j.prefix(), j.cfg.CommandDisplay, summary)
+	plan.Command = w.Command
+	plan.Display = w.CommandDisplay
+	if w.Templated {
+		plan.Command = expandCommandTemplate(w.Command, w.WatchRoot, w.UseShell, plan.Triggers)
+		plan.Display = expandCommandTemplate([]string{w.CommandDisplay}, w.WatchRoot, w.UseShell, plan.Triggers)[0]
+	}
+	return plan
+}
 
-	cmd := exec.Command(j.cfg.Command[0], j.cfg.Command[1:]...)
-	cmd.Dir = j.cfg.Cwd
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+func (w NormalizedWatcher) buildCommand(command []string) *exec.Cmd {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = w.Cwd
 	cmd.Stdin = nil
-	cmd.Env = buildEnvList(j.cfg.Env)
+	cmd.Env = buildEnvList(w.RunAs.env(w.Env))
+	if w.ProcessGroup {
+		setProcessGroup(cmd)
+	}
+	setRunAs(cmd, w.RunAs)
+	return cmd
+}
+
+func triggerRunID(triggers []Trigger) string {
+	for _, trigger := range triggers {
+		if trigger.RunID != "" {
+			return trigger.RunID
+		}
+	}
+	return ""
+}
 
-	if err := cmd.Start(); err != nil {
-		logError("%s failed to start command: %v", j.prefix(), err)
+func (j *watchJob) nextRunIDLocked(triggers []Trigger) string {
+	base := triggerRunID(triggers)
+	switch {
+	case base == "":
+		return newRunID()
+	case base == j.runBase:
+		j.runSeq++
+		return fmt.Sprintf("%s-%d", base, j.runSeq)
+	}
+	j.runBase, j.runSeq = base, 1
+	return base
+}
+
+func (j *watchJob) launchLocked(triggers []Trigger) {
+	plan := j.cfg.planRun(triggers, j.cachedHash, j.log().withRun(triggerRunID(triggers)))
+	if plan.Skip != "" {
+		j.log().withRun(triggerRunID(triggers)).Info("%s — %s", plan.Skip, formatTriggers(plan.Triggers))
 		return
 	}
 
-	j.running = true
-	j.cmd = cmd
+	runID := j.nextRunIDLocked(plan.Triggers)
+	log := j.log().withRun(runID)
+	summary := formatTriggers(plan.Triggers)
+	log.withTrigger(summary).Info("starting %s — %s", plan.Display, summary)
+
+	cmd := j.cfg.buildCommand(plan.Command)
+	cmd.Env = append(cmd.Env, "GHOST_RUN_ID="+runID)
+	cmd.Stdin = j.cfg.commandStdin(plan.Triggers)
+	if j.cfg.Stdout == "inherit" {
+		writeRunSeparator(j.cfg.Clear, j.cfg.Name, runID, summary, j.clock.Now())
+	}
+	forward := newOutputForwarder(j.cfg.Name, j.cfg.Secrets)
+	cmd.Stdout, cmd.Stderr = forward.wrap(jobOutput(j.cfg.Name, j.cfg.Stdout, j.cfg.PrefixOutput))
+	output, logFile := j.openOutputLog(runID, plan.Display, summary)
+	if output != nil {
+		cmd.Stdout, cmd.Stderr = io.MultiWriter(output, cmd.Stdout), io.MultiWriter(output, cmd.Stderr)
+	}
+
+	j.history.LastRun, j.history.LastRunID, j.history.LastTrigger = j.clock.Now(), runID, summary
+	if err := j.runner.Start(cmd); err != nil {
+		log.Error("failed to start command: %v", err)
+		logFile.started(0)
+		output.Close()
+		j.history.LastResult = "failed to start"
+		j.saveHistoryLocked()
+		return
+	}
+	j.history.LastResult = ""
+	j.saveHistoryLocked()
+	logFile.started(cmd.Process.Pid)
+	if err := applyProcessPriority(cmd.Process.Pid, j.cfg.Priority); err != nil {
+		log.withPID(cmd.Process.Pid).Error("failed to apply priority: %v", err)
+	}
+	auditStart("watcher", j.cfg.Name, runID, cmd, j.cfg.Env, j.cfg.Secrets, summary)
+	notifyWebhooks(webhookEvent{Event: "watcher.trigger", Kind: "watcher", Job: j.cfg.Name, RunID: runID, PID: cmd.Process.Pid, Message: summary})
+
+	j.runID = runID
+	j.cmds = append(j.cmds, cmd)
+	if path := logFile.Path(); path != "" {
+		j.logPath = path
+	}
+	if len(plan.Deferred) > 0 {
+		j.pending = append(plan.Deferred, j.pending...)
+	}
+
+	if j.cfg.Timeout > 0 {
+		j.startDeadlineLocked(cmd, runID)
+	}
+
+	go j.waitForExit(cmd, runID, plan.Hash, j.clock.Now(), forward, output)
+}
+
+// startDeadlineLocked stops cmd once it has run for timeout_ms. The run is
+// then reported as timed out rather than as an ordinary failure.
+func (j *watchJob) startDeadlineLocked(cmd *exec.Cmd, runID string) {
+	if j.deadlines == nil {
+		j.deadlines = make(map[*exec.Cmd]clockTimer)
+		j.timedOut = make(map[*exec.Cmd]bool)
+	}
+	j.deadlines[cmd] = j.clock.AfterFunc(j.cfg.Timeout, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.deadlines[cmd]; !ok {
+			return
+		}
+		delete(j.deadlines, cmd)
+		if j.killTimers[cmd] != nil {
+			return // already being stopped for another reason
+		}
+		j.timedOut[cmd] = true
+		j.log().withRun(runID).withPID(cmd.Process.Pid).Warn("still running after timeout_ms (%s), stopping it", j.cfg.Timeout)
+		j.stopCommandLocked(cmd)
+	})
+}
 
-	go j.waitForExit(cmd)
+func (j *watchJob) openOutputLog(runID, display, summary string) (*asyncLogWriter, *jobLogFile) {
+	if j.cfg.Stdout == "null" {
+		return nil, nil
+	}
+	file, err := openJobLog(j.cfg.LogPath, j.cfg.Name, j.cfg.LogPerms)
+	if err != nil {
+		j.log().Error("failed to open log file: %v", err)
+		return nil, nil
+	}
+	output := newAsyncLogWriter(file, j.log(), defaultLogBufferSize)
+	header := fmt.Sprintf("\n--- [%s] ghost watcher %s run %s starting: %s — %s ---\n",
+		j.clock.Now().Format(time.RFC3339), j.cfg.Name, runID, display, summary)
+	_, _ = output.Write([]byte(header))
+	return output, file
 }
 
-func (j *watchJob) waitForExit(cmd *exec.Cmd) {
+func (j *watchJob) waitForExit(cmd *exec.Cmd, runID, runHash string, startedAt time.Time, forward *outputForwarder, output *asyncLogWriter) {
+	release := keepAwake(j.cfg.KeepAwake, "ghost watcher "+j.cfg.Name+" is running", j.log().withRun(runID))
 	err := cmd.Wait()
+	release()
+	forward.Flush()
+	output.Close()
 
 	j.mu.Lock()
-	if j.killTimer != nil {
-		j.killTimer.Stop()
-		j.killTimer = nil
-	}
-	if j.cmd == cmd {
-		j.cmd = nil
+	if timer := j.killTimers[cmd]; timer != nil {
+		timer.Stop()
+		delete(j.killTimers, cmd)
+	}
+	if timer := j.deadlines[cmd]; timer != nil {
+		timer.Stop()
+		delete(j.deadlines, cmd)
+	}
+	timedOut := j.timedOut[cmd]
+	delete(j.timedOut, cmd)
+	for i, active := range j.cmds {
+		if active == cmd {
+			j.cmds = append(j.cmds[:i:i], j.cmds[i+1:]...)
+			break
+		}
 	}
-	j.running = false
 	closed := j.closed
 	restart := j.cfg.Restart
 	restartQueued := j.restartQueued
-	pending := j.pending
-	j.pending = nil
 	pendingRestart := j.pendingRestart
 	j.pendingRestart = nil
 	j.restartQueued = false
+	if timedOut {
+		err = &runTimeoutError{after: j.cfg.Timeout, err: err}
+	}
+	storeHash := ""
+	if err == nil && runHash != "" {
+		j.cachedHash = runHash
+		storeHash = runHash
+	}
+	if j.history.LastRunID == runID {
+		j.history.LastResult = runResult(err)
+		j.saveHistoryLocked()
+	}
 	j.mu.Unlock()
+	auditExit("watcher", j.cfg.Name, runID, cmd, j.cfg.Secrets, startedAt, err)
+
+	log := j.log().withRun(runID)
+	if storeHash != "" {
+		if err := storeCachedHash(j.cfg.Name, storeHash); err != nil {
+			log.Error("failed to persist cache: %v", err)
+		}
+	}
 
 	if err != nil {
+		event := "watcher.fail"
 		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			logError("%s process exited with code %d", j.prefix(), exitErr.ExitCode())
-		} else {
-			logError("%s process exited: %v", j.prefix(), err)
+		switch {
+		case timedOut:
+			event = "watcher.timeout"
+			log.withPID(cmd.Process.Pid).Error("%v", err)
+		case errors.As(err, &exitErr):
+			log.withPID(cmd.Process.Pid).Error("process exited with code %d", exitErr.ExitCode())
+		default:
+			log.withPID(cmd.Process.Pid).Error("process exited: %v", err)
+		}
+		if !closed {
+			notifyWebhooks(webhookExit(webhookEvent{Event: event, Kind: "watcher", Job: j.cfg.Name, RunID: runID, PID: cmd.Process.Pid}, err))
 		}
 	}
+	if !closed && !restartQueued && !j.cfg.Hooks.empty() {
+		go runExitHook(j.cfg.Hooks, hookRun{
+			Kind: "watcher", Job: j.cfg.Name, RunID: runID, Cwd: j.cfg.Cwd, Env: j.cfg.Env, RunAs: j.cfg.RunAs,
+			Secrets: j.cfg.Secrets, Stdout: j.cfg.Stdout, Prefix: j.cfg.PrefixOutput, Log: log,
+		}, err)
+	}
 
 	if closed {
 		return
@@ -227,34 +628,58 @@ func (j *watchJob) waitForExit(cmd *exec.Cmd) {
 		return
 	}
 
-	if len(pending) > 0 {
-		j.scheduleTriggers(pending)
-	}
+	j.mu.Lock()
+	j.drainLocked()
+	j.mu.Unlock()
+}
+
+// runTimeoutError marks a run that ghost stopped because it outlasted
+// timeout_ms; err is what the process exited with afterwards.
+type runTimeoutError struct {
+	after time.Duration
+	err   error
+}
+
+func (e *runTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.after)
+}
+
+func (e *runTimeoutError) Unwrap() error {
+	return e.err
 }
 
 func (j *watchJob) stopProcessLocked() {
-	if j.cmd == nil || j.cmd.Process == nil {
-		return
+	for _, cmd := range j.cmds {
+		if cmd.Process == nil || j.killTimers[cmd] != nil {
+			continue
+		}
+		j.stopCommandLocked(cmd)
 	}
+}
 
-	process := j.cmd.Process
-	if err := process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
-		logError("%s failed to send SIGTERM: %v", j.prefix(), err)
+func (j *watchJob) stopCommandLocked(cmd *exec.Cmd) {
+	process := cmd.Process
+	group := j.cfg.ProcessGroup
+	if err := signalProcess(process, syscall.SIGTERM, group); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		j.log().Error("failed to send SIGTERM: %v", err)
 	}
 
-	timer := time.AfterFunc(j.cfg.KillTimeout, func() {
+	timer := j.clock.AfterFunc(j.cfg.KillTimeout, func() {
 		j.mu.Lock()
 		defer j.mu.Unlock()
-		if j.cmd == nil || j.cmd.Process != process {
+		if _, ok := j.killTimers[cmd]; !ok {
 			return
 		}
-		if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
-			logError("%s failed to send SIGKILL: %v", j.prefix(), err)
+		if err := signalProcess(process, syscall.SIGKILL, group); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			j.log().Error("failed to send SIGKILL: %v", err)
 		} else {
-			logInfo("%s forcing process exit with SIGKILL", j.prefix())
+			j.log().Info("forcing process exit with SIGKILL")
 		}
 	})
-	j.killTimer = timer
+	if j.killTimers == nil {
+		j.killTimers = make(map[*exec.Cmd]clockTimer)
+	}
+	j.killTimers[cmd] = timer
 }
 
 func (j *watchJob) triggersForEvent(info notify.EventInfo) []Trigger {
@@ -268,25 +693,79 @@ func (j *watchJob) triggersForEvent(info notify.EventInfo) []Trigger {
 		return nil
 	}
 
-	rel, err := filepath.Rel(j.cfg.WatchRoot, path)
-	if err != nil || strings.HasPrefix(rel, "..") {
+	root, rel, ok := j.cfg.locate(path)
+	if !ok {
+		j.recordEvent(events, path, outcomeOutsideRoot)
+		return nil
+	}
+	if pausedJobs.isPaused("watcher", j.cfg.Name) {
+		j.log().Debug("ignoring %s %s: %s", strings.Join(events, ","), rel, outcomePaused)
+		j.recordEvent(events, rel, outcomePaused)
+		return nil
+	}
+	if j.clock.Now().Before(j.warmup) {
+		j.log().Debug("ignoring %s %s: %s", strings.Join(events, ","), rel, outcomeWarmup)
+		j.recordEvent(events, rel, outcomeWarmup)
 		return nil
 	}
+	if gitignore := j.gitignore[root]; gitignore != nil {
+		if filepath.Base(rel) == ".gitignore" {
+			j.loadGitignore(root)
+			gitignore = j.gitignore[root]
+		}
+		if gitignore.ignored(rel, isDirectory(path)) {
+			j.log().Debug("ignoring %s %s: %s", strings.Join(events, ","), rel, outcomeGitignored)
+			j.recordEvent(events, rel, outcomeGitignored)
+			return nil
+		}
+	}
 
-	rel = posixPath(rel)
+	triggers, outcome := j.cfg.triggersFor(events, rel)
+	for i := range triggers {
+		triggers[i].Root = j.cfg.triggerRoot(root)
+	}
+	if outcome == outcomeIgnored || outcome == outcomeUnmatched {
+		j.log().Debug("ignoring %s %s: %s", strings.Join(events, ","), rel, outcome)
+	}
+	j.recordEvent(events, rel, outcome)
+	return triggers
+}
 
-	if !j.cfg.matches(rel) {
-		return nil
+func (j *watchJob) loadGitignore(root string) {
+	matcher, err := loadGitignore(root, j.cfg.CaseSensitive)
+	if err != nil {
+		j.log().Warn("respect_gitignore: %v", err)
+		return
+	}
+	if j.gitignore == nil {
+		j.gitignore = make(map[string]*gitignoreMatcher, len(j.cfg.Roots))
 	}
+	j.gitignore[root] = matcher
+	j.log().Debug("loaded %d rule(s) from %d ignore file(s)", len(matcher.rules), matcher.files)
+}
+
+func isDirectory(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.IsDir()
+}
 
+func (w NormalizedWatcher) triggersFor(events []string, rel string) ([]Trigger, string) {
+	if w.ignored(rel) {
+		return nil, outcomeIgnored
+	}
+	if !w.matches(rel) {
+		return nil, outcomeUnmatched
+	}
 	var triggers []Trigger
 	for _, event := range events {
-		if j.cfg.allowsEvent(event) {
+		if w.allowsEvent(event) {
 			triggers = append(triggers, Trigger{Event: event, Path: rel})
 		}
 	}
-
-	return triggers
+	if len(triggers) == 0 {
+		return nil, outcomeFiltered
+	}
+	return triggers, outcomeMatched
 }
 
 func (j *watchJob) Close() error {
@@ -302,14 +781,79 @@ func (j *watchJob) Close() error {
 	j.restartQueued = false
 	close(j.stopCh)
 	j.stopProcessLocked()
+	j.history.StoppedAt = j.clock.Now()
+	j.saveHistoryLocked()
 	j.mu.Unlock()
 
 	<-j.doneCh
 	return nil
 }
 
-func (j *watchJob) prefix() string {
-	return "ghost:" + j.cfg.Name
+func (j *watchJob) kill() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, cmd := range j.cmds {
+		if cmd.Process != nil {
+			_ = signalProcess(cmd.Process, syscall.SIGKILL, j.cfg.ProcessGroup)
+		}
+	}
+}
+
+func (j *watchJob) state() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case len(j.cmds) == 1:
+		return fmt.Sprintf("running (pid %d, %d queued)", j.cmds[0].Process.Pid, len(j.pending))
+	case len(j.cmds) > 1:
+		return fmt.Sprintf("running (%d processes, %d queued)", len(j.cmds), len(j.pending))
+	}
+	if pausedJobs.isPaused("watcher", j.cfg.Name) {
+		return "paused"
+	}
+	return "idle"
+}
+
+func (j *watchJob) info() watcherInfo {
+	info := watcherInfo{
+		Name:    j.cfg.Name,
+		Command: j.cfg.CommandDisplay,
+		Root:    j.cfg.WatchRoot,
+		Roots:   multipleRoots(j.cfg.Roots),
+		State:   "idle",
+		Labels:  j.cfg.Labels,
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info.LogPath = j.logPath
+	info.RunID = j.runID
+	if info.LogPath == "" && j.cfg.Stdout != "null" {
+		info.LogPath = currentLogPath(j.cfg.LogPath, j.cfg.Name)
+	}
+	if len(j.cmds) > 0 {
+		info.State = "running"
+		info.PID = j.cmds[len(j.cmds)-1].Process.Pid
+	} else if pausedJobs.isPaused("watcher", j.cfg.Name) {
+		info.State = "paused"
+	}
+	if !j.history.LastRun.IsZero() {
+		last := j.history.LastRun
+		info.LastRun = &last
+		info.LastResult = j.history.LastResult
+		info.LastTrigger = j.history.LastTrigger
+		if info.RunID == "" {
+			info.RunID = j.history.LastRunID
+		}
+	}
+	return info
+}
+
+func (j *watchJob) log() logger {
+	return watcherLog(j.cfg.Name)
+}
+
+func watcherLog(name string) logger {
+	return logger{prefix: "ghost:" + name, fields: logFields{Component: "watcher", Job: name}}
 }
 
 func dedupeTriggers(triggers []Trigger) []Trigger {
@@ -319,7 +863,7 @@ func dedupeTriggers(triggers []Trigger) []Trigger {
 	seen := make(map[string]struct{}, len(triggers))
 	result := make([]Trigger, 0, len(triggers))
 	for _, trigger := range triggers {
-		key := trigger.Event + "|" + trigger.Path
+		key := trigger.Event + "|" + trigger.Root + "|" + trigger.Path + "|" + trigger.Group
 		if _, ok := seen[key]; ok {
 			continue
 		}
@@ -355,7 +899,7 @@ func formatTriggers(triggers []Trigger) string {
 	for _, trigger := range triggers {
 		label := trigger.Event
 		if trigger.Path != "" {
-			label = fmt.Sprintf("%s:%s", trigger.Event, trigger.Path)
+			label = fmt.Sprintf("%s:%s", trigger.Event, trigger.displayPath())
 		}
 		if _, ok := seen[label]; ok {
 			continue
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+)
+
+var jobActionPast = map[string]string{"restart": "restarted", "pause": "paused", "resume": "resumed"}
+
+func runRestartCommand(args []string) error {
+	return runJobAction("restart", args)
+}
+
+func runPauseCommand(args []string) error {
+	return runJobAction("pause", args)
+}
+
+func runResumeCommand(args []string) error {
+	return runJobAction("resume", args)
+}
+
+func runJobAction(action string, args []string) error {
+	fs := flag.NewFlagSet(action, flag.ContinueOnError)
+	var labels stringList
+	fs.Var(&labels, "l", "only jobs whose labels match, e.g. project=api (repeatable)")
+	dryRun := fs.Bool("dry-run", false, "list the jobs that would be affected without touching them")
+	names, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 && len(labels) == 0 {
+		return fmt.Errorf("usage: ghost %s <name or glob...> [-l key=value] [-dry-run]", action)
+	}
+	if _, err := parseLabelSelector(labels); err != nil {
+		return err
+	}
+
+	var result jobsResult
+	request := jobsRequest{Names: names, Labels: labels, DryRun: *dryRun}
+	if err := controlRequest("POST", "/v1/jobs/"+url.PathEscape(action), request, &result); err != nil {
+		return err
+	}
+	verb := jobActionPast[action]
+	if result.DryRun {
+		verb = "would " + action
+	}
+	switch {
+	case len(result.Jobs) > 0:
+	case action == "pause":
+		fmt.Println("every matching job is already paused")
+	case action == "resume":
+		fmt.Println("no matching job is paused")
+	}
+	for _, job := range result.Jobs {
+		fmt.Printf("%s %s %s\n", verb, job.Kind, job.Name)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/nikiv/ghost/pkg/windows"
+)
+
+type clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) clockTimer
+	AfterFunc(d time.Duration, f func()) clockTimer
+	NewTicker(d time.Duration) clockTicker
+}
+
+type clockTimer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+type clockTicker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) clockTimer {
+	return systemTimer{timer: time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) clockTimer {
+	return systemTimer{timer: time.AfterFunc(d, f)}
+}
+
+func (systemClock) NewTicker(d time.Duration) clockTicker {
+	return systemTicker{ticker: time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t systemTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t systemTicker) Stop() {
+	t.ticker.Stop()
+}
+
+type processRunner interface {
+	Start(cmd *exec.Cmd) error
+	StartPTY(cmd *exec.Cmd, size *pty.Winsize) (*os.File, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) Start(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	trackProcessGroup(cmd)
+	return nil
+}
+
+func (execRunner) StartPTY(cmd *exec.Cmd, size *pty.Winsize) (*os.File, error) {
+	return pty.StartWithSize(cmd, size)
+}
+
+type windowSource interface {
+	Snapshot() ([]windows.Window, error)
+	Title(pid int32, windowID uint64) (string, bool)
+	BrowserURL(app string) (string, error)
+}
+
+type systemWindows struct{}
+
+func (systemWindows) Snapshot() ([]windows.Window, error) {
+	return windows.List()
+}
+
+func (systemWindows) Title(pid int32, windowID uint64) (string, bool) {
+	return windows.AXTitle(pid, windowID)
+}
+
+func (systemWindows) BrowserURL(app string) (string, error) {
+	return windows.BrowserURL(app)
+}
+
+type jobRuntime struct {
+	clock  clock
+	runner processRunner
+}
+
+func (rt jobRuntime) withDefaults() jobRuntime {
+	if rt.clock == nil {
+		rt.clock = systemClock{}
+	}
+	if rt.runner == nil {
+		rt.runner = execRunner{}
+	}
+	return rt
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/nikiv/ghost/pkg/windows"
+	"github.com/rjeczalik/notify"
+)
+
+// fakeClock only moves when a test advances it. Timers and tickers fire
+// from Advance, in deadline order.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	c      chan time.Time
+	fn     func()
+	when   time.Time
+	period time.Duration
+	active bool
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) clockTimer {
+	return c.add(d, 0, nil)
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) clockTimer {
+	return c.add(d, 0, f)
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) clockTicker {
+	return fakeTicker{c.add(d, d, nil)}
+}
+
+func (c *fakeClock) add(d, period time.Duration, fn func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1), fn: fn, when: c.now.Add(d), period: period, active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing every timer that comes due
+// on the way. AfterFunc callbacks run on the caller's goroutine.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		var next *fakeTimer
+		for _, t := range c.timers {
+			if t.active && !t.when.After(target) && (next == nil || t.when.Before(next.when)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		c.now = next.when
+		if next.period > 0 {
+			next.when = next.when.Add(next.period)
+		} else {
+			next.active = false
+		}
+		if next.fn != nil {
+			c.mu.Unlock()
+			next.fn()
+			c.mu.Lock()
+			continue
+		}
+		select {
+		case next.c <- c.now:
+		default:
+		}
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+// pending reports whether a timer is waiting to fire at when.
+func (c *fakeClock) pending(when time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.timers {
+		if t.active && t.when.Equal(when) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.when, t.active = t.clock.now.Add(d), true
+	return active
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+// fakeRunner starts processes for real and counts the launches.
+type fakeRunner struct {
+	starts atomic.Int32
+}
+
+func (r *fakeRunner) Start(cmd *exec.Cmd) error {
+	r.starts.Add(1)
+	return execRunner{}.Start(cmd)
+}
+
+func (r *fakeRunner) StartPTY(cmd *exec.Cmd, size *pty.Winsize) (*os.File, error) {
+	r.starts.Add(1)
+	return execRunner{}.StartPTY(cmd, size)
+}
+
+// fakeWindows replays one snapshot per call and repeats the last one.
+type fakeWindows struct {
+	mu        sync.Mutex
+	snapshots [][]windows.Window
+	calls     int
+}
+
+func (w *fakeWindows) Snapshot() ([]windows.Window, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	snap := w.snapshots[min(w.calls, len(w.snapshots)-1)]
+	w.calls++
+	return snap, nil
+}
+
+func (w *fakeWindows) Title(int32, uint64) (string, bool) {
+	return "", false
+}
+
+func (w *fakeWindows) BrowserURL(string) (string, error) {
+	return "", nil
+}
+
+func (w *fakeWindows) snapshotsTaken() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.calls
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func useTestState(t *testing.T) StateConfig {
+	t.Helper()
+	previous := currentStateConfig()
+	state := StateConfig{Dir: t.TempDir(), Permissions: defaultPermissions}
+	setStateConfig(state)
+	t.Cleanup(func() {
+		flushJobHistory()
+		flushAuditLog()
+		setStateConfig(previous)
+	})
+	return state
+}
+
+func TestWatchJobDebouncesOnTheJobClock(t *testing.T) {
+	state := useTestState(t)
+	root := t.TempDir()
+	for _, name := range []string{"a.go", "b.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	debounce := int64(200)
+	cfg, err := normalizeWatcher(rawWatcher{Name: "w", Path: root, Command: "true", DebounceMs: &debounce}, 0, rawDefaults{}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk := newFakeClock()
+	batches := make(chan []Trigger, 4)
+	job, err := startWatchJob(cfg, jobRuntime{clock: clk, runner: &fakeRunner{}}, func(triggers []Trigger) {
+		batches <- triggers
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer job.Close()
+
+	// Events during warmup are dropped, so let it pass on the fake clock.
+	clk.Advance(cfg.Warmup)
+	start := clk.Now()
+	job.events <- polledEvent{event: notify.Write, path: filepath.Join(root, "a.go")}
+	waitFor(t, "the debounce timer", func() bool { return clk.pending(start.Add(200 * time.Millisecond)) })
+	clk.Advance(150 * time.Millisecond)
+	job.events <- polledEvent{event: notify.Write, path: filepath.Join(root, "b.go")}
+	waitFor(t, "the debounce timer to restart", func() bool { return clk.pending(start.Add(350 * time.Millisecond)) })
+
+	clk.Advance(199 * time.Millisecond)
+	select {
+	case batch := <-batches:
+		t.Fatalf("batch %v delivered before the debounce window closed", batch)
+	default:
+	}
+
+	clk.Advance(time.Millisecond)
+	select {
+	case batch := <-batches:
+		var paths []string
+		for _, trigger := range batch {
+			paths = append(paths, trigger.Path)
+		}
+		sort.Strings(paths)
+		if len(paths) != 2 || paths[0] != "a.go" || paths[1] != "b.go" {
+			t.Fatalf("batch paths %v, want [a.go b.go]", paths)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch after the debounce window closed")
+	}
+}
+
+func TestServerJobWaitsRestartDelayOnTheJobClock(t *testing.T) {
+	state := useTestState(t)
+	restart, delay := true, int64(5000)
+	cfg, err := normalizeServer(rawServer{Name: "srv", Command: "true", Cwd: t.TempDir(), Restart: &restart, RestartDelayMs: &delay}, 0, rawDefaults{}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk := newFakeClock()
+	runner := &fakeRunner{}
+	job, err := newServerJob(cfg, nil, jobRuntime{clock: clk, runner: runner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer job.Close()
+
+	restartAt := clk.Now().Add(5 * time.Second)
+	waitFor(t, "the restart delay", func() bool { return clk.pending(restartAt) })
+	if starts := runner.starts.Load(); starts != 1 {
+		t.Fatalf("%d launches before the restart delay passed, want 1", starts)
+	}
+	clk.Advance(5*time.Second - time.Millisecond)
+	if starts := runner.starts.Load(); starts != 1 {
+		t.Fatalf("%d launches before the restart delay passed, want 1", starts)
+	}
+	clk.Advance(time.Millisecond)
+	waitFor(t, "the second launch", func() bool { return runner.starts.Load() == 2 })
+}
+
+func TestWindowTrackerSessionsFollowTheClock(t *testing.T) {
+	editor := windows.Window{Owner: "Editor", Title: "main.go", ID: 1, PID: 10, OnScreen: true}
+	browser := windows.Window{Owner: "Browser", Title: "docs", ID: 2, PID: 20, OnScreen: true}
+	source := &fakeWindows{snapshots: [][]windows.Window{
+		{editor}, {editor}, {editor}, {editor},
+		{browser, editor}, {browser, editor}, {browser, editor},
+		{browser},
+	}}
+	clk := newFakeClock()
+	start := clk.Now()
+	cfg := WindowTrackerConfig{
+		Enabled:      true,
+		TrackAll:     true,
+		TrackFocus:   true,
+		PollInterval: time.Second,
+		MinFocus:     2 * time.Second,
+		DBPath:       filepath.Join(t.TempDir(), "windows.db"),
+		DirMode:      0o755,
+	}
+
+	tracker := &WindowTracker{clock: clk, windows: source}
+	tracker.mu.Lock()
+	err := tracker.startLocked(cfg)
+	tracker.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first snapshot only checks that windows can be listed; each tick
+	// after that is one poll.
+	waitFor(t, "the poll ticker", func() bool { return clk.pending(start.Add(time.Second)) })
+	for tick := 1; tick <= 7; tick++ {
+		clk.Advance(time.Second)
+		waitFor(t, "the poll", func() bool { return source.snapshotsTaken() > tick })
+	}
+	tracker.Stop()
+
+	db, err := sql.Open("sqlite", cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sessions := map[string][2]time.Time{}
+	rows, err := db.Query(`SELECT app_name, opened_at, closed_at FROM window_sessions`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var (
+			app            string
+			opened, closed sql.NullTime
+		)
+		if err := rows.Scan(&app, &opened, &closed); err != nil {
+			t.Fatal(err)
+		}
+		sessions[app] = [2]time.Time{opened.Time, closed.Time}
+	}
+	rows.Close()
+	wantSessions := map[string][2]time.Time{
+		"Editor":  {start.Add(time.Second), start.Add(7 * time.Second)},
+		"Browser": {start.Add(4 * time.Second), start.Add(7 * time.Second)},
+	}
+	for app, want := range wantSessions {
+		got, ok := sessions[app]
+		if !ok || !got[0].Equal(want[0]) || !got[1].Equal(want[1]) {
+			t.Errorf("%s window session %v, want opened %s and closed %s", app, got, want[0], want[1])
+		}
+	}
+	if len(sessions) != len(wantSessions) {
+		t.Errorf("%d window sessions, want %d", len(sessions), len(wantSessions))
+	}
+
+	focus := map[string]int64{}
+	rows, err = db.Query(`SELECT app_name, duration_ms FROM focus_sessions`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var (
+			app      string
+			duration int64
+		)
+		if err := rows.Scan(&app, &duration); err != nil {
+			t.Fatal(err)
+		}
+		focus[app] += duration
+	}
+	rows.Close()
+	if focus["Editor"] != 3000 || focus["Browser"] != 3000 || len(focus) != 2 {
+		t.Errorf("focus durations %v, want 3000ms each for Editor and Browser", focus)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var jobStateLog = componentLogger("state", "state")
+
+// jobHistory is what ghost remembers about a job's runs across daemon
+// restarts: the job_state row for its kind and name. Jobs load it when they
+// start and write it back whenever it changes.
+type jobHistory struct {
+	LastRun     time.Time
+	LastRunID   string
+	LastResult  string
+	LastTrigger string
+	Restarts    int
+	StoppedAt   time.Time
+}
+
+func createJobStateTable(tx *sql.Tx, _ string) error {
+	_, err := tx.Exec(`CREATE TABLE job_state (
+		kind TEXT NOT NULL,
+		name TEXT NOT NULL,
+		last_run TIMESTAMP,
+		last_run_id TEXT,
+		last_result TEXT,
+		last_trigger TEXT,
+		restarts INTEGER NOT NULL DEFAULT 0,
+		stopped_at TIMESTAMP,
+		PRIMARY KEY (kind, name)
+	)`)
+	return err
+}
+
+type jobHistoryKey struct {
+	kind, name string
+}
+
+// jobHistoryWriter saves histories from a goroutine of its own, so a slow
+// or locked state database never holds up a job that is holding its lock.
+// Only the newest history of each job waits to be written.
+type jobHistoryWriter struct {
+	mu      sync.Mutex
+	idle    sync.Cond
+	pending map[jobHistoryKey]jobHistory
+	writing map[jobHistoryKey]jobHistory
+	running bool
+}
+
+var historyWriter = newJobHistoryWriter()
+
+func newJobHistoryWriter() *jobHistoryWriter {
+	w := &jobHistoryWriter{
+		pending: make(map[jobHistoryKey]jobHistory),
+		writing: make(map[jobHistoryKey]jobHistory),
+	}
+	w.idle.L = &w.mu
+	return w
+}
+
+func (w *jobHistoryWriter) store(key jobHistoryKey, history jobHistory) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[key] = history
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+func (w *jobHistoryWriter) run() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.pending) > 0 {
+		for key, history := range w.pending {
+			delete(w.pending, key)
+			w.writing[key] = history
+			w.mu.Unlock()
+			writeJobHistory(key.kind, key.name, history)
+			w.mu.Lock()
+			delete(w.writing, key)
+			break
+		}
+	}
+	w.running = false
+	w.idle.Broadcast()
+}
+
+// lookup returns a history that is still waiting to be written, which is
+// newer than what the database has.
+func (w *jobHistoryWriter) lookup(key jobHistoryKey) (jobHistory, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if history, ok := w.pending[key]; ok {
+		return history, true
+	}
+	history, ok := w.writing[key]
+	return history, ok
+}
+
+// flush waits for every pending history to be written.
+func (w *jobHistoryWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.running {
+		w.idle.Wait()
+	}
+}
+
+// loadJobHistory returns the saved history of a job, or an empty one for a
+// job that never ran (or when the database can't be read).
+func loadJobHistory(kind, name string) jobHistory {
+	if history, ok := historyWriter.lookup(jobHistoryKey{kind, name}); ok {
+		return history
+	}
+	var history jobHistory
+	err := withStateDB(func(db *sql.DB) error {
+		var (
+			lastRun, stoppedAt     sql.NullTime
+			runID, result, trigger sql.NullString
+		)
+		err := db.QueryRow(`SELECT last_run, last_run_id, last_result, last_trigger, restarts, stopped_at FROM job_state WHERE kind = ? AND name = ?`, kind, name).
+			Scan(&lastRun, &runID, &result, &trigger, &history.Restarts, &stoppedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		history.LastRun, history.StoppedAt = lastRun.Time, stoppedAt.Time
+		history.LastRunID, history.LastResult, history.LastTrigger = runID.String, result.String, trigger.String
+		return nil
+	})
+	if err != nil {
+		jobStateLog.Warn("load history of %s %s: %v", kind, name, err)
+	}
+	return history
+}
+
+// storeJobHistory queues history to be saved and returns right away.
+func storeJobHistory(kind, name string, history jobHistory) {
+	historyWriter.store(jobHistoryKey{kind, name}, history)
+}
+
+// flushJobHistory waits until every queued history is saved, for shutdown.
+func flushJobHistory() {
+	historyWriter.flush()
+}
+
+func writeJobHistory(kind, name string, history jobHistory) {
+	err := withStateDB(func(db *sql.DB) error {
+		_, err := db.Exec(`INSERT INTO job_state (kind, name, last_run, last_run_id, last_result, last_trigger, restarts, stopped_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (kind, name) DO UPDATE SET last_run = excluded.last_run, last_run_id = excluded.last_run_id,
+				last_result = excluded.last_result, last_trigger = excluded.last_trigger,
+				restarts = excluded.restarts, stopped_at = excluded.stopped_at`,
+			kind, name, nullTime(history.LastRun), nullIfEmpty(history.LastRunID), nullIfEmpty(history.LastResult),
+			nullIfEmpty(history.LastTrigger), history.Restarts, nullTime(history.StoppedAt))
+		return err
+	})
+	if err != nil {
+		jobStateLog.Error("save history of %s %s: %v", kind, name, err)
+	}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// runResult is the short form of how a run ended that status shows.
+func runResult(err error) string {
+	var (
+		timeout *runTimeoutError
+		exitErr *exec.ExitError
+	)
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &timeout):
+		return timeout.Error()
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		return fmt.Sprintf("exit %d", exitErr.ExitCode())
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestManualTriggerPathStaysInsideTheRoot(t *testing.T) {
+	state := useTestState(t)
+	root := t.TempDir()
+	cfg, err := normalizeWatcher(rawWatcher{Name: "w", Path: root, Command: "true"}, 0, rawDefaults{}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := startWatchJob(cfg, jobRuntime{clock: newFakeClock(), runner: &fakeRunner{}}, func([]Trigger) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer job.Close()
+
+	for _, path := range []string{"../../etc/passwd", "..", "src/../../x", filepath.Join(filepath.Dir(root), "x")} {
+		if err := job.Trigger(path); err == nil {
+			t.Errorf("Trigger(%q) accepted a path outside the watch root", path)
+		}
+	}
+	for _, path := range []string{"src/app.ts", "src/../app.ts", filepath.Join(root, "app.ts")} {
+		if err := job.Trigger(path); err != nil {
+			t.Errorf("Trigger(%q): %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var keepAwakeWarnOnce sync.Once
+
+// Keep-awake modes. "system" stops idle sleep; "display" also keeps the
+// screen on, which matters for recordings and anything drawing to the GPU.
+const (
+	keepAwakeSystem  = "system"
+	keepAwakeDisplay = "display"
+)
+
+func normalizeKeepAwake(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case bool:
+		if v {
+			return keepAwakeSystem, nil
+		}
+		return "", nil
+	case string:
+		switch mode := strings.ToLower(strings.TrimSpace(v)); mode {
+		case "", "false", "off":
+			return "", nil
+		case "true", keepAwakeSystem:
+			return keepAwakeSystem, nil
+		case keepAwakeDisplay:
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("keep_awake must be true, false, \"system\" or \"display\", got %v", value)
+}
+
+// keepAwake holds a sleep assertion for as long as a job's process runs and
+// returns the function that releases it. Failures are logged once, not
+// fatal: a job should still run on a machine that might doze off.
+func keepAwake(mode, reason string, log logger) func() {
+	if mode == "" {
+		return func() {}
+	}
+	release, err := holdAwake(mode, reason)
+	if err != nil {
+		keepAwakeWarnOnce.Do(func() {
+			log.Warn("keep_awake: %v; jobs will not hold the machine awake", err)
+		})
+		return func() {}
+	}
+	return release
+}
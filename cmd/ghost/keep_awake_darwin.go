@@ -0,0 +1,37 @@
+//go:build darwin
+
+package main
+
+/*
+#cgo LDFLAGS: -framework IOKit -framework CoreFoundation
+#include <IOKit/pwr_mgt/IOPMLib.h>
+#include <stdlib.h>
+
+static IOReturn ghostHoldAwake(int display, const char *reason, IOPMAssertionID *id) {
+	CFStringRef name = CFStringCreateWithCString(kCFAllocatorDefault, reason, kCFStringEncodingUTF8);
+	CFStringRef kind = display ? kIOPMAssertionTypePreventUserIdleDisplaySleep : kIOPMAssertionTypePreventUserIdleSystemSleep;
+	IOReturn result = IOPMAssertionCreateWithName(kind, kIOPMAssertionLevelOn, name, id);
+	CFRelease(name);
+	return result;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func holdAwake(mode, reason string) (func(), error) {
+	cReason := C.CString(reason)
+	defer C.free(unsafe.Pointer(cReason))
+	display := C.int(0)
+	if mode == keepAwakeDisplay {
+		display = 1
+	}
+	var id C.IOPMAssertionID
+	if result := C.ghostHoldAwake(display, cReason, &id); result != C.kIOReturnSuccess {
+		return nil, fmt.Errorf("IOPMAssertionCreateWithName failed: 0x%x", uint32(result))
+	}
+	return func() { C.IOPMAssertionRelease(id) }, nil
+}
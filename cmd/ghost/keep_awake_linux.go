@@ -0,0 +1,36 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// holdAwake takes a logind inhibitor lock through systemd-inhibit, which
+// holds it for as long as its child runs. Releasing kills the whole group so
+// the sleep child doesn't outlive it.
+func holdAwake(mode, reason string) (func(), error) {
+	path, err := exec.LookPath("systemd-inhibit")
+	if err != nil {
+		return nil, fmt.Errorf("systemd-inhibit not found: %w", err)
+	}
+	what := "sleep"
+	if mode == keepAwakeDisplay {
+		what = "sleep:idle"
+	}
+	cmd := exec.Command(path, "--what="+what, "--who=ghost", "--why="+reason, "--mode=block", "sleep", "infinity")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start systemd-inhibit: %w", err)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			_ = signalProcess(cmd.Process, syscall.SIGKILL, true)
+			_ = cmd.Wait()
+		})
+	}, nil
+}
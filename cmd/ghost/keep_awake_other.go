@@ -0,0 +1,9 @@
+//go:build !darwin && !linux
+
+package main
+
+import "errors"
+
+func holdAwake(mode, reason string) (func(), error) {
+	return nil, errors.New("not supported on this platform")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+func normalizeLabels(labels map[string]any) (map[string]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make(map[string]string, len(labels))
+	for _, key := range keys {
+		value := labels[key]
+		if !labelKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("label %q: keys may only contain letters, digits, '_', '.' and '-'", key)
+		}
+		switch value.(type) {
+		case string, int64, float64, bool:
+		default:
+			return nil, fmt.Errorf("label %s must be a string", key)
+		}
+		str, _ := valueToString(value)
+		result[key] = str
+	}
+	return result, nil
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + labels[key]
+	}
+	return strings.Join(parts, ",")
+}
+
+type labelRequirement struct {
+	key    string
+	value  string
+	negate bool
+	exists bool
+}
+
+type labelSelector []labelRequirement
+
+func parseLabelSelector(values []string) (labelSelector, error) {
+	var selector labelSelector
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			var req labelRequirement
+			switch {
+			case strings.Contains(part, "!="):
+				key, val, _ := strings.Cut(part, "!=")
+				req = labelRequirement{key: strings.TrimSpace(key), value: strings.TrimSpace(val), negate: true}
+			case strings.Contains(part, "="):
+				key, val, _ := strings.Cut(part, "=")
+				req = labelRequirement{key: strings.TrimSpace(key), value: strings.TrimSpace(val)}
+			case strings.HasPrefix(part, "!"):
+				req = labelRequirement{key: strings.TrimSpace(part[1:]), exists: true, negate: true}
+			default:
+				req = labelRequirement{key: part, exists: true}
+			}
+			if !labelKeyPattern.MatchString(req.key) {
+				return nil, fmt.Errorf("invalid label selector %q", part)
+			}
+			selector = append(selector, req)
+		}
+	}
+	return selector, nil
+}
+
+func (s labelSelector) matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, ok := labels[req.key]
+		matched := ok
+		if !req.exists {
+			matched = ok && value == req.value
+		}
+		if matched == req.negate {
+			return false
+		}
+	}
+	return true
+}
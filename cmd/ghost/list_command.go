@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strings"
+)
+
+type jobListing struct {
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	Command   string            `json:"command"`
+	Root      string            `json:"root,omitempty"`
+	Roots     []string          `json:"roots,omitempty"`
+	Cwd       string            `json:"cwd,omitempty"`
+	Schedule  string            `json:"schedule,omitempty"`
+	DependsOn []string          `json:"depends_on,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type jobListings []jobListing
+
+func runListCommand(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	formatValue := formatFlag(fs)
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) > 1 {
+		return errors.New("usage: ghost list [config] [-format table|json|yaml|csv]")
+	}
+	format, err := parseOutputFormat(*formatValue)
+	if err != nil {
+		return err
+	}
+
+	var configPath string
+	if len(paths) == 1 {
+		configPath, err = resolvePath(paths[0])
+	} else {
+		configPath, err = determineConfigPath()
+	}
+	if err != nil {
+		return err
+	}
+	cfg, err := readConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	listings := jobListings{}
+	for _, watcher := range cfg.Watchers {
+		listings = append(listings, jobListing{Kind: "watcher", Name: watcher.Name, Command: watcher.CommandDisplay, Root: watcher.WatchRoot, Roots: multipleRoots(watcher.Roots), Labels: watcher.Labels})
+	}
+	for _, server := range cfg.Servers {
+		listings = append(listings, jobListing{Kind: "server", Name: server.Name, Command: server.CommandDisplay, Cwd: server.Cwd, DependsOn: server.DependsOn, Labels: server.Labels})
+	}
+	for _, schedule := range cfg.Schedules {
+		listings = append(listings, jobListing{Kind: "schedule", Name: schedule.Name, Command: schedule.CommandDisplay, Cwd: schedule.Cwd, Schedule: schedule.describe(), Labels: schedule.Labels})
+	}
+	return writeOutput(os.Stdout, format, listings, listings.table)
+}
+
+func (l jobListings) table() outputTable {
+	table := outputTable{header: []string{"KIND", "NAME", "COMMAND", "DETAIL"}}
+	for _, listing := range l {
+		var detail []string
+		switch {
+		case listing.Root != "":
+			detail = append(detail, joinRoots(listing.Root, listing.Roots))
+		case listing.Schedule != "":
+			detail = append(detail, listing.Schedule)
+		}
+		if len(listing.DependsOn) > 0 {
+			detail = append(detail, "depends on "+strings.Join(listing.DependsOn, ", "))
+		}
+		table.rows = append(table.rows, []string{listing.Kind, listing.Name, listing.Command, strings.Join(detail, "; ")})
+	}
+	return table
+}
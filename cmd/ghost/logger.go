@@ -1,27 +1,204 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
-var logMu sync.Mutex
+type logLevel int
 
-func logInfo(format string, args ...any) {
-	logWithWriter(os.Stdout, format, args...)
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = map[logLevel]string{
+	levelDebug: "debug",
+	levelInfo:  "info",
+	levelWarn:  "warn",
+	levelError: "error",
 }
 
-func logError(format string, args ...any) {
-	logWithWriter(os.Stderr, format, args...)
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+type LogSettings struct {
+	Format string
+	Level  logLevel
+}
+
+type logFields struct {
+	Component string
+	Job       string
+	PID       int
+	Trigger   string
+	RunID     string
+}
+
+type jsonLogLine struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Component string `json:"component"`
+	Job       string `json:"job,omitempty"`
+	PID       int    `json:"pid,omitempty"`
+	Trigger   string `json:"trigger,omitempty"`
+	RunID     string `json:"run_id,omitempty"`
+	Message   string `json:"msg"`
+}
+
+var (
+	logMu       sync.Mutex
+	logSettings = LogSettings{Format: "text", Level: levelInfo}
+)
+
+func normalizeLogSettings(format, level string) (LogSettings, error) {
+	settings := LogSettings{Format: "text", Level: levelInfo}
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text":
+	case "json":
+		settings.Format = "json"
+	default:
+		return LogSettings{}, fmt.Errorf("log_format: unsupported value %q (use text or json)", format)
+	}
+	if level = strings.ToLower(strings.TrimSpace(level)); level != "" {
+		parsed, ok := parseLogLevel(level)
+		if !ok {
+			return LogSettings{}, fmt.Errorf("log_level: unsupported value %q (use debug, info, warn or error)", level)
+		}
+		settings.Level = parsed
+	}
+	return settings, nil
 }
 
-func logWithWriter(writer *os.File, format string, args ...any) {
+func parseLogLevel(value string) (logLevel, bool) {
+	if value == "warning" {
+		return levelWarn, true
+	}
+	for level, name := range logLevelNames {
+		if name == value {
+			return level, true
+		}
+	}
+	return levelInfo, false
+}
+
+func setLogSettings(settings LogSettings) {
 	logMu.Lock()
 	defer logMu.Unlock()
+	logSettings = settings
+}
 
-	timestamp := time.Now().Format("15:04:05.000")
+type logger struct {
+	prefix string
+	fields logFields
+}
+
+var daemonLog = logger{fields: logFields{Component: "daemon"}}
+
+func componentLogger(component, prefix string) logger {
+	return logger{prefix: prefix, fields: logFields{Component: component}}
+}
+
+func (l logger) withPID(pid int) logger {
+	l.fields.PID = pid
+	return l
+}
+
+func (l logger) withTrigger(trigger string) logger {
+	l.fields.Trigger = trigger
+	return l
+}
+
+func (l logger) withRun(id string) logger {
+	l.fields.RunID = id
+	return l
+}
+
+func newRunID() string {
+	var buf [4]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+func (l logger) Debug(format string, args ...any) {
+	l.log(levelDebug, format, args...)
+}
+
+func (l logger) Info(format string, args ...any) {
+	l.log(levelInfo, format, args...)
+}
+
+func (l logger) Warn(format string, args ...any) {
+	l.log(levelWarn, format, args...)
+}
+
+func (l logger) Error(format string, args ...any) {
+	l.log(levelError, format, args...)
+}
+
+func (l logger) log(level logLevel, format string, args ...any) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Fprintf(writer, "[ghost %s] %s\n", timestamp, message)
+	text := message
+	if l.fields.RunID != "" {
+		text = "[run " + l.fields.RunID + "] " + text
+	}
+	if l.prefix != "" {
+		text = l.prefix + " " + text
+	}
+
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	if level < logSettings.Level {
+		return
+	}
+	writer := os.Stdout
+	if level >= levelWarn {
+		writer = os.Stderr
+	}
+
+	now := time.Now()
+	if logSettings.Format == "json" {
+		line, err := json.Marshal(jsonLogLine{
+			Time:      now.Format(time.RFC3339Nano),
+			Level:     level.String(),
+			Component: l.fields.Component,
+			Job:       l.fields.Job,
+			PID:       l.fields.PID,
+			Trigger:   l.fields.Trigger,
+			RunID:     l.fields.RunID,
+			Message:   message,
+		})
+		if err == nil {
+			fmt.Fprintf(writer, "%s\n", line)
+		}
+	} else {
+		fmt.Fprintf(writer, "[ghost %s] %s\n", now.Format("15:04:05.000"), text)
+	}
+	forwardSystemLog(systemLogDaemonCategory, level >= levelWarn, text)
+}
+
+func logDebug(format string, args ...any) {
+	daemonLog.Debug(format, args...)
+}
+
+func logInfo(format string, args ...any) {
+	daemonLog.Info(format, args...)
+}
+
+func logWarn(format string, args ...any) {
+	daemonLog.Warn(format, args...)
+}
+
+func logError(format string, args ...any) {
+	daemonLog.Error(format, args...)
 }
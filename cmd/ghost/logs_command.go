@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logPrefixColors = []string{"36", "33", "35", "32", "34", "31", "96", "93"}
+
+func runLogsCommand(args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "keep printing new log lines as they are written")
+	lines := fs.Int("n", 20, "number of trailing lines to show")
+	names, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var servers []serverInfo
+	if err := controlRequest("GET", "/v1/servers", nil, &servers); err != nil {
+		return err
+	}
+	var watchers []watcherInfo
+	if err := controlRequest("GET", "/v1/watchers", nil, &watchers); err != nil {
+		return err
+	}
+	available := make([]logTarget, 0, len(servers)+len(watchers))
+	for _, server := range servers {
+		if server.LogPath != "" {
+			available = append(available, logTarget{Name: server.Name, LogPath: server.LogPath})
+		}
+	}
+	for _, watcher := range watchers {
+		if watcher.LogPath != "" {
+			available = append(available, logTarget{Name: watcher.Name, LogPath: watcher.LogPath})
+		}
+	}
+
+	targets, err := selectLogTargets(available, names)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return errors.New("no servers or watchers are configured")
+	}
+
+	printer := newLogPrinter(targets, len(targets) > 1 || len(names) == 0)
+	for _, target := range targets {
+		if err := printer.printTail(target, *lines); err != nil {
+			return err
+		}
+	}
+	if !*follow {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target logTarget) {
+			defer wg.Done()
+			printer.follow(target)
+		}(target)
+	}
+	wg.Wait()
+	return nil
+}
+
+type logTarget struct {
+	Name    string
+	LogPath string
+}
+
+func selectLogTargets(targets []logTarget, names []string) ([]logTarget, error) {
+	if len(names) == 0 {
+		return targets, nil
+	}
+	byName := make(map[string]logTarget, len(targets))
+	for _, target := range targets {
+		if _, ok := byName[target.Name]; !ok {
+			byName[target.Name] = target
+		}
+	}
+	result := make([]logTarget, 0, len(names))
+	for _, name := range names {
+		target, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown server or watcher %q", name)
+		}
+		result = append(result, target)
+	}
+	return result, nil
+}
+
+type logPrinter struct {
+	mu       sync.Mutex
+	prefixes map[string]string
+}
+
+func newLogPrinter(targets []logTarget, prefixed bool) *logPrinter {
+	printer := &logPrinter{prefixes: make(map[string]string, len(targets))}
+	if !prefixed {
+		return printer
+	}
+	width := 0
+	for _, target := range targets {
+		if len(target.Name) > width {
+			width = len(target.Name)
+		}
+	}
+	color := stdoutSupportsColor()
+	for i, target := range targets {
+		label := fmt.Sprintf("%-*s | ", width, target.Name)
+		if color {
+			label = "\x1b[" + logPrefixColors[i%len(logPrefixColors)] + "m" + label + "\x1b[0m"
+		}
+		printer.prefixes[target.Name] = label
+	}
+	return printer
+}
+
+func (p *logPrinter) writeLine(name string, line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	os.Stdout.WriteString(p.prefixes[name])
+	os.Stdout.Write(line)
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		os.Stdout.WriteString("\n")
+	}
+}
+
+func (p *logPrinter) printTail(target logTarget, count int) error {
+	if count <= 0 {
+		return nil
+	}
+	lines, err := tailLines(target.LogPath, count)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read %s log: %w", target.Name, err)
+	}
+	for _, line := range lines {
+		p.writeLine(target.Name, line)
+	}
+	return nil
+}
+
+func (p *logPrinter) follow(target logTarget) {
+	var offset int64
+	if info, err := os.Stat(target.LogPath); err == nil {
+		offset = info.Size()
+	}
+
+	var partial []byte
+	for {
+		time.Sleep(250 * time.Millisecond)
+
+		info, err := os.Stat(target.LogPath)
+		if err != nil {
+			continue
+		}
+		if info.Size() < offset {
+			offset = 0
+			partial = nil
+		}
+		if info.Size() == offset {
+			continue
+		}
+
+		file, err := os.Open(target.LogPath)
+		if err != nil {
+			continue
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			continue
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+		offset += int64(len(data))
+
+		data = append(partial, data...)
+		for {
+			idx := bytes.IndexByte(data, '\n')
+			if idx < 0 {
+				break
+			}
+			p.writeLine(target.Name, data[:idx+1])
+			data = data[idx+1:]
+		}
+		partial = append([]byte(nil), data...)
+	}
+}
+
+func tailLines(path string, count int) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const chunkSize = 64 * 1024
+	var (
+		size = info.Size()
+		data []byte
+	)
+	for size > 0 && bytes.Count(data, []byte{'\n'}) <= count {
+		readSize := int64(chunkSize)
+		if size < readSize {
+			readSize = size
+		}
+		size -= readSize
+		chunk := make([]byte, readSize)
+		if _, err := file.ReadAt(chunk, size); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		data = append(chunk, data...)
+	}
+
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return lines, nil
+}
+
+func stdoutSupportsColor() bool {
+	if os.Getenv("NO_COLOR") != "" || strings.EqualFold(os.Getenv("TERM"), "dumb") {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
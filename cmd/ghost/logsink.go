@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	systemLogDaemonCategory = "daemon"
+	maxForwardedLine        = 8 << 10
+)
+
+type LoggingConfig struct {
+	SystemLog   bool
+	IncludeJobs bool
+	Subsystem   string
+}
+
+type systemLogger interface {
+	Log(category string, isError bool, message string)
+	Close() error
+}
+
+var (
+	systemLogMu  sync.Mutex
+	systemLog    systemLogger
+	systemLogCfg LoggingConfig
+
+	ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07]*\x07`)
+)
+
+func normalizeLogging(raw rawLogging) LoggingConfig {
+	cfg := LoggingConfig{
+		SystemLog:   valueOrDefaultBool(raw.SystemLog, false),
+		IncludeJobs: valueOrDefaultBool(raw.IncludeJobs, false),
+		Subsystem:   strings.TrimSpace(raw.Subsystem),
+	}
+	if !cfg.SystemLog {
+		return LoggingConfig{}
+	}
+	return cfg
+}
+
+func applyLogging(cfg LoggingConfig) error {
+	systemLogMu.Lock()
+	defer systemLogMu.Unlock()
+
+	if cfg == systemLogCfg && (systemLog != nil) == cfg.SystemLog {
+		return nil
+	}
+	if systemLog != nil {
+		_ = systemLog.Close()
+		systemLog = nil
+	}
+	systemLogCfg = LoggingConfig{}
+	if !cfg.SystemLog {
+		return nil
+	}
+
+	logger, err := newSystemLogger(cfg.Subsystem)
+	if err != nil {
+		return fmt.Errorf("logging.system_log: %w", err)
+	}
+	systemLog = logger
+	systemLogCfg = cfg
+	return nil
+}
+
+func closeSystemLog() {
+	_ = applyLogging(LoggingConfig{})
+}
+
+func forwardSystemLog(category string, isError bool, message string) {
+	systemLogMu.Lock()
+	defer systemLogMu.Unlock()
+	if systemLog == nil {
+		return
+	}
+	systemLog.Log(category, isError, message)
+}
+
+func forwardingJobOutput() bool {
+	systemLogMu.Lock()
+	defer systemLogMu.Unlock()
+	return systemLog != nil && systemLogCfg.IncludeJobs
+}
+
+type outputForwarder struct {
+	stdout *lineWriter
+	stderr *lineWriter
+}
+
+func newOutputForwarder(job string, secrets secretSet) *outputForwarder {
+	if !forwardingJobOutput() {
+		return nil
+	}
+	forward := func(isError bool) func(string) {
+		return func(line string) {
+			forwardSystemLog(job, isError, secrets.redactString(line))
+		}
+	}
+	return &outputForwarder{
+		stdout: &lineWriter{onLine: forward(false)},
+		stderr: &lineWriter{onLine: forward(true)},
+	}
+}
+
+func (f *outputForwarder) wrap(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if f == nil {
+		return stdout, stderr
+	}
+	return io.MultiWriter(stdout, f.stdout), io.MultiWriter(stderr, f.stderr)
+}
+
+func (f *outputForwarder) Flush() {
+	if f == nil {
+		return
+	}
+	f.stdout.Flush()
+	f.stderr.Flush()
+}
+
+type lineWriter struct {
+	onLine func(line string)
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		index := bytes.IndexByte(w.buf, '\n')
+		if index < 0 {
+			break
+		}
+		w.emit(w.buf[:index])
+		w.buf = w.buf[index+1:]
+	}
+	if len(w.buf) > maxForwardedLine {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) emit(line []byte) {
+	text := strings.TrimRight(ansiEscapePattern.ReplaceAllString(string(line), ""), "\r")
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	w.onLine(text)
+}
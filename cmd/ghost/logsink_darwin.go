@@ -0,0 +1,82 @@
+//go:build darwin
+
+package main
+
+/*
+#include <os/log.h>
+#include <os/object.h>
+#include <stdlib.h>
+
+static os_log_t ghostOSLogCreate(const char *subsystem, const char *category) {
+	return os_log_create(subsystem, category);
+}
+
+static void ghostOSLog(os_log_t log, int isError, const char *message) {
+	os_log_with_type(log, isError ? OS_LOG_TYPE_ERROR : OS_LOG_TYPE_DEFAULT, "%{public}s", message);
+}
+
+static void ghostOSLogRelease(os_log_t log) {
+	os_release(log);
+}
+*/
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+type osLogLogger struct {
+	mu        sync.Mutex
+	subsystem *C.char
+	logs      map[string]C.os_log_t
+}
+
+func newSystemLogger(subsystem string) (systemLogger, error) {
+	if subsystem == "" {
+		subsystem = "dev.nikiv.ghost"
+	}
+	return &osLogLogger{subsystem: C.CString(subsystem), logs: make(map[string]C.os_log_t)}, nil
+}
+
+// log returns the os_log_t for category, creating it on first use. Each one
+// lives until the sink is closed.
+func (l *osLogLogger) log(category string) C.os_log_t {
+	if log, ok := l.logs[category]; ok {
+		return log
+	}
+	cCategory := C.CString(category)
+	defer C.free(unsafe.Pointer(cCategory))
+	log := C.ghostOSLogCreate(l.subsystem, cCategory)
+	l.logs[category] = log
+	return log
+}
+
+func (l *osLogLogger) Log(category string, isError bool, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subsystem == nil {
+		return
+	}
+	cMessage := C.CString(message)
+	defer C.free(unsafe.Pointer(cMessage))
+	var flag C.int
+	if isError {
+		flag = 1
+	}
+	C.ghostOSLog(l.log(category), flag, cMessage)
+}
+
+func (l *osLogLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, log := range l.logs {
+		C.ghostOSLogRelease(log)
+	}
+	clear(l.logs)
+	if l.subsystem != nil {
+		C.free(unsafe.Pointer(l.subsystem))
+		l.subsystem = nil
+	}
+	return nil
+}
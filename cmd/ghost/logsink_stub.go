@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func newSystemLogger(subsystem string) (systemLogger, error) {
+	return nil, fmt.Errorf("system log forwarding is not supported on %s", runtime.GOOS)
+}
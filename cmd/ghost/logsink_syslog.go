@@ -0,0 +1,70 @@
+//go:build unix && !darwin
+
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+	"sync"
+)
+
+type syslogLogger struct {
+	tag string
+
+	mu      sync.Mutex
+	writers map[string]*syslog.Writer
+}
+
+func newSystemLogger(subsystem string) (systemLogger, error) {
+	if subsystem == "" {
+		subsystem = "ghost"
+	}
+	logger := &syslogLogger{tag: subsystem, writers: make(map[string]*syslog.Writer)}
+	if _, err := logger.writer(systemLogDaemonCategory); err != nil {
+		return nil, err
+	}
+	return logger, nil
+}
+
+func (l *syslogLogger) writer(category string) (*syslog.Writer, error) {
+	if writer, ok := l.writers[category]; ok {
+		return writer, nil
+	}
+	tag := l.tag
+	if category != systemLogDaemonCategory {
+		tag = l.tag + "/" + category
+	}
+	writer, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("connect to syslog: %w", err)
+	}
+	l.writers[category] = writer
+	return writer, nil
+}
+
+func (l *syslogLogger) Log(category string, isError bool, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	writer, err := l.writer(category)
+	if err != nil {
+		return
+	}
+	if isError {
+		_ = writer.Err(message)
+	} else {
+		_ = writer.Info(message)
+	}
+}
+
+func (l *syslogLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var firstErr error
+	for category, writer := range l.writers {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(l.writers, category)
+	}
+	return firstErr
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMailInterval = time.Minute
+	mailTimeout         = 30 * time.Second
+	mailMaxLiteral      = 1 << 20
+	mailHeaderFields    = "FROM TO SUBJECT DATE MESSAGE-ID"
+)
+
+var imapUIDPattern = regexp.MustCompile(`\bUID (\d+)`)
+
+type rawMailTrigger struct {
+	Server      string `toml:"server"`
+	User        string `toml:"user"`
+	Password    string `toml:"password"`
+	PasswordEnv string `toml:"password_env"`
+	Mailbox     string `toml:"mailbox"`
+	From        string `toml:"from"`
+	Subject     string `toml:"subject"`
+}
+
+type MailTrigger struct {
+	Server      string
+	User        string
+	Password    string
+	PasswordEnv string
+	Mailbox     string
+	From        string
+	Subject     string
+
+	from    *regexp.Regexp
+	subject *regexp.Regexp
+}
+
+type mailMessage struct {
+	UID       uint32
+	From      string
+	To        string
+	Subject   string
+	Date      string
+	MessageID string
+}
+
+func normalizeMailTrigger(raw *rawMailTrigger, env map[string]string) (*MailTrigger, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	trigger := &MailTrigger{
+		Server:      strings.TrimSpace(raw.Server),
+		User:        strings.TrimSpace(raw.User),
+		Password:    raw.Password,
+		PasswordEnv: strings.TrimSpace(raw.PasswordEnv),
+		Mailbox:     strings.TrimSpace(raw.Mailbox),
+		From:        raw.From,
+		Subject:     raw.Subject,
+	}
+	if trigger.Server == "" {
+		return nil, errors.New("mail.server is required")
+	}
+	if _, _, err := net.SplitHostPort(trigger.Server); err != nil {
+		trigger.Server = net.JoinHostPort(trigger.Server, "993")
+	}
+	if trigger.User == "" {
+		return nil, errors.New("mail.user is required")
+	}
+	switch {
+	case trigger.Password != "" && trigger.PasswordEnv != "":
+		return nil, errors.New("mail: set either password or password_env, not both")
+	case trigger.Password == "" && trigger.PasswordEnv == "":
+		return nil, errors.New("mail: password or password_env is required")
+	}
+	if trigger.Mailbox == "" {
+		trigger.Mailbox = "INBOX"
+	}
+	var err error
+	if trigger.from, err = compileMailFilter(raw.From); err != nil {
+		return nil, fmt.Errorf("mail.from: %w", err)
+	}
+	if trigger.subject, err = compileMailFilter(raw.Subject); err != nil {
+		return nil, fmt.Errorf("mail.subject: %w", err)
+	}
+	if trigger.PasswordEnv != "" {
+		if _, ok := env[trigger.PasswordEnv]; !ok {
+			if _, ok := os.LookupEnv(trigger.PasswordEnv); !ok {
+				return nil, fmt.Errorf("mail.password_env: %s is not set", trigger.PasswordEnv)
+			}
+		}
+	}
+	return trigger, nil
+}
+
+func compileMailFilter(pattern string) (*regexp.Regexp, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+func (t *MailTrigger) password(env map[string]string) string {
+	if t.PasswordEnv == "" {
+		return t.Password
+	}
+	if value, ok := env[t.PasswordEnv]; ok {
+		return value
+	}
+	return os.Getenv(t.PasswordEnv)
+}
+
+func (t *MailTrigger) matches(msg mailMessage) bool {
+	if t.from != nil && !t.from.MatchString(msg.From) {
+		return false
+	}
+	if t.subject != nil && !t.subject.MatchString(msg.Subject) {
+		return false
+	}
+	return true
+}
+
+func (t *MailTrigger) describe() string {
+	return fmt.Sprintf("mail %s/%s", t.Server, t.Mailbox)
+}
+
+func (m mailMessage) env(mailbox string) map[string]string {
+	return map[string]string{
+		"GHOST_MAIL_UID":        strconv.FormatUint(uint64(m.UID), 10),
+		"GHOST_MAIL_MAILBOX":    mailbox,
+		"GHOST_MAIL_FROM":       m.From,
+		"GHOST_MAIL_TO":         m.To,
+		"GHOST_MAIL_SUBJECT":    m.Subject,
+		"GHOST_MAIL_DATE":       m.Date,
+		"GHOST_MAIL_MESSAGE_ID": m.MessageID,
+	}
+}
+
+func (m mailMessage) String() string {
+	return fmt.Sprintf("mail from %s: %s", m.From, m.Subject)
+}
+
+type mailCursor struct {
+	Validity uint32
+	LastUID  uint32
+}
+
+func mailCursorPath(name string) string {
+	base := sanitizeFilename(name)
+	if base == "" {
+		base = "schedule"
+	}
+	return filepath.Join(currentStateConfig().Dir, "cache", base+".imap")
+}
+
+func loadMailCursor(name string) (mailCursor, bool) {
+	data, err := os.ReadFile(mailCursorPath(name))
+	if err != nil {
+		return mailCursor{}, false
+	}
+	var cursor mailCursor
+	if _, err := fmt.Sscanf(string(data), "%d %d", &cursor.Validity, &cursor.LastUID); err != nil {
+		return mailCursor{}, false
+	}
+	return cursor, true
+}
+
+func storeMailCursor(name string, cursor mailCursor) error {
+	path := mailCursorPath(name)
+	perms := currentStateConfig().Permissions
+	if err := os.MkdirAll(filepath.Dir(path), perms.DirMode); err != nil {
+		return fmt.Errorf("create cache directory: %w", err)
+	}
+	return os.WriteFile(path, []byte(fmt.Sprintf("%d %d\n", cursor.Validity, cursor.LastUID)), perms.FileMode)
+}
+
+func fetchNewMail(t *MailTrigger, password string, cursor mailCursor, known bool) ([]mailMessage, mailCursor, error) {
+	conn, err := dialIMAP(t.Server)
+	if err != nil {
+		return nil, cursor, err
+	}
+	defer conn.close()
+
+	if _, err := conn.command("LOGIN %s %s", imapQuote(t.User), imapQuote(password)); err != nil {
+		return nil, cursor, fmt.Errorf("login: %w", err)
+	}
+	responses, err := conn.command("EXAMINE %s", imapQuote(t.Mailbox))
+	if err != nil {
+		return nil, cursor, fmt.Errorf("open %s: %w", t.Mailbox, err)
+	}
+	validity := imapStatusCode(responses, "UIDVALIDITY")
+	next := imapStatusCode(responses, "UIDNEXT")
+	if !known || validity != cursor.Validity {
+		if next > 0 {
+			next--
+		}
+		return nil, mailCursor{Validity: validity, LastUID: next}, nil
+	}
+	if next != 0 && next <= cursor.LastUID+1 {
+		return nil, cursor, nil
+	}
+
+	responses, err = conn.command("UID FETCH %d:* (UID BODY.PEEK[HEADER.FIELDS (%s)])", cursor.LastUID+1, mailHeaderFields)
+	if err != nil {
+		return nil, cursor, fmt.Errorf("fetch: %w", err)
+	}
+	var messages []mailMessage
+	for _, resp := range responses {
+		match := imapUIDPattern.FindStringSubmatch(resp.text)
+		if match == nil || len(resp.literals) == 0 {
+			continue
+		}
+		uid, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || uint32(uid) <= cursor.LastUID {
+			continue
+		}
+		messages = append(messages, parseMailHeaders(uint32(uid), resp.literals[0]))
+	}
+	_, _ = conn.command("LOGOUT")
+	sort.Slice(messages, func(i, j int) bool { return messages[i].UID < messages[j].UID })
+	return messages, cursor, nil
+}
+
+func parseMailHeaders(uid uint32, data []byte) mailMessage {
+	msg := mailMessage{UID: uid}
+	parsed, err := mail.ReadMessage(io.MultiReader(bytes.NewReader(data), strings.NewReader("\r\n")))
+	if err != nil {
+		return msg
+	}
+	decoder := new(mime.WordDecoder)
+	header := func(key string) string {
+		value := parsed.Header.Get(key)
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			return decoded
+		}
+		return value
+	}
+	msg.From = header("From")
+	msg.To = header("To")
+	msg.Subject = header("Subject")
+	msg.Date = header("Date")
+	msg.MessageID = strings.Trim(header("Message-Id"), "<>")
+	return msg
+}
+
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+type imapResponse struct {
+	text     string
+	literals [][]byte
+}
+
+func dialIMAP(server string) (*imapConn, error) {
+	host, _, _ := net.SplitHostPort(server)
+	dialer := &net.Dialer{Timeout: mailTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", server, &tls.Config{ServerName: host})
+	if err != nil {
+		return nil, fmt.Errorf("connect %s: %w", server, err)
+	}
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	_ = conn.SetDeadline(time.Now().Add(mailTimeout))
+	greeting, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect %s: %w", server, err)
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("connect %s: unexpected greeting %q", server, greeting.text)
+	}
+	return c, nil
+}
+
+func (c *imapConn) close() {
+	_ = c.conn.Close()
+}
+
+func (c *imapConn) command(format string, args ...any) ([]imapResponse, error) {
+	c.tag++
+	tag := "g" + strconv.Itoa(c.tag)
+	_ = c.conn.SetDeadline(time.Now().Add(mailTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+	var untagged []imapResponse
+	for {
+		resp, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		status, ok := strings.CutPrefix(resp.text, tag+" ")
+		if !ok {
+			untagged = append(untagged, resp)
+			continue
+		}
+		if strings.HasPrefix(status, "OK") {
+			return untagged, nil
+		}
+		return nil, errors.New(status)
+	}
+}
+
+func (c *imapConn) read() (imapResponse, error) {
+	var resp imapResponse
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		resp.text += line
+		size, ok := imapLiteralSize(line)
+		if !ok {
+			return resp, nil
+		}
+		if size > mailMaxLiteral {
+			return resp, fmt.Errorf("literal of %d bytes is too large", size)
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, literal)
+	}
+}
+
+func imapLiteralSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	open := strings.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(line[open+1:len(line)-1], "+"))
+	return size, err == nil && size >= 0
+}
+
+func imapStatusCode(responses []imapResponse, code string) uint32 {
+	for _, resp := range responses {
+		_, rest, ok := strings.Cut(resp.text, "["+code+" ")
+		if !ok {
+			continue
+		}
+		value, _, _ := strings.Cut(rest, "]")
+		if n, err := strconv.ParseUint(value, 10, 32); err == nil {
+			return uint32(n)
+		}
+	}
+	return 0
+}
+
+func imapQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+func (j *scheduleJob) checkMail() {
+	j.checkMu.Lock()
+	defer j.checkMu.Unlock()
+
+	trigger := j.cfg.Mail
+	previous, known := loadMailCursor(j.cfg.Name)
+	messages, cursor, err := fetchNewMail(trigger, trigger.password(j.cfg.Env), previous, known)
+	if err != nil {
+		j.mu.Lock()
+		j.history.LastResult = "mail check failed"
+		j.mu.Unlock()
+		j.log().Error("%s: %v", trigger.describe(), err)
+		return
+	}
+	switch {
+	case !known:
+		j.log().Info("watching %s for new messages", trigger.describe())
+	case cursor.Validity != previous.Validity:
+		j.log().Warn("%s was recreated on the server, starting over from its newest message", trigger.describe())
+	}
+	for _, msg := range messages {
+		if trigger.matches(msg) {
+			if !j.waitIdle() {
+				return
+			}
+			j.launchWith(msg.String(), msg.env(trigger.Mailbox), nil)
+		} else {
+			j.log().Debug("skipping %s", msg)
+		}
+		cursor.LastUID = msg.UID
+		if err := storeMailCursor(j.cfg.Name, cursor); err != nil {
+			j.log().Error("save mail position: %v", err)
+		}
+	}
+	if len(messages) == 0 && cursor != previous {
+		if err := storeMailCursor(j.cfg.Name, cursor); err != nil {
+			j.log().Error("save mail position: %v", err)
+		}
+	}
+}
+
+func (j *scheduleJob) waitIdle() bool {
+	for {
+		j.mu.Lock()
+		closed, exited, running := j.closed, j.exited, j.cmd != nil
+		j.mu.Unlock()
+		if closed {
+			return false
+		}
+		if !running {
+			return true
+		}
+		select {
+		case <-exited:
+		case <-j.stopCh:
+			return false
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -12,13 +13,39 @@ import (
 const configEnvVar = "GHOST_CONFIG"
 
 func main() {
+	if len(os.Args) > 1 && (!strings.HasPrefix(os.Args[1], "-") || os.Args[1] == "-h" || os.Args[1] == "--help") {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
+	flags := flag.NewFlagSet("ghost", flag.ContinueOnError)
+	profile := flags.String("profile", os.Getenv(profileEnvVar), "run only the jobs of this profile from the config")
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() > 0 {
+		printUsage()
+		os.Exit(2)
+	}
+
 	configPath, err := determineConfigPath()
 	if err != nil {
 		logError("failed to determine config path: %v", err)
 		os.Exit(1)
 	}
 
+	run, err := runFirstRunSetup(configPath)
+	if err != nil {
+		logError("%v", err)
+		os.Exit(1)
+	}
+	if !run {
+		return
+	}
+
 	daemon := NewGhostDaemon(configPath)
+	if name := strings.TrimSpace(*profile); name != "" {
+		daemon.profile, daemon.profileChosen = name, true
+	}
 	if err := daemon.Start(); err != nil {
 		logError("failed to start daemon: %v", err)
 		os.Exit(1)
@@ -29,8 +56,28 @@ func main() {
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 
-	sig := <-signalCh
-	logInfo("received %s, shutting down", sig)
+	statusCh := make(chan os.Signal, 1)
+	if len(statusSignals) > 0 {
+		signal.Notify(statusCh, statusSignals...)
+	}
+
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+
+	for {
+		select {
+		case <-statusCh:
+			daemon.logStatus()
+			continue
+		case <-reloadCh:
+			logInfo("received hangup, reloading config")
+			go daemon.reloadNow("signal")
+			continue
+		case sig := <-signalCh:
+			logInfo("received %s, shutting down", sig)
+		}
+		break
+	}
 
 	daemon.Stop()
 }
@@ -44,10 +91,10 @@ func determineConfigPath() (string, error) {
 		return resolved, nil
 	}
 
-	home, err := os.UserHomeDir()
+	configHome, err := xdgDir("XDG_CONFIG_HOME", ".config")
 	if err != nil {
-		return "", fmt.Errorf("resolve home directory: %w", err)
+		return "", fmt.Errorf("resolve config directory: %w", err)
 	}
 
-	return filepath.Join(home, ".config", "ghost", "ghost.toml"), nil
+	return filepath.Join(configHome, "ghost", "ghost.toml"), nil
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const starterConfig = `# ghost config — saved changes are picked up right away, no restart needed.
+# Uncomment an example below and adjust it, or run "ghost add watcher" /
+# "ghost add server". "ghost validate" checks this file, "ghost status" shows
+# what is running. The readme lists every option.
+
+# Run a command whenever matching files change.
+# [[watchers]]
+# name = "notes"
+# path = "~/notes"
+# match = ["**/*.md"]
+# command = "make"
+# debounce_ms = 300
+# run_on_start = true
+
+# Keep a long-running process up, restarting it when it exits.
+# [[servers]]
+# name = "api"
+# command = "go run ."
+# cwd = "~/src/api"
+# ready_pattern = "listening on"
+
+# Run a command on a schedule.
+# [[schedules]]
+# name = "sync-notes"
+# command = "git pull --rebase"
+# cwd = "~/notes"
+# cron = "0 * * * *"
+
+# Record which app and window is in front (macOS and Linux),
+# then see where the day went with "ghost report".
+# [window_tracker]
+# enabled = true
+`
+
+func runInitCommand(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	force := fs.Bool("force", false, "overwrite an existing config")
+	printOnly := fs.Bool("print", false, "print the starter config instead of writing it")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 1 {
+		return errors.New("usage: ghost init [config] [-force] [-print]")
+	}
+	if *printOnly {
+		_, err := os.Stdout.WriteString(starterConfig)
+		return err
+	}
+
+	var path string
+	if len(rest) == 1 {
+		path, err = resolvePath(rest[0])
+	} else {
+		path, err = determineConfigPath()
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil && !*force {
+		return fmt.Errorf("%s already exists (use -force to replace it)", path)
+	}
+	if err := writeStarterConfig(path); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", path)
+	return nil
+}
+
+func writeStarterConfig(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(starterConfig), 0o644); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return nil
+}
+
+func runFirstRunSetup(configPath string) (bool, error) {
+	if _, err := os.Stat(configPath); !errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if !stdinIsTerminal() {
+		return false, fmt.Errorf("config file not found at %s; run `ghost init` to create a starter config", configPath)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Fprintf(os.Stderr, "ghost has no config yet (looked for %s).\n", configPath)
+	if !promptYesNo(reader, "Create a starter config there?", true) {
+		return false, fmt.Errorf("nothing to run; create %s or point %s at a config", configPath, configEnvVar)
+	}
+	if err := writeStarterConfig(configPath); err != nil {
+		return false, err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s; its examples are commented out, edit it and ghost reloads on save\n", configPath)
+
+	if !promptYesNo(reader, "Start ghost automatically at login?", false) {
+		return true, nil
+	}
+	if err := runInstallCommand([]string{"-start-at-login"}); err != nil {
+		fmt.Fprintf(os.Stderr, "ghost install: %v\nrunning in this terminal instead\n", err)
+		return true, nil
+	}
+	return false, nil
+}
+
+func promptYesNo(reader *bufio.Reader, question string, defaultYes bool) bool {
+	options := "y/N"
+	if defaultYes {
+		options = "Y/n"
+	}
+	answer, _ := promptLine(reader, fmt.Sprintf("%s [%s]", question, options))
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return defaultYes
+}
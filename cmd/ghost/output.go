@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+type outputFormat string
+
+const (
+	formatTable outputFormat = "table"
+	formatJSON  outputFormat = "json"
+	formatYAML  outputFormat = "yaml"
+	formatCSV   outputFormat = "csv"
+)
+
+func formatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", string(formatTable), "output format: table, json, yaml or csv")
+}
+
+func parseOutputFormat(value string) (outputFormat, error) {
+	switch format := outputFormat(strings.ToLower(strings.TrimSpace(value))); format {
+	case formatTable, formatJSON, formatYAML, formatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q (use table, json, yaml or csv)", value)
+	}
+}
+
+type outputTable struct {
+	header []string
+	rows   [][]string
+}
+
+func writeOutput(w io.Writer, format outputFormat, value any, table func() outputTable) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case formatYAML:
+		return writeYAML(w, value)
+	case formatCSV:
+		return table().writeCSV(w)
+	default:
+		return table().write(w)
+	}
+}
+
+func (t outputTable) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if cell == "" {
+				cell = "-"
+			}
+			cells[i] = cell
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (t outputTable) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(t.rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+type yamlNode struct {
+	scalar string
+	keys   []string
+	fields []yamlNode
+	items  []yamlNode
+	object bool
+	array  bool
+}
+
+func writeYAML(w io.Writer, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	node, err := decodeYAMLNode(decoder)
+	if err != nil {
+		return err
+	}
+	var builder strings.Builder
+	if node.object && len(node.keys) > 0 || node.array && len(node.items) > 0 {
+		node.write(&builder, 0)
+	} else {
+		builder.WriteString(node.inline() + "\n")
+	}
+	_, err = io.WriteString(w, builder.String())
+	return err
+}
+
+func decodeYAMLNode(decoder *json.Decoder) (yamlNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return yamlNode{}, err
+	}
+	switch v := token.(type) {
+	case json.Delim:
+		node := yamlNode{object: v == '{', array: v == '['}
+		for decoder.More() {
+			if node.object {
+				key, err := decoder.Token()
+				if err != nil {
+					return yamlNode{}, err
+				}
+				node.keys = append(node.keys, fmt.Sprint(key))
+			}
+			child, err := decodeYAMLNode(decoder)
+			if err != nil {
+				return yamlNode{}, err
+			}
+			if node.object {
+				node.fields = append(node.fields, child)
+			} else {
+				node.items = append(node.items, child)
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return yamlNode{}, err
+		}
+		return node, nil
+	case string:
+		return yamlNode{scalar: yamlString(v)}, nil
+	case json.Number:
+		return yamlNode{scalar: v.String()}, nil
+	case bool:
+		return yamlNode{scalar: fmt.Sprint(v)}, nil
+	default:
+		return yamlNode{scalar: "null"}, nil
+	}
+}
+
+func (n yamlNode) inline() string {
+	switch {
+	case n.object:
+		return "{}"
+	case n.array:
+		return "[]"
+	default:
+		return n.scalar
+	}
+}
+
+func (n yamlNode) nested() bool {
+	return n.object && len(n.keys) > 0 || n.array && len(n.items) > 0
+}
+
+func (n yamlNode) write(builder *strings.Builder, indent int) {
+	pad := strings.Repeat(" ", indent)
+	if n.object {
+		for i, key := range n.keys {
+			child := n.fields[i]
+			if child.nested() {
+				builder.WriteString(pad + yamlString(key) + ":\n")
+				childIndent := indent + 2
+				if child.array {
+					childIndent = indent
+				}
+				child.write(builder, childIndent)
+				continue
+			}
+			builder.WriteString(pad + yamlString(key) + ": " + child.inline() + "\n")
+		}
+		return
+	}
+	for _, item := range n.items {
+		if !item.nested() {
+			builder.WriteString(pad + "- " + item.inline() + "\n")
+			continue
+		}
+		var nested strings.Builder
+		item.write(&nested, indent+2)
+		builder.WriteString(pad + "- " + strings.TrimPrefix(nested.String(), pad+"  "))
+	}
+}
+
+var yamlPlainPattern = regexp.MustCompile(`^[A-Za-z_/.][A-Za-z0-9 _./@()+-]*$`)
+
+func yamlString(value string) string {
+	switch strings.ToLower(value) {
+	case "", "true", "false", "yes", "no", "on", "off", "null", "~":
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+	if yamlPlainPattern.MatchString(value) && !strings.HasSuffix(value, " ") {
+		return value
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type pauseRegistry struct {
+	mu      sync.Mutex
+	paused  map[string]bool
+	changed chan struct{}
+}
+
+var pausedJobs = &pauseRegistry{paused: make(map[string]bool), changed: make(chan struct{})}
+
+func (r *pauseRegistry) set(kind, name string, paused bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := kind + "/" + name
+	if r.paused[key] == paused {
+		return false
+	}
+	if paused {
+		r.paused[key] = true
+	} else {
+		delete(r.paused, key)
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+	return true
+}
+
+func (r *pauseRegistry) isPaused(kind, name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.paused[kind+"/"+name]
+}
+
+func (r *pauseRegistry) list() []jobRef {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.paused))
+	for key := range r.paused {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	refs := make([]jobRef, len(keys))
+	for i, key := range keys {
+		kind, name, _ := strings.Cut(key, "/")
+		refs[i] = jobRef{Kind: kind, Name: name}
+	}
+	return refs
+}
+
+func (r *pauseRegistry) changes() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changed
+}
+
+type jobsRequest struct {
+	Names  []string `json:"names,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+	DryRun bool     `json:"dry_run,omitempty"`
+}
+
+type jobRef struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+type jobsResult struct {
+	Action string   `json:"action"`
+	DryRun bool     `json:"dry_run,omitempty"`
+	Jobs   []jobRef `json:"jobs"`
+}
+
+var jobActionKinds = map[string][]string{
+	"restart": {"server"},
+	"pause":   {"watcher", "server", "schedule"},
+	"resume":  {"watcher", "server", "schedule"},
+}
+
+func (d *GhostDaemon) selectJobs(kinds []string, names []string, selector labelSelector) ([]jobRef, error) {
+	for _, pattern := range names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q", pattern)
+		}
+	}
+	matches := func(name string, labels map[string]string) bool {
+		if !selector.matches(labels) {
+			return false
+		}
+		if len(names) == 0 {
+			return true
+		}
+		for _, pattern := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var refs []jobRef
+	for _, kind := range kinds {
+		switch kind {
+		case "watcher":
+			for _, job := range d.manager.Jobs() {
+				if job != nil && matches(job.cfg.Name, job.cfg.Labels) {
+					refs = append(refs, jobRef{Kind: kind, Name: job.cfg.Name})
+				}
+			}
+		case "server":
+			if d.serverManager == nil {
+				continue
+			}
+			for _, job := range d.serverManager.Jobs() {
+				if job != nil && matches(job.cfg.Name, job.cfg.Labels) {
+					refs = append(refs, jobRef{Kind: kind, Name: job.cfg.Name})
+				}
+			}
+		case "schedule":
+			for _, job := range d.schedules.Jobs() {
+				if matches(job.cfg.Name, job.cfg.Labels) {
+					refs = append(refs, jobRef{Kind: kind, Name: job.cfg.Name})
+				}
+			}
+		}
+	}
+	return refs, nil
+}
+
+func (d *GhostDaemon) applyJobAction(action string, req jobsRequest) (jobsResult, error) {
+	kinds, ok := jobActionKinds[action]
+	if !ok {
+		return jobsResult{}, fmt.Errorf("unknown action %q (available: pause, restart, resume)", action)
+	}
+	if len(req.Names) == 0 && len(req.Labels) == 0 {
+		return jobsResult{}, errors.New("name patterns or a label selector are required")
+	}
+	selector, err := parseLabelSelector(req.Labels)
+	if err != nil {
+		return jobsResult{}, err
+	}
+
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+	refs, err := d.selectJobs(kinds, req.Names, selector)
+	if err != nil {
+		return jobsResult{}, err
+	}
+	if len(refs) == 0 {
+		return jobsResult{}, errors.New("no job matches")
+	}
+	result := jobsResult{Action: action, DryRun: req.DryRun, Jobs: refs}
+	if req.DryRun {
+		return result, nil
+	}
+
+	result.Jobs = []jobRef{}
+	for _, ref := range refs {
+		switch action {
+		case "restart":
+			if err := d.serverManager.Restart(ref.Name); err != nil {
+				return jobsResult{}, err
+			}
+		case "pause", "resume":
+			if !pausedJobs.set(ref.Kind, ref.Name, action == "pause") {
+				continue
+			}
+			logInfo("%sd %s %s", action, ref.Kind, ref.Name)
+			if ref.Kind == "server" && action == "pause" {
+				d.serverManager.stopPaused(ref.Name)
+			}
+		}
+		result.Jobs = append(result.Jobs, ref)
+	}
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+type FilePermissions struct {
+	FileMode os.FileMode
+	DirMode  os.FileMode
+}
+
+var defaultPermissions = FilePermissions{FileMode: 0o644, DirMode: 0o755}
+
+func normalizePermissions(defaults rawDefaults) (FilePermissions, error) {
+	perms := defaultPermissions
+	if mode, ok, err := parseFileMode(defaults.FileMode); err != nil {
+		return FilePermissions{}, fmt.Errorf("defaults.file_mode: %w", err)
+	} else if ok {
+		perms.FileMode = mode
+	}
+	if mode, ok, err := parseFileMode(defaults.DirMode); err != nil {
+		return FilePermissions{}, fmt.Errorf("defaults.dir_mode: %w", err)
+	} else if ok {
+		perms.DirMode = mode
+	}
+	if perms.DirMode&0o700 != 0o700 {
+		return FilePermissions{}, fmt.Errorf("defaults.dir_mode: %#o must keep owner rwx", perms.DirMode)
+	}
+	if perms.FileMode&0o600 != 0o600 {
+		return FilePermissions{}, fmt.Errorf("defaults.file_mode: %#o must keep owner rw", perms.FileMode)
+	}
+	return perms, nil
+}
+
+func normalizeUmask(value any, fallback any) (os.FileMode, bool, error) {
+	if value == nil {
+		value = fallback
+	}
+	mask, ok, err := parseFileMode(value)
+	if err != nil || !ok {
+		return 0, ok, err
+	}
+	if runtime.GOOS == "windows" {
+		return 0, false, errors.New("umask is not supported on windows")
+	}
+	return mask, true, nil
+}
+
+func parseFileMode(value any) (os.FileMode, bool, error) {
+	var mode uint64
+	switch v := value.(type) {
+	case nil:
+		return 0, false, nil
+	case int64:
+		if v < 0 {
+			return 0, false, fmt.Errorf("invalid mode %d", v)
+		}
+		mode = uint64(v)
+	case string:
+		trimmed := strings.TrimPrefix(strings.TrimSpace(v), "0o")
+		if trimmed == "" {
+			return 0, false, nil
+		}
+		parsed, err := strconv.ParseUint(trimmed, 8, 32)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid octal mode %q", v)
+		}
+		mode = parsed
+	default:
+		return 0, false, errors.New("mode must be an octal string or integer")
+	}
+	if mode > 0o777 {
+		return 0, false, fmt.Errorf("mode %#o out of range", mode)
+	}
+	return os.FileMode(mode), true, nil
+}
+
+func wrapUmaskCommand(command []string, mask os.FileMode) []string {
+	wrapped := []string{"/bin/sh", "-c", fmt.Sprintf(`umask %04o && exec "$@"`, uint32(mask)), "ghost-umask"}
+	return append(wrapped, command...)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+func parseCommandSteps(value any) ([][]string, error) {
+	items, ok := value.([]any)
+	if !ok {
+		return nil, errors.New("commands must be an array of commands")
+	}
+	if len(items) == 0 {
+		return nil, errors.New("commands must not be empty")
+	}
+	steps := make([][]string, 0, len(items))
+	for i, item := range items {
+		parts, _, err := parseCommandSpec(item, nil)
+		if err != nil {
+			return nil, fmt.Errorf("commands[%d]: %w", i, err)
+		}
+		if len(parts) == 0 {
+			return nil, fmt.Errorf("commands[%d] must not be empty", i)
+		}
+		steps = append(steps, parts)
+	}
+	return steps, nil
+}
+
+func pipelineCommand(steps [][]string, parallel, login bool, profile shellProfile, secrets secretSet) (string, []string) {
+	scripts := make([]string, len(steps))
+	displays := make([]string, len(steps))
+	for i, step := range steps {
+		scripts[i] = buildShellCommand(step)
+		displays[i] = buildShellCommand(secrets.redactArgs(step))
+	}
+
+	var script, display string
+	if parallel {
+		display = strings.Join(displays, " & ")
+		var builder strings.Builder
+		builder.WriteString("status=0")
+		for i, step := range scripts {
+			fmt.Fprintf(&builder, "; %s & p%d=$!", step, i)
+		}
+		for i := range scripts {
+			fmt.Fprintf(&builder, `; wait "$p%d" || status=$?`, i)
+		}
+		builder.WriteString(`; exit "$status"`)
+		script = builder.String()
+	} else {
+		display = strings.Join(displays, " && ")
+		script = strings.Join(scripts, " && ")
+	}
+
+	if login {
+		return display, profile.command(script)
+	}
+	if runtime.GOOS == "windows" {
+		return display, shellProfile{Mode: "none"}.command(script)
+	}
+	return display, []string{"/bin/sh", "-c", script}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rjeczalik/notify"
+)
+
+const (
+	defaultPollInterval = 2 * time.Second
+	minPollInterval     = 100 * time.Millisecond
+)
+
+type polledEvent struct {
+	event notify.Event
+	path  string
+}
+
+func (e polledEvent) Event() notify.Event { return e.event }
+func (e polledEvent) Path() string        { return e.path }
+func (e polledEvent) Sys() any            { return nil }
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	mode    fs.FileMode
+}
+
+type pollWatcher struct {
+	cfg    NormalizedWatcher
+	events chan<- notify.EventInfo
+	scan   func() (map[string]fileStamp, error)
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func newPollWatcher(cfg NormalizedWatcher, events chan<- notify.EventInfo) *pollWatcher {
+	p := &pollWatcher{
+		cfg:    cfg,
+		events: events,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	p.scan = p.scanLocal
+	if cfg.Remote != nil {
+		p.scan = p.scanRemote
+	}
+	go p.run()
+	return p
+}
+
+func (p *pollWatcher) run() {
+	defer close(p.doneCh)
+
+	previous, failing := p.rescan(nil, false)
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+		}
+		current, failed := p.rescan(previous, failing)
+		if failed || previous == nil {
+			previous, failing = current, failed
+			continue
+		}
+		failing = false
+		for path, stamp := range current {
+			old, ok := previous[path]
+			switch {
+			case !ok && stamp.mode.IsDir():
+				p.send(notify.Create, path)
+			case !ok:
+				p.send(notify.Create|notify.Write, path)
+			case !stamp.mode.IsDir() && (!old.modTime.Equal(stamp.modTime) || old.size != stamp.size || old.mode != stamp.mode):
+				p.send(notify.Write, path)
+			}
+		}
+		for path := range previous {
+			if _, ok := current[path]; !ok {
+				p.send(notify.Remove, path)
+			}
+		}
+		previous = current
+	}
+}
+
+func (p *pollWatcher) rescan(previous map[string]fileStamp, failing bool) (map[string]fileStamp, bool) {
+	stamps, err := p.scan()
+	if err == nil {
+		if failing {
+			watcherLog(p.cfg.Name).Info("scan recovered")
+		}
+		return stamps, false
+	}
+	select {
+	case <-p.stopCh:
+		return previous, failing
+	default:
+	}
+	if !failing {
+		watcherLog(p.cfg.Name).Warn("scan failed, keeping the last snapshot: %v", err)
+	}
+	return previous, true
+}
+
+func (p *pollWatcher) send(event notify.Event, path string) {
+	select {
+	case p.events <- polledEvent{event: event, path: path}:
+	case <-p.stopCh:
+	}
+}
+
+func (p *pollWatcher) scanLocal() (map[string]fileStamp, error) {
+	return scanWatchedFiles(p.cfg), nil
+}
+
+// scanWatchedFiles stats everything a local watcher subscribes to, leaving
+// out ignored paths.
+func scanWatchedFiles(cfg NormalizedWatcher) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, pattern := range cfg.WatchPatterns {
+		root, recursive := strings.CutSuffix(pattern, string(filepath.Separator)+"...")
+		_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if path != root {
+				if _, rel, ok := cfg.locate(path); ok && cfg.ignored(rel) {
+					if entry.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if info, err := entry.Info(); err == nil {
+					stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+				}
+			}
+			if entry.IsDir() && path != root && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+	return stamps
+}
+
+func (p *pollWatcher) Stop() {
+	select {
+	case <-p.stopCh:
+	default:
+		close(p.stopCh)
+	}
+	<-p.doneCh
+}
@@ -0,0 +1,33 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const (
+	ioprioClassShift = 13
+	ioprioWhoProcess = 1
+)
+
+func setIOPriority(pid int, class string, level int) error {
+	var classValue int
+	switch class {
+	case "realtime":
+		classValue = 1
+	case "best-effort":
+		classValue = 2
+	case "idle":
+		classValue = 3
+		level = 0
+	default:
+		return fmt.Errorf("unknown io class %q", class)
+	}
+	value := classValue<<ioprioClassShift | level
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(value)); errno != 0 {
+		return errno
+	}
+	return nil
+}
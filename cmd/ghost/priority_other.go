@@ -0,0 +1,14 @@
+//go:build unix && !linux
+
+package main
+
+import "sync"
+
+var ioniceWarnOnce sync.Once
+
+func setIOPriority(pid int, class string, level int) error {
+	ioniceWarnOnce.Do(func() {
+		logWarn("ionice is only supported on Linux; ignoring io class %q", class)
+	})
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+func applyProcessPriority(pid int, priority ProcessPriority) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func applyProcessPriority(pid int, priority ProcessPriority) error {
+	if priority.empty() || pid <= 0 {
+		return nil
+	}
+	if priority.NiceSet {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, priority.Nice); err != nil {
+			return fmt.Errorf("set nice %d: %w", priority.Nice, err)
+		}
+	}
+	if priority.IOClass != "" {
+		if err := setIOPriority(pid, priority.IOClass, priority.IOLevel); err != nil {
+			return fmt.Errorf("set ionice %s: %w", priority.IOClass, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func trackProcessGroup(cmd *exec.Cmd) {}
+
+func signalProcess(process *os.Process, sig syscall.Signal, group bool) error {
+	if sig == syscall.SIGKILL {
+		return process.Kill()
+	}
+	return process.Signal(sig)
+}
+
+func processAlive(pid int) bool {
+	return false
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func trackProcessGroup(cmd *exec.Cmd) {}
+
+func signalProcess(process *os.Process, sig syscall.Signal, group bool) error {
+	if !group {
+		return process.Signal(sig)
+	}
+	if err := syscall.Kill(-process.Pid, sig); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
+
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
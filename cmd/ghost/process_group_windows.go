@@ -0,0 +1,104 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows has no process groups to signal, so a grouped command gets a
+// console process group of its own (for Ctrl-Break, the closest thing to
+// SIGTERM) and a job object that holds everything it spawns (for SIGKILL).
+var processJobs = struct {
+	sync.Mutex
+	byPID map[int]windows.Handle
+}{byPID: make(map[int]windows.Handle)}
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP
+}
+
+// trackProcessGroup puts a started grouped command into a job object so its
+// whole tree can be terminated later. Children it spawned before this call
+// escape the job; in practice the gap is a few microseconds after start.
+func trackProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil || cmd.SysProcAttr == nil || cmd.SysProcAttr.CreationFlags&windows.CREATE_NEW_PROCESS_GROUP == 0 {
+		return
+	}
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE|windows.SYNCHRONIZE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		_ = windows.CloseHandle(job)
+		return
+	}
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		_ = windows.CloseHandle(process)
+		_ = windows.CloseHandle(job)
+		return
+	}
+
+	pid := cmd.Process.Pid
+	processJobs.Lock()
+	processJobs.byPID[pid] = job
+	processJobs.Unlock()
+	go func() {
+		// Release the job once the leader exits; leftover children keep
+		// running, as they do after a Unix group leader exits.
+		_, _ = windows.WaitForSingleObject(process, windows.INFINITE)
+		_ = windows.CloseHandle(process)
+		processJobs.Lock()
+		if processJobs.byPID[pid] == job {
+			delete(processJobs.byPID, pid)
+		}
+		processJobs.Unlock()
+		_ = windows.CloseHandle(job)
+	}()
+}
+
+// signalProcess maps SIGKILL to terminating the job object (or the process)
+// and every other signal to Ctrl-Break for grouped commands. A process that
+// is not in its own console group can't be asked to stop, so it is killed.
+func signalProcess(process *os.Process, sig syscall.Signal, group bool) error {
+	if sig != syscall.SIGKILL && group {
+		err := windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(process.Pid))
+		if err == nil || !processAlive(process.Pid) {
+			return nil
+		}
+	}
+	if group {
+		processJobs.Lock()
+		defer processJobs.Unlock()
+		if job, ok := processJobs.byPID[process.Pid]; ok {
+			return windows.TerminateJobObject(job, 1)
+		}
+	}
+	return process.Kill()
+}
+
+// stillActive is the exit code GetExitCodeProcess reports for a running
+// process.
+const stillActive = 259
+
+func processAlive(pid int) bool {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(handle)
+	var code uint32
+	if err := windows.GetExitCodeProcess(handle, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
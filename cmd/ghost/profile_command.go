@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+const profileUsage = "usage: ghost profile [switch <name> | off]"
+
+func runProfileCommand(args []string) error {
+	if len(args) == 0 {
+		var info profileInfo
+		if err := controlRequest("GET", "/v1/profile", nil, &info); err != nil {
+			return err
+		}
+		if len(info.Profiles) == 0 {
+			fmt.Println("no profiles defined; running every job")
+			return nil
+		}
+		for _, name := range info.Profiles {
+			marker := " "
+			if name == info.Active {
+				marker = "*"
+			}
+			if name == info.Default {
+				fmt.Printf("%s %s (default)\n", marker, name)
+			} else {
+				fmt.Printf("%s %s\n", marker, name)
+			}
+		}
+		if info.Active == "" {
+			fmt.Println("no profile active; running every job")
+		}
+		return nil
+	}
+
+	var name string
+	switch {
+	case args[0] == "switch" && len(args) == 2:
+		name = args[1]
+	case args[0] == "off" && len(args) == 1:
+	default:
+		return errors.New(profileUsage)
+	}
+	var info profileInfo
+	if err := controlRequest("PUT", "/v1/profile", profileRequest{Name: name}, &info); err != nil {
+		return err
+	}
+	if info.Active == "" {
+		fmt.Println("profile off; running every job")
+	} else {
+		fmt.Printf("switched to profile %s\n", info.Active)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+)
+
+const profileEnvVar = "GHOST_PROFILE"
+
+type rawProfile struct {
+	Watchers      any   `toml:"watchers"`
+	Servers       any   `toml:"servers"`
+	Schedules     any   `toml:"schedules"`
+	Labels        any   `toml:"labels"`
+	WindowTracker *bool `toml:"window_tracker"`
+	Streaming     *bool `toml:"streaming"`
+}
+
+type ProfileConfig struct {
+	Name          string
+	Watchers      []string
+	Servers       []string
+	Schedules     []string
+	Labels        labelSelector
+	WindowTracker *bool
+	Streaming     *bool
+}
+
+type profileInfo struct {
+	Active   string   `json:"active"`
+	Default  string   `json:"default"`
+	Profiles []string `json:"profiles"`
+}
+
+type profileRequest struct {
+	Name string `json:"name"`
+}
+
+func normalizeProfiles(raw map[string]rawProfile, selected string) (map[string]ProfileConfig, error) {
+	var errs configcheck.Errors
+	profiles := make(map[string]ProfileConfig, len(raw))
+	for _, name := range sortedKeys(raw) {
+		profile, err := normalizeProfile(name, raw[name])
+		if err != nil {
+			errs.Add(fmt.Errorf("profiles.%s.%w", name, err))
+			continue
+		}
+		profiles[name] = profile
+	}
+	if selected = strings.TrimSpace(selected); selected != "" {
+		if _, ok := raw[selected]; !ok {
+			errs.Add(fmt.Errorf("profile: %w", unknownProfileError(selected, sortedKeys(raw))))
+		}
+	}
+	return profiles, errs.Err()
+}
+
+func normalizeProfile(name string, raw rawProfile) (ProfileConfig, error) {
+	profile := ProfileConfig{Name: name, WindowTracker: raw.WindowTracker, Streaming: raw.Streaming}
+	for _, field := range []struct {
+		key   string
+		value any
+		out   *[]string
+	}{
+		{"watchers", raw.Watchers, &profile.Watchers},
+		{"servers", raw.Servers, &profile.Servers},
+		{"schedules", raw.Schedules, &profile.Schedules},
+	} {
+		patterns, err := valueToStringSlice(field.value)
+		if err != nil {
+			return ProfileConfig{}, fmt.Errorf("%s: %w", field.key, err)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return ProfileConfig{}, fmt.Errorf("%s: invalid name pattern %q", field.key, pattern)
+			}
+		}
+		*field.out = patterns
+	}
+	labels, err := valueToStringSlice(raw.Labels)
+	if err != nil {
+		return ProfileConfig{}, fmt.Errorf("labels: %w", err)
+	}
+	if profile.Labels, err = parseLabelSelector(labels); err != nil {
+		return ProfileConfig{}, fmt.Errorf("labels: %w", err)
+	}
+	return profile, nil
+}
+
+func (p ProfileConfig) selects(patterns []string, name string, labels map[string]string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return len(p.Labels) > 0 && p.Labels.matches(labels)
+}
+
+func (c NormalizedConfig) withProfile(name string) (NormalizedConfig, error) {
+	if name == "" {
+		return c, nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return NormalizedConfig{}, unknownProfileError(name, sortedKeys(c.Profiles))
+	}
+
+	watchers := make([]NormalizedWatcher, 0, len(c.Watchers))
+	for _, watcher := range c.Watchers {
+		if profile.selects(profile.Watchers, watcher.Name, watcher.Labels) {
+			watchers = append(watchers, watcher)
+		}
+	}
+	selected := make(map[string]bool, len(c.Servers))
+	for _, server := range c.Servers {
+		if profile.selects(profile.Servers, server.Name, server.Labels) {
+			selected[server.Name] = true
+		}
+	}
+	for added := true; added; {
+		added = false
+		for _, server := range c.Servers {
+			if !selected[server.Name] {
+				continue
+			}
+			for _, dependency := range server.DependsOn {
+				if !selected[dependency] {
+					selected[dependency], added = true, true
+				}
+			}
+		}
+	}
+	servers := make([]NormalizedServer, 0, len(selected))
+	for _, server := range c.Servers {
+		if selected[server.Name] {
+			servers = append(servers, server)
+		}
+	}
+	schedules := make([]NormalizedSchedule, 0, len(c.Schedules))
+	for _, schedule := range c.Schedules {
+		if profile.selects(profile.Schedules, schedule.Name, schedule.Labels) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	c.Watchers, c.Servers, c.Schedules = watchers, servers, schedules
+	if profile.WindowTracker != nil {
+		c.WindowTracker.Enabled = *profile.WindowTracker
+	}
+	if profile.Streaming != nil {
+		c.Streaming.Enabled = *profile.Streaming
+	}
+	return c, nil
+}
+
+func unknownProfileError(name string, defined []string) error {
+	if len(defined) == 0 {
+		return fmt.Errorf("unknown profile %q (no [profiles] are defined)", name)
+	}
+	return fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(defined, ", "))
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const redactedValue = "***"
+
+var secretKeySuffixes = []string{"_TOKEN", "_SECRET", "_PASSWORD", "_PASSWD", "_API_KEY", "_PRIVATE_KEY", "_CREDENTIALS"}
+
+var secretFlagNames = map[string]struct{}{
+	"token":         {},
+	"secret":        {},
+	"password":      {},
+	"passwd":        {},
+	"api-key":       {},
+	"apikey":        {},
+	"access-token":  {},
+	"auth-token":    {},
+	"client-secret": {},
+}
+
+var (
+	inlineAssignmentPattern = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)=('[^']*'|"[^"]*"|[^\s'"]+)`)
+	inlineFlagPattern       = regexp.MustCompile(`(--?([A-Za-z][A-Za-z-]*)(?:=|\s+))('[^']*'|"[^"]*"|[^\s'"-][^\s'"]*)`)
+)
+
+type secretSet struct {
+	keys   map[string]struct{}
+	values []string
+}
+
+func newSecretSet(env map[string]string, explicit ...[]string) secretSet {
+	set := secretSet{keys: make(map[string]struct{})}
+	for _, keys := range explicit {
+		for _, key := range keys {
+			key = strings.TrimSpace(key)
+			if key != "" {
+				set.keys[key] = struct{}{}
+			}
+		}
+	}
+
+	seen := make(map[string]struct{})
+	addValue := func(value string) {
+		value = strings.TrimSpace(value)
+		if len(value) < 4 {
+			return
+		}
+		if _, ok := seen[value]; ok {
+			return
+		}
+		seen[value] = struct{}{}
+		set.values = append(set.values, value)
+	}
+
+	for key, value := range env {
+		if set.isSecretKey(key) {
+			addValue(value)
+		}
+	}
+	for _, kv := range os.Environ() {
+		key, value, ok := strings.Cut(kv, "=")
+		if ok && set.isSecretKey(key) {
+			addValue(value)
+		}
+	}
+
+	sort.Slice(set.values, func(i, j int) bool {
+		return len(set.values[i]) > len(set.values[j])
+	})
+	return set
+}
+
+func (s secretSet) isSecretKey(key string) bool {
+	if _, ok := s.keys[key]; ok {
+		return true
+	}
+	upper := strings.ToUpper(key)
+	if upper == "TOKEN" || upper == "SECRET" || upper == "PASSWORD" {
+		return true
+	}
+	for _, suffix := range secretKeySuffixes {
+		if strings.HasSuffix(upper, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s secretSet) redactString(input string) string {
+	for _, value := range s.values {
+		input = strings.ReplaceAll(input, value, redactedValue)
+	}
+	return input
+}
+
+func (s secretSet) redactArgs(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	result := make([]string, len(args))
+	redactNext := false
+	for i, arg := range args {
+		switch {
+		case redactNext:
+			result[i] = redactedValue
+			redactNext = false
+			continue
+		case strings.ContainsAny(arg, " \t\n"):
+			result[i] = s.redactInline(arg)
+			continue
+		case strings.HasPrefix(arg, "-"):
+			name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			if _, ok := secretFlagNames[strings.ToLower(name)]; ok {
+				if hasValue {
+					result[i] = arg[:strings.Index(arg, "=")+1] + redactedValue
+				} else {
+					result[i] = arg
+					redactNext = true
+				}
+				continue
+			}
+		default:
+			if key, _, ok := strings.Cut(arg, "="); ok && isEnvKeyName(key) && s.isSecretKey(key) {
+				result[i] = key + "=" + redactedValue
+				continue
+			}
+		}
+		result[i] = s.redactString(arg)
+	}
+	return result
+}
+
+func (s secretSet) redactInline(script string) string {
+	script = inlineAssignmentPattern.ReplaceAllStringFunc(script, func(match string) string {
+		key, _, _ := strings.Cut(match, "=")
+		if !s.isSecretKey(key) {
+			return match
+		}
+		return key + "=" + redactedValue
+	})
+	script = inlineFlagPattern.ReplaceAllStringFunc(script, func(match string) string {
+		groups := inlineFlagPattern.FindStringSubmatch(match)
+		if _, ok := secretFlagNames[strings.ToLower(groups[2])]; !ok {
+			return match
+		}
+		return groups[1] + redactedValue
+	})
+	return s.redactString(script)
+}
+
+func (s secretSet) redactEnv(env map[string]string) map[string]string {
+	if len(env) == 0 {
+		return env
+	}
+	result := make(map[string]string, len(env))
+	for key, value := range env {
+		if s.isSecretKey(key) {
+			result[key] = redactedValue
+			continue
+		}
+		result[key] = s.redactString(value)
+	}
+	return result
+}
+
+func isEnvKeyName(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		switch {
+		case r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z'):
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
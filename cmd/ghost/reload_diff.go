@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type reloadSummary struct {
+	added     int
+	removed   int
+	restarted int
+	unchanged int
+}
+
+func (s reloadSummary) String() string {
+	return fmt.Sprintf("%d added, %d removed, %d restarted, %d unchanged", s.added, s.removed, s.restarted, s.unchanged)
+}
+
+func (m matcher) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.raw)
+}
+
+// MarshalJSON lets a reload see a change to secret_env. The values only go
+// in as a digest, so a fingerprint never holds a secret.
+func (s secretSet) MarshalJSON() ([]byte, error) {
+	values := slices.Sorted(slices.Values(s.values))
+	sum := sha256.Sum256([]byte(strings.Join(values, "\x00")))
+	return json.Marshal(struct {
+		Keys   []string
+		Values string
+	}{sortedKeys(s.keys), hex.EncodeToString(sum[:])})
+}
+
+func watcherFingerprint(cfg NormalizedWatcher) string {
+	cfg.ID = ""
+	return jsonFingerprint(cfg)
+}
+
+func serverFingerprint(cfg NormalizedServer) string {
+	cfg.ID = ""
+	return jsonFingerprint(cfg)
+}
+
+func scheduleFingerprint(cfg NormalizedSchedule) string {
+	cfg.ID = ""
+	return jsonFingerprint(cfg)
+}
+
+// jsonFingerprint panics when value doesn't marshal: every job config field
+// must, and a fingerprint that differs on each call would restart the job on
+// every reload.
+func jsonFingerprint(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(fmt.Sprintf("fingerprint %T: %v", value, err))
+	}
+	return string(data)
+}
+
+func uniqueJobKeys(names []string) []string {
+	keys := make([]string, len(names))
+	counts := make(map[string]int, len(names))
+	for i, name := range names {
+		counts[name]++
+		if counts[name] == 1 {
+			keys[i] = name
+		} else {
+			keys[i] = fmt.Sprintf("%s#%d", name, counts[name])
+		}
+	}
+	return keys
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+type configDiff struct {
+	Config    string      `json:"config"`
+	Watchers  []jobChange `json:"watchers"`
+	Servers   []jobChange `json:"servers"`
+	Schedules []jobChange `json:"schedules"`
+}
+
+type jobChange struct {
+	Name   string   `json:"name"`
+	Change string   `json:"change"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+type jobFields struct {
+	name   string
+	fields map[string]string
+}
+
+func fieldFingerprints(name string, cfg any) jobFields {
+	job := jobFields{name: name, fields: make(map[string]string)}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(jsonFingerprint(cfg)), &raw); err != nil {
+		panic(fmt.Sprintf("fingerprint %T: %v", cfg, err))
+	}
+	for field, value := range raw {
+		if field != "ID" {
+			job.fields[snakeCase(field)] = string(value)
+		}
+	}
+	return job
+}
+
+func diffJobs(applied, next []jobFields) []jobChange {
+	appliedNames := make([]string, len(applied))
+	for i, job := range applied {
+		appliedNames[i] = job.name
+	}
+	nextNames := make([]string, len(next))
+	for i, job := range next {
+		nextNames[i] = job.name
+	}
+	appliedKeys, nextKeys := uniqueJobKeys(appliedNames), uniqueJobKeys(nextNames)
+
+	existing := make(map[string]jobFields, len(applied))
+	for i, job := range applied {
+		existing[appliedKeys[i]] = job
+	}
+	changes := make([]jobChange, 0, len(next))
+	for i, job := range next {
+		old, ok := existing[nextKeys[i]]
+		if !ok {
+			changes = append(changes, jobChange{Name: job.name, Change: "added"})
+			continue
+		}
+		delete(existing, nextKeys[i])
+		fields := changedFields(old.fields, job.fields)
+		if len(fields) == 0 {
+			changes = append(changes, jobChange{Name: job.name, Change: "unchanged"})
+		} else {
+			changes = append(changes, jobChange{Name: job.name, Change: "restarted", Fields: fields})
+		}
+	}
+	for i, job := range applied {
+		if _, ok := existing[appliedKeys[i]]; ok {
+			changes = append(changes, jobChange{Name: job.name, Change: "removed"})
+		}
+	}
+	return changes
+}
+
+func changedFields(a, b map[string]string) []string {
+	var fields []string
+	for field, value := range a {
+		if b[field] != value {
+			fields = append(fields, field)
+		}
+	}
+	for field := range b {
+		if _, ok := a[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestServerFingerprintSeesSecretEnv(t *testing.T) {
+	state := StateConfig{Dir: t.TempDir(), Permissions: defaultPermissions}
+	raw := rawServer{Name: "api", Command: "true", Cwd: t.TempDir(), Env: map[string]any{"DB_URL": "postgres://db/main"}}
+	before, err := normalizeServer(raw, 0, rawDefaults{}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := normalizeServer(raw, 0, rawDefaults{}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverFingerprint(before) != serverFingerprint(again) {
+		t.Fatal("the same server config fingerprints differently")
+	}
+
+	raw.SecretEnv = []string{"DB_URL"}
+	after, err := normalizeServer(raw, 0, rawDefaults{}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverFingerprint(before) == serverFingerprint(after) {
+		t.Fatal("adding secret_env left the fingerprint unchanged")
+	}
+	fields := fieldFingerprints("api", after).fields
+	if fields["secrets"] == fieldFingerprints("api", before).fields["secrets"] {
+		t.Fatal("the config diff does not list secrets as changed")
+	}
+}
+
+// Fields json.Marshal skips never reach a fingerprint, so a change to one
+// would not restart the job. Only fields derived from another one may be
+// unexported, unless their type marshals itself.
+func TestJobConfigsFingerprintEveryField(t *testing.T) {
+	derived := map[string]bool{
+		"NormalizedSchedule.cron": true,
+		"FeedTrigger.title":       true,
+		"MailTrigger.from":        true,
+		"MailTrigger.subject":     true,
+	}
+	marshaler := reflect.TypeFor[json.Marshaler]()
+	seen := map[reflect.Type]bool{}
+	var walk func(reflect.Type)
+	walk = func(typ reflect.Type) {
+		for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct || seen[typ] || typ.Implements(marshaler) || typ.PkgPath() != reflect.TypeFor[NormalizedServer]().PkgPath() {
+			return
+		}
+		seen[typ] = true
+		for i := range typ.NumField() {
+			field := typ.Field(i)
+			if !field.IsExported() && !derived[typ.Name()+"."+field.Name] {
+				t.Errorf("%s.%s is not fingerprinted", typ.Name(), field.Name)
+			}
+			if tag := field.Tag.Get("json"); tag == "-" {
+				t.Errorf("%s.%s is skipped by its json tag", typ.Name(), field.Name)
+			}
+			walk(field.Type)
+		}
+	}
+	walk(reflect.TypeFor[NormalizedWatcher]())
+	walk(reflect.TypeFor[NormalizedServer]())
+	walk(reflect.TypeFor[NormalizedSchedule]())
+}
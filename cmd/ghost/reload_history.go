@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const reloadHistoryLimit = 500
+
+type reloadRecord struct {
+	ID        int64          `json:"id,omitempty"`
+	Time      time.Time      `json:"time"`
+	Reason    string         `json:"reason"`
+	Config    string         `json:"config"`
+	Hash      string         `json:"hash"`
+	Profile   string         `json:"profile,omitempty"`
+	OK        bool           `json:"ok"`
+	Error     string         `json:"error,omitempty"`
+	Changes   []reloadChange `json:"changes"`
+	Unchanged int            `json:"unchanged"`
+}
+
+type reloadResult struct {
+	Status string `json:"status"`
+	reloadRecord
+}
+
+type reloadChange struct {
+	Kind string `json:"kind"`
+	jobChange
+}
+
+func newReloadRecord(reason, configPath string) reloadRecord {
+	return reloadRecord{Time: time.Now(), Reason: reason, Config: configPath, Changes: []reloadChange{}}
+}
+
+func (r *reloadRecord) setDiff(diff configDiff) {
+	r.Changes, r.Unchanged = []reloadChange{}, 0
+	for _, section := range []struct {
+		kind    string
+		changes []jobChange
+	}{
+		{"watcher", diff.Watchers},
+		{"server", diff.Servers},
+		{"schedule", diff.Schedules},
+	} {
+		for _, change := range section.changes {
+			if change.Change == "unchanged" {
+				r.Unchanged++
+				continue
+			}
+			r.Changes = append(r.Changes, reloadChange{Kind: section.kind, jobChange: change})
+		}
+	}
+}
+
+func (r reloadRecord) summary() string {
+	var summary reloadSummary
+	for _, change := range r.Changes {
+		switch change.Change {
+		case "added":
+			summary.added++
+		case "removed":
+			summary.removed++
+		case "restarted":
+			summary.restarted++
+		}
+	}
+	summary.unchanged = r.Unchanged
+	return summary.String()
+}
+
+func (r reloadRecord) mentions(name string) bool {
+	for _, change := range r.Changes {
+		if change.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func configHash(configPath string, included []string) string {
+	hash := sha256.New()
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return ""
+	}
+	hash.Write(data)
+	for _, path := range included {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(hash, "\x00%s\x00", path)
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func recordReload(record reloadRecord) {
+	changes, err := json.Marshal(record.Changes)
+	if err != nil {
+		logWarn("reload history: encode changes: %v", err)
+		return
+	}
+
+	err = withStateDB(func(db *sql.DB) error {
+		_, err := db.Exec(`INSERT INTO reload_history (reloaded_at, reason, config_path, config_hash, profile, ok, error, changes, unchanged) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			record.Time.UTC(), record.Reason, record.Config, record.Hash, nullIfEmpty(record.Profile), record.OK, nullIfEmpty(record.Error), string(changes), record.Unchanged)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`DELETE FROM reload_history WHERE id <= (SELECT MAX(id) FROM reload_history) - ?`, reloadHistoryLimit)
+		return err
+	})
+	if err != nil {
+		logWarn("reload history: %v", err)
+	}
+}
+
+func queryReloadHistory(db *sql.DB) ([]reloadRecord, error) {
+	rows, err := db.Query(`SELECT id, reloaded_at, reason, config_path, config_hash, COALESCE(profile, ''), ok, COALESCE(error, ''), changes, unchanged FROM reload_history ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []reloadRecord
+	for rows.Next() {
+		var record reloadRecord
+		var changes string
+		if err := rows.Scan(&record.ID, &record.Time, &record.Reason, &record.Config, &record.Hash, &record.Profile, &record.OK, &record.Error, &changes, &record.Unchanged); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &record.Changes); err != nil || record.Changes == nil {
+			record.Changes = []reloadChange{}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func runReloadHistoryCommand(args []string) error {
+	fs := flag.NewFlagSet("reload-history", flag.ContinueOnError)
+	limit := fs.Int("n", 20, "show the last N reloads (0 for all)")
+	job := fs.String("job", "", "only show reloads that added, removed or restarted this job")
+	raw := fs.Bool("json", false, "print the raw JSON records")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("usage: ghost reload-history [-n N] [-job name] [-json]")
+	}
+
+	var all []reloadRecord
+	err = readStateDB(func(db *sql.DB) error {
+		all, err = queryReloadHistory(db)
+		return err
+	})
+	if errors.Is(err, os.ErrNotExist) || missingTable(err) {
+		fmt.Println("no reloads recorded yet")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read reload history: %w", err)
+	}
+
+	records := make([]reloadRecord, 0, len(all))
+	for _, record := range all {
+		if *job == "" || record.mentions(*job) {
+			records = append(records, record)
+		}
+	}
+	if *limit > 0 && len(records) > *limit {
+		records = records[len(records)-*limit:]
+	}
+
+	if *raw {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	}
+	if len(records) == 0 {
+		fmt.Println("no matching reloads")
+		return nil
+	}
+	for _, record := range records {
+		fmt.Println(formatReloadRecord(record))
+	}
+	return nil
+}
+
+func formatReloadRecord(record reloadRecord) string {
+	var builder strings.Builder
+	status := "ok"
+	if !record.OK {
+		status = "failed"
+	}
+	hash := record.Hash
+	if len(hash) > 12 {
+		hash = hash[:12]
+	} else if hash == "" {
+		hash = "-"
+	}
+	fmt.Fprintf(&builder, "%s %-6s %-8s %-12s", record.Time.Local().Format("2006-01-02 15:04:05"), status, record.Reason, hash)
+	if record.Profile != "" {
+		fmt.Fprintf(&builder, " profile=%s", record.Profile)
+	}
+	if record.OK || len(record.Changes) > 0 {
+		fmt.Fprintf(&builder, " %s", record.summary())
+	}
+	writeReloadChanges(&builder, record.Changes)
+	if record.Error != "" {
+		for _, line := range strings.Split(record.Error, "\n") {
+			fmt.Fprintf(&builder, "\n  ! %s", line)
+		}
+	}
+	return builder.String()
+}
+
+func writeReloadChanges(builder *strings.Builder, changes []reloadChange) {
+	for _, change := range changes {
+		fmt.Fprintf(builder, "\n  %s %s %s", jobChangeMarks[change.Change], change.Kind, change.Name)
+		if len(change.Fields) > 0 {
+			fmt.Fprintf(builder, " (%s)", strings.Join(change.Fields, ", "))
+		}
+	}
+}
+
+func runReloadCommand(args []string) error {
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("usage: ghost reload")
+	}
+	var result reloadResult
+	if err := controlRequest("POST", "/v1/reload", nil, &result); err != nil {
+		return err
+	}
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "reloaded %s: %s", result.Config, result.summary())
+	writeReloadChanges(&builder, result.Changes)
+	fmt.Println(builder.String())
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRemotePollInterval = 10 * time.Second
+	minRemotePollInterval     = time.Second
+	remoteScanTimeout         = time.Minute
+)
+
+const remoteListScript = `if stat -c %%s . >/dev/null 2>&1; then set -- -c '%%s %%Y %%n'; else set -- -f '%%z %%m %%N'; fi
+cd -- %s || exit 1
+find . -type f -exec stat "$@" {} + 2>/dev/null
+exit 0`
+
+type RemoteWatch struct {
+	Kind   string
+	Target string
+	Port   int
+	Dir    string
+	Bucket string
+	Prefix string
+}
+
+func parseRemoteWatch(value string) (*RemoteWatch, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "s3://") || strings.HasPrefix(value, "gs://") {
+		return parseBucketWatch(value)
+	}
+	// Listings run a shell script over ssh, which accounts limited to SFTP
+	// refuse.
+	if strings.HasPrefix(value, "sftp://") {
+		return nil, fmt.Errorf("%q: sftp:// is not supported, the remote needs a shell; use ssh://", value)
+	}
+	remote := &RemoteWatch{Kind: "ssh"}
+	if strings.HasPrefix(value, "ssh://") {
+		parsed, err := url.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid URL: %w", value, err)
+		}
+		remote.Target = parsed.Hostname()
+		if parsed.User != nil {
+			remote.Target = parsed.User.Username() + "@" + remote.Target
+		}
+		if port := parsed.Port(); port != "" {
+			remote.Port, err = strconv.Atoi(port)
+			if err != nil || remote.Port <= 0 || remote.Port > 65535 {
+				return nil, fmt.Errorf("%q has an invalid port", value)
+			}
+		}
+		remote.Dir = strings.TrimPrefix(parsed.Path, "/~/")
+		if parsed.Path == "/~" {
+			remote.Dir = ""
+		}
+		if parsed.Hostname() == "" {
+			return nil, fmt.Errorf("%q has no host", value)
+		}
+	} else {
+		host, dir, ok := strings.Cut(value, ":")
+		if !ok || host == "" || strings.ContainsAny(host, "/ ") {
+			return nil, fmt.Errorf("%q must look like [user@]host:/dir or ssh://[user@]host[:port]/dir", value)
+		}
+		remote.Target = host
+		remote.Dir = strings.TrimPrefix(dir, "~/")
+		if dir == "~" {
+			remote.Dir = ""
+		}
+	}
+	if strings.HasPrefix(remote.Target, "-") {
+		return nil, fmt.Errorf("%q: host must not start with -", value)
+	}
+	if remote.Dir == "" {
+		remote.Dir = "."
+	}
+	remote.Dir = path.Clean(remote.Dir)
+	return remote, nil
+}
+
+func (r *RemoteWatch) String() string {
+	if r.Kind != "ssh" {
+		return r.bucketURL()
+	}
+	target := r.Target
+	if r.Port != 0 {
+		target += ":" + strconv.Itoa(r.Port)
+	}
+	return target + ":" + r.Dir
+}
+
+func (r *RemoteWatch) listCommand() (string, []string) {
+	if r.Kind != "ssh" {
+		return r.bucketListCommand()
+	}
+	args := []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+	if r.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(r.Port))
+	}
+	script := fmt.Sprintf(remoteListScript, "'"+strings.ReplaceAll(r.Dir, "'", `'\''`)+"'")
+	return "ssh", append(args, "--", r.Target, "sh -c "+shellQuote(script))
+}
+
+func (r *RemoteWatch) parseListing(listing []byte, add func(rel string, size int64, modTime time.Time)) error {
+	switch r.Kind {
+	case "s3":
+		return parseS3Listing(listing, r.Prefix, add)
+	case "gcs":
+		return parseGCSListing(listing, r.bucketURL(), add)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(listing))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 || !strings.HasPrefix(fields[2], "./") {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		mtime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		add(strings.TrimPrefix(fields[2], "./"), size, time.Unix(mtime, 0))
+	}
+	return scanner.Err()
+}
+
+func (p *pollWatcher) scanRemote() (map[string]fileStamp, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteScanTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var stdout, stderr bytes.Buffer
+	name, args := p.cfg.Remote.listCommand()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = buildEnvList(p.cfg.Env)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := lastLine(strings.TrimSpace(stderr.String())); detail != "" {
+			return nil, fmt.Errorf("list %s: %s", p.cfg.Remote, detail)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("list %s: timed out after %s", p.cfg.Remote, remoteScanTimeout)
+		}
+		return nil, fmt.Errorf("list %s: %w", p.cfg.Remote, err)
+	}
+	stamps := make(map[string]fileStamp)
+	err := p.cfg.Remote.parseListing(stdout.Bytes(), func(rel string, size int64, modTime time.Time) {
+		rel = path.Clean(rel)
+		if rel == "." || strings.HasPrefix(rel, "../") || p.cfg.ignored(rel) {
+			return
+		}
+		stamps[filepath.Join(p.cfg.WatchRoot, filepath.FromSlash(rel))] = fileStamp{modTime: modTime, size: size}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", p.cfg.Remote, err)
+	}
+	return stamps, nil
+}
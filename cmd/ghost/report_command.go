@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+func runReportCommand(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	from := fs.String("from", "", "first day to include (YYYY-MM-DD)")
+	to := fs.String("to", "", "last day to include (YYYY-MM-DD, default today)")
+	formatValue := formatFlag(fs)
+	asJSON := fs.Bool("json", false, "shorthand for -format json")
+	asCSV := fs.Bool("csv", false, "shorthand for -format csv")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 1 {
+		return errors.New("usage: ghost report [today|yesterday|week|month] [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-json|-csv]")
+	}
+
+	format, err := parseOutputFormat(*formatValue)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *asJSON && *asCSV:
+		return errors.New("-json and -csv are mutually exclusive")
+	case *asJSON:
+		format = formatJSON
+	case *asCSV:
+		format = formatCSV
+	}
+
+	period := "today"
+	if len(rest) == 1 {
+		period = rest[0]
+	}
+	since, until, err := reportRange(time.Now(), period, *from, *to)
+	if err != nil {
+		return err
+	}
+	return writeWindowReport(format, since, until)
+}
+
+func reportRange(now time.Time, period, from, to string) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if from != "" || to != "" {
+		until := now
+		if to != "" {
+			day, err := time.ParseInLocation(time.DateOnly, to, now.Location())
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("-to: %w", err)
+			}
+			until = day.AddDate(0, 0, 1)
+		}
+		since := today
+		if from != "" {
+			day, err := time.ParseInLocation(time.DateOnly, from, now.Location())
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("-from: %w", err)
+			}
+			since = day
+		}
+		if !since.Before(until) {
+			return time.Time{}, time.Time{}, errors.New("-from must not be after -to")
+		}
+		return since, until, nil
+	}
+
+	switch period {
+	case "today":
+		return today, now, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, nil
+	case "week":
+		offset := (int(today.Weekday()) + 6) % 7
+		return today.AddDate(0, 0, -offset), now, nil
+	case "month":
+		return today.AddDate(0, 0, 1-today.Day()), now, nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown period %q (use today, yesterday, week or month)", period)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/creack/pty"
+)
+
+func runResizeCommand(args []string) error {
+	fs := flag.NewFlagSet("resize", flag.ContinueOnError)
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) < 1 || len(rest) > 2 {
+		return errors.New("usage: ghost resize <server> [COLSxROWS]")
+	}
+	name := rest[0]
+
+	var body resizeRequest
+	if len(rest) == 2 {
+		body, err = parsePTYSize(rest[1])
+		if err != nil {
+			return err
+		}
+	} else {
+		size, err := pty.GetsizeFull(os.Stdout)
+		if err != nil {
+			return fmt.Errorf("read terminal size (pass COLSxROWS instead): %w", err)
+		}
+		body = resizeRequest{Rows: int(size.Rows), Cols: int(size.Cols)}
+	}
+	if err := controlRequest("POST", "/v1/servers/"+url.PathEscape(name)+"/resize", body, nil); err != nil {
+		return err
+	}
+	fmt.Printf("resized %s to %dx%d\n", name, body.Cols, body.Rows)
+	return nil
+}
+
+func parsePTYSize(value string) (resizeRequest, error) {
+	cols, rows, ok := strings.Cut(strings.ToLower(value), "x")
+	if ok {
+		c, errCols := strconv.Atoi(cols)
+		r, errRows := strconv.Atoi(rows)
+		if errCols == nil && errRows == nil && c > 0 && r > 0 {
+			return resizeRequest{Rows: r, Cols: c}, nil
+		}
+	}
+	return resizeRequest{}, fmt.Errorf("invalid size %q (want COLSxROWS, e.g. 160x48)", value)
+}
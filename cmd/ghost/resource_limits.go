@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	resourcePollInterval = 5 * time.Second
+	resourceLimitSamples = 3
+)
+
+type ResourceLimits struct {
+	MaxMemory  int64
+	CPUPercent int
+	Action     string
+}
+
+type processUsage struct {
+	RSS     int64
+	CPUTime time.Duration
+}
+
+func (l ResourceLimits) empty() bool {
+	return l.MaxMemory <= 0 && l.CPUPercent <= 0
+}
+
+func normalizeResourceLimits(maxMemoryMB, cpuLimit *int64, action string) (ResourceLimits, error) {
+	var limits ResourceLimits
+	if maxMemoryMB != nil {
+		if *maxMemoryMB < 1 {
+			return ResourceLimits{}, errors.New("max_memory_mb must be at least 1")
+		}
+		limits.MaxMemory = *maxMemoryMB << 20
+	}
+	if cpuLimit != nil {
+		if *cpuLimit < 1 {
+			return ResourceLimits{}, errors.New("cpu_limit must be at least 1 (percent of one core)")
+		}
+		limits.CPUPercent = int(*cpuLimit)
+	}
+	limits.Action = strings.ToLower(strings.TrimSpace(action))
+	switch limits.Action {
+	case "":
+		limits.Action = "restart"
+	case "restart", "warn":
+	default:
+		return ResourceLimits{}, fmt.Errorf("limit_action must be \"restart\" or \"warn\", got %q", action)
+	}
+	return limits, nil
+}
+
+func sumProcessTree(root int, children map[int][]int, usages map[int]processUsage) processUsage {
+	var total processUsage
+	seen := make(map[int]bool)
+	queue := []int{root}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		if seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		usage := usages[pid]
+		total.RSS += usage.RSS
+		total.CPUTime += usage.CPUTime
+		queue = append(queue, children[pid]...)
+	}
+	return total
+}
+
+func (j *serverJob) monitorResources(cmd *exec.Cmd) func() {
+	limits := j.cfg.Limits
+	if limits.empty() || cmd.Process == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		j.watchResources(ctx, limits, cmd)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (j *serverJob) watchResources(ctx context.Context, limits ResourceLimits, cmd *exec.Cmd) {
+	pid := cmd.Process.Pid
+	log := j.log().withPID(pid)
+	ticker := j.clock.NewTicker(resourcePollInterval)
+	defer ticker.Stop()
+
+	var (
+		previous     processUsage
+		previousAt   time.Time
+		overMemory   int
+		overCPU      int
+		sampleFailed bool
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		usage, err := processTreeUsage(pid)
+		now := j.clock.Now()
+		if err != nil {
+			if !sampleFailed {
+				log.Warn("cannot read resource usage, limits are not enforced: %v", err)
+				sampleFailed = true
+			}
+			continue
+		}
+		sampleFailed = false
+
+		var reason string
+		if limits.MaxMemory > 0 {
+			if usage.RSS > limits.MaxMemory {
+				overMemory++
+			} else {
+				overMemory = 0
+			}
+			if overMemory >= resourceLimitSamples {
+				reason = fmt.Sprintf("memory %d MB over max_memory_mb %d", usage.RSS>>20, limits.MaxMemory>>20)
+				overMemory = 0
+			}
+		}
+		if limits.CPUPercent > 0 && !previousAt.IsZero() {
+			percent := int(100 * (usage.CPUTime - previous.CPUTime) / now.Sub(previousAt))
+			if percent > limits.CPUPercent {
+				overCPU++
+			} else {
+				overCPU = 0
+			}
+			if overCPU >= resourceLimitSamples && reason == "" {
+				reason = fmt.Sprintf("cpu %d%% over cpu_limit %d%%", percent, limits.CPUPercent)
+				overCPU = 0
+			}
+		}
+		previous, previousAt = usage, now
+		if reason == "" {
+			continue
+		}
+		if limits.Action == "warn" {
+			log.Warn("%s for %s", reason, resourcePollInterval*resourceLimitSamples)
+			continue
+		}
+		j.restartOverLimit(cmd, reason)
+		return
+	}
+}
+
+func (j *serverJob) restartOverLimit(cmd *exec.Cmd, reason string) {
+	j.mu.Lock()
+	if j.closed || j.cmd != cmd {
+		j.mu.Unlock()
+		return
+	}
+	j.healthRestart = true
+	j.restartCause = "resource limit"
+	j.stopProcessLocked()
+	j.mu.Unlock()
+
+	j.log().withPID(cmd.Process.Pid).Error("%s, restarting", reason)
+	writeAuditEntry(auditEntry{
+		Event: "limit",
+		Kind:  "server",
+		Job:   j.cfg.Name,
+		PID:   cmd.Process.Pid,
+		Argv:  j.cfg.Secrets.redactArgs(cmd.Args),
+		Cwd:   cmd.Dir,
+		Cause: reason,
+	})
+}
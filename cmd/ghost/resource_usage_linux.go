@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const clockTicksPerSecond = 100
+
+func processTreeUsage(root int) (processUsage, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return processUsage{}, err
+	}
+	children := make(map[int][]int)
+	usages := make(map[int]processUsage)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		ppid, usage, err := readProcStat(pid)
+		if err != nil {
+			continue
+		}
+		children[ppid] = append(children[ppid], pid)
+		usages[pid] = usage
+	}
+	if _, ok := usages[root]; !ok {
+		return processUsage{}, fmt.Errorf("process %d not found", root)
+	}
+	return sumProcessTree(root, children, usages), nil
+}
+
+func readProcStat(pid int) (int, processUsage, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, processUsage{}, err
+	}
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return 0, processUsage{}, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return 0, processUsage{}, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+	return ppid, processUsage{
+		RSS:     rss * int64(os.Getpagesize()),
+		CPUTime: time.Duration(utime+stime) * time.Second / clockTicksPerSecond,
+	}, nil
+}
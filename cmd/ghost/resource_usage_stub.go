@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func processTreeUsage(int) (processUsage, error) {
+	return processUsage{}, errors.New("resource usage is not available on this platform")
+}
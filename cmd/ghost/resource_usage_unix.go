@@ -0,0 +1,57 @@
+//go:build unix && !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func processTreeUsage(root int) (processUsage, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,rss=,time=").Output()
+	if err != nil {
+		return processUsage{}, fmt.Errorf("ps: %w", err)
+	}
+	children := make(map[int][]int)
+	usages := make(map[int]processUsage)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		rss, _ := strconv.ParseInt(fields[2], 10, 64)
+		children[ppid] = append(children[ppid], pid)
+		usages[pid] = processUsage{RSS: rss << 10, CPUTime: parsePSTime(fields[3])}
+	}
+	if _, ok := usages[root]; !ok {
+		return processUsage{}, fmt.Errorf("process %d not found", root)
+	}
+	return sumProcessTree(root, children, usages), nil
+}
+
+func parsePSTime(value string) time.Duration {
+	var days int64
+	if d, rest, ok := strings.Cut(value, "-"); ok {
+		days, _ = strconv.ParseInt(d, 10, 64)
+		value = rest
+	}
+	total := time.Duration(days) * 24 * time.Hour
+	parts := strings.Split(value, ":")
+	for i, part := range parts {
+		seconds, _ := strconv.ParseFloat(part, 64)
+		unit := time.Second
+		for k := i; k < len(parts)-1; k++ {
+			unit *= 60
+		}
+		total += time.Duration(seconds * float64(unit))
+	}
+	return total
+}
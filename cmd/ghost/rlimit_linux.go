@@ -0,0 +1,24 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// applyMemoryRlimit caps the data segment of a server that is restarted over
+// max_memory_mb, so the kernel stops a runaway allocation between two polls.
+// Children inherit the cap each on their own; the polled total still covers
+// the whole tree.
+func applyMemoryRlimit(pid int, limits ResourceLimits) error {
+	if limits.MaxMemory <= 0 || limits.Action != "restart" || pid <= 0 {
+		return nil
+	}
+	limit := uint64(limits.MaxMemory)
+	if err := unix.Prlimit(pid, unix.RLIMIT_DATA, &unix.Rlimit{Cur: limit, Max: limit}, nil); err != nil {
+		return fmt.Errorf("set RLIMIT_DATA to %d MB: %w", limits.MaxMemory>>20, err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// Only Linux can set another process's rlimits, so elsewhere max_memory_mb
+// is enforced by polling alone.
+func applyMemoryRlimit(pid int, limits ResourceLimits) error {
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// RunAs is the account a job's command runs as, from its user and group
+// settings. Switching accounts needs a daemon running as root.
+type RunAs struct {
+	User   string
+	Group  string
+	UID    uint32
+	GID    uint32
+	Groups []uint32
+	Home   string
+}
+
+func (r *RunAs) String() string {
+	switch {
+	case r.User != "" && r.Group != "":
+		return r.User + ":" + r.Group
+	case r.User != "":
+		return r.User
+	default:
+		return ":" + r.Group
+	}
+}
+
+// normalizeRunAs resolves user and group (names or numeric ids). Without a
+// group the user's primary group is used, so a numeric user with no passwd
+// entry needs one; without a user the job keeps ghost's user and only
+// changes group.
+func normalizeRunAs(userName, groupName string) (*RunAs, error) {
+	userName, groupName = strings.TrimSpace(userName), strings.TrimSpace(groupName)
+	if userName == "" && groupName == "" {
+		return nil, nil
+	}
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("user and group are not supported on windows")
+	}
+
+	runAs := &RunAs{User: userName, Group: groupName, UID: uint32(os.Getuid()), GID: uint32(os.Getgid())}
+	if userName != "" {
+		account, err := lookupUser(userName)
+		switch {
+		case err == nil:
+			uid, _ := strconv.ParseUint(account.Uid, 10, 32)
+			gid, _ := strconv.ParseUint(account.Gid, 10, 32)
+			runAs.UID, runAs.GID, runAs.Home = uint32(uid), uint32(gid), account.HomeDir
+			if ids, err := account.GroupIds(); err == nil {
+				for _, id := range ids {
+					if gid, err := strconv.ParseUint(id, 10, 32); err == nil {
+						runAs.Groups = append(runAs.Groups, uint32(gid))
+					}
+				}
+			}
+		case isNumericID(userName):
+			// An id with no passwd entry, as in many containers. There is
+			// no primary group to fall back on, and keeping ghost's would
+			// run the job in root's group.
+			if groupName == "" {
+				return nil, fmt.Errorf("user %s has no passwd entry; set group as well", userName)
+			}
+			uid, _ := strconv.ParseUint(userName, 10, 32)
+			runAs.UID = uint32(uid)
+		default:
+			return nil, err
+		}
+	}
+	if groupName != "" {
+		group, err := lookupGroup(groupName)
+		switch {
+		case err == nil:
+			gid, _ := strconv.ParseUint(group.Gid, 10, 32)
+			runAs.GID = uint32(gid)
+		case isNumericID(groupName):
+			gid, _ := strconv.ParseUint(groupName, 10, 32)
+			runAs.GID = uint32(gid)
+		default:
+			return nil, err
+		}
+	}
+
+	if os.Geteuid() != 0 && (runAs.UID != uint32(os.Geteuid()) || runAs.GID != uint32(os.Getegid())) {
+		return nil, fmt.Errorf("running as %s needs ghost to run as root", runAs)
+	}
+	return runAs, nil
+}
+
+// env points HOME, USER and LOGNAME at the job's user unless the job sets
+// them itself, so tools don't write into ghost's home.
+func (r *RunAs) env(env map[string]string) map[string]string {
+	if r == nil || r.User == "" {
+		return env
+	}
+	merged := make(map[string]string, len(env)+3)
+	if r.Home != "" {
+		merged["HOME"] = r.Home
+	}
+	if !isNumericID(r.User) {
+		merged["USER"], merged["LOGNAME"] = r.User, r.User
+	}
+	for key, value := range env {
+		merged[key] = value
+	}
+	return merged
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if isNumericID(name) {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if isNumericID(name) {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
+
+func isNumericID(value string) bool {
+	_, err := strconv.ParseUint(value, 10, 32)
+	return err == nil
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+func setRunAs(cmd *exec.Cmd, runAs *RunAs) {}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os/user"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNumericUserWithoutPasswdEntryNeedsGroup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("user is not supported on windows")
+	}
+	const uid = "48213"
+	if _, err := user.LookupId(uid); err == nil {
+		t.Skipf("uid %s has a passwd entry here", uid)
+	}
+	_, err := normalizeRunAs(uid, "")
+	if err == nil || !strings.Contains(err.Error(), "set group") {
+		t.Fatalf("normalizeRunAs(%q, \"\") = %v, want an error asking for group", uid, err)
+	}
+}
+
+func TestSandboxHomeIsTheJobUsers(t *testing.T) {
+	wrapped, err := wrapSandboxCommand([]string{"make"}, []string{"readonly-home"}, "", "/src", "/src", &RunAs{User: "builder", Home: "/home/builder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(wrapped, "HOME=/home/builder") {
+		t.Fatalf("sandbox parameters %q don't point HOME at the job user's home", wrapped)
+	}
+}
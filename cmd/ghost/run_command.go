@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+func runRunCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	path := fs.String("path", "", "file to report as changed (fills {path} and {relpath})")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errors.New("usage: ghost run <watcher> [-path file]")
+	}
+	name := rest[0]
+
+	body := triggerRequest{Path: *path}
+	if body.Path != "" && !filepath.IsAbs(body.Path) {
+		if abs, err := filepath.Abs(body.Path); err == nil {
+			if _, err := os.Stat(abs); err == nil {
+				body.Path = abs
+			}
+		}
+	}
+	if err := controlRequest("POST", "/v1/watchers/"+url.PathEscape(name)+"/trigger", body, nil); err != nil {
+		return err
+	}
+	if body.Path != "" {
+		fmt.Printf("triggered %s for %s\n", name, body.Path)
+	} else {
+		fmt.Printf("triggered %s\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const sandboxExecPath = "/usr/bin/sandbox-exec"
+
+var sandboxRules = map[string]string{
+	"no-network": `(deny network-outbound (remote ip "*:*"))
+(deny network-inbound (local ip "*:*"))`,
+	"readonly-home": `(deny file-write* (subpath (param "HOME")))
+(allow file-write* (subpath (param "WORKDIR")))
+(allow file-write* (subpath (param "ROOT")))`,
+}
+
+func normalizeSandbox(value any) ([]string, error) {
+	names, err := valueToStringSlice(value)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if runtime.GOOS != "darwin" {
+		return nil, fmt.Errorf("sandbox: profiles require macOS sandbox-exec (running on %s)", runtime.GOOS)
+	}
+	seen := make(map[string]struct{}, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := sandboxRules[name]; !ok {
+			return nil, fmt.Errorf("sandbox: unsupported profile %q (use no-network or readonly-home)", name)
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// normalizeSandboxProfile resolves sandbox_profile, a sandbox-exec profile
+// file of the user's own, used instead of the built-in profiles.
+func normalizeSandboxProfile(path string, names []string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", nil
+	}
+	if len(names) > 0 {
+		return "", errors.New("sandbox_profile cannot be combined with sandbox")
+	}
+	if runtime.GOOS != "darwin" {
+		return "", fmt.Errorf("sandbox_profile: profiles require macOS sandbox-exec (running on %s)", runtime.GOOS)
+	}
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("sandbox_profile: %w", err)
+	}
+	if _, err := os.Stat(resolved); err != nil {
+		return "", fmt.Errorf("sandbox_profile: %w", err)
+	}
+	return resolved, nil
+}
+
+func buildSandboxProfile(names []string) string {
+	var builder strings.Builder
+	builder.WriteString("(version 1)\n(allow default)\n")
+	for _, name := range names {
+		builder.WriteString(sandboxRules[name])
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// wrapSandboxCommand runs command under sandbox-exec with the built-in
+// profiles in names or the profile file. Both get HOME (the home of the
+// job's user), WORKDIR (the job's cwd) and ROOT (the watch root, or cwd for
+// servers) as parameters.
+func wrapSandboxCommand(command []string, names []string, profileFile, cwd, root string, runAs *RunAs) ([]string, error) {
+	if len(names) == 0 && profileFile == "" {
+		return command, nil
+	}
+	home := ""
+	if runAs != nil {
+		home = runAs.Home
+	}
+	if home == "" {
+		var err error
+		if home, err = os.UserHomeDir(); err != nil {
+			return nil, fmt.Errorf("resolve home: %w", err)
+		}
+	}
+	wrapped := []string{
+		sandboxExecPath,
+		"-D", "HOME=" + home,
+		"-D", "WORKDIR=" + cwd,
+		"-D", "ROOT=" + root,
+	}
+	if profileFile != "" {
+		wrapped = append(wrapped, "-f", profileFile)
+	} else {
+		wrapped = append(wrapped, "-p", buildSandboxProfile(names))
+	}
+	return append(wrapped, command...), nil
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+	"github.com/nikiv/ghost/pkg/cron"
+)
+
+const scheduleRecheckInterval = time.Minute
+
+type rawSchedule struct {
+	Name          string          `toml:"name"`
+	Command       any             `toml:"command"`
+	Args          any             `toml:"args"`
+	Cwd           any             `toml:"cwd"`
+	Env           map[string]any  `toml:"env"`
+	Cron          string          `toml:"cron"`
+	Every         string          `toml:"every"`
+	RunOnStart    *bool           `toml:"run_on_start"`
+	KillTimeoutMs *int64          `toml:"kill_timeout_ms"`
+	Shell         *bool           `toml:"shell"`
+	ShellProfile  string          `toml:"shell_profile"`
+	Nice          *int64          `toml:"nice"`
+	IONice        string          `toml:"ionice"`
+	IONiceLevel   *int64          `toml:"ionice_level"`
+	SecretEnv     []string        `toml:"secret_env"`
+	Umask         any             `toml:"umask"`
+	User          string          `toml:"user"`
+	Group         string          `toml:"group"`
+	ProcessGroup  *bool           `toml:"process_group"`
+	Labels        map[string]any  `toml:"labels"`
+	Mail          *rawMailTrigger `toml:"mail"`
+	Feed          *rawFeedTrigger `toml:"feed"`
+}
+
+type NormalizedSchedule struct {
+	ID             string
+	Name           string
+	Command        []string
+	CommandDisplay string
+	Env            map[string]string
+	Cwd            string
+	Cron           string
+	Every          time.Duration
+	RunOnStart     bool
+	KillTimeout    time.Duration
+	UseShell       bool
+	Priority       ProcessPriority
+	Secrets        secretSet
+	Umask          os.FileMode
+	UmaskSet       bool
+	RunAs          *RunAs
+	ProcessGroup   bool
+	Labels         map[string]string
+	Mail           *MailTrigger
+	Feed           *FeedTrigger
+
+	cron cron.Schedule
+}
+
+type scheduleInfo struct {
+	Name       string            `json:"name"`
+	Command    string            `json:"command"`
+	Schedule   string            `json:"schedule"`
+	State      string            `json:"state"`
+	PID        int               `json:"pid,omitempty"`
+	NextRun    *time.Time        `json:"next_run,omitempty"`
+	LastRun    *time.Time        `json:"last_run,omitempty"`
+	LastResult string            `json:"last_result,omitempty"`
+	LastRunID  string            `json:"last_run_id,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+func normalizeSchedule(raw rawSchedule, index int, defaults rawDefaults) (NormalizedSchedule, error) {
+	name := strings.TrimSpace(raw.Name)
+	if name == "" {
+		name = fmt.Sprintf("schedule-%d", index+1)
+	}
+
+	var errs configcheck.Errors
+	commandParts, displayParts, err := parseCommandSpec(raw.Command, raw.Args)
+	if err != nil {
+		errs.Add(fmt.Errorf("schedules[%d]: %w", index, err))
+	} else if len(commandParts) == 0 {
+		errs.Add(fmt.Errorf("schedules[%d]: command must not be empty", index))
+	}
+
+	result := NormalizedSchedule{
+		ID:   fmt.Sprintf("schedules[%d]", index),
+		Name: name,
+	}
+
+	cronExpr := strings.TrimSpace(raw.Cron)
+	every := strings.TrimSpace(raw.Every)
+	if rest, ok := strings.CutPrefix(cronExpr, "@every "); ok {
+		if every != "" {
+			errs.Add(fmt.Errorf("schedules[%d]: set either cron or every, not both", index))
+		} else {
+			cronExpr, every = "", strings.TrimSpace(rest)
+		}
+	}
+	switch {
+	case cronExpr != "" && every != "":
+		errs.Add(fmt.Errorf("schedules[%d]: set either cron or every, not both", index))
+	case cronExpr != "":
+		schedule, err := cron.Parse(cronExpr)
+		if err != nil {
+			errs.Add(fmt.Errorf("schedules[%d]: %w", index, err))
+		}
+		result.Cron = schedule.String()
+		result.cron = schedule
+	case every != "":
+		interval, err := time.ParseDuration(every)
+		if err != nil {
+			errs.Add(fmt.Errorf("schedules[%d]: every: %w", index, err))
+		} else if interval < time.Second {
+			errs.Add(fmt.Errorf("schedules[%d]: every must be at least 1s", index))
+		}
+		result.Every = interval
+	case raw.Mail != nil:
+		result.Every = defaultMailInterval
+	case raw.Feed != nil:
+		result.Every = defaultFeedInterval
+	default:
+		errs.Add(fmt.Errorf("schedules[%d]: cron or every is required", index))
+	}
+
+	env, err := normalizeEnv(raw.Env)
+	if err != nil {
+		errs.Add(fmt.Errorf("schedules[%d]: invalid env: %w", index, err))
+	}
+	result.Env = env
+
+	result.Mail, err = normalizeMailTrigger(raw.Mail, env)
+	if err != nil {
+		errs.Add(fmt.Errorf("schedules[%d]: %w", index, err))
+	}
+	result.Feed, err = normalizeFeedTrigger(raw.Feed)
+	if err != nil {
+		errs.Add(fmt.Errorf("schedules[%d]: %w", index, err))
+	}
+	if raw.Mail != nil && raw.Feed != nil {
+		errs.Add(fmt.Errorf("schedules[%d]: set either mail or feed, not both", index))
+	}
+
+	result.Labels, err = normalizeLabels(raw.Labels)
+	if err != nil {
+		errs.Add(fmt.Errorf("schedules[%d]: labels: %w", index, err))
+	}
+
+	if str, ok := valueToString(raw.Cwd); ok && str != "" {
+		resolved, err := resolvePath(str)
+		if err != nil {
+			errs.Add(fmt.Errorf("schedules[%d]: resolve cwd: %w", index, err))
+		}
+		result.Cwd = resolved
+	} else if wd, err := os.Getwd(); err == nil {
+		result.Cwd = wd
+	} else {
+		result.Cwd = "."
+	}
+
+	result.Priority, err = normalizePriority(raw.Nice, raw.IONice, raw.IONiceLevel)
+	if err != nil {
+		errs.Add(fmt.Errorf("schedules[%d]: %w", index, err))
+	}
+
+	result.RunOnStart = valueOrDefaultBool(raw.RunOnStart, false)
+	result.KillTimeout = chooseDuration(raw.KillTimeoutMs, defaults.KillTimeoutMs, defaultKillTimeout)
+	result.UseShell = valueOrDefaultBool(raw.Shell, false)
+	result.Secrets = newSecretSet(env, defaults.SecretEnv, raw.SecretEnv)
+	result.CommandDisplay = joinDisplayParts(result.Secrets.redactArgs(displayParts))
+	result.Command = append([]string(nil), commandParts...)
+	if result.UseShell {
+		result.CommandDisplay = buildShellCommand(result.Secrets.redactArgs(displayParts))
+		profile, err := normalizeShellProfile(raw.ShellProfile, defaults.ShellProfile)
+		if err != nil {
+			errs.Add(fmt.Errorf("schedules[%d]: %w", index, err))
+		}
+		result.Command = profile.command(buildShellCommand(displayParts))
+	}
+
+	result.Umask, result.UmaskSet, err = normalizeUmask(raw.Umask, defaults.Umask)
+	if err != nil {
+		errs.Add(fmt.Errorf("schedules[%d]: umask: %w", index, err))
+	}
+	if result.UmaskSet {
+		result.Command = wrapUmaskCommand(result.Command, result.Umask)
+	}
+	if result.RunAs, err = normalizeRunAs(raw.User, raw.Group); err != nil {
+		errs.Add(fmt.Errorf("schedules[%d]: %w", index, err))
+	}
+	result.ProcessGroup = valueOrDefaultBool(raw.ProcessGroup, valueOrDefaultBool(defaults.ProcessGroup, true))
+
+	if err := errs.Err(); err != nil {
+		return NormalizedSchedule{}, err
+	}
+	return result, nil
+}
+
+func (s NormalizedSchedule) next(after time.Time) time.Time {
+	if s.Every > 0 {
+		return after.Add(s.Every).Round(0)
+	}
+	return s.cron.Next(after)
+}
+
+func (s NormalizedSchedule) describe() string {
+	if s.Mail != nil {
+		return s.Mail.describe() + ", checked " + NormalizedSchedule{Every: s.Every, Cron: s.Cron}.describe()
+	}
+	if s.Feed != nil {
+		return s.Feed.describe() + ", checked " + NormalizedSchedule{Every: s.Every, Cron: s.Cron}.describe()
+	}
+	if s.Every > 0 {
+		every := s.Every.String()
+		if strings.HasSuffix(every, "m0s") {
+			every = strings.TrimSuffix(every, "0s")
+		}
+		if strings.HasSuffix(every, "h0m") {
+			every = strings.TrimSuffix(every, "0m")
+		}
+		return "every " + every
+	}
+	return "cron " + s.Cron
+}
+
+type scheduleJob struct {
+	jobRuntime
+	cfg NormalizedSchedule
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+
+	checkMu sync.Mutex
+	feed    feedPoller
+
+	mu        sync.Mutex
+	closed    bool
+	cmd       *exec.Cmd
+	exited    chan struct{}
+	killTimer clockTimer
+	nextRun   time.Time
+	history   jobHistory
+}
+
+func newScheduleJob(cfg NormalizedSchedule, rt jobRuntime) *scheduleJob {
+	job := &scheduleJob{
+		jobRuntime: rt.withDefaults(),
+		cfg:        cfg,
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+		history:    loadJobHistory("schedule", cfg.Name),
+	}
+	go job.run()
+	return job
+}
+
+func (j *scheduleJob) log() logger {
+	return logger{prefix: "ghost:" + j.cfg.Name, fields: logFields{Component: "schedule", Job: j.cfg.Name}}
+}
+
+func (j *scheduleJob) run() {
+	defer close(j.doneCh)
+
+	if j.cfg.RunOnStart {
+		j.fire("startup")
+	}
+
+	next := j.cfg.next(j.clock.Now())
+	if next.IsZero() {
+		j.log().Error("%s never fires, schedule disabled", j.cfg.describe())
+		return
+	}
+	j.setNextRun(next)
+
+	for {
+		wait := next.Sub(j.clock.Now())
+		if wait > scheduleRecheckInterval {
+			wait = scheduleRecheckInterval
+		}
+		timer := j.clock.NewTimer(wait)
+		select {
+		case <-j.stopCh:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		now := j.clock.Now()
+		if now.Before(next) {
+			continue
+		}
+		if pausedJobs.isPaused("schedule", j.cfg.Name) {
+			j.log().Info("paused, skipping — %s", j.cfg.describe())
+		} else {
+			j.fire(j.cfg.describe())
+		}
+		next = j.cfg.next(now)
+		j.setNextRun(next)
+	}
+}
+
+func (j *scheduleJob) setNextRun(next time.Time) {
+	j.mu.Lock()
+	j.nextRun = next
+	j.mu.Unlock()
+}
+
+func (j *scheduleJob) Run() {
+	go j.fire("manual")
+}
+
+func (j *scheduleJob) fire(cause string) {
+	switch {
+	case j.cfg.Mail != nil:
+		j.checkMail()
+		return
+	case j.cfg.Feed != nil:
+		j.checkFeed()
+		return
+	}
+	j.launch(cause)
+}
+
+func (j *scheduleJob) launch(cause string) {
+	j.launchWith(cause, nil, nil)
+}
+
+func (j *scheduleJob) launchWith(cause string, extraEnv map[string]string, stdin []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return
+	}
+	if j.cmd != nil {
+		j.log().Warn("previous run still in progress, skipping — %s", cause)
+		return
+	}
+
+	runID := newRunID()
+	log := j.log().withRun(runID)
+	log.withTrigger(cause).Info("starting %s — %s", j.cfg.CommandDisplay, cause)
+
+	cmd := exec.Command(j.cfg.Command[0], j.cfg.Command[1:]...)
+	cmd.Dir = j.cfg.Cwd
+	forward := newOutputForwarder(j.cfg.Name, j.cfg.Secrets)
+	cmd.Stdout, cmd.Stderr = forward.wrap(os.Stdout, os.Stderr)
+	cmd.Stdin = nil
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	env := j.cfg.Env
+	if len(extraEnv) > 0 {
+		env = make(map[string]string, len(j.cfg.Env)+len(extraEnv))
+		for key, value := range j.cfg.Env {
+			env[key] = value
+		}
+		for key, value := range extraEnv {
+			env[key] = value
+		}
+	}
+	cmd.Env = append(buildEnvList(j.cfg.RunAs.env(env)), "GHOST_RUN_ID="+runID)
+	if j.cfg.ProcessGroup {
+		setProcessGroup(cmd)
+	}
+	setRunAs(cmd, j.cfg.RunAs)
+
+	j.history.LastRun, j.history.LastRunID, j.history.LastTrigger = j.clock.Now(), runID, cause
+	if err := j.runner.Start(cmd); err != nil {
+		j.history.LastResult = "failed to start"
+		storeJobHistory("schedule", j.cfg.Name, j.history)
+		log.Error("failed to start command: %v", err)
+		return
+	}
+	j.history.LastResult = ""
+	storeJobHistory("schedule", j.cfg.Name, j.history)
+	if err := applyProcessPriority(cmd.Process.Pid, j.cfg.Priority); err != nil {
+		log.withPID(cmd.Process.Pid).Error("failed to apply priority: %v", err)
+	}
+	auditStart("schedule", j.cfg.Name, runID, cmd, env, j.cfg.Secrets, cause)
+
+	j.cmd = cmd
+	j.exited = make(chan struct{})
+	go j.waitForExit(cmd, runID, j.history.LastRun, forward, j.exited)
+}
+
+func (j *scheduleJob) waitForExit(cmd *exec.Cmd, runID string, startedAt time.Time, forward *outputForwarder, exited chan struct{}) {
+	err := cmd.Wait()
+	forward.Flush()
+	auditExit("schedule", j.cfg.Name, runID, cmd, j.cfg.Secrets, startedAt, err)
+
+	j.mu.Lock()
+	if j.killTimer != nil {
+		j.killTimer.Stop()
+		j.killTimer = nil
+	}
+	if j.cmd == cmd {
+		j.cmd = nil
+	}
+	j.history.LastResult = runResult(err)
+	history := j.history
+	closed := j.closed
+	j.mu.Unlock()
+	storeJobHistory("schedule", j.cfg.Name, history)
+	close(exited)
+
+	log := j.log().withRun(runID).withPID(cmd.Process.Pid)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			log.Error("process exited with code %d", exitErr.ExitCode())
+		} else {
+			log.Error("process exited: %v", err)
+		}
+		if !closed {
+			notifyWebhooks(webhookExit(webhookEvent{Event: "schedule.fail", Kind: "schedule", Job: j.cfg.Name, RunID: runID, PID: cmd.Process.Pid}, err))
+		}
+	} else {
+		log.Info("finished in %s", j.clock.Now().Sub(startedAt).Round(time.Millisecond))
+	}
+}
+
+func (j *scheduleJob) stopProcessLocked() {
+	if j.cmd == nil || j.cmd.Process == nil {
+		return
+	}
+
+	process := j.cmd.Process
+	group := j.cfg.ProcessGroup
+	if err := signalProcess(process, syscall.SIGTERM, group); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		j.log().Error("failed to send SIGTERM: %v", err)
+	}
+
+	j.killTimer = j.clock.AfterFunc(j.cfg.KillTimeout, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if j.cmd == nil || j.cmd.Process != process {
+			return
+		}
+		if err := signalProcess(process, syscall.SIGKILL, group); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			j.log().Error("failed to send SIGKILL: %v", err)
+		} else {
+			j.log().Info("forcing process exit with SIGKILL")
+		}
+	})
+}
+
+func (j *scheduleJob) Close() error {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		<-j.doneCh
+		return nil
+	}
+	j.closed = true
+	close(j.stopCh)
+	j.stopProcessLocked()
+	exited := j.exited
+	running := j.cmd != nil
+	j.mu.Unlock()
+
+	<-j.doneCh
+	if running {
+		<-exited
+	}
+	return nil
+}
+
+func (j *scheduleJob) kill() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cmd != nil && j.cmd.Process != nil {
+		_ = signalProcess(j.cmd.Process, syscall.SIGKILL, j.cfg.ProcessGroup)
+	}
+}
+
+func (j *scheduleJob) state() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cmd != nil && j.cmd.Process != nil {
+		return fmt.Sprintf("running (pid %d)", j.cmd.Process.Pid)
+	}
+	if pausedJobs.isPaused("schedule", j.cfg.Name) {
+		return "paused"
+	}
+	if j.nextRun.IsZero() {
+		return "idle"
+	}
+	return "next run " + j.nextRun.Format(time.DateTime)
+}
+
+func (j *scheduleJob) info() scheduleInfo {
+	info := scheduleInfo{
+		Name:     j.cfg.Name,
+		Command:  j.cfg.CommandDisplay,
+		Schedule: j.cfg.describe(),
+		State:    "idle",
+		Labels:   j.cfg.Labels,
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cmd != nil && j.cmd.Process != nil {
+		info.State = "running"
+		info.PID = j.cmd.Process.Pid
+	} else if pausedJobs.isPaused("schedule", j.cfg.Name) {
+		info.State = "paused"
+	}
+	if !j.nextRun.IsZero() {
+		next := j.nextRun
+		info.NextRun = &next
+	}
+	if !j.history.LastRun.IsZero() {
+		last := j.history.LastRun
+		info.LastRun = &last
+		info.LastResult = j.history.LastResult
+		info.LastRunID = j.history.LastRunID
+	}
+	return info
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+type ScheduleManager struct {
+	rt   jobRuntime
+	mu   sync.Mutex
+	jobs []*scheduleJob
+	keys []string
+}
+
+func (m *ScheduleManager) Apply(schedules []NormalizedSchedule) {
+	m.mu.Lock()
+	oldJobs, oldKeys := m.jobs, m.keys
+	m.mu.Unlock()
+
+	existing := make(map[string]*scheduleJob, len(oldJobs))
+	for i, job := range oldJobs {
+		if job != nil {
+			existing[oldKeys[i]] = job
+		}
+	}
+
+	names := make([]string, len(schedules))
+	for i, cfg := range schedules {
+		names[i] = cfg.Name
+	}
+	keys := uniqueJobKeys(names)
+
+	var summary reloadSummary
+	kept := make(map[string]*scheduleJob, len(schedules))
+	for i, cfg := range schedules {
+		job, ok := existing[keys[i]]
+		if !ok {
+			continue
+		}
+		if scheduleFingerprint(job.cfg) == scheduleFingerprint(cfg) {
+			kept[keys[i]] = job
+			delete(existing, keys[i])
+		}
+	}
+
+	for key, job := range existing {
+		if err := job.Close(); err != nil {
+			logError("failed to stop schedule: %v", err)
+		}
+		if !containsString(keys, key) {
+			summary.removed++
+		}
+	}
+
+	newJobs := make([]*scheduleJob, 0, len(schedules))
+	newKeys := make([]string, 0, len(schedules))
+	for i, cfg := range schedules {
+		if job, ok := kept[keys[i]]; ok {
+			summary.unchanged++
+			newJobs = append(newJobs, job)
+			newKeys = append(newKeys, keys[i])
+			continue
+		}
+		if _, replaced := existing[keys[i]]; replaced {
+			summary.restarted++
+		} else {
+			summary.added++
+		}
+		newJobs = append(newJobs, newScheduleJob(cfg, m.rt))
+		newKeys = append(newKeys, keys[i])
+	}
+
+	m.mu.Lock()
+	m.jobs, m.keys = newJobs, newKeys
+	m.mu.Unlock()
+	if len(newJobs) > 0 || len(oldJobs) > 0 {
+		logInfo("loaded %d schedule(s) (%s)", len(newJobs), summary)
+	}
+}
+
+func (m *ScheduleManager) Run(name string) error {
+	for _, job := range m.Jobs() {
+		if job.cfg.Name == name {
+			job.Run()
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown schedule %q", name)
+}
+
+func (m *ScheduleManager) Jobs() []*scheduleJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*scheduleJob(nil), m.jobs...)
+}
+
+func (m *ScheduleManager) StopAll() {
+	m.mu.Lock()
+	jobs := m.jobs
+	m.jobs, m.keys = nil, nil
+	m.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := job.Close(); err != nil {
+				logError("failed to stop schedule: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
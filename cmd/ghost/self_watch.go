@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+func ownStatePaths(cfg NormalizedConfig) []string {
+	paths := []string{cfg.State.Dir}
+	if cfg.WindowTracker.DBPath != "" {
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			paths = append(paths, cfg.WindowTracker.DBPath+suffix)
+		}
+	}
+	for _, watcher := range cfg.Watchers {
+		paths = append(paths, watcher.LogPath)
+	}
+	for _, server := range cfg.Servers {
+		paths = append(paths, server.LogPath)
+		for _, sink := range server.Sinks {
+			if sink.Type == "file" {
+				paths = append(paths, sink.Path)
+			}
+		}
+	}
+	return paths
+}
+
+func excludeOwnState(cfg *NormalizedConfig) {
+	paths := ownStatePaths(*cfg)
+	for i := range cfg.Watchers {
+		watcher := &cfg.Watchers[i]
+		for _, path := range paths {
+			if path == "" {
+				continue
+			}
+			_, rel, ok := watcher.locate(filepath.Clean(path))
+			if !ok || rel == "." || rel == watcher.SingleFile || watcher.ignored(rel) {
+				continue
+			}
+			pattern := "^" + ownPathPattern(rel) + "(?:/.*)?$"
+			if !defaultCaseSensitive() {
+				pattern = "(?i)" + pattern
+			}
+			watcher.Ignores = append(watcher.Ignores, matcher{raw: "/" + rel, re: regexp.MustCompile(pattern)})
+			logDebug("watcher %s: ignoring ghost's own %s", watcher.Name, path)
+		}
+	}
+}
+
+func ownPathPattern(rel string) string {
+	var builder strings.Builder
+	last := 0
+	for _, loc := range logPathPlaceholder.FindAllStringIndex(rel, -1) {
+		builder.WriteString(regexp.QuoteMeta(rel[last:loc[0]]))
+		builder.WriteString("[^/]*")
+		last = loc[1]
+	}
+	builder.WriteString(regexp.QuoteMeta(rel[last:]))
+	return builder.String()
+}
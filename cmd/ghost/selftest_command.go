@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const selftestTimeout = 10 * time.Second
+
+type selftest struct {
+	dir        string
+	configPath string
+	watchDir   string
+	marker     string
+	daemon     *GhostDaemon
+	out        io.Writer
+	failed     int
+}
+
+func runSelftestCommand(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	verbose := fs.Bool("v", false, "show daemon logs and job output")
+	keep := fs.Bool("keep", false, "keep the temporary directory for inspection")
+	if rest, err := parseInterspersed(fs, args); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return errors.New("usage: ghost selftest [-v] [-keep]")
+	}
+
+	dir, err := os.MkdirTemp("", "ghost-selftest-")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	if *keep {
+		defer fmt.Printf("kept %s\n", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	t := &selftest{
+		dir:        dir,
+		configPath: filepath.Join(dir, "ghost.toml"),
+		watchDir:   filepath.Join(dir, "watched"),
+		marker:     filepath.Join(dir, "runs.txt"),
+		out:        os.Stdout,
+	}
+	if err := os.MkdirAll(t.watchDir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(t.watchDir, "input.txt"), []byte("start\n"), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(t.configPath, []byte(t.config(false, *verbose)), 0o644); err != nil {
+		return err
+	}
+	os.Setenv(stateDirEnvVar, filepath.Join(dir, "state"))
+	os.Unsetenv(configEnvVar)
+
+	if !*verbose {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		stdout, stderr := os.Stdout, os.Stderr
+		os.Stdout, os.Stderr = devNull, devNull
+		defer func() {
+			os.Stdout, os.Stderr = stdout, stderr
+			devNull.Close()
+		}()
+	}
+
+	t.check("sqlite driver", checkSQLiteDriver)
+	if !t.check("daemon start", t.startDaemon) {
+		return t.result()
+	}
+	t.check("server in a pty", t.checkServerReady)
+	t.check("file watcher ("+notifyBackend()+")", t.checkWatcherRuns)
+	t.check("manual trigger", t.checkTrigger)
+	t.check("server restart", t.checkRestart)
+	t.check("config reload", t.checkReload)
+	t.check("control socket", t.checkControlSocket)
+	t.check("shutdown", t.checkShutdown)
+	return t.result()
+}
+
+func (t *selftest) config(reloaded, verbose bool) string {
+	level := "error"
+	if verbose {
+		level = "debug"
+	}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "log_level = %s\n\n", tomlString(level))
+	fmt.Fprintf(b, "[[watchers]]\nname = \"selftest-watcher\"\npath = %s\ndebounce_ms = 50\nwarmup_ms = 0\n", tomlString(t.watchDir))
+	writeTOMLList(b, "command", []string{"sh", "-c", `echo run >> "$0"`, t.marker})
+	fmt.Fprintf(b, "\n[[servers]]\nname = \"selftest-server\"\npty = true\nready_pattern = \"selftest-ready\"\nkill_timeout_ms = 1000\n")
+	writeTOMLList(b, "command", []string{"sh", "-c", "echo selftest-ready; exec sleep 600"})
+	if reloaded {
+		fmt.Fprintf(b, "\n[[watchers]]\nname = \"selftest-reloaded\"\npath = %s\ncommand = \"true\"\n", tomlString(t.watchDir))
+	}
+	return b.String()
+}
+
+func (t *selftest) check(name string, run func() error) bool {
+	started := time.Now()
+	err := run()
+	elapsed := time.Since(started).Round(time.Millisecond)
+	if err != nil {
+		t.failed++
+		fmt.Fprintf(t.out, "FAIL  %s (%s): %v\n", name, elapsed, err)
+		return false
+	}
+	fmt.Fprintf(t.out, "ok    %s (%s)\n", name, elapsed)
+	return true
+}
+
+func (t *selftest) result() error {
+	if t.daemon != nil {
+		t.daemon.Stop()
+	}
+	if t.failed > 0 {
+		return fmt.Errorf("%d check(s) failed", t.failed)
+	}
+	fmt.Fprintln(t.out, "all checks passed")
+	return nil
+}
+
+func checkSQLiteDriver() error {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := initWindowTrackerSchema(db); err != nil {
+		return err
+	}
+	if err := initWindowSummarySchema(db); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if _, err := db.Exec(`INSERT INTO focus_sessions (app_name, window_id, started_at, ended_at, duration_ms) VALUES (?, ?, ?, ?, ?)`,
+		"selftest", 1, now.Add(-time.Minute), now, int64(time.Minute/time.Millisecond)); err != nil {
+		return err
+	}
+	report, err := queryWindowReport(db, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	if len(report.Apps) != 1 || report.Apps[0].FocusMs != int64(time.Minute/time.Millisecond) {
+		return fmt.Errorf("unexpected report %+v", report.Apps)
+	}
+	return nil
+}
+
+func (t *selftest) startDaemon() error {
+	t.daemon = NewGhostDaemon(t.configPath)
+	if err := t.daemon.Start(); err != nil {
+		t.daemon = nil
+		return err
+	}
+	return nil
+}
+
+func (t *selftest) server() *serverJob {
+	for _, job := range t.daemon.serverManager.Jobs() {
+		if job != nil && job.cfg.Name == "selftest-server" {
+			return job
+		}
+	}
+	return nil
+}
+
+func (t *selftest) checkServerReady() error {
+	return waitUntil("server to print its ready pattern", func() bool {
+		job := t.server()
+		return job != nil && job.info().Ready
+	})
+}
+
+func (t *selftest) runs() int {
+	data, _ := os.ReadFile(t.marker)
+	return bytes.Count(data, []byte("run\n"))
+}
+
+func (t *selftest) checkWatcherRuns() error {
+	file, err := os.OpenFile(filepath.Join(t.watchDir, "input.txt"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString("change\n")
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return waitUntil("watcher to run after a file change", func() bool { return t.runs() >= 1 })
+}
+
+func (t *selftest) checkTrigger() error {
+	before := t.runs()
+	if err := t.daemon.manager.Trigger("selftest-watcher", ""); err != nil {
+		return err
+	}
+	return waitUntil("triggered run", func() bool { return t.runs() > before })
+}
+
+func (t *selftest) checkRestart() error {
+	job := t.server()
+	if job == nil {
+		return errors.New("server is not running")
+	}
+	pid := job.info().PID
+	if err := t.daemon.restartServer("selftest-server"); err != nil {
+		return err
+	}
+	return waitUntil("server to come back ready with a new pid", func() bool {
+		info := t.server().info()
+		return info.PID != 0 && info.PID != pid && info.Ready
+	})
+}
+
+func (t *selftest) checkReload() error {
+	if err := os.WriteFile(t.configPath, []byte(t.config(true, false)), 0o644); err != nil {
+		return err
+	}
+	if err := t.daemon.reloadConfig("selftest"); err != nil {
+		return err
+	}
+	for _, job := range t.daemon.manager.Jobs() {
+		if job.cfg.Name == "selftest-reloaded" {
+			return nil
+		}
+	}
+	return errors.New("reloaded watcher is missing")
+}
+
+func (t *selftest) checkControlSocket() error {
+	var watchers []watcherInfo
+	if err := controlRequest("GET", "/v1/watchers", nil, &watchers); err != nil {
+		return err
+	}
+	if len(watchers) != 2 {
+		return fmt.Errorf("daemon reported %d watcher(s), want 2", len(watchers))
+	}
+	return nil
+}
+
+func (t *selftest) checkShutdown() error {
+	pid := t.server().info().PID
+	daemon := t.daemon
+	t.daemon = nil
+	done := make(chan struct{})
+	go func() {
+		daemon.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(selftestTimeout):
+		return errors.New("daemon did not stop in time")
+	}
+	if pid != 0 && processAlive(pid) {
+		return fmt.Errorf("server process %d is still running", pid)
+	}
+	return nil
+}
+
+func waitUntil(what string, done func() bool) error {
+	deadline := time.Now().Add(selftestTimeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil
+}
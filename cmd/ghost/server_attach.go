@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+const (
+	attachProtocol   = "ghost-attach"
+	attachQueueSize  = 256
+	attachMaxFrame   = 1 << 16
+	attachFrameInput = 0
+	attachFrameSize  = 1
+)
+
+type attachHub struct {
+	mu       sync.Mutex
+	sessions map[*attachSession]struct{}
+}
+
+type attachSession struct {
+	conn net.Conn
+	out  chan []byte
+	once sync.Once
+}
+
+func (h *attachHub) add(session *attachSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sessions == nil {
+		h.sessions = make(map[*attachSession]struct{})
+	}
+	h.sessions[session] = struct{}{}
+}
+
+func (h *attachHub) remove(session *attachSession) {
+	h.mu.Lock()
+	delete(h.sessions, session)
+	h.mu.Unlock()
+	session.close()
+}
+
+func (h *attachHub) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for session := range h.sessions {
+		session.send(p)
+	}
+	return len(p), nil
+}
+
+func (h *attachHub) closeAll() {
+	h.mu.Lock()
+	sessions := h.sessions
+	h.sessions = nil
+	h.mu.Unlock()
+	for session := range sessions {
+		session.close()
+	}
+}
+
+func newAttachSession(conn net.Conn) *attachSession {
+	session := &attachSession{conn: conn, out: make(chan []byte, attachQueueSize)}
+	go session.run()
+	return session
+}
+
+func (s *attachSession) send(p []byte) {
+	select {
+	case s.out <- append([]byte(nil), p...):
+	default:
+	}
+}
+
+func (s *attachSession) run() {
+	for data := range s.out {
+		if _, err := s.conn.Write(data); err != nil {
+			_ = s.conn.Close()
+		}
+	}
+	_ = s.conn.Close()
+}
+
+func (s *attachSession) close() {
+	s.once.Do(func() { close(s.out) })
+}
+
+func (j *serverJob) writeInput(p []byte) error {
+	j.mu.Lock()
+	ptmx := j.pty
+	j.mu.Unlock()
+	if ptmx == nil {
+		return nil
+	}
+	_, err := ptmx.Write(p)
+	return err
+}
+
+func (j *serverJob) attach(conn net.Conn, input *bufio.Reader) {
+	session := newAttachSession(conn)
+	j.attached.add(session)
+	defer j.attached.remove(session)
+	j.log().Info("terminal attached")
+	defer j.log().Info("terminal detached")
+
+	for {
+		kind, payload, err := readAttachFrame(input)
+		if err != nil {
+			return
+		}
+		switch kind {
+		case attachFrameInput:
+			if err := j.writeInput(payload); err != nil {
+				j.log().Warn("write attached input: %v", err)
+			}
+		case attachFrameSize:
+			if len(payload) != 4 {
+				return
+			}
+			rows, cols := binary.BigEndian.Uint16(payload[:2]), binary.BigEndian.Uint16(payload[2:])
+			if err := j.resize(int(rows), int(cols)); err != nil {
+				j.log().Warn("resize attached terminal: %v", err)
+			}
+		}
+	}
+}
+
+func (d *GhostDaemon) handleAttach(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var job *serverJob
+	if d.serverManager != nil {
+		for _, candidate := range d.serverManager.Jobs() {
+			if candidate != nil && candidate.cfg.Name == name {
+				job = candidate
+			}
+		}
+	}
+	if job == nil {
+		writeControlError(w, http.StatusNotFound, "unknown server %q", name)
+		return
+	}
+	if !job.cfg.UsePTY {
+		writeControlError(w, http.StatusBadRequest, "server %q does not run in a pty (pty = false)", name)
+		return
+	}
+	if r.Header.Get("Upgrade") != attachProtocol {
+		writeControlError(w, http.StatusUpgradeRequired, "attach needs an %s upgrade", attachProtocol)
+		return
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", attachProtocol)
+	if err := rw.Flush(); err != nil {
+		_ = conn.Close()
+		return
+	}
+	job.attach(conn, rw.Reader)
+}
+
+func writeAttachFrame(w io.Writer, kind byte, payload []byte) error {
+	header := make([]byte, 5)
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func readAttachFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > attachMaxFrame {
+		return 0, nil, errors.New("attach frame too large")
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
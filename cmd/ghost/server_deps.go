@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+)
+
+func checkServerDependencies(servers []NormalizedServer) error {
+	var errs configcheck.Errors
+	byName := serverIndicesByName(servers)
+	for _, cfg := range servers {
+		for _, dep := range cfg.DependsOn {
+			if len(byName[dep]) == 0 {
+				errs.Add(fmt.Errorf("%s: depends_on: unknown server %q", cfg.ID, dep))
+			}
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+	if _, cycle := serverStartOrder(servers); len(cycle) > 0 {
+		return fmt.Errorf("%s: depends_on: dependency cycle %s", servers[cycle[0]].ID, cycleDisplay(servers, cycle))
+	}
+	return nil
+}
+
+func cycleDisplay(servers []NormalizedServer, cycle []int) string {
+	names := make([]string, 0, len(cycle)+1)
+	for _, index := range cycle {
+		names = append(names, servers[index].Name)
+	}
+	names = append(names, servers[cycle[0]].Name)
+	return strings.Join(names, " → ")
+}
+
+func serverIndicesByName(servers []NormalizedServer) map[string][]int {
+	byName := make(map[string][]int, len(servers))
+	for i, cfg := range servers {
+		byName[cfg.Name] = append(byName[cfg.Name], i)
+	}
+	return byName
+}
+
+func serverStartOrder(servers []NormalizedServer) ([]int, []int) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	byName := serverIndicesByName(servers)
+	marks := make([]int, len(servers))
+	order := make([]int, 0, len(servers))
+	var (
+		stack []int
+		cycle []int
+		visit func(int)
+	)
+	visit = func(i int) {
+		marks[i] = visiting
+		stack = append(stack, i)
+		for _, dep := range servers[i].DependsOn {
+			for _, j := range byName[dep] {
+				switch marks[j] {
+				case visiting:
+					if cycle == nil {
+						cycle = cycleFrom(stack, j)
+					}
+				case unvisited:
+					visit(j)
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		marks[i] = visited
+		order = append(order, i)
+	}
+	for i := range servers {
+		if marks[i] == unvisited {
+			visit(i)
+		}
+	}
+	return order, cycle
+}
+
+func cycleFrom(stack []int, start int) []int {
+	for k := len(stack) - 1; k >= 0; k-- {
+		if stack[k] == start {
+			return append([]int(nil), stack[k:]...)
+		}
+	}
+	return nil
+}
+
+type serverReadiness struct {
+	ch   chan struct{}
+	once sync.Once
+}
+
+func newServerReadiness() *serverReadiness {
+	return &serverReadiness{ch: make(chan struct{})}
+}
+
+func (r *serverReadiness) mark() bool {
+	marked := false
+	r.once.Do(func() {
+		close(r.ch)
+		marked = true
+	})
+	return marked
+}
+
+func (r *serverReadiness) done() bool {
+	select {
+	case <-r.ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func (j *serverJob) markReady(reason string) {
+	j.mu.Lock()
+	cmd := j.cmd
+	if cmd == nil || cmd.Process == nil || !j.readyAt.IsZero() {
+		j.mu.Unlock()
+		return
+	}
+	j.readyAt = j.clock.Now()
+	j.mu.Unlock()
+	j.ready.mark()
+
+	j.log().withPID(cmd.Process.Pid).Info("ready: %s", reason)
+	writeAuditEntry(auditEntry{
+		Event: "ready",
+		Kind:  "server",
+		Job:   j.cfg.Name,
+		PID:   cmd.Process.Pid,
+		Argv:  j.cfg.Secrets.redactArgs(cmd.Args),
+		Cwd:   cmd.Dir,
+		Cause: reason,
+	})
+}
+
+func (j *serverJob) markStarted() {
+	if j.cfg.ReadyPattern != "" || j.cfg.HealthCheck != nil {
+		return
+	}
+	j.mu.Lock()
+	j.readyAt = j.clock.Now()
+	j.mu.Unlock()
+	if j.ready.mark() {
+		j.log().Debug("ready: started")
+	}
+}
+
+func (j *serverJob) waitForDependencies() bool {
+	defer j.setWaitingFor("")
+	for _, dep := range j.deps {
+		if dep.ready.done() {
+			continue
+		}
+		j.setWaitingFor(dep.cfg.Name)
+		j.log().Info("waiting for %s to become ready", dep.cfg.Name)
+		select {
+		case <-dep.ready.ch:
+		case <-dep.doneCh:
+			if !dep.ready.done() {
+				j.log().Error("not starting: dependency %s stopped before it became ready", dep.cfg.Name)
+				return false
+			}
+		case <-j.stopCh:
+			return false
+		}
+	}
+	return true
+}
+
+func (j *serverJob) setWaitingFor(name string) {
+	j.mu.Lock()
+	j.waitingFor = name
+	j.mu.Unlock()
+}
+
+type readyMatcher struct {
+	re      *regexp.Regexp
+	onMatch func()
+
+	mu      sync.Mutex
+	line    []byte
+	matched bool
+}
+
+const readyMatcherLineLimit = 64 << 10
+
+func (j *serverJob) readyMatchers() (io.Writer, io.Writer) {
+	if j.cfg.ReadyPattern == "" {
+		return io.Discard, io.Discard
+	}
+	re := regexp.MustCompile(j.cfg.ReadyPattern)
+	onMatch := func() {
+		j.markReady(fmt.Sprintf("output matched %q", j.cfg.ReadyPattern))
+	}
+	return &readyMatcher{re: re, onMatch: onMatch}, &readyMatcher{re: re, onMatch: onMatch}
+}
+
+func (m *readyMatcher) Write(data []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.matched {
+		return len(data), nil
+	}
+	m.line = append(m.line, data...)
+	for {
+		index := bytes.IndexByte(m.line, '\n')
+		if index < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(m.line[:index]), "\r")
+		m.line = m.line[index+1:]
+		if m.re.MatchString(line) {
+			m.matched = true
+			m.line = nil
+			m.onMatch()
+			return len(data), nil
+		}
+	}
+	if len(m.line) > readyMatcherLineLimit {
+		m.line = m.line[len(m.line)-readyMatcherLineLimit:]
+	}
+	return len(data), nil
+}
@@ -6,16 +6,13 @@ import (
 	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
-
-	"github.com/creack/pty"
 )
 
 type serverJob struct {
+	jobRuntime
 	cfg NormalizedServer
 
 	stopCh chan struct{}
@@ -25,32 +22,92 @@ type serverJob struct {
 	cmd       *exec.Cmd
 	pty       *os.File
 	closed    bool
-	killTimer *time.Timer
+	killTimer clockTimer
+	launches  int
+	sinks     []outputSink
+
+	health        string
+	healthRestart bool
+
+	deps       []*serverJob
+	ready      *serverReadiness
+	readyAt    time.Time
+	waitingFor string
+	logPath    string
+	ptyRows    int
+	ptyCols    int
+	attached   attachHub
+	recorder   *asciicastRecorder
+
+	restartCause string
+	standby      *standbyProcess
+
+	watcher          *watchJob
+	changed          chan struct{}
+	waitingForChange bool
+
+	history jobHistory
 }
 
-func newServerJob(cfg NormalizedServer) (*serverJob, error) {
+func newServerJob(cfg NormalizedServer, deps []*serverJob, rt jobRuntime) (*serverJob, error) {
 	job := &serverJob{
-		cfg:    cfg,
-		stopCh: make(chan struct{}),
-		doneCh: make(chan struct{}),
+		jobRuntime: rt.withDefaults(),
+		cfg:        cfg,
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+		deps:       deps,
+		ptyRows:    cfg.PTYRows,
+		ptyCols:    cfg.PTYCols,
+		ready:      newServerReadiness(),
+		changed:    make(chan struct{}, 1),
+		history:    loadJobHistory("server", cfg.Name),
+	}
+	if cfg.Watch != nil {
+		watcher, err := startWatchJob(*cfg.Watch, rt, job.restartForChange)
+		if err != nil {
+			return nil, fmt.Errorf("watch: %w", err)
+		}
+		job.watcher = watcher
 	}
+	job.sinks = openSinks(cfg.Sinks, job.log(), cfg.LogPerms)
 	go job.run()
 	return job, nil
 }
 
 func (j *serverJob) run() {
 	defer close(j.doneCh)
+	defer j.dropStandby()
 
+	if !j.waitForDependencies() {
+		return
+	}
 	for {
+		if !j.waitWhilePaused() {
+			return
+		}
 		err := j.launchOnce()
-		if err != nil && !j.isClosed() {
-			logError("%s failed: %v", j.prefix(), err)
+		if err != nil && !j.isClosed() && !j.paused() {
+			j.log().Error("failed: %v", err)
 		}
+		j.recordExit(err)
 
-		if j.isClosed() || !j.cfg.Restart {
+		healthRestart := j.takeHealthRestart()
+		if j.isClosed() {
 			return
 		}
+		if j.paused() {
+			continue
+		}
+		if !j.cfg.Restart && !healthRestart {
+			if j.cfg.Watch == nil || !j.waitForChange() {
+				return
+			}
+			continue
+		}
 
+		if healthRestart && j.hasStandby() {
+			continue
+		}
 		if !j.waitForRestart() {
 			return
 		}
@@ -62,50 +119,152 @@ func (j *serverJob) launchOnce() error {
 		return nil
 	}
 
-	logFile, err := j.openLogFile()
-	if err != nil {
-		return err
+	var (
+		logFile   *jobLogFile
+		logWriter io.Writer = io.Discard
+		standby   *standbyProcess
+	)
+	if j.cfg.Standby {
+		standby = j.takeStandby()
+	}
+	if j.cfg.Stdout != "null" {
+		file, err := openJobLog(j.cfg.LogPath, j.cfg.Name, j.cfg.LogPerms)
+		if err != nil {
+			return err
+		}
+		output := newAsyncLogWriter(file, j.log(), j.cfg.LogBufferSize)
+		defer output.Close()
+		defer file.started(0)
+
+		display := j.cfg.CommandDisplay
+		if standby != nil {
+			display += " (from standby)"
+		}
+		header := fmt.Sprintf("\n--- [%s] ghost server %s starting: %s ---\n",
+			j.clock.Now().Format(time.RFC3339), j.cfg.Name, display)
+		_, _ = output.Write([]byte(header))
+		logFile, logWriter = file, output
 	}
-	defer logFile.Close()
 
-	header := fmt.Sprintf("\n--- [%s] ghost server %s starting: %s ---\n",
-		time.Now().Format(time.RFC3339), j.cfg.Name, j.cfg.CommandDisplay)
-	if _, err := logFile.WriteString(header); err != nil {
-		return fmt.Errorf("write log header: %w", err)
+	forward := newOutputForwarder(j.cfg.Name, j.cfg.Secrets)
+	sinks := newSinkForwarder(j.sinks, j.cfg.Secrets)
+	stdoutDest, stderrDest := forward.wrap(jobOutput(j.cfg.Name, j.cfg.Stdout, j.cfg.PrefixOutput))
+	stdoutDest, stderrDest = sinks.wrap(stdoutDest, stderrDest)
+	stdoutReady, stderrReady := j.readyMatchers()
+
+	var (
+		cmd                 *exec.Cmd
+		gateRead, gateWrite *os.File
+	)
+	switch {
+	case standby != nil:
+		cmd = standby.cmd
+	case j.cfg.Standby:
+		var err error
+		if cmd, gateRead, gateWrite, err = j.standbyCommand(); err != nil {
+			return err
+		}
+		defer gateRead.Close()
+		defer gateWrite.Close()
+	default:
+		cmd = exec.Command(j.cfg.Command[0], j.cfg.Command[1:]...)
+		cmd.Dir = j.cfg.Cwd
+		cmd.Env = buildEnvList(j.cfg.RunAs.env(j.cfg.Env))
+		cmd.Stdin = nil
+		setRunAs(cmd, j.cfg.RunAs)
 	}
 
-	lockedLog := &lockedWriter{w: logFile}
+	if standby != nil {
+		j.log().withPID(cmd.Process.Pid).Info("promoting standby %s", j.cfg.CommandDisplay)
+	} else {
+		j.log().Info("starting %s", j.cfg.CommandDisplay)
+	}
 
-	cmd := exec.Command(j.cfg.Command[0], j.cfg.Command[1:]...)
-	cmd.Dir = j.cfg.Cwd
-	cmd.Env = buildEnvList(j.cfg.Env)
-	cmd.Stdin = nil
+	j.mu.Lock()
+	cause := "start"
+	if j.launches > 0 {
+		cause = "restart"
+	}
 
-	logInfo("%s starting %s", j.prefix(), j.cfg.CommandDisplay)
+	if j.health == "unhealthy" {
+		cause = "health check"
+	}
+	if j.restartCause != "" {
+		cause, j.restartCause = j.restartCause, ""
+	}
+	if standby != nil {
+		cause += " via standby"
+	}
+	if j.launches > 0 {
+		j.history.Restarts++
+	}
+	j.launches++
+	j.history.LastRun, j.history.LastTrigger, j.history.LastResult = j.clock.Now(), cause, ""
+	history := j.history
+	j.mu.Unlock()
+	storeJobHistory("server", j.cfg.Name, history)
 
 	var (
-		wg      sync.WaitGroup
-		ptmx    *os.File
-		waitErr error
+		wg         sync.WaitGroup
+		ptmx       *os.File
+		err        error
+		waitErr    error
+		startedAt  = j.clock.Now()
+		stopHealth func()
+		stopLimits func()
 	)
 
+	defer keepAwake(j.cfg.KeepAwake, "ghost server "+j.cfg.Name+" is running", j.log())()
+
 	if j.cfg.UsePTY {
-		ptmx, err = pty.Start(cmd)
+		size := j.ptySize()
+		ptmx, err = j.runner.StartPTY(cmd, size)
 		if err != nil {
 			return fmt.Errorf("start command: %w", err)
 		}
+		output := []io.Writer{logWriter, stdoutDest, stdoutReady, &j.attached}
+		if recorder := j.startRecording(size); recorder != nil {
+			defer recorder.Close()
+			output = append(output, recorder)
+		}
 		j.setProcess(cmd, ptmx)
+		j.setLogFile(logFile, cmd.Process.Pid)
+		j.applyPriority(cmd)
+		auditStart("server", j.cfg.Name, "", cmd, j.cfg.Env, j.cfg.Secrets, cause)
+		notifyWebhooks(webhookEvent{Event: "server.start", Kind: "server", Job: j.cfg.Name, PID: cmd.Process.Pid, Message: cause})
+		stopHealth = j.monitorHealth(cmd)
+		stopLimits = j.monitorResources(cmd)
+		j.markStarted()
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if _, err := io.Copy(io.MultiWriter(lockedLog, os.Stdout), ptmx); err != nil && !errors.Is(err, os.ErrClosed) && !j.isClosed() {
-				logError("%s stream error: %v", j.prefix(), err)
+			if _, err := io.Copy(io.MultiWriter(output...), ptmx); err != nil && !errors.Is(err, os.ErrClosed) && !j.isClosed() && !j.paused() {
+				j.log().Error("stream error: %v", err)
 			}
 		}()
 		waitErr = cmd.Wait()
 		_ = ptmx.Close()
 		wg.Wait()
+		_, _ = fmt.Fprintf(&j.attached, "\r\n[ghost: %s exited]\r\n", j.cfg.Name)
+	} else if standby != nil {
+		standby.stdout.attach(io.MultiWriter(logWriter, stdoutDest, stdoutReady))
+		standby.stderr.attach(io.MultiWriter(logWriter, stderrDest, stderrReady))
+		startedAt = standby.startedAt
+		j.setProcess(cmd, nil)
+		j.setLogFile(logFile, cmd.Process.Pid)
+		notifyWebhooks(webhookEvent{Event: "server.start", Kind: "server", Job: j.cfg.Name, PID: cmd.Process.Pid, Message: cause})
+		stopHealth = j.monitorHealth(cmd)
+		stopLimits = j.monitorResources(cmd)
+		standby.openGate()
+		j.markStarted()
+		go j.prepareStandby()
+
+		<-standby.done
+		waitErr = standby.err
 	} else {
+		if j.cfg.ProcessGroup {
+			setProcessGroup(cmd)
+		}
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
 			return fmt.Errorf("stdout pipe: %w", err)
@@ -114,22 +273,37 @@ func (j *serverJob) launchOnce() error {
 		if err != nil {
 			return fmt.Errorf("stderr pipe: %w", err)
 		}
-		if err := cmd.Start(); err != nil {
+		err = j.runner.Start(cmd)
+		if gateRead != nil {
+			_ = gateRead.Close()
+			_ = gateWrite.Close()
+		}
+		if err != nil {
 			return fmt.Errorf("start command: %w", err)
 		}
 		j.setProcess(cmd, nil)
+		j.setLogFile(logFile, cmd.Process.Pid)
+		j.applyPriority(cmd)
+		auditStart("server", j.cfg.Name, "", cmd, j.cfg.Env, j.cfg.Secrets, cause)
+		notifyWebhooks(webhookEvent{Event: "server.start", Kind: "server", Job: j.cfg.Name, PID: cmd.Process.Pid, Message: cause})
+		stopHealth = j.monitorHealth(cmd)
+		stopLimits = j.monitorResources(cmd)
+		j.markStarted()
+		if j.cfg.Standby {
+			go j.prepareStandby()
+		}
 
 		wg.Add(2)
 		go func() {
 			defer wg.Done()
-			if _, err := io.Copy(io.MultiWriter(lockedLog, os.Stdout), stdout); err != nil && !errors.Is(err, os.ErrClosed) && !j.isClosed() {
-				logError("%s stdout stream error: %v", j.prefix(), err)
+			if _, err := io.Copy(io.MultiWriter(logWriter, stdoutDest, stdoutReady), stdout); err != nil && !errors.Is(err, os.ErrClosed) && !j.isClosed() && !j.paused() {
+				j.log().Error("stdout stream error: %v", err)
 			}
 		}()
 		go func() {
 			defer wg.Done()
-			if _, err := io.Copy(io.MultiWriter(lockedLog, os.Stderr), stderr); err != nil && !errors.Is(err, os.ErrClosed) && !j.isClosed() {
-				logError("%s stderr stream error: %v", j.prefix(), err)
+			if _, err := io.Copy(io.MultiWriter(logWriter, stderrDest, stderrReady), stderr); err != nil && !errors.Is(err, os.ErrClosed) && !j.isClosed() && !j.paused() {
+				j.log().Error("stderr stream error: %v", err)
 			}
 		}()
 
@@ -137,58 +311,94 @@ func (j *serverJob) launchOnce() error {
 		wg.Wait()
 	}
 
+	stopHealth()
+	stopLimits()
+	forward.Flush()
+	sinks.Flush()
 	j.clearProcess()
+	auditExit("server", j.cfg.Name, "", cmd, j.cfg.Secrets, startedAt, waitErr)
+	j.notifyExit(cmd, waitErr)
+	if !j.isClosed() && !j.paused() && !j.cfg.Hooks.empty() {
+		go runExitHook(j.cfg.Hooks, hookRun{
+			Kind: "server", Job: j.cfg.Name, Cwd: j.cfg.Cwd, Env: j.cfg.Env, RunAs: j.cfg.RunAs,
+			Secrets: j.cfg.Secrets, Stdout: j.cfg.Stdout, Prefix: j.cfg.PrefixOutput, Log: j.log(),
+		}, waitErr)
+	}
 
-	if waitErr != nil && !j.isClosed() {
+	if waitErr != nil && !j.isClosed() && !j.paused() {
 		var exitErr *exec.ExitError
 		if errors.As(waitErr, &exitErr) {
-			logError("%s exited with code %d", j.prefix(), exitErr.ExitCode())
+			j.log().withPID(cmd.Process.Pid).Error("exited with code %d", exitErr.ExitCode())
 		} else {
-			logError("%s exited: %v", j.prefix(), waitErr)
+			j.log().withPID(cmd.Process.Pid).Error("exited: %v", waitErr)
 		}
 	} else if waitErr == nil {
-		logInfo("%s exited cleanly", j.prefix())
+		j.log().withPID(cmd.Process.Pid).Info("exited cleanly")
 	}
 
 	return waitErr
 }
 
+func (j *serverJob) notifyExit(cmd *exec.Cmd, waitErr error) {
+	event := webhookEvent{Event: "server.exit", Kind: "server", Job: j.cfg.Name, PID: cmd.Process.Pid}
+	j.mu.Lock()
+	unhealthy := j.health == "unhealthy"
+	j.mu.Unlock()
+	switch {
+	case j.isClosed() || j.paused():
+		event.Event = "server.stop"
+	case unhealthy:
+		event.Event, event.Message = "server.crash", "health check failed"
+	case waitErr != nil:
+		event.Event = "server.crash"
+	}
+	notifyWebhooks(webhookExit(event, waitErr))
+}
+
 func (j *serverJob) waitForRestart() bool {
 	delay := j.cfg.RestartDelay
 	if delay <= 0 {
 		delay = defaultRestartDelay
 	}
-	timer := time.NewTimer(delay)
+	timer := j.clock.NewTimer(delay)
 	defer timer.Stop()
 	select {
-	case <-timer.C:
+	case <-timer.C():
 		return !j.isClosed()
 	case <-j.stopCh:
 		return false
 	}
 }
 
-func (j *serverJob) openLogFile() (*os.File, error) {
-	if strings.TrimSpace(j.cfg.LogPath) == "" {
-		return nil, errors.New("log path is empty")
-	}
-	if err := os.MkdirAll(filepath.Dir(j.cfg.LogPath), 0o755); err != nil {
-		return nil, fmt.Errorf("create log directory: %w", err)
-	}
-	file, err := os.OpenFile(j.cfg.LogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
-	if err != nil {
-		return nil, fmt.Errorf("open log file: %w", err)
-	}
-	return file, nil
-}
-
 func (j *serverJob) setProcess(cmd *exec.Cmd, pty *os.File) {
 	j.mu.Lock()
 	j.cmd = cmd
 	j.pty = pty
+	j.readyAt = time.Time{}
 	j.mu.Unlock()
 }
 
+func (j *serverJob) setLogFile(file *jobLogFile, pid int) {
+	file.started(pid)
+	if path := file.Path(); path != "" {
+		j.mu.Lock()
+		j.logPath = path
+		j.mu.Unlock()
+	}
+}
+
+func (j *serverJob) applyPriority(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := applyProcessPriority(cmd.Process.Pid, j.cfg.Priority); err != nil {
+		j.log().withPID(cmd.Process.Pid).Error("failed to apply priority: %v", err)
+	}
+	if err := applyMemoryRlimit(cmd.Process.Pid, j.cfg.Limits); err != nil {
+		j.log().withPID(cmd.Process.Pid).Error("failed to apply max_memory_mb: %v", err)
+	}
+}
+
 func (j *serverJob) clearProcess() {
 	j.mu.Lock()
 	if j.killTimer != nil {
@@ -197,6 +407,11 @@ func (j *serverJob) clearProcess() {
 	}
 	j.cmd = nil
 	j.pty = nil
+	j.recorder = nil
+	j.readyAt = time.Time{}
+	if j.health != "unhealthy" {
+		j.health = ""
+	}
 	j.mu.Unlock()
 }
 
@@ -214,20 +429,21 @@ func (j *serverJob) stopProcessLocked() {
 		_ = j.pty.Close()
 		j.pty = nil
 	}
-	if err := process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
-		logError("%s failed to send SIGTERM: %v", j.prefix(), err)
+	group := j.cfg.ProcessGroup
+	if err := signalProcess(process, syscall.SIGTERM, group); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		j.log().Error("failed to send SIGTERM: %v", err)
 	}
 
-	timer := time.AfterFunc(j.cfg.KillTimeout, func() {
+	timer := j.clock.AfterFunc(j.cfg.KillTimeout, func() {
 		j.mu.Lock()
 		defer j.mu.Unlock()
 		if j.cmd == nil || j.cmd.Process != process {
 			return
 		}
-		if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
-			logError("%s failed to send SIGKILL: %v", j.prefix(), err)
+		if err := signalProcess(process, syscall.SIGKILL, group); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			j.log().Error("failed to send SIGKILL: %v", err)
 		} else {
-			logInfo("%s forcing process exit with SIGKILL", j.prefix())
+			j.log().Info("forcing process exit with SIGKILL")
 		}
 	})
 	if j.killTimer != nil {
@@ -246,29 +462,152 @@ func (j *serverJob) Close() error {
 	j.closed = true
 	close(j.stopCh)
 	j.stopProcessLocked()
+	j.dropStandbyLocked()
 	j.mu.Unlock()
 
 	<-j.doneCh
+	if j.watcher != nil {
+		_ = j.watcher.Close()
+	}
+	j.attached.closeAll()
+	closeSinks(j.sinks)
 	return nil
 }
 
+// recordExit saves how the last launch ended. Exits ghost caused (stop,
+// pause, health or watch restarts) are recorded as "stopped".
+func (j *serverJob) recordExit(err error) {
+	j.mu.Lock()
+	if j.history.LastRun.IsZero() || j.history.LastResult != "" {
+		j.mu.Unlock()
+		return
+	}
+	switch {
+	case err == nil:
+		j.history.LastResult = "ok"
+	case j.closed || j.healthRestart || j.paused():
+		j.history.LastResult = "stopped"
+	default:
+		j.history.LastResult = runResult(err)
+	}
+	history := j.history
+	j.mu.Unlock()
+	storeJobHistory("server", j.cfg.Name, history)
+}
+
+func (j *serverJob) kill() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cmd != nil && j.cmd.Process != nil {
+		_ = signalProcess(j.cmd.Process, syscall.SIGKILL, j.cfg.ProcessGroup)
+	}
+}
+
+func (j *serverJob) paused() bool {
+	return pausedJobs.isPaused("server", j.cfg.Name)
+}
+
+func (j *serverJob) waitWhilePaused() bool {
+	for {
+		changes := pausedJobs.changes()
+		if !j.paused() {
+			return true
+		}
+		select {
+		case <-changes:
+		case <-j.stopCh:
+			return false
+		}
+	}
+}
+
+func (j *serverJob) stopForPause() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.closed {
+		j.stopProcessLocked()
+		j.dropStandbyLocked()
+	}
+}
+
 func (j *serverJob) isClosed() bool {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 	return j.closed
 }
 
-func (j *serverJob) prefix() string {
-	return "ghost:server:" + j.cfg.Name
+func (j *serverJob) state() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cmd != nil && j.cmd.Process != nil {
+		detail := fmt.Sprintf("pid %d, %d launch(es)", j.cmd.Process.Pid, j.launches)
+		if j.health != "" {
+			detail += ", " + j.health
+		}
+		if j.readyAt.IsZero() {
+			detail += ", not ready"
+		}
+		if j.standby != nil && j.standby.cmd.Process != nil {
+			detail += fmt.Sprintf(", standby pid %d", j.standby.cmd.Process.Pid)
+		}
+		return "running (" + detail + ")"
+	}
+	if j.closed {
+		return "stopped"
+	}
+	if pausedJobs.isPaused("server", j.cfg.Name) {
+		return "paused"
+	}
+	if j.waitingFor != "" {
+		return "waiting for " + j.waitingFor
+	}
+	return "waiting"
+}
+
+func (j *serverJob) info() serverInfo {
+	info := serverInfo{
+		Name:    j.cfg.Name,
+		Command: j.cfg.CommandDisplay,
+		Cwd:     j.cfg.Cwd,
+		State:   "waiting",
+		Labels:  j.cfg.Labels,
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info.LogPath = j.logPath
+	if info.LogPath == "" && j.cfg.Stdout != "null" {
+		info.LogPath = currentLogPath(j.cfg.LogPath, j.cfg.Name)
+	}
+	switch {
+	case j.cmd != nil && j.cmd.Process != nil:
+		info.State = "running"
+		info.PID = j.cmd.Process.Pid
+		info.Health = j.health
+		info.Ready = !j.readyAt.IsZero()
+		if j.standby != nil && j.standby.cmd.Process != nil {
+			info.StandbyPID = j.standby.cmd.Process.Pid
+		}
+	case j.closed:
+		info.State = "stopped"
+	case pausedJobs.isPaused("server", j.cfg.Name):
+		info.State = "paused"
+	default:
+		info.WaitingFor = j.waitingFor
+	}
+	if !j.history.LastRun.IsZero() {
+		last := j.history.LastRun
+		info.LastStart = &last
+		info.LastResult = j.history.LastResult
+		info.LastTrigger = j.history.LastTrigger
+	}
+	info.Restarts = j.history.Restarts
+	return info
 }
 
-type lockedWriter struct {
-	mu sync.Mutex
-	w  io.Writer
+func (j *serverJob) prefix() string {
+	return "ghost:server:" + j.cfg.Name
 }
 
-func (w *lockedWriter) Write(p []byte) (int, error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	return w.w.Write(p)
+func (j *serverJob) log() logger {
+	return logger{prefix: j.prefix(), fields: logFields{Component: "server", Job: j.cfg.Name}}
 }
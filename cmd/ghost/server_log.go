@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogBufferSize = 1 << 20
+	logDrainTimeout      = 2 * time.Second
+)
+
+type asyncLogWriter struct {
+	log   logger
+	w     io.WriteCloser
+	limit int
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	chunks       [][]byte
+	size         int
+	droppedBytes int
+	droppedLines int
+	closed       bool
+	done         chan struct{}
+}
+
+func newAsyncLogWriter(w io.WriteCloser, log logger, limit int) *asyncLogWriter {
+	if limit <= 0 {
+		limit = defaultLogBufferSize
+	}
+	writer := &asyncLogWriter{
+		log:   log,
+		w:     w,
+		limit: limit,
+		done:  make(chan struct{}),
+	}
+	writer.cond = sync.NewCond(&writer.mu)
+	go writer.run()
+	return writer
+}
+
+func (w *asyncLogWriter) Write(p []byte) (int, error) {
+	chunk := append([]byte(nil), p...)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return len(p), nil
+	}
+	if len(chunk) > w.limit {
+		w.recordDropLocked(chunk[:len(chunk)-w.limit])
+		chunk = chunk[len(chunk)-w.limit:]
+	}
+	w.chunks = append(w.chunks, chunk)
+	w.size += len(chunk)
+	for w.size > w.limit && len(w.chunks) > 1 {
+		oldest := w.chunks[0]
+		w.chunks[0] = nil
+		w.chunks = w.chunks[1:]
+		w.size -= len(oldest)
+		w.recordDropLocked(oldest)
+	}
+	w.cond.Signal()
+	return len(p), nil
+}
+
+func (w *asyncLogWriter) recordDropLocked(chunk []byte) {
+	w.droppedBytes += len(chunk)
+	w.droppedLines += bytes.Count(chunk, []byte{'\n'})
+}
+
+func (w *asyncLogWriter) run() {
+	defer close(w.done)
+	defer w.w.Close()
+
+	failing := false
+	for {
+		w.mu.Lock()
+		for len(w.chunks) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.chunks) == 0 && w.closed {
+			w.mu.Unlock()
+			return
+		}
+		chunks := w.chunks
+		w.chunks, w.size = nil, 0
+		droppedBytes, droppedLines := w.droppedBytes, w.droppedLines
+		w.droppedBytes, w.droppedLines = 0, 0
+		w.mu.Unlock()
+
+		if droppedBytes > 0 {
+			w.log.Warn("log destination is too slow, discarded %d line(s) (%d bytes) of output", droppedLines, droppedBytes)
+			chunks = append([][]byte{[]byte(fmt.Sprintf("\n--- [%s] ghost discarded %d line(s) (%d bytes): log destination too slow ---\n",
+				time.Now().Format(time.RFC3339), droppedLines, droppedBytes))}, chunks...)
+		}
+		for _, chunk := range chunks {
+			_, err := w.w.Write(chunk)
+			switch {
+			case err != nil && !failing:
+				w.log.Error("write log file: %v (discarding output until it recovers)", err)
+				failing = true
+			case err == nil && failing:
+				w.log.Info("log file writes recovered")
+				failing = false
+			}
+		}
+	}
+}
+
+func (w *asyncLogWriter) Close() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.closed = true
+	pending := w.size
+	w.cond.Broadcast()
+	w.mu.Unlock()
+
+	timer := time.NewTimer(logDrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.done:
+	case <-timer.C:
+		w.log.Warn("log destination still blocked after %s, abandoning up to %d buffered bytes", logDrainTimeout, pending)
+	}
+}
+
+var logPathPlaceholder = regexp.MustCompile(`\{[a-z]+\}`)
+
+func validateLogPathTemplate(path string) error {
+	for _, placeholder := range logPathPlaceholder.FindAllString(path, -1) {
+		switch placeholder {
+		case "{name}", "{date}", "{pid}":
+		default:
+			return fmt.Errorf("unknown placeholder %s (use {name}, {date} or {pid})", placeholder)
+		}
+	}
+	return nil
+}
+
+func expandLogPath(template, name string, now time.Time, pid int) string {
+	return logPathPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		switch placeholder {
+		case "{name}":
+			return sanitizeFilename(name)
+		case "{date}":
+			return now.Format(time.DateOnly)
+		case "{pid}":
+			return strconv.Itoa(pid)
+		}
+		return placeholder
+	})
+}
+
+func logPathGlob(template, name string) string {
+	return logPathPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if placeholder == "{name}" {
+			return sanitizeFilename(name)
+		}
+		return "*"
+	})
+}
+
+func currentLogPath(template, name string) string {
+	if !logPathPlaceholder.MatchString(template) {
+		return template
+	}
+	matches, _ := filepath.Glob(logPathGlob(template, name))
+	latest, latestMod := "", time.Time{}
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() && info.ModTime().After(latestMod) {
+			latest, latestMod = match, info.ModTime()
+		}
+	}
+	if latest == "" {
+		return expandLogPath(template, name, time.Now(), 0)
+	}
+	return latest
+}
+
+type jobLogFile struct {
+	template string
+	name     string
+	perms    FilePermissions
+	opened   time.Time
+
+	once  sync.Once
+	ready chan struct{}
+	path  string
+	file  *os.File
+	err   error
+}
+
+func openJobLog(template, name string, perms FilePermissions) (*jobLogFile, error) {
+	if strings.TrimSpace(template) == "" {
+		return nil, errors.New("log path is empty")
+	}
+	log := &jobLogFile{template: template, name: name, perms: perms, opened: time.Now(), ready: make(chan struct{})}
+	if strings.Contains(template, "{pid}") {
+		return log, nil
+	}
+	if err := log.open(0); err != nil {
+		return nil, err
+	}
+	log.once.Do(func() { close(log.ready) })
+	return log, nil
+}
+
+func (l *jobLogFile) open(pid int) error {
+	path := expandLogPath(l.template, l.name, l.opened, pid)
+	if err := os.MkdirAll(filepath.Dir(path), l.perms.DirMode); err != nil {
+		return fmt.Errorf("create log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, l.perms.FileMode)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	l.path, l.file = path, file
+	return nil
+}
+
+func (l *jobLogFile) started(pid int) {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		if pid > 0 {
+			l.err = l.open(pid)
+		}
+		close(l.ready)
+	})
+}
+
+func (l *jobLogFile) Path() string {
+	if l == nil {
+		return ""
+	}
+	select {
+	case <-l.ready:
+		return l.path
+	default:
+		return ""
+	}
+}
+
+func (l *jobLogFile) Write(p []byte) (int, error) {
+	<-l.ready
+	if l.file == nil {
+		if l.err != nil {
+			return 0, l.err
+		}
+		return len(p), nil
+	}
+	return l.file.Write(p)
+}
+
+func (l *jobLogFile) Close() error {
+	l.started(0)
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+func jobOutput(name, mode string, prefixed bool) (io.Writer, io.Writer) {
+	if mode != "inherit" {
+		return io.Discard, io.Discard
+	}
+	if !prefixed {
+		return os.Stdout, os.Stderr
+	}
+	prefix := []byte("[" + name + "] ")
+	return &prefixWriter{w: os.Stdout, prefix: prefix}, &prefixWriter{w: os.Stderr, prefix: prefix}
+}
+
+func writeRunSeparator(mode, name, runID, summary string, now time.Time) {
+	if mode == "" {
+		return
+	}
+	var out strings.Builder
+	if mode == "screen" && stdoutIsTerminal() {
+		out.WriteString("\x1b[2J\x1b[3J\x1b[H")
+	}
+	fmt.Fprintf(&out, "──── %s %s run %s — %s ────\n", now.Format("15:04:05"), name, runID, summary)
+	_, _ = os.Stdout.WriteString(out.String())
+}
+
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+
+	mu      sync.Mutex
+	midLine bool
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]byte, 0, len(data)+len(p.prefix))
+	for rest := data; len(rest) > 0; {
+		if !p.midLine {
+			out = append(out, p.prefix...)
+			p.midLine = true
+		}
+		index := bytes.IndexByte(rest, '\n')
+		if index < 0 {
+			out = append(out, rest...)
+			break
+		}
+		out = append(out, rest[:index+1]...)
+		rest = rest[index+1:]
+		p.midLine = false
+	}
+	if _, err := p.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -1,49 +1,246 @@
 package main
 
 import (
+	"fmt"
 	"sync"
 )
 
 type ServerManager struct {
+	rt   jobRuntime
 	mu   sync.Mutex
 	jobs []*serverJob
+	keys []string
 }
 
 func (m *ServerManager) Apply(servers []NormalizedServer) {
-	oldJobs := m.swapJobs(nil)
-	for _, job := range oldJobs {
-		if job == nil {
+	m.mu.Lock()
+	oldJobs, oldKeys := m.jobs, m.keys
+	m.mu.Unlock()
+
+	existing := make(map[string]*serverJob, len(oldJobs))
+	for i, job := range oldJobs {
+		if job != nil {
+			existing[oldKeys[i]] = job
+		}
+	}
+
+	names := make([]string, len(servers))
+	for i, cfg := range servers {
+		names[i] = cfg.Name
+	}
+	keys := uniqueJobKeys(names)
+
+	var summary reloadSummary
+	kept := make(map[string]*serverJob, len(servers))
+	for i, cfg := range servers {
+		job, ok := existing[keys[i]]
+		if !ok {
+			continue
+		}
+		if serverFingerprint(job.cfg) == serverFingerprint(cfg) {
+			kept[keys[i]] = job
+			delete(existing, keys[i])
+		}
+	}
+
+	order, _ := serverStartOrder(servers)
+	byName := serverIndicesByName(servers)
+	for _, i := range order {
+		job, ok := kept[keys[i]]
+		if !ok {
+			continue
+		}
+		depRestarted := false
+		for _, dep := range servers[i].DependsOn {
+			for _, j := range byName[dep] {
+				if _, depKept := kept[keys[j]]; !depKept {
+					depRestarted = true
+				}
+			}
+		}
+		if depRestarted {
+			delete(kept, keys[i])
+			existing[keys[i]] = job
+		}
+	}
+
+	oldCfgs := make([]NormalizedServer, len(oldJobs))
+	for i, job := range oldJobs {
+		if job != nil {
+			oldCfgs[i] = job.cfg
+		}
+	}
+	oldOrder, _ := serverStartOrder(oldCfgs)
+	for k := len(oldOrder) - 1; k >= 0; k-- {
+		i := oldOrder[k]
+		job, ok := existing[oldKeys[i]]
+		if !ok || job != oldJobs[i] {
 			continue
 		}
 		if err := job.Close(); err != nil {
 			logError("failed to stop server: %v", err)
 		}
+		if !containsString(keys, oldKeys[i]) {
+			summary.removed++
+		}
 	}
 
-	newJobs := make([]*serverJob, 0, len(servers))
-	for _, cfg := range servers {
-		job, err := newServerJob(cfg)
+	started := make([]*serverJob, len(servers))
+	for _, i := range order {
+		cfg := servers[i]
+		if job, ok := kept[keys[i]]; ok {
+			summary.unchanged++
+			started[i] = job
+			continue
+		}
+		var deps []*serverJob
+		for _, dep := range cfg.DependsOn {
+			for _, j := range byName[dep] {
+				if started[j] != nil {
+					deps = append(deps, started[j])
+				}
+			}
+		}
+		job, err := newServerJob(cfg, deps, m.rt)
 		if err != nil {
 			logError("failed to start server %q: %v", cfg.Name, err)
 			continue
 		}
-		newJobs = append(newJobs, job)
+		if _, replaced := existing[keys[i]]; replaced {
+			summary.restarted++
+		} else {
+			summary.added++
+		}
+		started[i] = job
+	}
+
+	newJobs := make([]*serverJob, 0, len(servers))
+	newKeys := make([]string, 0, len(servers))
+	for i, job := range started {
+		if job != nil {
+			newJobs = append(newJobs, job)
+			newKeys = append(newKeys, keys[i])
+		}
 	}
 
-	m.swapJobs(newJobs)
-	logInfo("loaded %d server(s)", len(newJobs))
+	m.mu.Lock()
+	m.jobs, m.keys = newJobs, newKeys
+	m.mu.Unlock()
+	logInfo("loaded %d server(s) (%s)", len(newJobs), summary)
+}
+
+func (m *ServerManager) Restart(name string) error {
+	m.mu.Lock()
+	index := -1
+	for i, job := range m.jobs {
+		if job != nil && job.cfg.Name == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		m.mu.Unlock()
+		return fmt.Errorf("unknown server %q", name)
+	}
+	old := m.jobs[index]
+	m.mu.Unlock()
+
+	if old.restartFromStandby() {
+		logInfo("restarted server %s from standby", name)
+		return nil
+	}
+
+	if err := old.Close(); err != nil {
+		logError("failed to stop server: %v", err)
+	}
+	job, err := newServerJob(old.cfg, old.deps, old.jobRuntime)
+	if err != nil {
+		return fmt.Errorf("start server %q: %w", name, err)
+	}
+
+	m.mu.Lock()
+	if index < len(m.jobs) && m.jobs[index] == old {
+		m.jobs[index] = job
+	}
+	m.mu.Unlock()
+	logInfo("restarted server %s", name)
+	return nil
+}
+
+func (m *ServerManager) stopPaused(name string) {
+	for _, job := range m.Jobs() {
+		if job != nil && job.cfg.Name == name {
+			job.stopForPause()
+		}
+	}
+}
+
+func (m *ServerManager) Jobs() []*serverJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*serverJob(nil), m.jobs...)
 }
 
 func (m *ServerManager) StopAll() {
+	m.stopAll(nil)
+}
+
+func (m *ServerManager) stopAll(abort <-chan struct{}) {
 	jobs := m.swapJobs(nil)
-	for _, job := range jobs {
+	byName := make(map[string][]int, len(jobs))
+	for i, job := range jobs {
+		if job != nil {
+			byName[job.cfg.Name] = append(byName[job.cfg.Name], i)
+		}
+	}
+	dependents := make([][]int, len(jobs))
+	for i, job := range jobs {
 		if job == nil {
 			continue
 		}
-		if err := job.Close(); err != nil {
-			logError("failed to stop server: %v", err)
+		for _, dep := range job.cfg.DependsOn {
+			for _, k := range byName[dep] {
+				if k != i {
+					dependents[k] = append(dependents[k], i)
+				}
+			}
 		}
 	}
+
+	stopped := make([]chan struct{}, len(jobs))
+	for i := range jobs {
+		stopped[i] = make(chan struct{})
+	}
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(stopped[i])
+			for _, k := range dependents[i] {
+				select {
+				case <-stopped[k]:
+				case <-abort:
+				}
+			}
+			if job == nil {
+				return
+			}
+			closed := make(chan struct{})
+			go func() {
+				select {
+				case <-abort:
+					job.kill()
+				case <-closed:
+				}
+			}()
+			if err := job.Close(); err != nil {
+				logError("failed to stop server: %v", err)
+			}
+			close(closed)
+		}()
+	}
+	wg.Wait()
 }
 
 func (m *ServerManager) swapJobs(jobs []*serverJob) []*serverJob {
@@ -51,5 +248,6 @@ func (m *ServerManager) swapJobs(jobs []*serverJob) []*serverJob {
 	defer m.mu.Unlock()
 	old := m.jobs
 	m.jobs = jobs
+	m.keys = nil
 	return old
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/creack/pty"
+)
+
+const (
+	defaultPTYRows  = 40
+	defaultPTYCols  = 120
+	maxPTYDimension = 1<<16 - 1
+)
+
+type resizeRequest struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+}
+
+func (j *serverJob) ptySize() *pty.Winsize {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return &pty.Winsize{Rows: uint16(j.ptyRows), Cols: uint16(j.ptyCols)}
+}
+
+func (j *serverJob) resize(rows, cols int) error {
+	if rows < 1 || rows > maxPTYDimension || cols < 1 || cols > maxPTYDimension {
+		return fmt.Errorf("rows and cols must be between 1 and %d", maxPTYDimension)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.cfg.UsePTY {
+		return fmt.Errorf("server %q does not run in a pty (pty = false)", j.cfg.Name)
+	}
+	j.ptyRows, j.ptyCols = rows, cols
+	if j.pty == nil {
+		return nil
+	}
+	if err := pty.Setsize(j.pty, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)}); err != nil {
+		return fmt.Errorf("resize pty: %w", err)
+	}
+	if j.recorder != nil {
+		j.recorder.resize(rows, cols)
+	}
+	return nil
+}
+
+func (m *ServerManager) Resize(name string, rows, cols int) error {
+	for _, job := range m.Jobs() {
+		if job != nil && job.cfg.Name == name {
+			return job.resize(rows, cols)
+		}
+	}
+	return fmt.Errorf("unknown server %q", name)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/creack/pty"
+)
+
+const (
+	recordAsciicast   = "asciicast"
+	defaultRecordKeep = 20
+)
+
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+type asciicastRecorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	clock   clock
+	start   time.Time
+	partial []byte
+	failed  bool
+	log     logger
+}
+
+func normalizeRecording(raw rawServer, usePTY bool, stateDir, name string) (string, string, int, error) {
+	mode := strings.ToLower(strings.TrimSpace(raw.Record))
+	switch mode {
+	case "", "none":
+		return "", "", 0, nil
+	case recordAsciicast:
+	default:
+		return "", "", 0, fmt.Errorf("record must be %q, got %q", recordAsciicast, raw.Record)
+	}
+	if !usePTY {
+		return "", "", 0, errors.New("record needs pty = true")
+	}
+
+	dir := filepath.Join(stateDir, "recordings", sanitizeFilename(name))
+	if str, ok := valueToString(raw.RecordDir); ok && str != "" {
+		resolved, err := resolvePath(str)
+		if err != nil {
+			return "", "", 0, fmt.Errorf("record_dir: %w", err)
+		}
+		dir = resolved
+	}
+	keep := defaultRecordKeep
+	if raw.RecordKeep != nil {
+		if *raw.RecordKeep < 0 {
+			return "", "", 0, errors.New("record_keep must not be negative")
+		}
+		keep = int(*raw.RecordKeep)
+	}
+	return mode, dir, keep, nil
+}
+
+func (j *serverJob) startRecording(size *pty.Winsize) *asciicastRecorder {
+	if j.cfg.Record == "" {
+		return nil
+	}
+	recorder, err := newAsciicastRecorder(j.cfg, size, j.clock, j.log())
+	if err != nil {
+		j.log().Error("recording disabled for this run: %v", err)
+		return nil
+	}
+	j.mu.Lock()
+	j.recorder = recorder
+	j.mu.Unlock()
+	return recorder
+}
+
+func newAsciicastRecorder(cfg NormalizedServer, size *pty.Winsize, clock clock, log logger) (*asciicastRecorder, error) {
+	if err := os.MkdirAll(cfg.RecordDir, cfg.LogPerms.DirMode); err != nil {
+		return nil, fmt.Errorf("create recording directory: %w", err)
+	}
+	now := clock.Now()
+	path := filepath.Join(cfg.RecordDir, now.Format("20060102-150405.000")+".cast")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, cfg.LogPerms.FileMode)
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %w", err)
+	}
+
+	header := asciicastHeader{
+		Version:   2,
+		Width:     int(size.Cols),
+		Height:    int(size.Rows),
+		Timestamp: now.Unix(),
+		Command:   cfg.CommandDisplay,
+		Title:     cfg.Name,
+	}
+	term, ok := cfg.Env["TERM"]
+	if !ok {
+		term = os.Getenv("TERM")
+	}
+	if term != "" {
+		header.Env = map[string]string{"TERM": term}
+	}
+	data, err := json.Marshal(header)
+	if err == nil {
+		_, err = file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("write recording: %w", err)
+	}
+	log.Debug("recording to %s", path)
+	pruneRecordings(cfg.RecordDir, cfg.RecordKeep, log)
+	return &asciicastRecorder{file: file, clock: clock, start: now, log: log}, nil
+}
+
+func (r *asciicastRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := append(r.partial, p...)
+	complete := completeUTF8(data)
+	r.partial = append([]byte(nil), data[complete:]...)
+	if complete > 0 {
+		r.event("o", string(data[:complete]))
+	}
+	return len(p), nil
+}
+
+func (r *asciicastRecorder) resize(rows, cols int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *asciicastRecorder) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	if len(r.partial) > 0 {
+		r.event("o", string(r.partial))
+		r.partial = nil
+	}
+	if err := r.file.Close(); err != nil && !r.failed {
+		r.log.Error("recording: %v", err)
+	}
+	r.file = nil
+}
+
+func (r *asciicastRecorder) event(kind, data string) {
+	if r.file == nil || r.failed {
+		return
+	}
+	elapsed := math.Round(r.clock.Now().Sub(r.start).Seconds()*1e6) / 1e6
+	line, err := json.Marshal([]any{elapsed, kind, data})
+	if err == nil {
+		_, err = r.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		r.failed = true
+		r.log.Error("recording stopped: %v", err)
+	}
+}
+
+func completeUTF8(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if utf8.FullRune(data[i:]) {
+				return len(data)
+			}
+			return i
+		}
+	}
+	return len(data)
+}
+
+func pruneRecordings(dir string, keep int, log logger) {
+	if keep <= 0 {
+		return
+	}
+	recordings, _ := filepath.Glob(filepath.Join(dir, "*.cast"))
+	if len(recordings) <= keep {
+		return
+	}
+	sort.Strings(recordings)
+	for _, path := range recordings[:len(recordings)-keep] {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn("failed to remove old recording: %v", err)
+		}
+	}
+}
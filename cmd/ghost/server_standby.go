@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// standbyGateFD is the descriptor a standby-mode server reads its gate from;
+// it's the first of cmd.ExtraFiles.
+const standbyGateFD = 3
+
+// standbyBufferSize caps how much output a standby instance can print
+// before it is promoted; anything past it is dropped.
+const standbyBufferSize = 256 << 10
+
+// standbyProcess is a pre-started server instance waiting for its gate to
+// open. It does its slow startup while the active instance serves, and
+// takes over as soon as that one exits.
+type standbyProcess struct {
+	cmd       *exec.Cmd
+	gate      *os.File
+	stdout    *gatedWriter
+	stderr    *gatedWriter
+	startedAt time.Time
+	done      chan struct{}
+	err       error
+}
+
+// openGate lets the standby instance continue past its gate.
+func (s *standbyProcess) openGate() {
+	if s.gate != nil {
+		_ = s.gate.Close()
+		s.gate = nil
+	}
+}
+
+func (s *standbyProcess) exited() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// standbyCommand builds a server command with the gate pipe attached. The
+// returned file is the write end; closing it opens the gate.
+func (j *serverJob) standbyCommand() (*exec.Cmd, *os.File, *os.File, error) {
+	read, write, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("standby gate: %w", err)
+	}
+	cmd := exec.Command(j.cfg.Command[0], j.cfg.Command[1:]...)
+	cmd.Dir = j.cfg.Cwd
+	cmd.Env = append(buildEnvList(j.cfg.RunAs.env(j.cfg.Env)), fmt.Sprintf("GHOST_STANDBY_FD=%d", standbyGateFD))
+	cmd.Stdin = nil
+	cmd.ExtraFiles = []*os.File{read}
+	if j.cfg.ProcessGroup {
+		setProcessGroup(cmd)
+	}
+	setRunAs(cmd, j.cfg.RunAs)
+	return cmd, read, write, nil
+}
+
+// prepareStandby starts the next instance behind a closed gate, unless one
+// is already waiting.
+func (j *serverJob) prepareStandby() {
+	j.mu.Lock()
+	if j.closed || j.standby != nil {
+		j.mu.Unlock()
+		return
+	}
+	j.mu.Unlock()
+
+	cmd, read, gate, err := j.standbyCommand()
+	if err != nil {
+		j.log().Error("%v", err)
+		return
+	}
+	standby := &standbyProcess{
+		cmd:    cmd,
+		gate:   gate,
+		stdout: newGatedWriter(standbyBufferSize),
+		stderr: newGatedWriter(standbyBufferSize),
+		done:   make(chan struct{}),
+	}
+	cmd.Stdout, cmd.Stderr = standby.stdout, standby.stderr
+	err = j.runner.Start(cmd)
+	standby.startedAt = j.clock.Now()
+	_ = read.Close()
+	if err != nil {
+		_ = gate.Close()
+		j.log().Error("failed to start standby: %v", err)
+		return
+	}
+	j.applyPriority(cmd)
+	auditStart("server", j.cfg.Name, "", cmd, j.cfg.Env, j.cfg.Secrets, "standby")
+	j.log().withPID(cmd.Process.Pid).Debug("standby started")
+	go func() {
+		standby.err = cmd.Wait()
+		close(standby.done)
+	}()
+
+	j.mu.Lock()
+	if j.closed || j.paused() || j.standby != nil {
+		j.mu.Unlock()
+		j.discardStandby(standby)
+		return
+	}
+	j.standby = standby
+	j.mu.Unlock()
+}
+
+// takeStandby hands over the waiting instance, or nil when there is none or
+// it died during warm-up.
+func (j *serverJob) takeStandby() *standbyProcess {
+	j.mu.Lock()
+	standby := j.standby
+	j.standby = nil
+	j.mu.Unlock()
+	if standby == nil {
+		return nil
+	}
+	if standby.exited() {
+		j.log().withPID(standby.cmd.Process.Pid).Warn("standby exited before it was needed (%v), starting fresh", standby.err)
+		auditExit("server", j.cfg.Name, "", standby.cmd, j.cfg.Secrets, standby.startedAt, standby.err)
+		return nil
+	}
+	return standby
+}
+
+func (j *serverJob) hasStandby() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.standby != nil
+}
+
+// restartFromStandby stops the active instance so the run loop promotes the
+// waiting one right away. It reports false when there is nothing to swap.
+func (j *serverJob) restartFromStandby() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed || j.cmd == nil || j.standby == nil {
+		return false
+	}
+	j.healthRestart = true
+	j.restartCause = "manual"
+	j.stopProcessLocked()
+	return true
+}
+
+func (j *serverJob) dropStandby() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.dropStandbyLocked()
+}
+
+func (j *serverJob) dropStandbyLocked() {
+	if j.standby == nil {
+		return
+	}
+	standby := j.standby
+	j.standby = nil
+	go j.discardStandby(standby)
+}
+
+// discardStandby kills an instance that will never be promoted. It never
+// served anything, so there is nothing to shut down gracefully.
+func (j *serverJob) discardStandby(standby *standbyProcess) {
+	if err := signalProcess(standby.cmd.Process, syscall.SIGKILL, j.cfg.ProcessGroup); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		j.log().Error("failed to stop standby: %v", err)
+	}
+	standby.openGate()
+	<-standby.done
+	auditExit("server", j.cfg.Name, "", standby.cmd, j.cfg.Secrets, standby.startedAt, standby.err)
+}
+
+// gatedWriter holds a standby instance's output until it is promoted, then
+// passes everything through to the real destination.
+type gatedWriter struct {
+	mu      sync.Mutex
+	limit   int
+	buf     []byte
+	dropped int
+	dest    io.Writer
+}
+
+func newGatedWriter(limit int) *gatedWriter {
+	return &gatedWriter{limit: limit}
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.dest != nil {
+		return g.dest.Write(p)
+	}
+	n := len(p)
+	if room := max(g.limit-len(g.buf), 0); room < n {
+		g.dropped += n - room
+		p = p[:room]
+	}
+	g.buf = append(g.buf, p...)
+	return n, nil
+}
+
+// attach flushes the buffered output to dest and forwards from then on.
+func (g *gatedWriter) attach(dest io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, _ = dest.Write(g.buf)
+	if g.dropped > 0 {
+		_, _ = fmt.Fprintf(dest, "[ghost: dropped %d bytes of standby output]\n", g.dropped)
+	}
+	g.buf, g.dest = nil, dest
+}
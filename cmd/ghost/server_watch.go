@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+)
+
+// rawServerWatch is a server's [servers.watch] table: the file-watching part
+// of a watcher, with the server restart as its only action.
+type rawServerWatch struct {
+	Path             any      `toml:"path"`
+	Match            any      `toml:"match"`
+	Ignore           any      `toml:"ignore"`
+	DefaultIgnores   *bool    `toml:"default_ignores"`
+	CaseSensitive    *bool    `toml:"case_sensitive"`
+	Gitignore        *bool    `toml:"respect_gitignore"`
+	Events           []string `toml:"events"`
+	DebounceMs       *int64   `toml:"debounce_ms"`
+	AdaptiveDebounce *bool    `toml:"adaptive_debounce"`
+	MaxDebounceMs    *int64   `toml:"max_debounce_ms"`
+	PollFallback     *bool    `toml:"poll_fallback"`
+	Backend          string   `toml:"backend"`
+	PollIntervalMs   *int64   `toml:"poll_interval_ms"`
+	WarmupMs         *int64   `toml:"warmup_ms"`
+}
+
+// normalizeServerWatch runs the watch table through normalizeWatcher so
+// servers match, ignore and debounce exactly like watchers do. Relative paths
+// are taken from the server's cwd, which is also the default.
+func normalizeServerWatch(raw *rawServerWatch, name, cwd string, index int, defaults rawDefaults, state StateConfig) (*NormalizedWatcher, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	paths, err := valueToStringSlice(raw.Path)
+	if err != nil {
+		return nil, fmt.Errorf("servers[%d].watch: path: %w", index, err)
+	}
+	paths = continueIfEmpty(paths)
+	if len(paths) == 0 {
+		paths = []string{cwd}
+	}
+	resolved := make([]any, len(paths))
+	for i, path := range paths {
+		if !filepath.IsAbs(path) && path != "~" && !hasHomePrefix(path) {
+			path = filepath.Join(cwd, path)
+		}
+		resolved[i] = path
+	}
+
+	watcher, err := normalizeWatcher(rawWatcher{
+		Name:             name,
+		Path:             resolved,
+		Command:          []any{"restart", name}, // never run; the action is the restart
+		Cwd:              cwd,
+		Match:            raw.Match,
+		Ignore:           raw.Ignore,
+		DefaultIgnores:   raw.DefaultIgnores,
+		CaseSensitive:    raw.CaseSensitive,
+		Gitignore:        raw.Gitignore,
+		Events:           raw.Events,
+		DebounceMs:       raw.DebounceMs,
+		AdaptiveDebounce: raw.AdaptiveDebounce,
+		MaxDebounceMs:    raw.MaxDebounceMs,
+		PollFallback:     raw.PollFallback,
+		Backend:          raw.Backend,
+		PollIntervalMs:   raw.PollIntervalMs,
+		WarmupMs:         raw.WarmupMs,
+		Stdout:           "null",
+	}, index, defaults, state)
+	if err != nil {
+		return nil, relabelConfigError(err, fmt.Sprintf("watchers[%d]", index), fmt.Sprintf("servers[%d].watch", index))
+	}
+	return &watcher, nil
+}
+
+// relabelConfigError points errors from normalizeWatcher at the server's
+// watch table instead of a watchers entry that doesn't exist.
+func relabelConfigError(err error, from, to string) error {
+	var list configcheck.Errors
+	if errors.As(err, &list) {
+		for _, item := range list {
+			item.Message = strings.Replace(item.Message, from, to, 1)
+		}
+		return list
+	}
+	return errors.New(strings.Replace(err.Error(), from, to, 1))
+}
+
+// restartForChange is the watch action: it restarts a running server, or
+// starts one that exited and is waiting for changes.
+func (j *serverJob) restartForChange(triggers []Trigger) {
+	summary := formatTriggers(triggers)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed || j.paused() {
+		return
+	}
+	if j.cmd == nil {
+		if j.waitingForChange {
+			j.waitingForChange = false
+			j.restartCause = "watch: " + summary
+			j.changed <- struct{}{}
+		}
+		return
+	}
+	j.log().Info("files changed, restarting — %s", summary)
+	j.healthRestart = true
+	j.restartCause = "watch: " + summary
+	j.stopProcessLocked()
+}
+
+// waitForChange parks a server that exited without restart = true until a
+// watched file changes, the way nodemon waits after a crash.
+func (j *serverJob) waitForChange() bool {
+	j.mu.Lock()
+	j.waitingForChange = true
+	j.mu.Unlock()
+	j.log().Info("waiting for file changes before starting again")
+	select {
+	case <-j.changed:
+		return !j.isClosed()
+	case <-j.stopCh:
+		return false
+	}
+}
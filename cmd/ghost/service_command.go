@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	launchdLabel    = "dev.nikiv.ghost"
+	systemdUnitName = "ghost.service"
+)
+
+type serviceSpec struct {
+	Binary       string
+	Config       string
+	Path         string
+	LogPath      string
+	StartAtLogin bool
+}
+
+func runInstallCommand(args []string) error {
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	startAtLogin := fs.Bool("start-at-login", false, "also start the daemon every time you log in")
+	configFlag := fs.String("config", "", "config file for the service (default: the one ghost would use now)")
+	printOnly := fs.Bool("print", false, "print the service file instead of installing it")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("usage: ghost install [-start-at-login] [-config file] [-print]")
+	}
+
+	spec := serviceSpec{StartAtLogin: *startAtLogin, Path: os.Getenv("PATH")}
+	if spec.Binary, err = os.Executable(); err != nil {
+		return fmt.Errorf("locate ghost binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(spec.Binary); err == nil {
+		spec.Binary = resolved
+	}
+	if *configFlag != "" {
+		spec.Config, err = resolvePath(*configFlag)
+	} else {
+		spec.Config, err = determineConfigPath()
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(spec.Config); err != nil {
+		return fmt.Errorf("config file not found at %s", spec.Config)
+	}
+	state, err := readStateConfig(spec.Config)
+	if err != nil {
+		return err
+	}
+	spec.LogPath = filepath.Join(state.Dir, "daemon.log")
+
+	switch runtime.GOOS {
+	case "darwin":
+		plist := spec.launchdPlist()
+		if *printOnly {
+			_, err := os.Stdout.Write(plist)
+			return err
+		}
+		return installLaunchAgent(plist, spec, state.Permissions)
+	case "linux":
+		unit := spec.systemdUnit()
+		if *printOnly {
+			_, err := os.Stdout.WriteString(unit)
+			return err
+		}
+		return installSystemdUnit(unit, spec)
+	}
+	return fmt.Errorf("not supported on %s (only macOS launchd and Linux systemd)", runtime.GOOS)
+}
+
+func runUninstallCommand(args []string) error {
+	fs := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("usage: ghost uninstall")
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return uninstallLaunchAgent()
+	case "linux":
+		return uninstallSystemdUnit()
+	}
+	return fmt.Errorf("not supported on %s (only macOS launchd and Linux systemd)", runtime.GOOS)
+}
+
+func (s serviceSpec) launchdPlist() []byte {
+	var buf bytes.Buffer
+	str := func(value string) string {
+		var escaped bytes.Buffer
+		_ = xml.EscapeText(&escaped, []byte(value))
+		return "<string>" + escaped.String() + "</string>"
+	}
+	runAtLoad := "<false/>"
+	if s.StartAtLogin {
+		runAtLoad = "<true/>"
+	}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+`)
+	fmt.Fprintf(&buf, "\t<key>Label</key>\n\t%s\n", str(launchdLabel))
+	fmt.Fprintf(&buf, "\t<key>ProgramArguments</key>\n\t<array>\n\t\t%s\n\t</array>\n", str(s.Binary))
+	fmt.Fprintf(&buf, "\t<key>EnvironmentVariables</key>\n\t<dict>\n\t\t<key>%s</key>\n\t\t%s\n", configEnvVar, str(s.Config))
+	if s.Path != "" {
+		fmt.Fprintf(&buf, "\t\t<key>PATH</key>\n\t\t%s\n", str(s.Path))
+	}
+	buf.WriteString("\t</dict>\n")
+	fmt.Fprintf(&buf, "\t<key>RunAtLoad</key>\n\t%s\n", runAtLoad)
+	buf.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	buf.WriteString("\t<key>ProcessType</key>\n\t<string>Interactive</string>\n")
+	fmt.Fprintf(&buf, "\t<key>StandardOutPath</key>\n\t%s\n", str(s.LogPath))
+	fmt.Fprintf(&buf, "\t<key>StandardErrorPath</key>\n\t%s\n", str(s.LogPath))
+	buf.WriteString("</dict>\n</plist>\n")
+	return buf.Bytes()
+}
+
+func (s serviceSpec) systemdUnit() string {
+	var buf strings.Builder
+	buf.WriteString("[Unit]\nDescription=ghost daemon\n\n[Service]\nType=notify\nNotifyAccess=main\n")
+	fmt.Fprintf(&buf, "ExecStart=%s\n", systemdQuote(s.Binary))
+	fmt.Fprintf(&buf, "Environment=%s\n", systemdQuote(configEnvVar+"="+s.Config))
+	if s.Path != "" {
+		fmt.Fprintf(&buf, "Environment=%s\n", systemdQuote("PATH="+s.Path))
+	}
+	buf.WriteString("ExecReload=/bin/kill -HUP $MAINPID\nRestart=on-failure\nRestartSec=2\nWatchdogSec=60\nKillMode=mixed\n\n[Install]\nWantedBy=default.target\n")
+	return buf.String()
+}
+
+func systemdQuote(value string) string {
+	value = strings.ReplaceAll(value, "%", "%%")
+	if !strings.ContainsAny(value, " \t\"'\\;") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func launchAgentPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"), nil
+}
+
+func launchdDomain() string {
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+func installLaunchAgent(plist []byte, spec serviceSpec, perms FilePermissions) error {
+	path, err := launchAgentPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(spec.LogPath), perms.DirMode); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	_ = exec.Command("launchctl", "bootout", launchdDomain()+"/"+launchdLabel).Run()
+	warnIfDaemonRunning()
+	if err := os.WriteFile(path, plist, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", path)
+	if err := runServiceTool("launchctl", "bootstrap", launchdDomain(), path); err != nil {
+		return err
+	}
+	if err := runServiceTool("launchctl", "kickstart", launchdDomain()+"/"+launchdLabel); err != nil {
+		return err
+	}
+	fmt.Printf("started %s (logs in %s)\n", launchdLabel, spec.LogPath)
+	if spec.StartAtLogin {
+		fmt.Println("ghost will start at login")
+	}
+	return nil
+}
+
+func uninstallLaunchAgent() error {
+	path, err := launchAgentPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no launch agent installed at %s", path)
+	}
+	_ = exec.Command("launchctl", "bootout", launchdDomain()+"/"+launchdLabel).Run()
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Printf("stopped %s and removed %s\n", launchdLabel, path)
+	return nil
+}
+
+func systemdUnitPath() (string, error) {
+	configHome, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configHome, "systemd", "user", systemdUnitName), nil
+}
+
+func installSystemdUnit(unit string, spec serviceSpec) error {
+	path, err := systemdUnitPath()
+	if err != nil {
+		return err
+	}
+	if exec.Command("systemctl", "--user", "is-active", "--quiet", systemdUnitName).Run() != nil {
+		warnIfDaemonRunning()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(unit), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", path)
+	if err := runServiceTool("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	if spec.StartAtLogin {
+		err = runServiceTool("systemctl", "--user", "enable", systemdUnitName)
+	} else {
+		err = runServiceTool("systemctl", "--user", "disable", systemdUnitName)
+	}
+	if err != nil {
+		return err
+	}
+	if err := runServiceTool("systemctl", "--user", "restart", systemdUnitName); err != nil {
+		return err
+	}
+	fmt.Printf("started %s (logs: journalctl --user -u %s)\n", systemdUnitName, systemdUnitName)
+	if spec.StartAtLogin {
+		fmt.Println("ghost will start at login")
+	}
+	return nil
+}
+
+func uninstallSystemdUnit() error {
+	path, err := systemdUnitPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no systemd unit installed at %s", path)
+	}
+	if err := runServiceTool("systemctl", "--user", "disable", "--now", systemdUnitName); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := runServiceTool("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	fmt.Printf("stopped %s and removed %s\n", systemdUnitName, path)
+	return nil
+}
+
+func runServiceTool(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if detail := lastLine(strings.TrimSpace(string(output))); detail != "" {
+			return fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), detail)
+		}
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func warnIfDaemonRunning() {
+	if err := controlRequest("GET", "/v1/servers", nil, nil); err == nil {
+		fmt.Fprintf(os.Stderr, "warning: a ghost daemon is already running (%s); stop it or the service will exit right away\n", controlSocketPath())
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type shellProfile struct {
+	Mode string
+	File string
+}
+
+func normalizeShellProfile(value, fallback string) (shellProfile, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		value = strings.TrimSpace(fallback)
+	}
+	switch {
+	case value == "" || value == "login":
+		return shellProfile{Mode: "login"}, nil
+	case value == "none":
+		return shellProfile{Mode: "none"}, nil
+	case strings.HasPrefix(value, "custom:"):
+		file := strings.TrimSpace(strings.TrimPrefix(value, "custom:"))
+		if file == "" {
+			return shellProfile{}, errors.New("shell_profile: custom: needs a file, e.g. custom:~/.config/ghost/profile.sh")
+		}
+		resolved, err := resolvePath(file)
+		if err != nil {
+			return shellProfile{}, fmt.Errorf("shell_profile: %w", err)
+		}
+		if info, err := os.Stat(resolved); err != nil {
+			return shellProfile{}, fmt.Errorf("shell_profile: %w", err)
+		} else if info.IsDir() {
+			return shellProfile{}, fmt.Errorf("shell_profile: %s is a directory", resolved)
+		}
+		return shellProfile{Mode: "custom", File: resolved}, nil
+	}
+	return shellProfile{}, fmt.Errorf("shell_profile must be \"login\", \"none\" or \"custom:<file>\", got %q", value)
+}
+
+func (p shellProfile) command(script string) []string {
+	shell := defaultShell()
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe")
+	switch name {
+	case "cmd":
+		if p.Mode == "custom" {
+			script = "call " + cmdQuote(p.File) + " && " + script
+		}
+		return []string{shell, "/d", "/s", "/c", script}
+	case "pwsh", "powershell":
+		args := []string{shell, "-NoLogo", "-NonInteractive"}
+		if p.Mode != "" && p.Mode != "login" {
+			args = append(args, "-NoProfile")
+		}
+		if p.Mode == "custom" {
+			script = ". " + powershellQuote(p.File) + "\n" + script
+		}
+		return append(args, "-Command", script)
+	}
+	if p.Mode == "" || p.Mode == "login" {
+		return []string{shell, "-lc", script}
+	}
+
+	var args []string
+	source := "."
+	switch name {
+	case "zsh":
+		args = []string{"-f", "-c"}
+	case "bash":
+		args = []string{"--noprofile", "--norc", "-c"}
+	case "fish":
+		args = []string{"--no-config", "-c"}
+		source = "source"
+	default:
+		args = []string{"-c"}
+	}
+	if p.Mode == "custom" {
+		script = source + " " + shellQuote(p.File) + "\n" + script
+	}
+	return append([]string{shell}, append(args, script)...)
+}
+
+// windowsShell is the fallback when SHELL is unset on Windows: PowerShell 7
+// if it is installed, since it understands && and ||, otherwise cmd.
+var windowsShell = sync.OnceValue(func() string {
+	if path, err := exec.LookPath("pwsh"); err == nil {
+		return path
+	}
+	if comspec := strings.TrimSpace(os.Getenv("ComSpec")); comspec != "" {
+		return comspec
+	}
+	return "cmd.exe"
+})
+
+func cmdQuote(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
+
+func powershellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,7 @@
+//go:build !(darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import "os"
+
+var statusSignals []os.Signal
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runSimulateCommand(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	name := fs.String("watcher", "", "watcher to simulate (required)")
+	event := fs.String("event", "change", "event type: add, addDir, change, unlink, unlinkDir, rename, renameDir")
+	var paths stringList
+	fs.Var(&paths, "path", "changed path, absolute or relative to the watch root (repeatable)")
+	dryRun := fs.Bool("dry-run", false, "show the runs without executing them")
+	configFlag := fs.String("config", "", "config file (default: the daemon's config)")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	paths = append(paths, rest...)
+	if *name == "" {
+		return errors.New("-watcher is required")
+	}
+	if _, ok := allowedEvents[*event]; !ok {
+		return fmt.Errorf("unsupported event %q", *event)
+	}
+
+	configPath := *configFlag
+	if configPath == "" {
+		if configPath, err = determineConfigPath(); err != nil {
+			return err
+		}
+	} else if configPath, err = resolvePath(configPath); err != nil {
+		return err
+	}
+	cfg, err := readConfig(configPath)
+	if err != nil {
+		return err
+	}
+	var watcher *NormalizedWatcher
+	for i := range cfg.Watchers {
+		if cfg.Watchers[i].Name == *name {
+			watcher = &cfg.Watchers[i]
+			break
+		}
+	}
+	if watcher == nil {
+		return fmt.Errorf("unknown watcher %q in %s", *name, configPath)
+	}
+
+	debounce := watcher.Debounce.String()
+	if watcher.AdaptiveDebounce {
+		debounce += " adaptive up to " + watcher.MaxDebounce.String()
+	}
+	fmt.Printf("watcher %s (root %s, debounce %s)\n", watcher.Name, joinRoots(watcher.WatchRoot, watcher.Roots), debounce)
+	gitignores := make(map[string]*gitignoreMatcher)
+	if watcher.Gitignore {
+		for _, root := range watcher.Roots {
+			if gitignores[root], err = loadGitignore(root, watcher.CaseSensitive); err != nil {
+				return fmt.Errorf("respect_gitignore: %w", err)
+			}
+		}
+	}
+	var triggers []Trigger
+	if len(paths) == 0 {
+		fmt.Println("  no path → manual trigger")
+		triggers = append(triggers, Trigger{Event: "manual"})
+	}
+	for _, path := range paths {
+		rel, root := path, watcher.WatchRoot
+		if filepath.IsAbs(path) {
+			var ok bool
+			if root, rel, ok = watcher.locate(path); !ok {
+				fmt.Printf("  %s %s → %s\n", *event, path, outcomeOutsideRoot)
+				continue
+			}
+		}
+		rel = posixPath(filepath.Clean(rel))
+		if gitignore := gitignores[root]; gitignore != nil && gitignore.ignored(rel, isDirectory(filepath.Join(root, rel))) {
+			fmt.Printf("  %s %s → %s\n", *event, rel, outcomeGitignored)
+			continue
+		}
+		matched, outcome := watcher.triggersFor([]string{*event}, rel)
+		fmt.Printf("  %s %s → %s\n", *event, rel, outcome)
+		for i := range matched {
+			matched[i].Root = watcher.triggerRoot(root)
+		}
+		triggers = append(triggers, matched...)
+	}
+	if len(triggers) == 0 {
+		fmt.Println("nothing to run")
+		return nil
+	}
+
+	triggers = dedupeTriggers(triggers)
+	fmt.Printf("debounced into %d trigger(s): %s\n", len(triggers), formatTriggers(triggers))
+	if len(watcher.Transform) > 0 && len(paths) > 0 {
+		transformed, err := watcher.transformTriggers(triggers)
+		switch {
+		case err != nil:
+			fmt.Printf("transform failed, running with untransformed triggers: %v\n", err)
+		case len(transformed) == 0:
+			fmt.Println("transform dropped all triggers, nothing to run")
+			return nil
+		default:
+			triggers = dedupeTriggers(transformed)
+			fmt.Printf("transformed into %d trigger(s): %s\n", len(triggers), formatTriggers(triggers))
+		}
+	}
+
+	log := watcherLog(watcher.Name)
+	cachedHash := ""
+	if watcher.Cache {
+		cachedHash = loadCachedHash(watcher.Name)
+	}
+
+	var failed []string
+	for run := 1; len(triggers) > 0; run++ {
+		plan := watcher.planRun(triggers, cachedHash, log)
+		if plan.Skip != "" {
+			fmt.Printf("run %d: %s — %s\n", run, plan.Skip, formatTriggers(plan.Triggers))
+			break
+		}
+		summary := formatTriggers(plan.Triggers)
+		fmt.Printf("run %d: %s — %s\n", run, plan.Display, summary)
+		triggers = plan.Deferred
+		if *dryRun {
+			continue
+		}
+		if err := runSimulatedCommand(*watcher, plan, summary); err != nil {
+			fmt.Printf("run %d: %v\n", run, err)
+			failed = append(failed, fmt.Sprintf("run %d", run))
+		}
+	}
+	if *dryRun {
+		fmt.Println("dry run: no commands executed")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func runSimulatedCommand(watcher NormalizedWatcher, plan runPlan, summary string) error {
+	cmd := watcher.buildCommand(plan.Command)
+	cmd.Stdin = watcher.commandStdin(plan.Triggers)
+	forward := newOutputForwarder(watcher.Name, watcher.Secrets)
+	cmd.Stdout, cmd.Stderr = forward.wrap(os.Stdout, os.Stderr)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+	_ = applyProcessPriority(cmd.Process.Pid, watcher.Priority)
+	auditStart("watcher", watcher.Name, "", cmd, watcher.Env, watcher.Secrets, "simulate: "+summary)
+
+	startedAt := time.Now()
+	err := cmd.Wait()
+	forward.Flush()
+	auditExit("watcher", watcher.Name, "", cmd, watcher.Secrets, startedAt, err)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("exited with code %d", exitErr.ExitCode())
+	}
+	return err
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sinkQueueSize        = 1024
+	defaultLokiBatch     = time.Second
+	maxSinkBatchLines    = 500
+	sinkDialTimeout      = 3 * time.Second
+	defaultSyslogAddress = "udp://127.0.0.1:514"
+)
+
+type rawSink struct {
+	Type    string            `toml:"type"`
+	Path    any               `toml:"path"`
+	Address string            `toml:"address"`
+	Tag     string            `toml:"tag"`
+	URL     string            `toml:"url"`
+	Labels  map[string]string `toml:"labels"`
+	BatchMs *int64            `toml:"batch_ms"`
+}
+
+type SinkConfig struct {
+	Type          string
+	Path          string
+	Network       string
+	Address       string
+	Tag           string
+	URL           string
+	Labels        map[string]string
+	BatchInterval time.Duration
+}
+
+type sinkLine struct {
+	At     time.Time
+	Stream string
+	Text   string
+}
+
+type outputSink interface {
+	Send(line sinkLine)
+	Close() error
+}
+
+func normalizeSinks(raw []rawSink, serverName string) ([]SinkConfig, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	sinks := make([]SinkConfig, 0, len(raw))
+	for i, item := range raw {
+		sink, err := normalizeSink(item, serverName)
+		if err != nil {
+			return nil, fmt.Errorf("sinks[%d]: %w", i, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func normalizeSink(raw rawSink, serverName string) (SinkConfig, error) {
+	sink := SinkConfig{Type: strings.ToLower(strings.TrimSpace(raw.Type))}
+	switch sink.Type {
+	case "file":
+		str, ok := valueToString(raw.Path)
+		if !ok || strings.TrimSpace(str) == "" {
+			return SinkConfig{}, errors.New("path is required for file sinks")
+		}
+		resolved, err := resolvePath(str)
+		if err != nil {
+			return SinkConfig{}, fmt.Errorf("resolve path: %w", err)
+		}
+		sink.Path = resolved
+	case "syslog":
+		address := strings.TrimSpace(raw.Address)
+		if address == "" {
+			address = defaultSyslogAddress
+		}
+		network := "udp"
+		if scheme, rest, ok := strings.Cut(address, "://"); ok {
+			network = strings.ToLower(scheme)
+			address = rest
+		}
+		if network != "udp" && network != "tcp" {
+			return SinkConfig{}, fmt.Errorf("address: unsupported protocol %q (use udp:// or tcp://)", network)
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return SinkConfig{}, fmt.Errorf("address: %w", err)
+		}
+		sink.Network = network
+		sink.Address = address
+		sink.Tag = strings.TrimSpace(raw.Tag)
+		if sink.Tag == "" {
+			sink.Tag = serverName
+		}
+	case "loki":
+		target := strings.TrimSpace(raw.URL)
+		if target == "" {
+			return SinkConfig{}, errors.New("url is required for loki sinks")
+		}
+		parsed, err := url.Parse(target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return SinkConfig{}, fmt.Errorf("url: %q is not an http(s) URL", target)
+		}
+		if parsed.Path == "" || parsed.Path == "/" {
+			parsed.Path = "/loki/api/v1/push"
+		}
+		sink.URL = parsed.String()
+		sink.Labels = map[string]string{"job": "ghost", "server": serverName}
+		for key, value := range raw.Labels {
+			sink.Labels[key] = value
+		}
+		sink.BatchInterval = chooseDuration(raw.BatchMs, nil, defaultLokiBatch)
+		if sink.BatchInterval <= 0 {
+			sink.BatchInterval = defaultLokiBatch
+		}
+	case "":
+		return SinkConfig{}, errors.New("type is required (file, syslog or loki)")
+	default:
+		return SinkConfig{}, fmt.Errorf("type: unsupported value %q (use file, syslog or loki)", sink.Type)
+	}
+	return sink, nil
+}
+
+func openSinks(configs []SinkConfig, log logger, perms FilePermissions) []outputSink {
+	sinks := make([]outputSink, 0, len(configs))
+	for _, cfg := range configs {
+		switch cfg.Type {
+		case "file":
+			sinks = append(sinks, &fileSink{path: cfg.Path, perms: perms, log: log})
+		case "syslog":
+			sinks = append(sinks, newQueuedSink(log, &syslogSink{cfg: cfg, hostname: sinkHostname()}))
+		case "loki":
+			sinks = append(sinks, newQueuedSink(log, &lokiSink{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}))
+		}
+	}
+	return sinks
+}
+
+func closeSinks(sinks []outputSink) {
+	for _, sink := range sinks {
+		_ = sink.Close()
+	}
+}
+
+func newSinkForwarder(sinks []outputSink, secrets secretSet) *outputForwarder {
+	if len(sinks) == 0 {
+		return nil
+	}
+	send := func(stream string) func(string) {
+		return func(text string) {
+			line := sinkLine{At: time.Now(), Stream: stream, Text: secrets.redactString(text)}
+			for _, sink := range sinks {
+				sink.Send(line)
+			}
+		}
+	}
+	return &outputForwarder{
+		stdout: &lineWriter{onLine: send("stdout")},
+		stderr: &lineWriter{onLine: send("stderr")},
+	}
+}
+
+func sinkHostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "-"
+	}
+	return host
+}
+
+type fileSink struct {
+	path  string
+	perms FilePermissions
+	log   logger
+
+	mu     sync.Mutex
+	file   *os.File
+	failed bool
+}
+
+func (s *fileSink) Send(line sinkLine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		if err := os.MkdirAll(filepath.Dir(s.path), s.perms.DirMode); err != nil {
+			s.fail(err)
+			return
+		}
+		file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, s.perms.FileMode)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		s.file = file
+		s.failed = false
+	}
+	if _, err := fmt.Fprintf(s.file, "%s %s\n", line.At.Format(time.RFC3339), line.Text); err != nil {
+		s.fail(err)
+		_ = s.file.Close()
+		s.file = nil
+	}
+}
+
+func (s *fileSink) fail(err error) {
+	if !s.failed {
+		s.log.Error("file sink %s: %v", s.path, err)
+		s.failed = true
+	}
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+type sinkDelivery interface {
+	name() string
+	deliver(lines []sinkLine) error
+	batchInterval() time.Duration
+	close() error
+}
+
+type queuedSink struct {
+	log      logger
+	delivery sinkDelivery
+	lines    chan sinkLine
+	done     chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+}
+
+func newQueuedSink(log logger, delivery sinkDelivery) *queuedSink {
+	sink := &queuedSink{
+		log:      log,
+		delivery: delivery,
+		lines:    make(chan sinkLine, sinkQueueSize),
+		done:     make(chan struct{}),
+	}
+	go sink.run()
+	return sink
+}
+
+func (s *queuedSink) Send(line sinkLine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.lines <- line:
+	default:
+		s.dropped++
+	}
+}
+
+func (s *queuedSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.done
+		return nil
+	}
+	s.closed = true
+	close(s.lines)
+	s.mu.Unlock()
+	<-s.done
+	return s.delivery.close()
+}
+
+func (s *queuedSink) run() {
+	defer close(s.done)
+
+	var (
+		batch   []sinkLine
+		ticker  *time.Ticker
+		tick    <-chan time.Time
+		failing bool
+	)
+	if interval := s.delivery.batchInterval(); interval > 0 {
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := s.delivery.deliver(batch)
+		switch {
+		case err != nil && !failing:
+			s.log.Error("%s sink: %v (dropping output until it recovers)", s.delivery.name(), err)
+			failing = true
+		case err == nil && failing:
+			s.log.Info("%s sink recovered", s.delivery.name())
+			failing = false
+		}
+		batch = batch[:0]
+
+		s.mu.Lock()
+		dropped := s.dropped
+		s.dropped = 0
+		s.mu.Unlock()
+		if dropped > 0 {
+			s.log.Warn("%s sink dropped %d line(s), queue full", s.delivery.name(), dropped)
+		}
+	}
+
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, line)
+			if tick == nil || len(batch) >= maxSinkBatchLines {
+				flush()
+			}
+		case <-tick:
+			flush()
+		}
+	}
+}
+
+type syslogSink struct {
+	cfg      SinkConfig
+	hostname string
+	conn     net.Conn
+}
+
+func (s *syslogSink) name() string {
+	return "syslog " + s.cfg.Network + "://" + s.cfg.Address
+}
+
+func (s *syslogSink) batchInterval() time.Duration {
+	return 0
+}
+
+func (s *syslogSink) deliver(lines []sinkLine) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.cfg.Network, s.cfg.Address, sinkDialTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	for _, line := range lines {
+		if err := s.write(line); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) write(line sinkLine) error {
+	severity := 6
+	if line.Stream == "stderr" {
+		severity = 3
+	}
+	const facilityLocal0 = 16
+	message := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		facilityLocal0*8+severity, line.At.Format(time.RFC3339Nano), s.hostname, s.cfg.Tag, os.Getpid(), line.Text)
+	if s.cfg.Network == "tcp" {
+		message = strconv.Itoa(len(message)) + " " + message
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(sinkDialTimeout))
+	_, err := io.WriteString(s.conn, message)
+	return err
+}
+
+func (s *syslogSink) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+type lokiSink struct {
+	cfg    SinkConfig
+	client *http.Client
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (s *lokiSink) name() string {
+	return "loki " + s.cfg.URL
+}
+
+func (s *lokiSink) batchInterval() time.Duration {
+	return s.cfg.BatchInterval
+}
+
+func (s *lokiSink) deliver(lines []sinkLine) error {
+	byStream := make(map[string][][2]string)
+	for _, line := range lines {
+		byStream[line.Stream] = append(byStream[line.Stream], [2]string{strconv.FormatInt(line.At.UnixNano(), 10), line.Text})
+	}
+	streams := make([]string, 0, len(byStream))
+	for stream := range byStream {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	push := lokiPush{Streams: make([]lokiStream, 0, len(streams))}
+	for _, stream := range streams {
+		labels := make(map[string]string, len(s.cfg.Labels)+1)
+		for key, value := range s.cfg.Labels {
+			labels[key] = value
+		}
+		labels["stream"] = stream
+		push.Streams = append(push.Streams, lokiStream{Stream: labels, Values: byStream[stream]})
+	}
+
+	body, err := json.Marshal(push)
+	if err != nil {
+		return fmt.Errorf("encode push: %w", err)
+	}
+	resp, err := s.client.Post(s.cfg.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func (s *lokiSink) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	snapshotVersion  = 1
+	snapshotFileName = "snapshot.json"
+)
+
+type runtimeSnapshot struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+	Paused  []jobRef  `json:"paused"`
+	// Profile is set when a profile was picked with --profile or ghost
+	// profile rather than taken from the config; "" means profiles were off.
+	Profile       *string `json:"profile,omitempty"`
+	TrackerPaused bool    `json:"tracker_paused,omitempty"`
+}
+
+type snapshotResult struct {
+	Paused  []jobRef `json:"paused"`
+	Resumed []jobRef `json:"resumed"`
+	// Profile and TrackerPaused are only set when the restore changed them.
+	Profile       *profileInfo `json:"profile,omitempty"`
+	TrackerPaused *bool        `json:"tracker_paused,omitempty"`
+}
+
+func (d *GhostDaemon) captureSnapshot() runtimeSnapshot {
+	snapshot := runtimeSnapshot{
+		Version:       snapshotVersion,
+		SavedAt:       time.Now().UTC(),
+		Paused:        pausedJobs.list(),
+		TrackerPaused: d.trackerPaused(),
+	}
+	d.configMu.Lock()
+	if d.profileChosen {
+		profile := d.profile
+		snapshot.Profile = &profile
+	}
+	d.configMu.Unlock()
+	return snapshot
+}
+
+func (d *GhostDaemon) restoreSnapshot(snapshot runtimeSnapshot) (snapshotResult, error) {
+	info := d.profileInfo()
+	if name := snapshot.Profile; name != nil && *name != "" && !containsString(info.Profiles, *name) {
+		return snapshotResult{}, unknownProfileError(*name, info.Profiles)
+	}
+	d.reloadMu.Lock()
+	result, err := d.applySnapshot(snapshot)
+	d.reloadMu.Unlock()
+	if err != nil || snapshot.Profile == nil || *snapshot.Profile == info.Active {
+		return result, err
+	}
+	// Switching profiles reloads the config, which takes reloadMu itself.
+	switched, err := d.switchProfile(*snapshot.Profile)
+	if err != nil {
+		return result, err
+	}
+	result.Profile = &switched
+	return result, nil
+}
+
+func (d *GhostDaemon) applySnapshot(snapshot runtimeSnapshot) (snapshotResult, error) {
+	if snapshot.Version < 1 || snapshot.Version > snapshotVersion {
+		return snapshotResult{}, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+	want := make(map[jobRef]bool, len(snapshot.Paused))
+	for _, ref := range snapshot.Paused {
+		if !containsString(jobActionKinds["pause"], ref.Kind) || ref.Name == "" {
+			return snapshotResult{}, fmt.Errorf("invalid paused job %q/%q in snapshot", ref.Kind, ref.Name)
+		}
+		want[ref] = true
+	}
+
+	result := snapshotResult{Paused: []jobRef{}, Resumed: []jobRef{}}
+	for _, ref := range pausedJobs.list() {
+		if want[ref] || !pausedJobs.set(ref.Kind, ref.Name, false) {
+			continue
+		}
+		logInfo("resumed %s %s", ref.Kind, ref.Name)
+		result.Resumed = append(result.Resumed, ref)
+	}
+	for _, ref := range snapshot.Paused {
+		if !pausedJobs.set(ref.Kind, ref.Name, true) {
+			continue
+		}
+		logInfo("paused %s %s", ref.Kind, ref.Name)
+		if ref.Kind == "server" && d.serverManager != nil {
+			d.serverManager.stopPaused(ref.Name)
+		}
+		result.Paused = append(result.Paused, ref)
+	}
+	if snapshot.TrackerPaused != d.trackerPaused() {
+		d.pauseTracker(snapshot.TrackerPaused)
+		result.TrackerPaused = &snapshot.TrackerPaused
+	}
+	return result, nil
+}
+
+// restoreSavedSnapshot applies the snapshot saved on the last shutdown. It
+// runs before the first profile is applied, so profiles lists the ones the
+// config defines.
+func (d *GhostDaemon) restoreSavedSnapshot(profiles []string) {
+	var snapshot runtimeSnapshot
+	var found bool
+	err := withStateDB(func(db *sql.DB) error {
+		var err error
+		snapshot, found, err = loadSnapshot(db)
+		return err
+	})
+	if err != nil {
+		logWarn("ignoring runtime snapshot: %v", err)
+		return
+	}
+	if !found {
+		return
+	}
+	if _, err := d.applySnapshot(snapshot); err != nil {
+		logWarn("ignoring runtime snapshot: %v", err)
+		return
+	}
+	logInfo("restored runtime snapshot from %s (%d paused job(s))", snapshot.SavedAt.Local().Format(time.DateTime), len(snapshot.Paused))
+	if snapshot.Profile == nil {
+		return
+	}
+	name := *snapshot.Profile
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+	switch {
+	case d.profileChosen:
+		if name != d.profile {
+			logInfo("--profile %q overrides profile %q from the runtime snapshot", d.profile, name)
+		}
+	case name != "" && !containsString(profiles, name):
+		logWarn("ignoring runtime snapshot profile: %v", unknownProfileError(name, profiles))
+	default:
+		d.profile, d.profileChosen = name, true
+	}
+}
+
+func (d *GhostDaemon) saveSnapshot() {
+	snapshot := d.captureSnapshot()
+	err := withStateDB(func(db *sql.DB) error {
+		return storeSnapshot(db, snapshot)
+	})
+	if err != nil {
+		logError("failed to save runtime snapshot: %v", err)
+	}
+}
+
+// loadSnapshot reads the snapshot kept in the state database; found is false
+// when none has been saved yet.
+func loadSnapshot(db *sql.DB) (snapshot runtimeSnapshot, found bool, err error) {
+	var data string
+	err = db.QueryRow(`SELECT snapshot FROM runtime_snapshot WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) || missingTable(err) {
+		return runtimeSnapshot{}, false, nil
+	}
+	if err != nil {
+		return runtimeSnapshot{}, false, err
+	}
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+		return runtimeSnapshot{}, false, fmt.Errorf("parse snapshot: %w", err)
+	}
+	return snapshot, true, nil
+}
+
+func storeSnapshot(db sqlExecer, snapshot runtimeSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO runtime_snapshot (id, saved_at, snapshot) VALUES (1, ?, ?) ON CONFLICT (id) DO UPDATE SET saved_at = excluded.saved_at, snapshot = excluded.snapshot`,
+		snapshot.SavedAt.UTC(), string(data))
+	return err
+}
+
+func readSnapshotFile(path string) (runtimeSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return runtimeSnapshot{}, err
+	}
+	var snapshot runtimeSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return runtimeSnapshot{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+func writeSnapshotFile(path string, snapshot runtimeSnapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	perms := currentStateConfig().Permissions
+	if err := os.MkdirAll(filepath.Dir(path), perms.DirMode); err != nil {
+		return fmt.Errorf("create snapshot directory: %w", err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	tempPath := temp.Name()
+	defer os.Remove(tempPath)
+	if _, err := temp.Write(append(data, '\n')); err != nil {
+		temp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Chmod(tempPath, perms.FileMode); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+)
+
+func runSnapshotCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 || (args[0] != "save" && args[0] != "restore") {
+		return errors.New("usage: ghost snapshot save|restore [file]")
+	}
+	// Without a file the snapshot lives in the state database, where the
+	// daemon saves it on shutdown.
+	path, where := "", stateDBName
+	if len(args) == 2 {
+		resolved, err := resolvePath(args[1])
+		if err != nil {
+			return err
+		}
+		path, where = resolved, resolved
+	}
+
+	if args[0] == "save" {
+		var snapshot runtimeSnapshot
+		if err := controlRequest("GET", "/v1/snapshot", nil, &snapshot); err != nil {
+			return err
+		}
+		var err error
+		if path == "" {
+			err = withStateDB(func(db *sql.DB) error { return storeSnapshot(db, snapshot) })
+		} else {
+			err = writeSnapshotFile(path, snapshot)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("saved %d paused job(s) to %s\n", len(snapshot.Paused), where)
+		if snapshot.Profile != nil && *snapshot.Profile != "" {
+			fmt.Printf("profile: %s\n", *snapshot.Profile)
+		} else if snapshot.Profile != nil {
+			fmt.Println("profile: off")
+		}
+		if snapshot.TrackerPaused {
+			fmt.Println("window tracker: paused")
+		}
+		return nil
+	}
+
+	var snapshot runtimeSnapshot
+	var err error
+	if path == "" {
+		found := false
+		err = readStateDB(func(db *sql.DB) error {
+			snapshot, found, err = loadSnapshot(db)
+			return err
+		})
+		if errors.Is(err, os.ErrNotExist) || err == nil && !found {
+			err = errors.New("no snapshot saved yet")
+		}
+	} else {
+		snapshot, err = readSnapshotFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	var result snapshotResult
+	if err := controlRequest("POST", "/v1/snapshot", snapshot, &result); err != nil {
+		return err
+	}
+	if len(result.Paused) == 0 && len(result.Resumed) == 0 && result.Profile == nil && result.TrackerPaused == nil {
+		fmt.Printf("runtime state already matches %s\n", where)
+	}
+	for _, job := range result.Paused {
+		fmt.Printf("paused %s %s\n", job.Kind, job.Name)
+	}
+	for _, job := range result.Resumed {
+		fmt.Printf("resumed %s %s\n", job.Kind, job.Name)
+	}
+	if result.Profile != nil && result.Profile.Active != "" {
+		fmt.Printf("switched to profile %s\n", result.Profile.Active)
+	} else if result.Profile != nil {
+		fmt.Println("profile off; running every job")
+	}
+	if paused := result.TrackerPaused; paused != nil && *paused {
+		fmt.Println("paused the window tracker")
+	} else if paused != nil {
+		fmt.Println("resumed the window tracker")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+const stateDirEnvVar = "GHOST_STATE_DIR"
+
+type StateConfig struct {
+	Dir         string
+	DataDir     string
+	Permissions FilePermissions
+}
+
+var (
+	stateConfigMu sync.RWMutex
+	stateConfig   StateConfig
+)
+
+func setStateConfig(cfg StateConfig) {
+	stateConfigMu.Lock()
+	defer stateConfigMu.Unlock()
+	stateConfig = cfg
+}
+
+func currentStateConfig() StateConfig {
+	stateConfigMu.RLock()
+	cfg := stateConfig
+	stateConfigMu.RUnlock()
+	if cfg.Dir != "" {
+		return cfg
+	}
+	fallback, err := normalizeState("", rawDefaults{})
+	if err != nil {
+		return StateConfig{Permissions: defaultPermissions}
+	}
+	return fallback
+}
+
+func normalizeState(configured string, defaults rawDefaults) (StateConfig, error) {
+	perms, err := normalizePermissions(defaults)
+	if err != nil {
+		return StateConfig{}, err
+	}
+
+	override := strings.TrimSpace(os.Getenv(stateDirEnvVar))
+	if override == "" {
+		override = strings.TrimSpace(configured)
+	}
+	if override != "" {
+		dir, err := resolvePath(override)
+		if err != nil {
+			return StateConfig{}, fmt.Errorf("state_dir: %w", err)
+		}
+		return StateConfig{Dir: dir, DataDir: dir, Permissions: perms}, nil
+	}
+
+	stateHome, err := xdgDir("XDG_STATE_HOME", ".local", "state")
+	if err != nil {
+		return StateConfig{}, err
+	}
+	dataHome, err := xdgDir("XDG_DATA_HOME", ".local", "share")
+	if err != nil {
+		return StateConfig{}, err
+	}
+	return StateConfig{
+		Dir:         filepath.Join(stateHome, "ghost"),
+		DataDir:     filepath.Join(dataHome, "ghost"),
+		Permissions: perms,
+	}, nil
+}
+
+func xdgDir(envVar string, fallback ...string) (string, error) {
+	if value := strings.TrimSpace(os.Getenv(envVar)); value != "" && filepath.IsAbs(value) {
+		return filepath.Clean(value), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home: %w", err)
+	}
+	return filepath.Join(append([]string{home}, fallback...)...), nil
+}
+
+func readStateConfig(configPath string) (StateConfig, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return normalizeState("", rawDefaults{})
+		}
+		return StateConfig{}, fmt.Errorf("read config: %w", err)
+	}
+	var raw rawConfig
+	if err := toml.Unmarshal(data, &raw); err != nil {
+		return StateConfig{}, fmt.Errorf("parse config: %w", err)
+	}
+	return normalizeState(raw.StateDir, raw.Defaults)
+}
+
+func loadCLIState() {
+	configPath, err := determineConfigPath()
+	if err != nil {
+		return
+	}
+	cfg, err := readStateConfig(configPath)
+	if err != nil {
+		return
+	}
+	setStateConfig(cfg)
+}
+
+func migrateLegacyState(cfg StateConfig, tracker WindowTrackerConfig) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+
+	legacyState := filepath.Join(home, ".local", "state", "ghost")
+	if legacyState != cfg.Dir {
+		for _, name := range []string{"audit.jsonl", "servers"} {
+			migrateStatePath(filepath.Join(legacyState, name), filepath.Join(cfg.Dir, name), cfg.Permissions)
+		}
+	}
+
+	legacyDB := filepath.Join(home, ".db", "ghost", "windows.sqlite")
+	if tracker.DBPath != "" && tracker.DBPath != legacyDB && tracker.DBPath == filepath.Join(cfg.DataDir, "windows.sqlite") {
+		if _, err := os.Stat(tracker.DBPath); errors.Is(err, os.ErrNotExist) {
+			for _, suffix := range []string{"", "-wal", "-shm"} {
+				migrateStatePath(legacyDB+suffix, tracker.DBPath+suffix, cfg.Permissions)
+			}
+		}
+	}
+}
+
+func migrateStatePath(from, to string, perms FilePermissions) {
+	if _, err := os.Lstat(from); err != nil {
+		return
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(to), perms.DirMode); err != nil {
+		logError("state migration: create %s: %v", filepath.Dir(to), err)
+		return
+	}
+	if err := os.Rename(from, to); err != nil {
+		logError("state migration: move %s → %s: %v", from, to, err)
+		return
+	}
+	logInfo("migrated %s → %s", from, to)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const stateDBName = "ghost.sqlite"
+
+// stateDBMode is the database's mode whatever file_mode says: the audit log
+// in it holds every job's argv and environment overrides.
+const stateDBMode os.FileMode = 0o600
+
+// The state database, <state dir>/ghost.sqlite, holds what ghost keeps
+// about itself: reload history, the audit log, the runtime snapshot, pending
+// one-shot jobs and the run history of every job. The window tracker's database stays separate since
+// it belongs to the user. The daemon keeps one handle open and every write
+// goes through withStateDB; CLI commands read with readStateDB.
+var stateStore struct {
+	mu   sync.Mutex
+	path string
+	db   *sql.DB
+}
+
+// stateMigrations bring the database up to date one step at a time; its
+// user_version counts the steps already applied. Only ever append.
+var stateMigrations = []func(tx *sql.Tx, dir string) error{
+	createStateTables,
+	createJobStateTable,
+}
+
+func stateDBPath() (string, error) {
+	dir := currentStateConfig().Dir
+	if dir == "" {
+		return "", errors.New("state directory is unavailable")
+	}
+	return filepath.Join(dir, stateDBName), nil
+}
+
+func openStateDB(readOnly bool) (*sql.DB, error) {
+	path, err := stateDBPath()
+	if err != nil {
+		return nil, err
+	}
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)"
+	if readOnly {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		dsn += "&mode=ro"
+	} else if err := os.MkdirAll(filepath.Dir(path), currentStateConfig().Permissions.DirMode); err != nil {
+		return nil, fmt.Errorf("create state directory: %w", err)
+	} else if err := createPrivateFile(path); err != nil {
+		return nil, fmt.Errorf("create state db: %w", err)
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open state db: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// createPrivateFile creates path with stateDBMode before SQLite opens it, so
+// the database is never readable by others, not even briefly. SQLite gives
+// its journal the same mode.
+func createPrivateFile(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, stateDBMode)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// withStateDB runs fn with the shared read-write handle, opening and
+// migrating the database first if needed (or again after state_dir moved).
+// Calls are serialized, so fn must not call withStateDB itself.
+func withStateDB(fn func(db *sql.DB) error) error {
+	stateStore.mu.Lock()
+	defer stateStore.mu.Unlock()
+	path, err := stateDBPath()
+	if err != nil {
+		return err
+	}
+	if stateStore.db == nil || stateStore.path != path {
+		if stateStore.db != nil {
+			_ = stateStore.db.Close()
+			stateStore.db = nil
+		}
+		db, err := openStateDB(false)
+		if err != nil {
+			return err
+		}
+		if err := migrateStateDB(db, filepath.Dir(path)); err != nil {
+			_ = db.Close()
+			return fmt.Errorf("migrate %s: %w", path, err)
+		}
+		if err := os.Chmod(path, stateDBMode); err != nil {
+			logWarn("state db: %v", err)
+		}
+		stateStore.db, stateStore.path = db, path
+	}
+	return fn(stateStore.db)
+}
+
+// readStateDB opens the database read-only for fn. A database that doesn't
+// exist yet is reported as os.ErrNotExist.
+func readStateDB(fn func(db *sql.DB) error) error {
+	db, err := openStateDB(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+// missingTable reports whether err comes from reading a table that a newer
+// ghost hasn't created yet; readers treat that like an empty table.
+func missingTable(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such table")
+}
+
+func migrateStateDB(db *sql.DB, dir string) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version == len(stateMigrations) {
+		return nil
+	}
+	if version > len(stateMigrations) {
+		return fmt.Errorf("written by a newer ghost (schema version %d, this one knows %d)", version, len(stateMigrations))
+	}
+	for version < len(stateMigrations) {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := stateMigrations[version](tx, dir); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("schema version %d: %w", version+1, err)
+		}
+		version++
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	retireLegacyStateFiles(dir)
+	return nil
+}
+
+// createStateTables is the first schema. reload_history predates the
+// versioning, so it may exist already; the rest replace JSON files that are
+// imported here.
+func createStateTables(tx *sql.Tx, dir string) error {
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS reload_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			reloaded_at TIMESTAMP NOT NULL,
+			reason TEXT NOT NULL,
+			config_path TEXT NOT NULL,
+			config_hash TEXT NOT NULL,
+			profile TEXT,
+			ok INTEGER NOT NULL,
+			error TEXT,
+			changes TEXT NOT NULL,
+			unchanged INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			logged_at TIMESTAMP NOT NULL,
+			event TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			job TEXT NOT NULL,
+			run_id TEXT,
+			entry TEXT NOT NULL
+		)`,
+		`CREATE INDEX audit_log_job ON audit_log (job, id)`,
+		`CREATE INDEX audit_log_run ON audit_log (run_id, id)`,
+		`CREATE TABLE runtime_snapshot (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			saved_at TIMESTAMP NOT NULL,
+			snapshot TEXT NOT NULL
+		)`,
+		`CREATE TABLE at_jobs (
+			id TEXT PRIMARY KEY,
+			run_at TIMESTAMP NOT NULL,
+			command TEXT NOT NULL,
+			display TEXT NOT NULL,
+			cwd TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE TABLE state_meta (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)`,
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return importLegacyState(tx, dir)
+}
+
+// legacyStateFiles are the files the state database replaced.
+var legacyStateFiles = []string{"audit.jsonl", snapshotFileName, atStoreFileName}
+
+func importLegacyState(tx *sql.Tx, dir string) error {
+	if err := importLegacyAudit(tx, filepath.Join(dir, "audit.jsonl")); err != nil {
+		return err
+	}
+	if snapshot, err := readSnapshotFile(filepath.Join(dir, snapshotFileName)); err == nil {
+		if err := storeSnapshot(tx, snapshot); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logWarn("not importing the runtime snapshot: %v", err)
+	}
+	if store, err := readAtStore(filepath.Join(dir, atStoreFileName)); err == nil {
+		if err := saveAtJobs(tx, store.NextID, store.Jobs); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logWarn("not importing one-shot jobs: %v", err)
+	}
+	return nil
+}
+
+func importLegacyAudit(tx *sql.Tx, path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if err := insertAuditEntry(tx, entry, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// retireLegacyStateFiles renames imported JSON files to *.imported, so they
+// aren't imported twice and can still be looked at.
+func retireLegacyStateFiles(dir string) {
+	for _, name := range legacyStateFiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := os.Rename(path, path+".imported"); err != nil {
+			logWarn("state db: %v", err)
+			continue
+		}
+		logInfo("imported %s into %s", path, stateDBName)
+	}
+}
+
+// sqlExecer is what both *sql.DB and *sql.Tx offer for writes.
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type statusReport struct {
+	Servers   []serverInfo   `json:"servers"`
+	Watchers  []watcherInfo  `json:"watchers"`
+	Schedules []scheduleInfo `json:"schedules"`
+	At        []atInfo       `json:"at"`
+}
+
+func runStatusCommand(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	formatValue := formatFlag(fs)
+	var labels stringList
+	fs.Var(&labels, "l", "only show jobs whose labels match, e.g. project=api (repeatable)")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("usage: ghost status [-l key=value] [-format table|json|yaml|csv]")
+	}
+	format, err := parseOutputFormat(*formatValue)
+	if err != nil {
+		return err
+	}
+
+	if _, err := parseLabelSelector(labels); err != nil {
+		return err
+	}
+	query := ""
+	if len(labels) > 0 {
+		query = "?" + url.Values{"label": labels}.Encode()
+	}
+
+	report := statusReport{Servers: []serverInfo{}, Watchers: []watcherInfo{}, Schedules: []scheduleInfo{}, At: []atInfo{}}
+	if err := controlRequest("GET", "/v1/servers"+query, nil, &report.Servers); err != nil {
+		return err
+	}
+	if err := controlRequest("GET", "/v1/watchers"+query, nil, &report.Watchers); err != nil {
+		return err
+	}
+	if err := controlRequest("GET", "/v1/schedules"+query, nil, &report.Schedules); err != nil {
+		return err
+	}
+	if len(labels) == 0 {
+		if err := controlRequest("GET", "/v1/at", nil, &report.At); err != nil {
+			return err
+		}
+	}
+	return writeOutput(os.Stdout, format, report, report.table)
+}
+
+func (r statusReport) table() outputTable {
+	table := outputTable{header: []string{"KIND", "NAME", "STATE", "PID", "LABELS", "DETAIL"}}
+	for _, server := range r.Servers {
+		var detail []string
+		if server.State == "running" {
+			if server.Ready {
+				detail = append(detail, "ready")
+			} else {
+				detail = append(detail, "not ready")
+			}
+		}
+		if server.Health != "" {
+			detail = append(detail, server.Health)
+		}
+		if server.WaitingFor != "" {
+			detail = append(detail, "waiting for "+server.WaitingFor)
+		}
+		if server.StandbyPID != 0 {
+			detail = append(detail, "standby pid "+strconv.Itoa(server.StandbyPID))
+		}
+		if server.State != "running" && server.LastStart != nil {
+			detail = append(detail, formatLastRun(*server.LastStart, server.LastResult))
+		}
+		if server.Restarts > 0 {
+			detail = append(detail, strconv.Itoa(server.Restarts)+" restart(s)")
+		}
+		table.rows = append(table.rows, []string{"server", server.Name, server.State, formatPID(server.PID), formatLabels(server.Labels), strings.Join(detail, ", ")})
+	}
+	for _, watcher := range r.Watchers {
+		detail := joinRoots(watcher.Root, watcher.Roots)
+		if watcher.State != "running" && watcher.LastRun != nil {
+			detail += ", " + formatLastRun(*watcher.LastRun, watcher.LastResult)
+		}
+		table.rows = append(table.rows, []string{"watcher", watcher.Name, watcher.State, formatPID(watcher.PID), formatLabels(watcher.Labels), detail})
+	}
+	for _, schedule := range r.Schedules {
+		detail := schedule.Schedule
+		if schedule.NextRun != nil {
+			detail += ", next " + schedule.NextRun.Local().Format(time.DateTime)
+		}
+		if schedule.LastResult != "" {
+			detail += ", last " + schedule.LastResult
+		}
+		table.rows = append(table.rows, []string{"schedule", schedule.Name, schedule.State, formatPID(schedule.PID), formatLabels(schedule.Labels), detail})
+	}
+	for _, job := range r.At {
+		detail := "at " + job.At.Local().Format(time.DateTime) + ", " + job.Command
+		table.rows = append(table.rows, []string{"at", job.ID, job.State, formatPID(job.PID), "", detail})
+	}
+	return table
+}
+
+// formatLastRun describes a job's last run for the status table.
+func formatLastRun(at time.Time, result string) string {
+	if result == "" {
+		result = "unfinished"
+	}
+	return "last " + result + " at " + at.Local().Format(time.DateTime)
+}
+
+func formatPID(pid int) string {
+	if pid == 0 {
+		return ""
+	}
+	return strconv.Itoa(pid)
+}
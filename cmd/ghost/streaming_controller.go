@@ -3,15 +3,23 @@ package main
 import (
 	"context"
 	"errors"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/andreykaipov/goobs"
+	obsevents "github.com/andreykaipov/goobs/api/events"
+	"github.com/andreykaipov/goobs/api/events/subscriptions"
 	"github.com/andreykaipov/goobs/api/requests/scenes"
 	"github.com/andreykaipov/goobs/api/requests/stream"
+	"github.com/nikiv/ghost/pkg/windows"
 )
 
+const obsResyncInterval = 30 * time.Second
+
+var streamingLog = componentLogger("streaming", "streaming:")
+
 type StreamingController struct {
 	mu     sync.Mutex
 	cfg    StreamingConfig
@@ -35,6 +43,13 @@ func (c *StreamingController) Apply(cfg StreamingConfig) error {
 		return nil
 	}
 
+	if !windows.Supported {
+		streamingLog.Warn("privacy monitor needs window enumeration, which is not supported on %s; streaming control disabled", runtime.GOOS)
+		c.stopLocked()
+		c.cfg = StreamingConfig{}
+		return nil
+	}
+
 	if c.cfg.active() && streamingConfigsEqual(c.cfg, cfg) {
 		return nil
 	}
@@ -59,7 +74,7 @@ func (c *StreamingController) startLocked(cfg StreamingConfig) error {
 	c.cancel = cancel
 	c.wg.Add(1)
 	go c.run(ctx, cfg)
-	logInfo("streaming monitor enabled (%d excluded app(s))", len(cfg.ExcludedApplications))
+	streamingLog.Info("monitor enabled (%d excluded app(s), %d title pattern(s), %d source rule(s))", len(cfg.ExcludedApplications), len(cfg.ExcludedTitles), len(cfg.Rules))
 	return nil
 }
 
@@ -76,14 +91,24 @@ func (c *StreamingController) run(ctx context.Context, cfg StreamingConfig) {
 
 	ticker := time.NewTicker(cfg.PollInterval)
 	defer ticker.Stop()
+	resync := time.NewTicker(obsResyncInterval)
+	defer resync.Stop()
 
 	var (
 		client       *goobs.Client
+		incoming     chan any
 		currentScene string
 		privacyOn    bool
+		rules        streamingRuleState
+		titles       = &windows.TitleResolver{TTL: cfg.PollInterval, Lookup: windows.AXTitle, Trusted: windows.AccessibilityTrusted}
 	)
 
 	reconnectDelay := 2 * time.Second
+	dropClient := func() bool {
+		disconnectOBS(client)
+		client, incoming = nil, nil
+		return waitForContext(ctx, reconnectDelay)
+	}
 
 	for {
 		if client == nil {
@@ -96,17 +121,19 @@ func (c *StreamingController) run(ctx context.Context, cfg StreamingConfig) {
 			var err error
 			client, err = c.connectOBS(cfg)
 			if err != nil {
-				logError("streaming: obs connect failed: %v", err)
+				streamingLog.Error("obs connect failed: %v", err)
 				if !waitForContext(ctx, reconnectDelay) {
 					return
 				}
 				continue
 			}
-			logInfo("streaming: connected to OBS at %s://%s", cfg.OBSScheme, cfg.OBSHost)
+			incoming = client.IncomingEvents
+			streamingLog.Info("connected to OBS at %s://%s", cfg.OBSScheme, cfg.OBSHost)
 			currentScene = ""
+			rules.reset()
 			if cfg.AutoStart {
 				if err := ensureStreamRunning(client); err != nil {
-					logError("streaming: failed to start stream: %v", err)
+					streamingLog.Error("failed to start stream: %v", err)
 				}
 			}
 		}
@@ -115,30 +142,89 @@ func (c *StreamingController) run(ctx context.Context, cfg StreamingConfig) {
 		case <-ctx.Done():
 			disconnectOBS(client)
 			return
+		case event, ok := <-incoming:
+			if !ok {
+				streamingLog.Warn("obs connection closed")
+				client, incoming = nil, nil
+				if !waitForContext(ctx, reconnectDelay) {
+					return
+				}
+				continue
+			}
+			switch event := event.(type) {
+			case *obsevents.CurrentProgramSceneChanged:
+				if event.SceneName == currentScene {
+					continue
+				}
+				if !privacyOn {
+					streamingLog.Info("scene switched to %s outside ghost", event.SceneName)
+					continue
+				}
+				if err := restorePrivacyScene(client, cfg, event.SceneName); err != nil {
+					streamingLog.Error("switch scene failed: %v", err)
+					if !dropClient() {
+						return
+					}
+				}
+			case *obsevents.SceneItemEnableStateChanged:
+				rules.sceneItemChanged(client, event.SceneName, event.SceneItemId, event.SceneItemEnabled)
+			case *obsevents.SourceFilterEnableStateChanged:
+				rules.filterChanged(client, event.SourceName, event.FilterName, event.FilterEnabled)
+			case *obsevents.StreamStateChanged:
+				streamingLog.Info("stream %s", strings.ToLower(strings.TrimPrefix(event.OutputState, "OBS_WEBSOCKET_OUTPUT_")))
+			case *obsevents.ExitStarted:
+				streamingLog.Info("OBS is exiting")
+				if !dropClient() {
+					return
+				}
+			}
+		case <-resync.C:
+			rules.enforce(client)
+			if !privacyOn {
+				continue
+			}
+			scene, err := currentProgramScene(client)
+			if err == nil && scene != cfg.PrivacyScene {
+				err = restorePrivacyScene(client, cfg, scene)
+			}
+			if err != nil {
+				streamingLog.Error("check scene failed: %v", err)
+				if !dropClient() {
+					return
+				}
+			}
 		case <-ticker.C:
-			privacyNeeded, offenders, err := evaluatePrivacy(cfg)
+			visible, err := visibleWindows(cfg)
 			if err != nil {
-				logError("streaming: window snapshot failed: %v", err)
+				streamingLog.Error("window snapshot failed: %v", err)
 				continue
 			}
+			now := time.Now()
+			titles.Prune(now)
+			apps := windowOwners(visible)
+			rules.update(client, cfg.Rules, apps)
+			offenders := append(cfg.offenders(apps), titleOffenders(cfg, titles, visible, now)...)
+			privacyNeeded := len(offenders) > 0
 			targetScene := cfg.LiveScene
 			if privacyNeeded {
 				targetScene = cfg.PrivacyScene
 			}
 			if currentScene != targetScene {
 				if err := switchScene(client, targetScene); err != nil {
-					logError("streaming: switch scene failed: %v", err)
+					streamingLog.Error("switch scene failed: %v", err)
 					disconnectOBS(client)
-					client = nil
+					client, incoming = nil, nil
 					continue
 				}
 				currentScene = targetScene
 				if privacyNeeded {
-					logInfo("streaming: privacy scene (%s)", strings.Join(offenders, ", "))
+					streamingLog.Info("privacy scene (%s)", strings.Join(offenders, ", "))
+					notifyWebhooks(webhookEvent{Event: "streaming.privacy", Message: strings.Join(offenders, ", ")})
 				} else if privacyOn {
-					logInfo("streaming: resumed %s", cfg.LiveScene)
+					streamingLog.Info("resumed %s", cfg.LiveScene)
+					notifyWebhooks(webhookEvent{Event: "streaming.live", Message: cfg.LiveScene})
 				} else {
-					logInfo("streaming: scene set to %s", cfg.LiveScene)
+					streamingLog.Info("scene set to %s", cfg.LiveScene)
 				}
 			}
 			privacyOn = privacyNeeded
@@ -147,7 +233,10 @@ func (c *StreamingController) run(ctx context.Context, cfg StreamingConfig) {
 }
 
 func (c *StreamingController) connectOBS(cfg StreamingConfig) (*goobs.Client, error) {
-	opts := []goobs.Option{goobs.WithScheme(cfg.OBSScheme)}
+	opts := []goobs.Option{
+		goobs.WithScheme(cfg.OBSScheme),
+		goobs.WithEventSubscriptions(subscriptions.General | subscriptions.Scenes | subscriptions.Outputs | subscriptions.SceneItems | subscriptions.Filters),
+	}
 	if cfg.OBSPassword != "" {
 		opts = append(opts, goobs.WithPassword(cfg.OBSPassword))
 	}
@@ -179,40 +268,69 @@ func switchScene(client *goobs.Client, scene string) error {
 	return err
 }
 
-func evaluatePrivacy(cfg StreamingConfig) (bool, []string, error) {
-	snapshots, err := captureWindowSnapshot()
+func currentProgramScene(client *goobs.Client) (string, error) {
+	if client == nil {
+		return "", errors.New("obs client is nil")
+	}
+	resp, err := client.Scenes.GetCurrentProgramScene(&scenes.GetCurrentProgramSceneParams{})
 	if err != nil {
-		return false, nil, err
+		return "", err
 	}
-	if len(cfg.ExcludedApplications) == 0 {
-		return false, nil, nil
+	if resp.SceneName != "" {
+		return resp.SceneName, nil
 	}
+	return resp.CurrentProgramSceneName, nil
+}
 
-	seen := make(map[string]struct{})
-	var offenders []string
-	var frontmost string
+func restorePrivacyScene(client *goobs.Client, cfg StreamingConfig, scene string) error {
+	streamingLog.Warn("scene switched to %s while privacy is needed; switching back to %s", scene, cfg.PrivacyScene)
+	return switchScene(client, cfg.PrivacyScene)
+}
+
+// visibleWindows lists the windows privacy_mode looks at: every one on
+// screen, or only the frontmost.
+func visibleWindows(cfg StreamingConfig) ([]windows.Window, error) {
+	snapshots, err := windows.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var visible []windows.Window
 	for _, snap := range snapshots {
-		if snap.layer != 0 || !snap.onScreen {
+		if snap.Layer != 0 || !snap.OnScreen {
 			continue
 		}
-		if frontmost == "" {
-			frontmost = snap.ownerName
-			if cfg.PrivacyMode == "frontmost" {
-				if cfg.excludesApp(frontmost) {
-					return true, []string{frontmost}, nil
-				}
-				return false, nil, nil
-			}
+		if cfg.PrivacyMode == "frontmost" {
+			return []windows.Window{snap}, nil
 		}
-		if cfg.excludesApp(snap.ownerName) {
-			name := snap.ownerName
-			if _, ok := seen[name]; !ok {
-				seen[name] = struct{}{}
-				offenders = append(offenders, name)
-			}
+		visible = append(visible, snap)
+	}
+	return visible, nil
+}
+
+// windowOwners returns the applications owning windows, each once.
+func windowOwners(visible []windows.Window) []string {
+	seen := make(map[string]struct{})
+	var apps []string
+	for _, win := range visible {
+		if _, ok := seen[win.Owner]; !ok {
+			seen[win.Owner] = struct{}{}
+			apps = append(apps, win.Owner)
+		}
+	}
+	return apps
+}
+
+// offenders returns the visible applications that call for the privacy
+// scene.
+func (s StreamingConfig) offenders(visible []string) []string {
+	var offenders []string
+	for _, app := range visible {
+		if s.excludesApp(app) {
+			offenders = append(offenders, app)
 		}
 	}
-	return len(offenders) > 0, offenders, nil
+	return offenders
 }
 
 func disconnectOBS(client *goobs.Client) {
@@ -220,7 +338,7 @@ func disconnectOBS(client *goobs.Client) {
 		return
 	}
 	if err := client.Disconnect(); err != nil {
-		logError("streaming: failed to disconnect OBS: %v", err)
+		streamingLog.Error("failed to disconnect OBS: %v", err)
 	}
 }
 
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/requests/filters"
+	"github.com/andreykaipov/goobs/api/requests/sceneitems"
+)
+
+type rawStreamingRule struct {
+	Applications any    `toml:"applications"`
+	Scene        string `toml:"scene"`
+	Source       string `toml:"source"`
+	Filter       string `toml:"filter"`
+}
+
+// StreamingRule hides one source, or turns on one of its filters, while any
+// of its applications is visible, instead of swapping the whole scene.
+type StreamingRule struct {
+	Applications []string
+	lookup       map[string]struct{}
+	Target       obsTarget
+}
+
+// obsTarget is what a rule acts on: the source in Scene when Filter is
+// empty, otherwise the filter on Source (in every scene that shows it).
+type obsTarget struct {
+	Scene  string
+	Source string
+	Filter string
+}
+
+func (t obsTarget) String() string {
+	if t.Filter != "" {
+		return fmt.Sprintf("filter %q on %q", t.Filter, t.Source)
+	}
+	return fmt.Sprintf("%q in %s", t.Source, t.Scene)
+}
+
+func normalizeStreamingRules(raw []rawStreamingRule, liveScene string) ([]StreamingRule, error) {
+	rules := make([]StreamingRule, 0, len(raw))
+	for i, item := range raw {
+		appsRaw, err := valueToStringSlice(item.Applications)
+		if err != nil {
+			return nil, fmt.Errorf("streaming.rules[%d].applications: %w", i, err)
+		}
+		apps := normalizeAppList(appsRaw)
+		if len(apps) == 0 {
+			return nil, fmt.Errorf("streaming.rules[%d]: applications is required", i)
+		}
+		target := obsTarget{
+			Scene:  strings.TrimSpace(item.Scene),
+			Source: strings.TrimSpace(item.Source),
+			Filter: strings.TrimSpace(item.Filter),
+		}
+		if target.Source == "" {
+			return nil, fmt.Errorf("streaming.rules[%d]: source is required", i)
+		}
+		switch {
+		case target.Filter != "" && target.Scene != "":
+			return nil, fmt.Errorf("streaming.rules[%d]: scene does not apply to a filter, which is set on the source itself", i)
+		case target.Filter == "" && target.Scene == "":
+			target.Scene = liveScene
+		}
+		rule := StreamingRule{Applications: apps, lookup: make(map[string]struct{}, len(apps)), Target: target}
+		for _, app := range apps {
+			rule.lookup[strings.ToLower(app)] = struct{}{}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func streamingRulesEqual(a, b []StreamingRule) bool {
+	return slices.EqualFunc(a, b, func(x, y StreamingRule) bool {
+		return x.Target == y.Target && stringSlicesEqual(x.Applications, y.Applications)
+	})
+}
+
+// matching returns the visible applications that set the rule off.
+func (r StreamingRule) matching(visible []string) []string {
+	var apps []string
+	for _, app := range visible {
+		if _, ok := r.lookup[strings.ToLower(strings.TrimSpace(app))]; ok {
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// streamingRuleState tracks which targets ghost has hidden or filtered on
+// the current OBS connection.
+type streamingRuleState struct {
+	applied map[obsTarget]bool
+	itemIDs map[obsTarget]int
+}
+
+// reset forgets what ghost changed, for a new connection. Targets whose
+// rules don't match then are left as OBS has them.
+func (s *streamingRuleState) reset() {
+	s.applied = make(map[obsTarget]bool)
+	s.itemIDs = make(map[obsTarget]int)
+}
+
+// update hides or filters every target one of whose rules matches a visible
+// application and puts the others back. Failures are logged and not retried
+// until the target's state has to change again, so a misspelled source does
+// not flood the log.
+func (s *streamingRuleState) update(client *goobs.Client, rules []StreamingRule, visible []string) {
+	wanted := make(map[obsTarget][]string)
+	var order []obsTarget
+	for _, rule := range rules {
+		if _, ok := wanted[rule.Target]; !ok {
+			order = append(order, rule.Target)
+			wanted[rule.Target] = nil
+		}
+		wanted[rule.Target] = append(wanted[rule.Target], rule.matching(visible)...)
+	}
+	for _, target := range order {
+		apps := wanted[target]
+		active := len(apps) > 0
+		applied := s.applied[target]
+		s.applied[target] = active
+		if applied == active {
+			continue
+		}
+		if err := s.set(client, target, active); err != nil {
+			streamingLog.Error("update %s: %v", target, err)
+			continue
+		}
+		if active {
+			slices.Sort(apps)
+			streamingLog.Info("%s %s (%s)", ruleVerb(target, true), target, strings.Join(slices.Compact(apps), ", "))
+		} else {
+			streamingLog.Info("%s %s", ruleVerb(target, false), target)
+		}
+	}
+}
+
+// enforce reapplies every active target, for the periodic resync.
+func (s *streamingRuleState) enforce(client *goobs.Client) {
+	for target, active := range s.applied {
+		if !active {
+			continue
+		}
+		if err := s.set(client, target, true); err != nil {
+			streamingLog.Error("update %s: %v", target, err)
+		}
+	}
+}
+
+// sceneItemChanged puts a hidden source back out of sight when it is
+// turned on in OBS while its rule is active.
+func (s *streamingRuleState) sceneItemChanged(client *goobs.Client, scene string, itemID int, enabled bool) {
+	if !enabled {
+		return
+	}
+	for target, active := range s.applied {
+		if !active || target.Filter != "" || target.Scene != scene {
+			continue
+		}
+		if id, ok := s.itemIDs[target]; !ok || id != itemID {
+			continue
+		}
+		streamingLog.Warn("%s was shown while its rule is active; hiding it again", target)
+		if err := s.set(client, target, true); err != nil {
+			streamingLog.Error("update %s: %v", target, err)
+		}
+	}
+}
+
+// filterChanged turns a rule's filter back on when it is disabled in OBS
+// while the rule is active.
+func (s *streamingRuleState) filterChanged(client *goobs.Client, source, filter string, enabled bool) {
+	target := obsTarget{Source: source, Filter: filter}
+	if enabled || !s.applied[target] {
+		return
+	}
+	streamingLog.Warn("%s was disabled while its rule is active; enabling it again", target)
+	if err := s.set(client, target, true); err != nil {
+		streamingLog.Error("update %s: %v", target, err)
+	}
+}
+
+// set puts target into its active state (source hidden, filter on) or back.
+func (s *streamingRuleState) set(client *goobs.Client, target obsTarget, active bool) error {
+	if client == nil {
+		return errors.New("obs client is nil")
+	}
+	if target.Filter != "" {
+		_, err := client.Filters.SetSourceFilterEnabled(
+			filters.NewSetSourceFilterEnabledParams().
+				WithSourceName(target.Source).
+				WithFilterName(target.Filter).
+				WithFilterEnabled(active),
+		)
+		return err
+	}
+	id, ok := s.itemIDs[target]
+	if !ok {
+		resp, err := client.SceneItems.GetSceneItemId(
+			sceneitems.NewGetSceneItemIdParams().WithSceneName(target.Scene).WithSourceName(target.Source),
+		)
+		if err != nil {
+			return err
+		}
+		id = resp.SceneItemId
+		s.itemIDs[target] = id
+	}
+	_, err := client.SceneItems.SetSceneItemEnabled(
+		sceneitems.NewSetSceneItemEnabledParams().
+			WithSceneName(target.Scene).
+			WithSceneItemId(id).
+			WithSceneItemEnabled(!active),
+	)
+	return err
+}
+
+func ruleVerb(target obsTarget, active bool) string {
+	switch {
+	case target.Filter != "" && active:
+		return "enabled"
+	case target.Filter != "":
+		return "disabled"
+	case active:
+		return "hid"
+	default:
+		return "showed"
+	}
+}
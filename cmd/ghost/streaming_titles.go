@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikiv/ghost/pkg/windows"
+)
+
+type rawTitleExclusion struct {
+	Pattern      string `toml:"pattern"`
+	Applications any    `toml:"applications"`
+}
+
+// TitleExclusion calls for the privacy scene while a window whose title
+// matches Pattern is visible, optionally only for some applications, so a
+// browser can be streamed until it shows Gmail.
+type TitleExclusion struct {
+	Pattern      *regexp.Regexp
+	Applications []string
+	lookup       map[string]struct{}
+}
+
+func normalizeTitleExclusions(raw []rawTitleExclusion) ([]TitleExclusion, error) {
+	exclusions := make([]TitleExclusion, 0, len(raw))
+	for i, item := range raw {
+		pattern := strings.TrimSpace(item.Pattern)
+		if pattern == "" {
+			return nil, fmt.Errorf("streaming.exclude_titles[%d]: pattern is required", i)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("streaming.exclude_titles[%d].pattern: %w", i, err)
+		}
+		appsRaw, err := valueToStringSlice(item.Applications)
+		if err != nil {
+			return nil, fmt.Errorf("streaming.exclude_titles[%d].applications: %w", i, err)
+		}
+		exclusion := TitleExclusion{Pattern: re, Applications: normalizeAppList(appsRaw)}
+		if len(exclusion.Applications) > 0 {
+			exclusion.lookup = make(map[string]struct{}, len(exclusion.Applications))
+			for _, app := range exclusion.Applications {
+				exclusion.lookup[strings.ToLower(app)] = struct{}{}
+			}
+		}
+		exclusions = append(exclusions, exclusion)
+	}
+	return exclusions, nil
+}
+
+func titleExclusionsEqual(a, b []TitleExclusion) bool {
+	return slices.EqualFunc(a, b, func(x, y TitleExclusion) bool {
+		return x.Pattern.String() == y.Pattern.String() && stringSlicesEqual(x.Applications, y.Applications)
+	})
+}
+
+// covers reports whether the exclusion looks at windows of app.
+func (e TitleExclusion) covers(app string) bool {
+	if e.lookup == nil {
+		return true
+	}
+	_, ok := e.lookup[strings.ToLower(strings.TrimSpace(app))]
+	return ok
+}
+
+// titleOffenders checks the titles of the visible windows against the
+// title exclusions. Offenders are named by application and pattern, never
+// by title, since the title is what must not leak into logs and webhooks.
+func titleOffenders(cfg StreamingConfig, titles *windows.TitleResolver, visible []windows.Window, now time.Time) []string {
+	if len(cfg.ExcludedTitles) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{})
+	var offenders []string
+	for _, win := range visible {
+		var title string
+		resolved := false
+		for _, exclusion := range cfg.ExcludedTitles {
+			if !exclusion.covers(win.Owner) {
+				continue
+			}
+			if !resolved {
+				var source windows.TitleSource
+				if title, source = titles.Resolve(win, now); source == windows.TitleFromApp {
+					title = "" // no title available, only the app name
+				}
+				resolved = true
+			}
+			if title == "" || !exclusion.Pattern.MatchString(title) {
+				continue
+			}
+			name := fmt.Sprintf("%s (title matches %q)", win.Owner, exclusion.Pattern)
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				offenders = append(offenders, name)
+			}
+			break
+		}
+	}
+	return offenders
+}
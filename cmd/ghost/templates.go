@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+var templateParam = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+type jobTemplate struct {
+	name   string
+	fields map[string]any
+	params map[string]any
+}
+
+func expandTemplates(raw *rawConfig, sources []configSource) ([]WatcherSetConfig, error) {
+	uses := false
+	for _, watcher := range raw.Watchers {
+		uses = uses || watcher.Template != ""
+	}
+	for _, server := range raw.Servers {
+		uses = uses || server.Template != ""
+	}
+	if !uses && len(raw.Templates) == 0 && len(raw.WatcherSets) == 0 {
+		return nil, nil
+	}
+
+	var errs configcheck.Errors
+	templates := make(map[string]jobTemplate, len(raw.Templates))
+	for i, fields := range raw.Templates {
+		template, err := newJobTemplate(fields)
+		if err != nil {
+			errs.Add(fmt.Errorf("templates[%d]: %w", i, err))
+			continue
+		}
+		if _, exists := templates[template.name]; exists {
+			errs.Add(fmt.Errorf("templates[%d]: name %q is already used by another template", i, template.name))
+			continue
+		}
+		templates[template.name] = template
+	}
+	if !uses {
+		sets := expandWatcherSets(raw, templates, &errs)
+		return sets, errs.Err()
+	}
+
+	var watchers, servers []map[string]any
+	for _, source := range sources {
+		var doc struct {
+			Watchers []map[string]any `toml:"watchers"`
+			Servers  []map[string]any `toml:"servers"`
+		}
+		if err := toml.Unmarshal(source.data, &doc); err != nil {
+			return nil, fmt.Errorf("parse config: %w", err)
+		}
+		watchers = append(watchers, doc.Watchers...)
+		servers = append(servers, doc.Servers...)
+	}
+
+	for i := range raw.Watchers {
+		if raw.Watchers[i].Template == "" || i >= len(watchers) {
+			continue
+		}
+		expanded, err := instantiateTemplate(templates, watchers[i])
+		if err == nil {
+			var watcher rawWatcher
+			if err = decodeExpanded(expanded, &watcher); err == nil {
+				raw.Watchers[i] = watcher
+			}
+		}
+		if err != nil {
+			errs.Add(fmt.Errorf("watchers[%d]: %w", i, err))
+		}
+	}
+	for i := range raw.Servers {
+		if raw.Servers[i].Template == "" || i >= len(servers) {
+			continue
+		}
+		expanded, err := instantiateTemplate(templates, servers[i])
+		if err == nil {
+			var server rawServer
+			if err = decodeExpanded(expanded, &server); err == nil {
+				raw.Servers[i] = server
+			}
+		}
+		if err != nil {
+			errs.Add(fmt.Errorf("servers[%d]: %w", i, err))
+		}
+	}
+	sets := expandWatcherSets(raw, templates, &errs)
+	return sets, errs.Err()
+}
+
+func newJobTemplate(fields map[string]any) (jobTemplate, error) {
+	name, _ := fields["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return jobTemplate{}, errors.New("name is required")
+	}
+	if _, nested := fields["template"]; nested {
+		return jobTemplate{}, errors.New("template: a template cannot be based on another template")
+	}
+	template := jobTemplate{name: name, fields: make(map[string]any, len(fields))}
+	for key, value := range fields {
+		switch key {
+		case "name":
+		case "params":
+			params, ok := value.(map[string]any)
+			if !ok {
+				return jobTemplate{}, errors.New("params: must be a table of default values")
+			}
+			template.params = params
+		default:
+			template.fields[key] = value
+		}
+	}
+	return template, nil
+}
+
+func instantiateTemplate(templates map[string]jobTemplate, instance map[string]any) (map[string]any, error) {
+	name, _ := instance["template"].(string)
+	template, ok := templates[strings.TrimSpace(name)]
+	if !ok {
+		known := make([]string, 0, len(templates))
+		for key := range templates {
+			known = append(known, key)
+		}
+		sort.Strings(known)
+		if len(known) == 0 {
+			return nil, fmt.Errorf("template: unknown template %q (no [[templates]] are defined)", name)
+		}
+		return nil, fmt.Errorf("template: unknown template %q (defined: %s)", name, strings.Join(known, ", "))
+	}
+
+	params := make(map[string]any, len(template.params)+1)
+	for key, value := range template.params {
+		params[key] = value
+	}
+	if value, ok := instance["params"]; ok {
+		given, ok := value.(map[string]any)
+		if !ok {
+			return nil, errors.New("params: must be a table, e.g. params = { dir = \"api\" }")
+		}
+		for key, value := range given {
+			params[key] = value
+		}
+	}
+	if jobName, ok := instance["name"].(string); ok {
+		if _, set := params["name"]; !set {
+			params["name"] = jobName
+		}
+	}
+
+	merged := mergeTemplateFields(template.fields, instance)
+	delete(merged, "template")
+	delete(merged, "params")
+	expanded, err := expandTemplateValue(merged, params)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %w", template.name, err)
+	}
+	return expanded.(map[string]any), nil
+}
+
+func mergeTemplateFields(base, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseTable, baseIsTable := merged[key].(map[string]any)
+		table, isTable := value.(map[string]any)
+		if baseIsTable && isTable {
+			merged[key] = mergeTemplateFields(baseTable, table)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+func expandTemplateValue(value any, params map[string]any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if match := templateParam.FindStringSubmatch(v); match != nil && match[0] == v {
+			param, ok := params[match[1]]
+			if !ok {
+				return nil, fmt.Errorf("{{%s}} has no value (set params.%s)", match[1], match[1])
+			}
+			return param, nil
+		}
+		var missing string
+		expanded := templateParam.ReplaceAllStringFunc(v, func(placeholder string) string {
+			key := templateParam.FindStringSubmatch(placeholder)[1]
+			param, ok := params[key]
+			if !ok {
+				if missing == "" {
+					missing = key
+				}
+				return placeholder
+			}
+			if str, ok := param.(string); ok {
+				return str
+			}
+			return fmt.Sprint(param)
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("{{%s}} has no value (set params.%s)", missing, missing)
+		}
+		return expanded, nil
+	case []any:
+		expanded := make([]any, len(v))
+		for i, item := range v {
+			value, err := expandTemplateValue(item, params)
+			if err != nil {
+				return nil, err
+			}
+			expanded[i] = value
+		}
+		return expanded, nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		expanded := make(map[string]any, len(v))
+		for _, key := range keys {
+			value, err := expandTemplateValue(v[key], params)
+			if err != nil {
+				return nil, err
+			}
+			expanded[key] = value
+		}
+		return expanded, nil
+	}
+	return value, nil
+}
+
+func decodeExpanded(fields map[string]any, out any) error {
+	data, err := toml.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return toml.Unmarshal(data, out)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultTransformTimeout = 10 * time.Second
+
+type transformTrigger struct {
+	Event string `json:"event"`
+	Path  string `json:"path,omitempty"`
+	Root  string `json:"root,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+func (w NormalizedWatcher) transformTriggers(triggers []Trigger) ([]Trigger, error) {
+	input := make([]transformTrigger, 0, len(triggers))
+	for _, trigger := range triggers {
+		input = append(input, transformTrigger{Event: trigger.Event, Path: trigger.Path, Root: trigger.Root, Group: trigger.Group})
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if w.TransformTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.TransformTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, w.Transform[0], w.Transform[1:]...)
+	cmd.Dir = w.Cwd
+	cmd.Env = buildEnvList(w.RunAs.env(w.Env))
+	setRunAs(cmd, w.RunAs)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	forward := newOutputForwarder(w.Name, w.Secrets)
+	_, cmd.Stderr = forward.wrap(io.Discard, os.Stderr)
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+	forward.Flush()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("timed out after %s", w.TransformTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w.parseTransformOutput(stdout.String())
+}
+
+func (w NormalizedWatcher) parseTransformOutput(output string) ([]Trigger, error) {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return nil, nil
+	}
+
+	var entries []transformTrigger
+	if strings.HasPrefix(output, "[") {
+		if err := json.Unmarshal([]byte(output), &entries); err != nil {
+			return nil, fmt.Errorf("decode output: %w", err)
+		}
+	} else {
+		for _, line := range strings.Split(output, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				entries = append(entries, transformTrigger{Event: "change", Path: line})
+			}
+		}
+	}
+
+	result := make([]Trigger, 0, len(entries))
+	for _, entry := range entries {
+		trigger := Trigger{Event: strings.TrimSpace(entry.Event), Group: entry.Group}
+		if trigger.Event == "" {
+			trigger.Event = "change"
+		}
+		if entry.Path != "" {
+			rel := entry.Path
+			if filepath.IsAbs(rel) {
+				root, inside, ok := w.locate(rel)
+				if !ok {
+					return nil, fmt.Errorf("path %s is outside %s", entry.Path, joinRoots(w.WatchRoot, w.Roots))
+				}
+				rel, trigger.Root = inside, w.triggerRoot(root)
+			} else if entry.Root != "" {
+				root := filepath.Clean(entry.Root)
+				if !containsString(w.Roots, root) {
+					return nil, fmt.Errorf("root %s is not one of the watcher's paths", entry.Root)
+				}
+				trigger.Root = w.triggerRoot(root)
+			}
+			trigger.Path = posixPath(filepath.Clean(rel))
+		}
+		result = append(result, trigger)
+	}
+	return result, nil
+}
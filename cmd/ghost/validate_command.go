@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+)
+
+func runValidateCommand(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	raw := fs.Bool("json", false, "print the errors as JSON")
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) > 1 {
+		return errors.New("usage: ghost validate [config] [-json]")
+	}
+
+	var configPath string
+	if len(paths) == 1 {
+		configPath, err = resolvePath(paths[0])
+	} else {
+		configPath, err = determineConfigPath()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = readConfig(configPath)
+	var errs configcheck.Errors
+	if err != nil && !errors.As(err, &errs) {
+		return err
+	}
+	if *raw {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(append(configcheck.Errors{}, errs...)); err != nil {
+			return err
+		}
+	} else if len(errs) == 0 {
+		fmt.Printf("%s: ok\n", configPath)
+	} else {
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d error(s) in %s", len(errs), configPath)
+	}
+	return nil
+}
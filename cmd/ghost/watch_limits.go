@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+func isWatchLimitError(err error) bool {
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "no space left on device") || strings.Contains(message, "too many open files")
+}
+
+func isWatchUnsupportedError(err error) bool {
+	if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "not supported") || strings.Contains(message, "not implemented")
+}
+
+func watchLimitError(pattern string, err error) error {
+	hint := watchLimitHint()
+	if hint == "" {
+		return fmt.Errorf("watch %s: %s limit reached: %w", pattern, notifyBackend(), err)
+	}
+	return fmt.Errorf("watch %s: %s limit reached: %w (%s)", pattern, notifyBackend(), err, hint)
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func watchLimitHint() string {
+	var limits []string
+	for _, name := range []string{"max_user_watches", "max_user_instances"} {
+		data, err := os.ReadFile("/proc/sys/fs/inotify/" + name)
+		if err != nil {
+			continue
+		}
+		limits = append(limits, fmt.Sprintf("fs.inotify.%s = %s", name, strings.TrimSpace(string(data))))
+	}
+	if len(limits) == 0 {
+		return ""
+	}
+	return strings.Join(limits, ", ") + "; raise them with sysctl, e.g. sysctl fs.inotify.max_user_watches=524288"
+}
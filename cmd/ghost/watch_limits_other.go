@@ -0,0 +1,16 @@
+//go:build unix && !linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func watchLimitHint() string {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("open file limit %d, hard limit %d; raise it with ulimit -n or kern.maxfiles", limit.Cur, limit.Max)
+}
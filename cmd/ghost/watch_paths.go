@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	windowsLongPathPrefix = `\\?\`
+	windowsLongUNCPrefix  = `\\?\UNC\`
+)
+
+func defaultCaseSensitive() bool {
+	return runtime.GOOS != "windows"
+}
+
+func relativeWatchPath(root, path string) (string, bool) {
+	return relativePathFor(runtime.GOOS, root, path)
+}
+
+func relativePathFor(goos, root, path string) (string, bool) {
+	if path == "" || root == "" {
+		return "", false
+	}
+	if goos == "windows" {
+		root = normalizeWindowsPath(root)
+		path = normalizeWindowsPath(path)
+		if !strings.EqualFold(windowsVolume(root), windowsVolume(path)) {
+			return "", false
+		}
+		rootLower := strings.ToLower(root)
+		pathLower := strings.ToLower(path)
+		if pathLower == rootLower {
+			return ".", true
+		}
+		prefix := strings.TrimSuffix(rootLower, `\`) + `\`
+		if !strings.HasPrefix(pathLower, prefix) {
+			return "", false
+		}
+		return strings.ReplaceAll(path[len(prefix):], `\`, "/"), true
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", false
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return posixPath(rel), true
+}
+
+// normalizeWindowsPath brings a Windows path to one spelling: backslashes,
+// no \\?\ prefix (\\?\UNC\ becomes the \\ of a UNC path), no doubled
+// separators past the leading \\ of a UNC path, and no trailing separator
+// except on a drive root.
+func normalizeWindowsPath(path string) string {
+	path = strings.ReplaceAll(path, "/", `\`)
+	switch {
+	case len(path) >= len(windowsLongUNCPrefix) && strings.EqualFold(path[:len(windowsLongUNCPrefix)], windowsLongUNCPrefix):
+		path = `\\` + path[len(windowsLongUNCPrefix):]
+	case strings.HasPrefix(path, windowsLongPathPrefix):
+		path = path[len(windowsLongPathPrefix):]
+	}
+	unc := strings.HasPrefix(path, `\\`)
+	for strings.Contains(path, `\\`) {
+		path = strings.ReplaceAll(path, `\\`, `\`)
+	}
+	if unc {
+		path = `\` + path
+	}
+	if len(path) > 3 {
+		path = strings.TrimSuffix(path, `\`)
+	}
+	return path
+}
+
+// windowsVolume returns the drive ("C:") or UNC share (\\server\share) a
+// normalized path is on, or "" for a relative path.
+func windowsVolume(path string) string {
+	if len(path) >= 2 && path[1] == ':' {
+		return path[:2]
+	}
+	if !strings.HasPrefix(path, `\\`) {
+		return ""
+	}
+	parts := strings.SplitN(path[2:], `\`, 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return ""
+	}
+	return `\\` + parts[0] + `\` + parts[1]
+}
+
+func normalizeMatchPattern(pattern, watchRoot string) string {
+	return normalizeMatchPatternFor(runtime.GOOS, pattern, watchRoot)
+}
+
+func normalizeMatchPatternFor(goos, pattern, watchRoot string) string {
+	if goos == "windows" {
+		if windowsVolume(normalizeWindowsPath(pattern)) != "" {
+			if rel, ok := relativePathFor(goos, watchRoot, pattern); ok {
+				return rel
+			}
+		}
+		return strings.ReplaceAll(pattern, `\`, "/")
+	}
+	if strings.HasPrefix(pattern, "/") && watchRoot != "" {
+		if rel, ok := relativePathFor(goos, watchRoot, pattern); ok {
+			return rel
+		}
+	}
+	return pattern
+}
+
+func watchRoots(watchRoot, singleFile string, rest []string) ([]string, error) {
+	roots := []string{watchRoot}
+	if len(rest) == 0 {
+		return roots, nil
+	}
+	if singleFile != "" {
+		return nil, fmt.Errorf("path: %s is a file; a watcher with several paths only watches directories", filepath.Join(watchRoot, singleFile))
+	}
+	for _, value := range rest {
+		root, err := resolvePath(value)
+		if err != nil {
+			return nil, fmt.Errorf("resolve path: %w", err)
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("path: %s is not a directory; a watcher with several paths only watches directories", root)
+		}
+		for _, other := range roots {
+			if rel, ok := relativeWatchPath(other, root); ok {
+				if rel == "." {
+					return nil, fmt.Errorf("path: %s is listed twice", root)
+				}
+				return nil, fmt.Errorf("path: %s is inside %s", root, other)
+			}
+			if _, ok := relativeWatchPath(root, other); ok {
+				return nil, fmt.Errorf("path: %s is inside %s", other, root)
+			}
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+func (w NormalizedWatcher) locate(path string) (string, string, bool) {
+	for _, root := range w.Roots {
+		if rel, ok := relativeWatchPath(root, path); ok {
+			return root, rel, true
+		}
+	}
+	rel, ok := relativeWatchPath(w.WatchRoot, path)
+	return w.WatchRoot, rel, ok
+}
+
+func (w NormalizedWatcher) triggerRoot(root string) string {
+	if root == w.WatchRoot {
+		return ""
+	}
+	return root
+}
+
+func multipleRoots(roots []string) []string {
+	if len(roots) > 1 {
+		return roots
+	}
+	return nil
+}
+
+func joinRoots(root string, roots []string) string {
+	if len(roots) > 1 {
+		return strings.Join(roots, ", ")
+	}
+	return root
+}
+
+func (t Trigger) absPath(root string) string {
+	if t.Root != "" {
+		root = t.Root
+	}
+	return filepath.Join(root, filepath.FromSlash(t.Path))
+}
+
+func (t Trigger) displayPath() string {
+	if t.Root == "" || t.Path == "" {
+		return t.Path
+	}
+	return path.Join(posixPath(filepath.Base(t.Root)), t.Path)
+}
+
+type watchSubscription struct {
+	dir       string
+	recursive bool
+}
+
+func (s watchSubscription) pattern() string {
+	if s.recursive {
+		return filepath.Join(s.dir, "...")
+	}
+	return s.dir
+}
+
+func effectiveWatchPatterns(watchRoot string, matchers []matcher) []string {
+	everything := []string{watchSubscription{dir: watchRoot, recursive: true}.pattern()}
+	if len(matchers) == 0 {
+		return everything
+	}
+
+	subscriptions := make([]watchSubscription, 0, len(matchers))
+	for _, matcher := range matchers {
+		if defaultCaseSensitive() && strings.HasPrefix(matcher.re.String(), "(?i)") {
+			return everything
+		}
+		dir, recursive, ok := literalMatchPrefix(normalizeMatchPattern(matcher.raw, watchRoot))
+		if !ok {
+			return everything
+		}
+		subscription := watchSubscription{dir: filepath.Join(watchRoot, filepath.FromSlash(dir)), recursive: recursive}
+		for subscription.dir != watchRoot {
+			if info, err := os.Stat(subscription.dir); err == nil && info.IsDir() {
+				break
+			}
+			subscription = watchSubscription{dir: filepath.Dir(subscription.dir), recursive: true}
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].dir != subscriptions[j].dir {
+			return subscriptions[i].dir < subscriptions[j].dir
+		}
+		return subscriptions[i].recursive && !subscriptions[j].recursive
+	})
+	var kept []watchSubscription
+	for _, subscription := range subscriptions {
+		covered := false
+		for _, other := range kept {
+			if other.dir == subscription.dir && (other.recursive || !subscription.recursive) {
+				covered = true
+				break
+			}
+			if rel, ok := relativeWatchPath(other.dir, subscription.dir); ok && rel != "." && other.recursive {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, subscription)
+		}
+	}
+
+	patterns := make([]string, 0, len(kept))
+	for _, subscription := range kept {
+		patterns = append(patterns, subscription.pattern())
+	}
+	return patterns
+}
+
+func effectiveRootPatterns(roots []string, matchers []matcher) []string {
+	var patterns []string
+	for _, root := range roots {
+		patterns = append(patterns, effectiveWatchPatterns(root, matchers)...)
+	}
+	return patterns
+}
+
+func literalMatchPrefix(pattern string) (string, bool, bool) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || strings.HasPrefix(pattern, "/") || windowsVolume(pattern) != "" {
+		return "", false, false
+	}
+	segments := strings.Split(path.Clean(pattern), "/")
+	for i, segment := range segments {
+		if segment == ".." {
+			return "", false, false
+		}
+		if !strings.ContainsAny(segment, "*?") {
+			continue
+		}
+		recursive := i < len(segments)-1 || strings.Contains(segment, "**")
+		return path.Join(append([]string{"."}, segments[:i]...)...), recursive, true
+	}
+	return path.Dir(path.Clean(pattern)), false, true
+}
@@ -0,0 +1,136 @@
+package main
+
+import "testing"
+
+func TestRelativePathForWindows(t *testing.T) {
+	tests := []struct {
+		name, root, path string
+		want             string
+		ok               bool
+	}{
+		{"same dir", `C:\src\app`, `C:\src\app`, ".", true},
+		{"child", `C:\src\app`, `C:\src\app\main.go`, "main.go", true},
+		{"nested", `C:\src\app`, `C:\src\app\pkg\util\x.go`, "pkg/util/x.go", true},
+		{"drive letter case", `c:\src\app`, `C:\src\app\main.go`, "main.go", true},
+		{"folded case keeps event spelling", `C:\Src\App`, `c:\src\app\Pkg\Main.go`, "Pkg/Main.go", true},
+		{"trailing separator on root", `C:\src\app\`, `C:\src\app\main.go`, "main.go", true},
+		{"drive root", `C:\`, `C:\src\main.go`, "src/main.go", true},
+		{"mixed separators", `C:/src/app`, `C:\src\app/pkg\x.go`, "pkg/x.go", true},
+		{"doubled separators", `C:\src\\app`, `C:\src\app\\pkg\x.go`, "pkg/x.go", true},
+		{"long path prefix", `C:\src\app`, `\\?\C:\src\app\main.go`, "main.go", true},
+		{"other drive", `C:\src\app`, `D:\src\app\main.go`, "", false},
+		{"sibling with common prefix", `C:\src\app`, `C:\src\apple\main.go`, "", false},
+		{"parent", `C:\src\app`, `C:\src`, "", false},
+		{"unc", `\\server\share\app`, `\\server\share\app\main.go`, "main.go", true},
+		{"unc share root", `\\server\share`, `\\server\share\app\main.go`, "app/main.go", true},
+		{"unc case folding", `\\SERVER\Share\app`, `\\server\share\App\Main.go`, "Main.go", true},
+		{"unc forward slashes", `//server/share/app`, `\\server\share\app\main.go`, "main.go", true},
+		{"long unc prefix", `\\server\share\app`, `\\?\UNC\server\share\app\main.go`, "main.go", true},
+		{"long unc root", `\\?\UNC\server\share\app`, `\\server\share\app\x\y.go`, "x/y.go", true},
+		{"other share", `\\server\share\app`, `\\server\other\app\main.go`, "", false},
+		{"unc against drive", `\\server\share\app`, `C:\share\app\main.go`, "", false},
+		{"empty path", `C:\src`, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := relativePathFor("windows", tt.root, tt.path)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("relativePathFor(%q, %q) = %q, %v; want %q, %v", tt.root, tt.path, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRelativePathForPosix(t *testing.T) {
+	tests := []struct {
+		root, path string
+		want       string
+		ok         bool
+	}{
+		{"/src/app", "/src/app", ".", true},
+		{"/src/app", "/src/app/pkg/x.go", "pkg/x.go", true},
+		{"/src/app", "/src/apple/x.go", "", false},
+		{"/src/app", "/src", "", false},
+		{"/src/App", "/src/app/x.go", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := relativePathFor("linux", tt.root, tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("relativePathFor(%q, %q) = %q, %v; want %q, %v", tt.root, tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeWindowsPath(t *testing.T) {
+	tests := map[string]string{
+		`C:\src\app`:                  `C:\src\app`,
+		`C:\src\app\`:                 `C:\src\app`,
+		`C:\`:                         `C:\`,
+		`C:/src//app/`:                `C:\src\app`,
+		`\\?\C:\src\app`:              `C:\src\app`,
+		`\\server\share\x`:            `\\server\share\x`,
+		`\\server\share\\x\`:          `\\server\share\x`,
+		`//server/share/x`:            `\\server\share\x`,
+		`\\?\UNC\server\share\x`:      `\\server\share\x`,
+		`\\?\unc\server\share`:        `\\server\share`,
+		`relative\dir\..\file.go`:     `relative\dir\..\file.go`,
+		`relative//dir/with/mixed\\x`: `relative\dir\with\mixed\x`,
+	}
+	for in, want := range tests {
+		if got := normalizeWindowsPath(in); got != want {
+			t.Errorf("normalizeWindowsPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeMatchPatternFor(t *testing.T) {
+	tests := []struct {
+		name, goos, pattern, root string
+		want                      string
+	}{
+		{"windows relative glob", "windows", `src\**\*.go`, `C:\app`, "src/**/*.go"},
+		{"windows forward slashes", "windows", "src/**/*.go", `C:\app`, "src/**/*.go"},
+		{"windows absolute under root", "windows", `C:\app\src\*.go`, `C:\app`, "src/*.go"},
+		{"windows absolute drive case", "windows", `c:\APP\src\*.go`, `C:\app`, "src/*.go"},
+		{"windows absolute mixed separators", "windows", `C:/app\src/*.go`, `C:\app`, "src/*.go"},
+		{"windows long path", "windows", `\\?\C:\app\src\*.go`, `C:\app`, "src/*.go"},
+		{"windows unc under root", "windows", `\\server\share\app\src\*.go`, `\\server\share\app`, "src/*.go"},
+		{"windows long unc under root", "windows", `\\?\UNC\server\share\app\*.go`, `\\server\share\app`, "*.go"},
+		{"windows absolute outside root", "windows", `D:\other\*.go`, `C:\app`, "D:/other/*.go"},
+		{"posix relative", "linux", "src/**/*.go", "/app", "src/**/*.go"},
+		{"posix absolute under root", "linux", "/app/src/*.go", "/app", "src/*.go"},
+		{"posix absolute outside root", "linux", "/other/*.go", "/app", "/other/*.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeMatchPatternFor(tt.goos, tt.pattern, tt.root); got != tt.want {
+				t.Errorf("normalizeMatchPatternFor(%q, %q, %q) = %q, want %q", tt.goos, tt.pattern, tt.root, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoubleStarSlashMatchesTopLevel(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/ghost/main.go", true},
+		{"**/*.go", "main.txt", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "srcmain.go", false},
+		{"src/**", "src/a/b", true},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.pattern, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
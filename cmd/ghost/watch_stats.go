@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	outcomeMatched     = "matched"
+	outcomeUnmatched   = "no matching pattern"
+	outcomeIgnored     = "matches an ignore pattern"
+	outcomeGitignored  = "matches .gitignore"
+	outcomeFiltered    = "event type not watched"
+	outcomeOutsideRoot = "outside root"
+	outcomeWarmup      = "during warm-up"
+	outcomePaused      = "while paused"
+)
+
+type watchStats struct {
+	rootInfo    os.FileInfo
+	events      int64
+	matched     int64
+	unmatched   int64
+	ignored     int64
+	filtered    int64
+	outsideRoot int64
+	warmup      int64
+	paused      int64
+	lastEvent   *watchEventInfo
+	lastMatch   *watchEventInfo
+}
+
+type watchEventInfo struct {
+	Time    time.Time `json:"time"`
+	Events  []string  `json:"events"`
+	Path    string    `json:"path"`
+	Outcome string    `json:"outcome"`
+}
+
+type watchDebugInfo struct {
+	Name          string          `json:"name"`
+	Root          string          `json:"root"`
+	Patterns      []string        `json:"patterns"`
+	Backend       string          `json:"backend"`
+	Subscriptions int             `json:"subscriptions"`
+	RootExists    bool            `json:"root_exists"`
+	RootReplaced  bool            `json:"root_replaced,omitempty"`
+	Matchers      []string        `json:"matchers,omitempty"`
+	Ignores       []string        `json:"ignores,omitempty"`
+	Events        int64           `json:"events"`
+	Matched       int64           `json:"matched"`
+	Unmatched     int64           `json:"unmatched"`
+	Ignored       int64           `json:"ignored"`
+	Filtered      int64           `json:"filtered"`
+	OutsideRoot   int64           `json:"outside_root"`
+	Warmup        int64           `json:"warmup"`
+	Paused        int64           `json:"paused"`
+	LastEvent     *watchEventInfo `json:"last_event,omitempty"`
+	LastMatch     *watchEventInfo `json:"last_match,omitempty"`
+	State         string          `json:"state"`
+	Error         string          `json:"error,omitempty"`
+}
+
+func (j *watchJob) recordEvent(events []string, path, outcome string) {
+	event := &watchEventInfo{Time: time.Now(), Events: events, Path: path, Outcome: outcome}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	stats := &j.stats
+	stats.events++
+	stats.lastEvent = event
+	switch outcome {
+	case outcomeMatched:
+		stats.matched++
+		stats.lastMatch = event
+	case outcomeUnmatched:
+		stats.unmatched++
+	case outcomeIgnored:
+		stats.ignored++
+	case outcomeFiltered:
+		stats.filtered++
+	case outcomeOutsideRoot:
+		stats.outsideRoot++
+	case outcomeWarmup:
+		stats.warmup++
+	case outcomePaused:
+		stats.paused++
+	}
+}
+
+func (j *watchJob) debugInfo() watchDebugInfo {
+	info := watchDebugInfo{
+		Name:     j.cfg.Name,
+		Root:     joinRoots(j.cfg.WatchRoot, j.cfg.Roots),
+		Patterns: j.cfg.WatchPatterns,
+		Backend:  notifyBackend(),
+		State:    j.state(),
+	}
+	for _, matcher := range j.cfg.Matchers {
+		info.Matchers = append(info.Matchers, matcher.raw)
+	}
+	for _, ignore := range j.cfg.Ignores {
+		info.Ignores = append(info.Ignores, ignore.raw)
+	}
+
+	current, err := os.Stat(j.cfg.WatchRoot)
+	info.RootExists = err == nil && current.IsDir()
+	if err != nil && !os.IsNotExist(err) {
+		info.Error = err.Error()
+	}
+	for _, root := range j.cfg.Roots {
+		if extra, err := os.Stat(root); root != j.cfg.WatchRoot && (err != nil || !extra.IsDir()) {
+			info.RootExists = false
+		}
+	}
+	if j.poller != nil {
+		info.Backend = "poll"
+	}
+	if j.cfg.Remote != nil {
+		info.Backend = j.cfg.Remote.Kind
+		info.Patterns = []string{j.cfg.Remote.String()}
+	}
+	if info.RootExists && j.poller == nil {
+		subscriptions, err := countWatchSubscriptions(j.cfg.WatchPatterns)
+		info.Subscriptions = subscriptions
+		if err != nil {
+			info.Error = err.Error()
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	stats := j.stats
+	if stats.rootInfo != nil && current != nil {
+		info.RootReplaced = !os.SameFile(stats.rootInfo, current)
+	}
+	info.Events = stats.events
+	info.Matched = stats.matched
+	info.Unmatched = stats.unmatched
+	info.Ignored = stats.ignored
+	info.Filtered = stats.filtered
+	info.OutsideRoot = stats.outsideRoot
+	info.Warmup = stats.warmup
+	info.Paused = stats.paused
+	info.LastEvent = stats.lastEvent
+	info.LastMatch = stats.lastMatch
+	return info
+}
+
+func notifyBackend() string {
+	switch runtime.GOOS {
+	case "linux", "android":
+		return "inotify"
+	case "darwin":
+		return "fsevents"
+	case "windows":
+		return "ReadDirectoryChangesW"
+	case "freebsd", "openbsd", "netbsd", "dragonfly":
+		return "kqueue"
+	default:
+		return runtime.GOOS
+	}
+}
+
+func countWatchSubscriptions(patterns []string) (int, error) {
+	backend := notifyBackend()
+	if backend != "inotify" && backend != "kqueue" {
+		return len(patterns), nil
+	}
+	count := 0
+	for _, pattern := range patterns {
+		root, recursive := strings.CutSuffix(pattern, string(filepath.Separator)+"...")
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				return nil
+			}
+			if entry.IsDir() && path != root && !recursive {
+				if backend == "kqueue" {
+					count++
+				}
+				return filepath.SkipDir
+			}
+			if entry.IsDir() || backend == "kqueue" {
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nikiv/ghost/pkg/configcheck"
+)
+
+type rawWatcherSet struct {
+	Name     string         `toml:"name"`
+	Path     string         `toml:"path"`
+	Detect   any            `toml:"detect"`
+	Exclude  any            `toml:"exclude"`
+	Template string         `toml:"template"`
+	Params   map[string]any `toml:"params"`
+}
+
+type WatcherSetConfig struct {
+	Name     string
+	Root     string
+	Detect   []string
+	Exclude  []string
+	Template string
+	Projects []string
+}
+
+func expandWatcherSets(raw *rawConfig, templates map[string]jobTemplate, errs *configcheck.Errors) []WatcherSetConfig {
+	sets := make([]WatcherSetConfig, 0, len(raw.WatcherSets))
+	seen := make(map[string]bool, len(raw.WatcherSets))
+	for i, rawSet := range raw.WatcherSets {
+		set, err := normalizeWatcherSet(rawSet, templates)
+		if err == nil && seen[set.Name] {
+			err = fmt.Errorf("name %q is already used by another watcher set", set.Name)
+		}
+		if err != nil {
+			errs.Add(fmt.Errorf("watcher_sets[%d]: %w", i, err))
+			continue
+		}
+		seen[set.Name] = true
+
+		projects, err := discoverProjects(set)
+		if err != nil {
+			errs.Add(fmt.Errorf("watcher_sets[%d]: %w", i, err))
+			continue
+		}
+		_, templatePath := templates[set.Template].fields["path"]
+		for _, project := range projects {
+			name := filepath.Base(project)
+			params := make(map[string]any, len(rawSet.Params)+2)
+			for key, value := range rawSet.Params {
+				params[key] = value
+			}
+			params["dir"], params["project"] = project, name
+			instance := map[string]any{
+				"name":     set.Name + "/" + name,
+				"template": set.Template,
+				"params":   params,
+			}
+			if !templatePath {
+				instance["path"] = project
+			}
+
+			expanded, err := instantiateTemplate(templates, instance)
+			var watcher rawWatcher
+			if err == nil {
+				err = decodeExpanded(expanded, &watcher)
+			}
+			if err != nil {
+				errs.Add(fmt.Errorf("watcher_sets[%d]: %s: %w", i, name, err))
+				continue
+			}
+			watcher.origin = fmt.Sprintf("watcher_sets[%d]: %s", i, name)
+			raw.Watchers = append(raw.Watchers, watcher)
+			set.Projects = append(set.Projects, project)
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+func normalizeWatcherSet(raw rawWatcherSet, templates map[string]jobTemplate) (WatcherSetConfig, error) {
+	set := WatcherSetConfig{Name: strings.TrimSpace(raw.Name)}
+	if set.Name == "" {
+		return set, errors.New("name is required")
+	}
+	root, err := resolvePath(raw.Path)
+	if err != nil {
+		return set, fmt.Errorf("path: %w", err)
+	}
+	if info, err := os.Stat(root); err != nil {
+		return set, fmt.Errorf("path: %w", err)
+	} else if !info.IsDir() {
+		return set, fmt.Errorf("path: %s is not a directory", root)
+	}
+	set.Root = root
+
+	if set.Detect, err = valueToStringSlice(raw.Detect); err != nil {
+		return set, fmt.Errorf("detect: %w", err)
+	}
+	if len(set.Detect) == 0 {
+		return set, errors.New(`detect is required, e.g. detect = "go.mod"`)
+	}
+	if set.Exclude, err = valueToStringSlice(raw.Exclude); err != nil {
+		return set, fmt.Errorf("exclude: %w", err)
+	}
+	for _, pattern := range append(append([]string(nil), set.Detect...), set.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return set, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	set.Template = strings.TrimSpace(raw.Template)
+	if set.Template == "" {
+		return set, errors.New("template is required")
+	}
+	if _, ok := templates[set.Template]; !ok {
+		return set, fmt.Errorf("template: unknown template %q", set.Template)
+	}
+	return set, nil
+}
+
+func discoverProjects(set WatcherSetConfig) ([]string, error) {
+	entries, err := os.ReadDir(set.Root)
+	if err != nil {
+		return nil, err
+	}
+	var projects []string
+	for _, entry := range entries {
+		dir := filepath.Join(set.Root, entry.Name())
+		if !set.candidate(dir) {
+			continue
+		}
+		for _, pattern := range set.Detect {
+			if matches, _ := filepath.Glob(filepath.Join(dir, pattern)); len(matches) > 0 {
+				projects = append(projects, dir)
+				break
+			}
+		}
+	}
+	return projects, nil
+}
+
+func (s WatcherSetConfig) candidate(dir string) bool {
+	name := filepath.Base(dir)
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, pattern := range s.Exclude {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return false
+		}
+	}
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+func (s WatcherSetConfig) candidates() []string {
+	entries, err := os.ReadDir(s.Root)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if dir := filepath.Join(s.Root, entry.Name()); s.candidate(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func (s WatcherSetConfig) affectedBy(path string, removed bool) bool {
+	dir := filepath.Dir(path)
+	if dir == s.Root {
+		if removed {
+			return containsString(s.Projects, path)
+		}
+		return s.candidate(path)
+	}
+	if filepath.Dir(dir) != s.Root || !s.candidate(dir) {
+		return false
+	}
+	for _, pattern := range s.Detect {
+		if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+var generatedWatcherIndex = regexp.MustCompile(`^watchers\[(\d+)\]`)
+
+func relabelGeneratedWatcherErrors(errs configcheck.Errors, watchers []rawWatcher) {
+	for _, err := range errs {
+		match := generatedWatcherIndex.FindStringSubmatch(err.Message)
+		if match == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(match[1])
+		if index < len(watchers) && watchers[index].origin != "" {
+			err.Message = watchers[index].origin + err.Message[len(match[0]):]
+		}
+	}
+}
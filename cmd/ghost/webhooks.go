@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	webhookQueueSize        = 256
+	defaultWebhookTimeout   = 5 * time.Second
+	webhookBaseBackoff      = time.Second
+	webhookMaxBackoff       = 5 * time.Minute
+	webhookBreakerThreshold = 5
+	webhookBreakerCooldown  = 30 * time.Second
+)
+
+var webhookEvents = []string{
+	"server.start",
+	"server.stop",
+	"server.exit",
+	"server.crash",
+	"watcher.trigger",
+	"watcher.fail",
+	"watcher.timeout",
+	"schedule.fail",
+	"config.reload_failed",
+	"streaming.privacy",
+	"streaming.live",
+	"disk.low",
+	"disk.ok",
+}
+
+var webhookLog = componentLogger("webhook", "webhook")
+
+type rawWebhook struct {
+	URL       string            `toml:"url"`
+	Events    []string          `toml:"events"`
+	Headers   map[string]string `toml:"headers"`
+	TimeoutMs *int64            `toml:"timeout_ms"`
+}
+
+type WebhookConfig struct {
+	URL     string
+	Events  []string
+	Headers map[string]string
+	Timeout time.Duration
+}
+
+type webhookEvent struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Host     string    `json:"host"`
+	Kind     string    `json:"kind,omitempty"`
+	Job      string    `json:"job,omitempty"`
+	RunID    string    `json:"run_id,omitempty"`
+	PID      int       `json:"pid,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
+
+func normalizeWebhook(raw rawWebhook) (WebhookConfig, error) {
+	target := strings.TrimSpace(raw.URL)
+	if target == "" {
+		return WebhookConfig{}, errors.New("url is required")
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return WebhookConfig{}, fmt.Errorf("url: %q is not an http(s) URL", target)
+	}
+	hook := WebhookConfig{
+		URL:     parsed.String(),
+		Headers: raw.Headers,
+		Timeout: chooseDuration(raw.TimeoutMs, nil, defaultWebhookTimeout),
+	}
+	if hook.Timeout <= 0 {
+		hook.Timeout = defaultWebhookTimeout
+	}
+	for _, pattern := range raw.Events {
+		pattern = strings.TrimSpace(pattern)
+		matched := false
+		for _, event := range webhookEvents {
+			if ok, err := path.Match(pattern, event); err == nil && ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return WebhookConfig{}, fmt.Errorf("events: %q matches no event (available: %s)", pattern, strings.Join(webhookEvents, ", "))
+		}
+		hook.Events = append(hook.Events, pattern)
+	}
+	return hook, nil
+}
+
+func (cfg WebhookConfig) wants(event string) bool {
+	if len(cfg.Events) == 0 {
+		return true
+	}
+	for _, pattern := range cfg.Events {
+		if ok, _ := path.Match(pattern, event); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type webhookDispatcher struct {
+	mu      sync.Mutex
+	cfgs    []WebhookConfig
+	targets []*webhookTarget
+}
+
+var webhooks = &webhookDispatcher{}
+
+func (d *webhookDispatcher) Apply(cfgs []WebhookConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if reflect.DeepEqual(d.cfgs, cfgs) {
+		return
+	}
+	old := d.targets
+	d.cfgs = cfgs
+	d.targets = make([]*webhookTarget, len(cfgs))
+	for i, cfg := range cfgs {
+		d.targets[i] = newWebhookTarget(cfg)
+	}
+	go closeWebhookTargets(old)
+	if len(cfgs) > 0 {
+		webhookLog.Info("delivering events to %d webhook(s)", len(cfgs))
+	}
+}
+
+func (d *webhookDispatcher) Stop() {
+	d.mu.Lock()
+	old := d.targets
+	d.cfgs, d.targets = nil, nil
+	d.mu.Unlock()
+	closeWebhookTargets(old)
+}
+
+func (d *webhookDispatcher) send(event webhookEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, target := range d.targets {
+		if target.cfg.wants(event.Event) {
+			target.send(event)
+		}
+	}
+}
+
+func notifyWebhooks(event webhookEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Host = sinkHostname()
+	webhooks.send(event)
+}
+
+func webhookExit(event webhookEvent, waitErr error) webhookEvent {
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if waitErr != nil {
+		code = -1
+	}
+	event.ExitCode = &code
+	if waitErr != nil && event.Message == "" {
+		event.Message = waitErr.Error()
+	}
+	return event
+}
+
+func closeWebhookTargets(targets []*webhookTarget) {
+	for _, target := range targets {
+		target.close()
+	}
+}
+
+type webhookTarget struct {
+	cfg    WebhookConfig
+	client *http.Client
+	events chan webhookEvent
+	done   chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+}
+
+func newWebhookTarget(cfg WebhookConfig) *webhookTarget {
+	target := &webhookTarget{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		events: make(chan webhookEvent, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go target.run()
+	return target
+}
+
+func (t *webhookTarget) send(event webhookEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.events <- event:
+	default:
+		t.dropped++
+	}
+}
+
+func (t *webhookTarget) close() {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.events)
+	}
+	t.mu.Unlock()
+	<-t.done
+}
+
+func (t *webhookTarget) run() {
+	defer close(t.done)
+	var (
+		queue   []webhookEvent
+		breaker deliveryBreaker
+	)
+	events := t.events
+	for {
+		if len(queue) > 0 && breaker.ready(time.Now()) {
+			queue = t.attempt(queue, &breaker)
+			t.reportDropped()
+			continue
+		}
+		if events == nil && (len(queue) == 0 || breaker.failures > 0) {
+			if len(queue) > 0 {
+				webhookLog.Warn("%s: discarding %d undelivered event(s)", t.cfg.URL, len(queue))
+			}
+			return
+		}
+
+		var (
+			timer *time.Timer
+			retry <-chan time.Time
+		)
+		if len(queue) > 0 {
+			timer = time.NewTimer(breaker.wait(time.Now()))
+			retry = timer.C
+		}
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+			} else {
+				queue = t.enqueue(queue, event)
+			}
+		case <-retry:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (t *webhookTarget) enqueue(queue []webhookEvent, event webhookEvent) []webhookEvent {
+	queue = append(queue, event)
+	if len(queue) > webhookQueueSize {
+		queue = queue[len(queue)-webhookQueueSize:]
+		t.mu.Lock()
+		t.dropped++
+		t.mu.Unlock()
+	}
+	return queue
+}
+
+func (t *webhookTarget) attempt(queue []webhookEvent, breaker *deliveryBreaker) []webhookEvent {
+	err := t.deliver(queue[0])
+	var refused *webhookStatusError
+	if err == nil || (errors.As(err, &refused) && refused.permanent()) {
+		// The endpoint answered; a refused event is dropped, not retried.
+		if err != nil {
+			webhookLog.Error("%s refused %s event, dropping it: %v", t.cfg.URL, queue[0].Event, err)
+		}
+		if failures := breaker.success(); failures > 0 {
+			webhookLog.Info("%s recovered after %d failed attempt(s); delivering %d queued event(s)", t.cfg.URL, failures, len(queue)-1)
+		}
+		return queue[1:]
+	}
+
+	trial := breaker.state == breakerHalfOpen
+	delay := breaker.failure(time.Now())
+	switch {
+	case breaker.state == breakerClosed && breaker.failures == 1:
+		webhookLog.Error("%s: %v (retrying in %s)", t.cfg.URL, err, delay)
+	case breaker.state == breakerOpen && !trial:
+		webhookLog.Warn("%s: %d deliveries in a row failed; pausing deliveries for %s and holding up to %d event(s)", t.cfg.URL, breaker.failures, delay, webhookQueueSize)
+	case breaker.state == breakerOpen:
+		webhookLog.Warn("%s: still failing (%v); pausing deliveries for %s", t.cfg.URL, err, delay)
+	}
+	return queue
+}
+
+func (t *webhookTarget) reportDropped() {
+	t.mu.Lock()
+	dropped := t.dropped
+	t.dropped = 0
+	t.mu.Unlock()
+	if dropped > 0 {
+		webhookLog.Warn("%s dropped %d event(s), queue full", t.cfg.URL, dropped)
+	}
+}
+
+type webhookStatusError struct {
+	code   int
+	status string
+	detail string
+}
+
+func (e *webhookStatusError) Error() string {
+	if e.detail == "" {
+		return e.status
+	}
+	return e.status + ": " + e.detail
+}
+
+func (e *webhookStatusError) permanent() bool {
+	return e.code >= 400 && e.code < 500 && e.code != http.StatusRequestTimeout && e.code != http.StatusTooManyRequests
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// deliveryBreaker is a circuit breaker for one webhook. Closed, failed
+// deliveries are retried with exponential backoff; after
+// webhookBreakerThreshold failures in a row it opens and makes no attempts
+// for a cooldown, then lets a single trial delivery through (half-open).
+// A successful trial closes it again; a failed one reopens it with twice the
+// cooldown, up to webhookMaxBackoff.
+type deliveryBreaker struct {
+	state    breakerState
+	failures int
+	trips    int
+	retryAt  time.Time
+}
+
+// ready reports whether a delivery may be attempted now, turning an open
+// breaker half-open once its cooldown is over.
+func (b *deliveryBreaker) ready(now time.Time) bool {
+	if now.Before(b.retryAt) {
+		return false
+	}
+	if b.state == breakerOpen {
+		b.state = breakerHalfOpen
+	}
+	return true
+}
+
+func (b *deliveryBreaker) wait(now time.Time) time.Duration {
+	return max(b.retryAt.Sub(now), 0)
+}
+
+// failure records a failed attempt and returns how long to hold off.
+func (b *deliveryBreaker) failure(now time.Time) time.Duration {
+	b.failures++
+	var delay time.Duration
+	if b.state == breakerHalfOpen || b.failures >= webhookBreakerThreshold {
+		b.state = breakerOpen
+		b.trips++
+		delay = min(webhookBreakerCooldown<<min(b.trips-1, 20), webhookMaxBackoff)
+	} else {
+		delay = min(webhookBaseBackoff<<min(b.failures-1, 20), webhookMaxBackoff)
+	}
+	b.retryAt = now.Add(delay)
+	return delay
+}
+
+func (b *deliveryBreaker) success() int {
+	failures := b.failures
+	*b = deliveryBreaker{}
+	return failures
+}
+
+func (t *webhookTarget) deliver(event webhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, t.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ghost")
+	for key, value := range t.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &webhookStatusError{code: resp.StatusCode, status: resp.Status, detail: strings.TrimSpace(string(detail))}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
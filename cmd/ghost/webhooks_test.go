@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeliveryBreakerOpensAndHalfOpens(t *testing.T) {
+	var b deliveryBreaker
+	now := time.Unix(0, 0)
+
+	for i := 1; i < webhookBreakerThreshold; i++ {
+		if delay := b.failure(now); delay != webhookBaseBackoff<<(i-1) {
+			t.Fatalf("failure %d: delay %s, want %s", i, delay, webhookBaseBackoff<<(i-1))
+		}
+		if b.state != breakerClosed {
+			t.Fatalf("failure %d: breaker opened before the threshold", i)
+		}
+	}
+	if delay := b.failure(now); delay != webhookBreakerCooldown || b.state != breakerOpen {
+		t.Fatalf("at the threshold: state %d, delay %s; want open for %s", b.state, delay, webhookBreakerCooldown)
+	}
+
+	if b.ready(now.Add(webhookBreakerCooldown - time.Millisecond)) {
+		t.Fatal("open breaker allowed a delivery during its cooldown")
+	}
+	now = now.Add(webhookBreakerCooldown)
+	if !b.ready(now) || b.state != breakerHalfOpen {
+		t.Fatalf("after the cooldown: state %d, want half-open", b.state)
+	}
+	if delay := b.failure(now); delay != 2*webhookBreakerCooldown || b.state != breakerOpen {
+		t.Fatalf("failed trial: state %d, delay %s; want open for %s", b.state, delay, 2*webhookBreakerCooldown)
+	}
+
+	now = now.Add(2 * webhookBreakerCooldown)
+	if !b.ready(now) {
+		t.Fatal("breaker not ready after the second cooldown")
+	}
+	if failures := b.success(); failures != webhookBreakerThreshold+1 {
+		t.Fatalf("success reported %d failures, want %d", failures, webhookBreakerThreshold+1)
+	}
+	if b.state != breakerClosed || !b.ready(now) {
+		t.Fatalf("after success: state %d, want closed and ready", b.state)
+	}
+}
+
+func TestWebhookRefusedEventLeavesBreakerClosed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	target := &webhookTarget{cfg: WebhookConfig{URL: server.URL}, client: server.Client()}
+	var breaker deliveryBreaker
+	queue := []webhookEvent{{Event: "server.crash"}, {Event: "server.start"}}
+	for range webhookBreakerThreshold + 1 {
+		queue = target.attempt(append(queue, webhookEvent{Event: "server.exit"}), &breaker)
+	}
+	if breaker.state != breakerClosed || breaker.failures != 0 || !breaker.ready(time.Now()) {
+		t.Fatalf("refused events counted against the breaker: %+v", breaker)
+	}
+	if len(queue) != 2 {
+		t.Fatalf("queue has %d events, want refused events dropped", len(queue))
+	}
+}
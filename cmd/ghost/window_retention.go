@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	trackerCompactInterval = 6 * time.Hour
+	defaultVacuumInterval  = 7 * 24 * time.Hour
+)
+
+func initWindowSummarySchema(db *sql.DB) error {
+	schema := []string{
+		`CREATE TABLE IF NOT EXISTS app_daily (
+			day TEXT NOT NULL,
+			app_name TEXT NOT NULL,
+			focus_ms INTEGER NOT NULL DEFAULT 0,
+			focus_sessions INTEGER NOT NULL DEFAULT 0,
+			windows_opened INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (day, app_name)
+		);`,
+		`CREATE TABLE IF NOT EXISTS tracker_meta (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);`,
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("initialize window tracker summary schema: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *WindowTracker) compact(now time.Time, cfg WindowTrackerConfig) {
+	if cfg.Retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-cfg.Retention).UTC().Truncate(24 * time.Hour)
+	focus, windows, err := compactWindowSessions(t.db, cutoff)
+	if err != nil {
+		trackerLog.Error("compaction failed: %v", err)
+		return
+	}
+	if focus > 0 || windows > 0 {
+		trackerLog.Info("folded %d focus session(s) and %d window session(s) before %s into daily summaries", focus, windows, cutoff.Format(time.DateOnly))
+	}
+	if cfg.VacuumInterval <= 0 {
+		return
+	}
+	last, err := trackerMetaTime(t.db, "last_vacuum")
+	if err != nil {
+		trackerLog.Error("read last vacuum time: %v", err)
+		return
+	}
+	if !last.IsZero() && now.Sub(last) < cfg.VacuumInterval {
+		return
+	}
+	started := t.clock.Now()
+	if _, err := t.db.Exec(`VACUUM`); err != nil {
+		trackerLog.Error("vacuum failed: %v", err)
+		return
+	}
+	if err := setTrackerMetaTime(t.db, "last_vacuum", now); err != nil {
+		trackerLog.Error("record vacuum time: %v", err)
+	}
+	trackerLog.Info("vacuumed %s in %s", cfg.DBPath, t.clock.Now().Sub(started).Round(time.Millisecond))
+}
+
+func compactWindowSessions(db *sql.DB, cutoff time.Time) (int64, int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO app_daily (day, app_name, focus_ms, focus_sessions)
+		SELECT substr(started_at, 1, 10), app_name, SUM(duration_ms), COUNT(*) FROM focus_sessions
+		WHERE started_at < ? GROUP BY 1, 2
+		ON CONFLICT (day, app_name) DO UPDATE SET
+			focus_ms = focus_ms + excluded.focus_ms,
+			focus_sessions = focus_sessions + excluded.focus_sessions`, cutoff); err != nil {
+		return 0, 0, fmt.Errorf("summarize focus sessions: %w", err)
+	}
+	result, err := tx.Exec(`DELETE FROM focus_sessions WHERE started_at < ?`, cutoff)
+	if err != nil {
+		return 0, 0, fmt.Errorf("delete focus sessions: %w", err)
+	}
+	focus, _ := result.RowsAffected()
+
+	if _, err := tx.Exec(`INSERT INTO app_daily (day, app_name, windows_opened)
+		SELECT substr(opened_at, 1, 10), app_name, COUNT(*) FROM window_sessions
+		WHERE opened_at < ? AND closed_at IS NOT NULL GROUP BY 1, 2
+		ON CONFLICT (day, app_name) DO UPDATE SET
+			windows_opened = windows_opened + excluded.windows_opened`, cutoff); err != nil {
+		return 0, 0, fmt.Errorf("summarize window sessions: %w", err)
+	}
+	result, err = tx.Exec(`DELETE FROM window_sessions WHERE opened_at < ? AND closed_at IS NOT NULL`, cutoff)
+	if err != nil {
+		return 0, 0, fmt.Errorf("delete window sessions: %w", err)
+	}
+	windows, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return focus, windows, nil
+}
+
+func trackerMetaTime(db *sql.DB, key string) (time.Time, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM tracker_meta WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func setTrackerMetaTime(db *sql.DB, key string, value time.Time) error {
+	_, err := db.Exec(`INSERT INTO tracker_meta (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value.UTC().Format(time.RFC3339))
+	return err
+}
@@ -7,34 +7,41 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/nikiv/ghost/pkg/windows"
 	_ "modernc.org/sqlite"
 )
 
-var errWindowEnumerationUnavailable = errors.New("window enumeration unavailable on this platform")
-var accessibilityWarnOnce sync.Once
+var trackerLog = componentLogger("window_tracker", "window tracker")
 
-type windowSnapshot struct {
-	ownerName   string
-	windowTitle string
-	windowID    uint64
-	layer       int
-	ownerPID    int32
-	onScreen    bool
-}
+const titleFlushInterval = 10 * time.Second
+
+var accessibilityWarnOnce sync.Once
+var browserURLWarnOnce sync.Once
+var windowTrackerUnsupportedOnce sync.Once
 
 type WindowTracker struct {
+	clock     clock
+	windows   windowSource
 	mu        sync.Mutex
 	cfg       WindowTrackerConfig
 	db        *sql.DB
+	tx        *sql.Tx
 	cancel    context.CancelFunc
 	wg        sync.WaitGroup
 	sessions  map[uint64]*windowSession
 	appLookup map[string]string
 	trackAll  bool
+	focus     *focusSpan
+	nextFocus *focusSpan
+	titles    *windows.TitleResolver
+	browsers  map[string]bool
+	suspended []string
 }
 
 type windowSession struct {
@@ -42,11 +49,29 @@ type windowSession struct {
 	windowID    uint64
 	appName     string
 	windowTitle string
+	titleSource windows.TitleSource
+	url         string
+	domain      string
+	urlTitle    string
+	urlChecked  bool
 	openTime    time.Time
+	dirty       bool
+	flushedAt   time.Time
+}
+
+type focusSpan struct {
+	sessionID   int64
+	windowID    uint64
+	appName     string
+	windowTitle string
+	titleSource windows.TitleSource
+	url         string
+	domain      string
+	start       time.Time
 }
 
 func NewWindowTracker() *WindowTracker {
-	return &WindowTracker{}
+	return &WindowTracker{clock: systemClock{}, windows: systemWindows{}}
 }
 
 func (t *WindowTracker) Apply(cfg WindowTrackerConfig) error {
@@ -55,19 +80,39 @@ func (t *WindowTracker) Apply(cfg WindowTrackerConfig) error {
 
 	if !cfg.active() {
 		if t.cfg.active() {
-			logInfo("window tracker disabled")
+			trackerLog.Info("disabled")
 		}
 		t.stopLocked()
 		t.cfg = WindowTrackerConfig{}
 		return nil
 	}
 
+	if !windows.Supported {
+		windowTrackerUnsupportedOnce.Do(func() {
+			trackerLog.Info("is not supported on %s; ignoring [window_tracker]", runtime.GOOS)
+		})
+		t.stopLocked()
+		t.cfg = WindowTrackerConfig{}
+		return nil
+	}
+
+	if len(t.suspended) > 0 {
+		t.stopLocked()
+		t.cfg = cfg
+		return nil
+	}
+
 	if t.cfg.active() && windowTrackerConfigsEqual(t.cfg, cfg) {
 		return nil
 	}
 
 	t.stopLocked()
 	if err := t.startLocked(cfg); err != nil {
+		if errors.Is(err, windows.ErrUnavailable) {
+			trackerLog.Warn("disabled: %v", err)
+			t.cfg = WindowTrackerConfig{}
+			return nil
+		}
 		return err
 	}
 	t.cfg = cfg
@@ -81,12 +126,56 @@ func (t *WindowTracker) Stop() {
 	t.cfg = WindowTrackerConfig{}
 }
 
+// Suspend stops recording without forgetting the config, for example while
+// the disk is nearly full. Open sessions are flushed first. Each reason is
+// lifted on its own by Resume.
+func (t *WindowTracker) Suspend(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if slices.Contains(t.suspended, reason) {
+		return
+	}
+	t.suspended = append(t.suspended, reason)
+	if t.cancel != nil {
+		t.stopLocked()
+		trackerLog.Warn("paused: %s", reason)
+	}
+}
+
+// Resume lifts one reason for a suspension. Once none is left the tracker
+// restarts with the config it last received.
+func (t *WindowTracker) Resume(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	index := slices.Index(t.suspended, reason)
+	if index < 0 {
+		return
+	}
+	t.suspended = slices.Delete(t.suspended, index, index+1)
+	if len(t.suspended) > 0 || !t.cfg.active() {
+		return
+	}
+	if err := t.startLocked(t.cfg); err != nil {
+		trackerLog.Error("failed to resume: %v", err)
+		t.cfg = WindowTrackerConfig{}
+		return
+	}
+	trackerLog.Info("resumed")
+}
+
+// Suspended reports whether the tracker is suspended for reason.
+func (t *WindowTracker) Suspended(reason string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Contains(t.suspended, reason)
+}
+
 func (t *WindowTracker) startLocked(cfg WindowTrackerConfig) error {
-	if err := ensureWindowEnumerationAvailable(); err != nil {
+	if err := ensureWindowEnumerationAvailable(t.windows); err != nil {
 		return err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(cfg.DBPath), 0o755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(cfg.DBPath), cfg.DirMode); err != nil {
 		return fmt.Errorf("create db directory: %w", err)
 	}
 
@@ -102,9 +191,14 @@ func (t *WindowTracker) startLocked(cfg WindowTrackerConfig) error {
 		_ = db.Close()
 		return err
 	}
+	if err := initWindowSummarySchema(db); err != nil {
+		_ = db.Close()
+		return err
+	}
 
 	t.db = db
 	t.sessions = make(map[uint64]*windowSession)
+	t.titles = &windows.TitleResolver{TTL: cfg.TitleTTL, Lookup: t.windows.Title, Trusted: windows.AccessibilityTrusted}
 	t.trackAll = cfg.TrackAll
 	if !cfg.TrackAll {
 		t.appLookup = make(map[string]string, len(cfg.Applications))
@@ -114,17 +208,30 @@ func (t *WindowTracker) startLocked(cfg WindowTrackerConfig) error {
 	} else {
 		t.appLookup = nil
 	}
+	t.browsers = nil
+	if cfg.CaptureURLs && runtime.GOOS != "darwin" {
+		trackerLog.Warn("capture_urls is only supported on macOS; not recording URLs")
+	} else if cfg.CaptureURLs {
+		t.browsers = make(map[string]bool)
+		browsers := cfg.Browsers
+		if len(browsers) == 0 {
+			browsers = windows.SupportedBrowsers()
+		}
+		for _, browser := range browsers {
+			t.browsers[strings.ToLower(browser)] = true
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	t.cancel = cancel
 	t.wg.Add(1)
-	go t.run(ctx, cfg.PollInterval)
+	go t.run(ctx, cfg)
 
 	target := fmt.Sprintf("%d application(s)", len(cfg.Applications))
 	if cfg.TrackAll {
 		target = "all applications"
 	}
-	logInfo("window tracker tracking %s → %s", target, cfg.DBPath)
+	trackerLog.Info("tracking %s → %s", target, cfg.DBPath)
 	return nil
 }
 
@@ -141,41 +248,105 @@ func (t *WindowTracker) stopLocked() {
 	t.sessions = nil
 	t.appLookup = nil
 	t.trackAll = false
+	t.focus = nil
+	t.nextFocus = nil
+	t.titles = nil
+	t.browsers = nil
 }
 
-func (t *WindowTracker) run(ctx context.Context, pollInterval time.Duration) {
+func (t *WindowTracker) run(ctx context.Context, cfg WindowTrackerConfig) {
 	defer t.wg.Done()
 
-	ticker := time.NewTicker(pollInterval)
+	ticker := t.clock.NewTicker(cfg.PollInterval)
 	defer ticker.Stop()
+	compactTicker := t.clock.NewTicker(trackerCompactInterval)
+	defer compactTicker.Stop()
+	t.compact(t.clock.Now(), cfg)
 
 	for {
 		select {
+		case <-compactTicker.C():
+			t.compact(t.clock.Now(), cfg)
 		case <-ctx.Done():
-			t.closeAllSessions(time.Now())
+			t.shutdown(t.clock.Now(), cfg.MinFocus)
 			return
-		case <-ticker.C:
-			if err := t.pollOnce(time.Now()); err != nil {
-				if errors.Is(err, errWindowEnumerationUnavailable) {
-					logError("window tracker stopped: %v", err)
-					t.closeAllSessions(time.Now())
+		case <-ticker.C():
+			if err := t.pollOnce(t.clock.Now(), cfg); err != nil {
+				if errors.Is(err, windows.ErrUnavailable) {
+					trackerLog.Error("stopped: %v", err)
+					t.shutdown(t.clock.Now(), cfg.MinFocus)
 					return
 				}
-				logError("window tracker poll failed: %v", err)
+				trackerLog.Error("poll failed: %v", err)
 			}
 		}
 	}
 }
 
-func (t *WindowTracker) pollOnce(now time.Time) error {
-	snapshots, err := captureWindowSnapshot()
+func (t *WindowTracker) shutdown(now time.Time, minFocus time.Duration) {
+	err := t.inTransaction(func() {
+		t.endFocus(now, minFocus)
+		t.closeAllSessions(now)
+	})
+	if err != nil {
+		trackerLog.Error("failed to close sessions: %v", err)
+	}
+}
+
+func (t *WindowTracker) pollOnce(now time.Time, cfg WindowTrackerConfig) error {
+	snapshots, err := t.windows.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	var opened []uint64
+	err = t.inTransaction(func() {
+		opened = t.applySnapshot(snapshots, now, cfg)
+	})
 	if err != nil {
+		for _, id := range opened {
+			delete(t.sessions, id)
+		}
 		return err
 	}
+	return nil
+}
+
+func (t *WindowTracker) inTransaction(fn func()) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	t.tx = tx
+	fn()
+	t.tx = nil
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
 
+func (t *WindowTracker) exec(query string, args ...any) (sql.Result, error) {
+	if t.tx != nil {
+		return t.tx.Exec(query, args...)
+	}
+	return t.db.Exec(query, args...)
+}
+
+func (t *WindowTracker) applySnapshot(snapshots []windows.Window, now time.Time, cfg WindowTrackerConfig) []uint64 {
+	var frontmost uint64
+	for _, snap := range snapshots {
+		if snap.Layer == 0 && snap.OnScreen && snap.ID != 0 {
+			frontmost = snap.ID
+			break
+		}
+	}
+
+	var opened []uint64
 	seen := make(map[uint64]struct{}, len(snapshots))
 	for _, snap := range snapshots {
-		if snap.layer != 0 || snap.windowID == 0 {
+		if snap.Layer != 0 || snap.ID == 0 {
 			continue
 		}
 		var (
@@ -183,69 +354,152 @@ func (t *WindowTracker) pollOnce(now time.Time) error {
 			ok      bool
 		)
 		if t.trackAll {
-			appName = snap.ownerName
+			appName = snap.Owner
 			ok = true
 		} else {
-			appName, ok = t.appLookup[strings.ToLower(snap.ownerName)]
+			appName, ok = t.appLookup[strings.ToLower(snap.Owner)]
 		}
 		if !ok {
 			continue
 		}
-		title := t.resolvedTitle(snap)
-		seen[snap.windowID] = struct{}{}
-
-		if session, exists := t.sessions[snap.windowID]; exists {
-			if session.windowTitle != title {
-				if err := t.updateWindowTitle(session.rowID, title); err != nil {
-					logError("window tracker failed to update title: %v", err)
-				} else {
-					session.windowTitle = title
-				}
+		title, source := t.resolvedTitle(snap, now)
+		seen[snap.ID] = struct{}{}
+
+		if session, exists := t.sessions[snap.ID]; exists {
+			if session.windowTitle != title || session.titleSource != source {
+				session.windowTitle, session.titleSource, session.dirty = title, source, true
 			}
 			continue
 		}
 
-		rowID, err := t.insertSession(appName, title, snap.windowID, now)
+		rowID, err := t.insertSession(appName, title, source, snap.ID, now)
 		if err != nil {
-			logError("window tracker failed to insert session: %v", err)
+			trackerLog.Error("failed to insert session: %v", err)
 			continue
 		}
-		t.sessions[snap.windowID] = &windowSession{
+		t.sessions[snap.ID] = &windowSession{
 			rowID:       rowID,
-			windowID:    snap.windowID,
+			windowID:    snap.ID,
 			appName:     appName,
 			windowTitle: title,
+			titleSource: source,
 			openTime:    now,
+			flushedAt:   now,
 		}
+		opened = append(opened, snap.ID)
 	}
 
 	for id, session := range t.sessions {
 		if _, ok := seen[id]; ok {
 			continue
 		}
-		if err := t.closeSession(session.rowID, now); err != nil {
-			logError("window tracker failed to close session: %v", err)
+		if err := t.closeSession(session, now); err != nil {
+			trackerLog.Error("failed to close session: %v", err)
 		}
 		delete(t.sessions, id)
 	}
+	t.titles.Prune(now)
 
-	return nil
+	if session := t.sessions[frontmost]; session != nil && t.browsers[strings.ToLower(session.appName)] {
+		t.captureURL(session, cfg.DomainOnly)
+	}
+	for _, session := range t.sessions {
+		if session.dirty && now.Sub(session.flushedAt) >= titleFlushInterval {
+			if err := t.flushSession(session, now); err != nil {
+				trackerLog.Error("failed to update title: %v", err)
+			}
+		}
+	}
+	if cfg.TrackFocus {
+		t.updateFocus(t.sessions[frontmost], now, cfg.MinFocus)
+	}
+	return opened
+}
+
+func (t *WindowTracker) captureURL(session *windowSession, domainOnly bool) {
+	if session.urlChecked && session.urlTitle == session.windowTitle {
+		return
+	}
+	session.urlChecked, session.urlTitle = true, session.windowTitle
+	url, err := t.windows.BrowserURL(session.appName)
+	if err != nil {
+		browserURLWarnOnce.Do(func() {
+			trackerLog.Warn("%v; allow ghost to control the browser in System Settings → Privacy & Security → Automation to record URLs", err)
+		})
+		return
+	}
+	domain := windows.Domain(url)
+	if domainOnly {
+		url = ""
+	}
+	if url != session.url || domain != session.domain {
+		session.url, session.domain, session.dirty = url, domain, true
+	}
+}
+
+func (t *WindowTracker) updateFocus(session *windowSession, now time.Time, minFocus time.Duration) {
+	span := &focusSpan{start: now}
+	if session != nil {
+		span.sessionID = session.rowID
+		span.windowID = session.windowID
+		span.appName = session.appName
+		span.windowTitle = session.windowTitle
+		span.titleSource = session.titleSource
+		span.url = session.url
+		span.domain = session.domain
+	}
+
+	switch {
+	case t.focus == nil:
+		t.focus = span
+	case span.windowID == t.focus.windowID:
+		t.nextFocus = nil
+	case t.nextFocus != nil && span.windowID == t.nextFocus.windowID:
+		if now.Sub(t.nextFocus.start) >= minFocus {
+			t.recordFocus(t.focus, t.nextFocus.start, minFocus)
+			t.focus, t.nextFocus = t.nextFocus, nil
+		}
+	default:
+		t.nextFocus = span
+	}
+}
+
+func (t *WindowTracker) endFocus(now time.Time, minFocus time.Duration) {
+	if t.focus == nil {
+		return
+	}
+	if next := t.nextFocus; next != nil && now.Sub(next.start) >= minFocus {
+		t.recordFocus(t.focus, next.start, minFocus)
+		t.focus = next
+	}
+	t.recordFocus(t.focus, now, minFocus)
+	t.focus, t.nextFocus = nil, nil
+}
+
+func (t *WindowTracker) recordFocus(span *focusSpan, end time.Time, minFocus time.Duration) {
+	if span.windowID == 0 || end.Sub(span.start) < minFocus {
+		return
+	}
+	if err := t.insertFocusSession(span, end); err != nil {
+		trackerLog.Error("failed to record focus session: %v", err)
+	}
 }
 
 func (t *WindowTracker) closeAllSessions(now time.Time) {
 	for id, session := range t.sessions {
-		if err := t.closeSession(session.rowID, now); err != nil {
-			logError("window tracker failed to close session %d: %v", id, err)
+		if err := t.closeSession(session, now); err != nil {
+			trackerLog.Error("failed to close session %d: %v", id, err)
 		}
 		delete(t.sessions, id)
 	}
 }
 
-func (t *WindowTracker) insertSession(appName, title string, windowID uint64, openedAt time.Time) (int64, error) {
-	result, err := t.db.Exec(
-		`INSERT INTO window_sessions (app_name, window_title, window_id, opened_at) VALUES (?, ?, ?, ?)`,
+func (t *WindowTracker) insertSession(appName, title string, source windows.TitleSource, windowID uint64, openedAt time.Time) (int64, error) {
+	result, err := t.exec(
+		`INSERT INTO window_sessions (app_name, window_title, title_source, window_id, opened_at) VALUES (?, ?, ?, ?, ?)`,
 		appName,
 		title,
+		string(source),
 		windowID,
 		openedAt.UTC(),
 	)
@@ -255,13 +509,52 @@ func (t *WindowTracker) insertSession(appName, title string, windowID uint64, op
 	return result.LastInsertId()
 }
 
-func (t *WindowTracker) updateWindowTitle(rowID int64, title string) error {
-	_, err := t.db.Exec(`UPDATE window_sessions SET window_title = ? WHERE id = ?`, title, rowID)
+func (t *WindowTracker) insertFocusSession(focus *focusSpan, endedAt time.Time) error {
+	_, err := t.exec(
+		`INSERT INTO focus_sessions (session_id, app_name, window_title, title_source, url, domain, window_id, started_at, ended_at, duration_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		focus.sessionID,
+		focus.appName,
+		focus.windowTitle,
+		string(focus.titleSource),
+		nullIfEmpty(focus.url),
+		nullIfEmpty(focus.domain),
+		focus.windowID,
+		focus.start.UTC(),
+		endedAt.UTC(),
+		endedAt.Sub(focus.start).Milliseconds(),
+	)
 	return err
 }
 
-func (t *WindowTracker) closeSession(rowID int64, closedAt time.Time) error {
-	_, err := t.db.Exec(`UPDATE window_sessions SET closed_at = COALESCE(closed_at, ?) WHERE id = ?`, closedAt.UTC(), rowID)
+func (t *WindowTracker) flushSession(session *windowSession, now time.Time) error {
+	_, err := t.exec(
+		`UPDATE window_sessions SET window_title = ?, title_source = ?, url = ?, domain = ? WHERE id = ?`,
+		session.windowTitle,
+		string(session.titleSource),
+		nullIfEmpty(session.url),
+		nullIfEmpty(session.domain),
+		session.rowID,
+	)
+	if err == nil {
+		session.dirty, session.flushedAt = false, now
+	}
+	return err
+}
+
+func nullIfEmpty(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func (t *WindowTracker) closeSession(session *windowSession, closedAt time.Time) error {
+	if session.dirty {
+		if err := t.flushSession(session, closedAt); err != nil {
+			return err
+		}
+	}
+	_, err := t.exec(`UPDATE window_sessions SET closed_at = COALESCE(closed_at, ?) WHERE id = ?`, closedAt.UTC(), session.rowID)
 	return err
 }
 
@@ -283,12 +576,29 @@ func initWindowTrackerSchema(db *sql.DB) error {
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			app_name TEXT NOT NULL,
 			window_title TEXT,
+			title_source TEXT,
+			url TEXT,
+			domain TEXT,
 			window_id INTEGER NOT NULL,
 			opened_at TIMESTAMP NOT NULL,
 			closed_at TIMESTAMP
 		);`,
 		`CREATE INDEX IF NOT EXISTS idx_window_sessions_app_opened ON window_sessions(app_name, opened_at);`,
 		`CREATE INDEX IF NOT EXISTS idx_window_sessions_window_id ON window_sessions(window_id, opened_at);`,
+		`CREATE TABLE IF NOT EXISTS focus_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER REFERENCES window_sessions(id) ON DELETE SET NULL,
+			app_name TEXT NOT NULL,
+			window_title TEXT,
+			title_source TEXT,
+			url TEXT,
+			domain TEXT,
+			window_id INTEGER NOT NULL,
+			started_at TIMESTAMP NOT NULL,
+			ended_at TIMESTAMP NOT NULL,
+			duration_ms INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_focus_sessions_app_started ON focus_sessions(app_name, started_at);`,
 	}
 
 	for _, stmt := range schema {
@@ -296,35 +606,60 @@ func initWindowTrackerSchema(db *sql.DB) error {
 			return fmt.Errorf("initialize window tracker schema: %w", err)
 		}
 	}
+	for _, table := range []string{"window_sessions", "focus_sessions"} {
+		for _, column := range []string{"title_source", "url", "domain"} {
+			if err := ensureColumn(db, table, column, "TEXT"); err != nil {
+				return fmt.Errorf("initialize window tracker schema: %w", err)
+			}
+		}
+	}
 	return nil
 }
 
-func ensureWindowEnumerationAvailable() error {
-	_, err := captureWindowSnapshot()
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, kind       string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &kind, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func ensureWindowEnumerationAvailable(source windowSource) error {
+	_, err := source.Snapshot()
 	if err == nil {
 		return nil
 	}
-	if errors.Is(err, errWindowEnumerationUnavailable) {
+	if errors.Is(err, windows.ErrUnavailable) {
 		return fmt.Errorf("window tracking unsupported: %w", err)
 	}
 	return err
 }
 
-func normalizeWindowTitle(title string) string {
-	return strings.TrimSpace(title)
-}
-
-func (t *WindowTracker) resolvedTitle(snap windowSnapshot) string {
-	title := normalizeWindowTitle(snap.windowTitle)
-	if title != "" || snap.ownerPID == 0 {
-		return title
-	}
-	fallback, ok := fetchAXWindowTitle(snap.ownerPID, snap.windowID)
-	if ok && fallback != "" {
-		return normalizeWindowTitle(fallback)
+func (t *WindowTracker) resolvedTitle(snap windows.Window, now time.Time) (string, windows.TitleSource) {
+	title, source := t.titles.Resolve(snap, now)
+	if source == windows.TitleFromApp && runtime.GOOS == "darwin" && !windows.AccessibilityTrusted() {
+		warnAccessibilityOnce()
 	}
-	warnAccessibilityOnce()
-	return title
+	return title, source
 }
 
 func warnAccessibilityOnce() {
@@ -338,16 +673,10 @@ func (cfg WindowTrackerConfig) active() bool {
 }
 
 func windowTrackerConfigsEqual(a, b WindowTrackerConfig) bool {
-	if a.Enabled != b.Enabled || a.DBPath != b.DBPath || a.PollInterval != b.PollInterval || a.TrackAll != b.TrackAll {
+	if a.Enabled != b.Enabled || a.DBPath != b.DBPath || a.PollInterval != b.PollInterval || a.TrackAll != b.TrackAll ||
+		a.TrackFocus != b.TrackFocus || a.MinFocus != b.MinFocus || a.Retention != b.Retention || a.VacuumInterval != b.VacuumInterval ||
+		a.TitleTTL != b.TitleTTL || a.CaptureURLs != b.CaptureURLs || a.DomainOnly != b.DomainOnly {
 		return false
 	}
-	if len(a.Applications) != len(b.Applications) {
-		return false
-	}
-	for i := range a.Applications {
-		if a.Applications[i] != b.Applications[i] {
-			return false
-		}
-	}
-	return true
+	return stringSlicesEqual(a.Applications, b.Applications) && stringSlicesEqual(a.Browsers, b.Browsers)
 }
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type windowAppReport struct {
+	App           string `json:"app"`
+	FocusMs       int64  `json:"focus_ms"`
+	FocusSessions int    `json:"focus_sessions"`
+	WindowsOpened int    `json:"windows_opened"`
+}
+
+type windowReport struct {
+	Since time.Time         `json:"since"`
+	Until time.Time         `json:"until"`
+	Apps  []windowAppReport `json:"apps"`
+}
+
+func runWindowsCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: ghost windows report [-since 24h] [-format table|json|yaml|csv] | pause | resume")
+	}
+	switch args[0] {
+	case "report":
+		return runWindowsReport(args[1:])
+	case "pause", "resume":
+		if len(args) > 1 {
+			return fmt.Errorf("usage: ghost windows %s", args[0])
+		}
+		var state trackerState
+		if err := controlRequest("POST", "/v1/windows/tracker/"+args[0], nil, &state); err != nil {
+			return err
+		}
+		if state.Paused {
+			fmt.Println("window tracker paused")
+		} else {
+			fmt.Println("window tracker resumed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown windows command %q (available: report, pause, resume)", args[0])
+	}
+}
+
+func runWindowsReport(args []string) error {
+	fs := flag.NewFlagSet("windows report", flag.ContinueOnError)
+	since := fs.Duration("since", 24*time.Hour, "only count activity from this long ago")
+	formatValue := formatFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	format, err := parseOutputFormat(*formatValue)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return writeWindowReport(format, now.Add(-*since), now)
+}
+
+func writeWindowReport(format outputFormat, since, until time.Time) error {
+	db, err := openWindowTrackerDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := queryWindowReport(db, since, until)
+	if err != nil {
+		return err
+	}
+	if format == formatCSV {
+		return writeOutput(os.Stdout, format, report, report.csvTable)
+	}
+	return writeOutput(os.Stdout, format, report, report.table)
+}
+
+func openWindowTrackerDB() (*sql.DB, error) {
+	configPath, err := determineConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := readConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	dbPath := cfg.WindowTracker.DBPath
+	if _, err := os.Stat(dbPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no window tracker database at %s; enable [window_tracker] first", dbPath)
+		}
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite db: %w", err)
+	}
+	return db, nil
+}
+
+func queryWindowReport(db *sql.DB, since, until time.Time) (windowReport, error) {
+	report := windowReport{Since: since, Until: until, Apps: []windowAppReport{}}
+	byApp := make(map[string]*windowAppReport)
+	app := func(name string) *windowAppReport {
+		if entry, ok := byApp[name]; ok {
+			return entry
+		}
+		entry := &windowAppReport{App: name}
+		byApp[name] = entry
+		return entry
+	}
+
+	rows, err := db.Query(`SELECT app_name, COUNT(*), COALESCE(SUM(duration_ms), 0) FROM focus_sessions WHERE started_at >= ? AND started_at < ? GROUP BY app_name`, since.UTC(), until.UTC())
+	if err != nil {
+		return report, fmt.Errorf("query focus sessions: %w", err)
+	}
+	for rows.Next() {
+		var (
+			name     string
+			sessions int
+			focusMs  int64
+		)
+		if err := rows.Scan(&name, &sessions, &focusMs); err != nil {
+			rows.Close()
+			return report, fmt.Errorf("query focus sessions: %w", err)
+		}
+		entry := app(name)
+		entry.FocusSessions += sessions
+		entry.FocusMs += focusMs
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT app_name, COUNT(*) FROM window_sessions WHERE opened_at >= ? AND opened_at < ? GROUP BY app_name`, since.UTC(), until.UTC())
+	if err != nil {
+		return report, fmt.Errorf("query window sessions: %w", err)
+	}
+	for rows.Next() {
+		var (
+			name   string
+			opened int
+		)
+		if err := rows.Scan(&name, &opened); err != nil {
+			rows.Close()
+			return report, fmt.Errorf("query window sessions: %w", err)
+		}
+		app(name).WindowsOpened += opened
+	}
+	rows.Close()
+
+	var summaries int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'app_daily'`).Scan(&summaries); err != nil {
+		return report, fmt.Errorf("query daily summaries: %w", err)
+	}
+	if summaries > 0 {
+		rows, err = db.Query(`SELECT app_name, SUM(focus_sessions), SUM(focus_ms), SUM(windows_opened) FROM app_daily WHERE day >= ? AND day <= ? GROUP BY app_name`,
+			since.UTC().Format(time.DateOnly), until.Add(-time.Nanosecond).UTC().Format(time.DateOnly))
+		if err != nil {
+			return report, fmt.Errorf("query daily summaries: %w", err)
+		}
+		for rows.Next() {
+			var (
+				name     string
+				sessions int
+				focusMs  int64
+				opened   int
+			)
+			if err := rows.Scan(&name, &sessions, &focusMs, &opened); err != nil {
+				rows.Close()
+				return report, fmt.Errorf("query daily summaries: %w", err)
+			}
+			entry := app(name)
+			entry.FocusSessions += sessions
+			entry.FocusMs += focusMs
+			entry.WindowsOpened += opened
+		}
+		rows.Close()
+	}
+
+	for _, entry := range byApp {
+		report.Apps = append(report.Apps, *entry)
+	}
+	sort.Slice(report.Apps, func(i, j int) bool {
+		a, b := report.Apps[i], report.Apps[j]
+		if a.FocusMs != b.FocusMs {
+			return a.FocusMs > b.FocusMs
+		}
+		if a.WindowsOpened != b.WindowsOpened {
+			return a.WindowsOpened > b.WindowsOpened
+		}
+		return a.App < b.App
+	})
+	return report, nil
+}
+
+func (r windowReport) table() outputTable {
+	table := outputTable{header: []string{"APP", "FOCUSED", "SESSIONS", "WINDOWS"}}
+	for _, app := range r.Apps {
+		focused := (time.Duration(app.FocusMs) * time.Millisecond).Round(time.Second).String()
+		table.rows = append(table.rows, []string{app.App, focused, strconv.Itoa(app.FocusSessions), strconv.Itoa(app.WindowsOpened)})
+	}
+	return table
+}
+
+func (r windowReport) csvTable() outputTable {
+	table := outputTable{header: []string{"app", "focus_ms", "focus_sessions", "windows_opened"}}
+	for _, app := range r.Apps {
+		table.rows = append(table.rows, []string{app.App, strconv.FormatInt(app.FocusMs, 10), strconv.Itoa(app.FocusSessions), strconv.Itoa(app.WindowsOpened)})
+	}
+	return table
+}
@@ -3,16 +3,18 @@ module github.com/nikiv/ghost
 go 1.24.0
 
 require (
+	github.com/andreykaipov/goobs v1.5.6
+	github.com/creack/pty v1.1.24
 	github.com/fsnotify/fsnotify v1.9.0
+	github.com/jezek/xgb v1.3.1
 	github.com/pelletier/go-toml/v2 v2.2.4
 	github.com/rjeczalik/notify v0.9.3
+	golang.org/x/sys v0.36.0
 	modernc.org/sqlite v1.40.0
 )
 
 require (
-	github.com/andreykaipov/goobs v1.5.6 // indirect
 	github.com/buger/jsonparser v1.1.1 // indirect
-	github.com/creack/pty v1.1.24 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
@@ -24,7 +26,6 @@ require (
 	github.com/nu7hatch/gouuid v0.0.0-20131221200532-179d4d0c4d8d // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
-	golang.org/x/sys v0.36.0 // indirect
 	modernc.org/libc v1.66.10 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
@@ -0,0 +1,240 @@
+// Package configcheck reports problems in a ghost config with the file,
+// line and key path they come from.
+package configcheck
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+type Error struct {
+	File    string `json:"file,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%d:%d", e.Line, e.Column)
+		}
+		b.WriteString(": ")
+	} else if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d, column %d: ", e.Line, e.Column)
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+type Errors []*Error
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("%d config errors:", len(e)))
+	for _, err := range e {
+		lines = append(lines, "  "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *Errors) Add(err error) {
+	if err == nil {
+		return
+	}
+	var list Errors
+	if errors.As(err, &list) {
+		*e = append(*e, list...)
+		return
+	}
+	var single *Error
+	if errors.As(err, &single) {
+		*e = append(*e, single)
+		return
+	}
+	var decode *toml.DecodeError
+	if errors.As(err, &decode) {
+		line, column := decode.Position()
+		*e = append(*e, &Error{
+			Path:    strings.Join(decode.Key(), "."),
+			Line:    line,
+			Column:  column,
+			Message: strings.TrimPrefix(decode.Error(), "toml: "),
+		})
+		return
+	}
+	*e = append(*e, &Error{Message: err.Error()})
+}
+
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e Errors) Locate(file string, source []byte) {
+	positions := indexKeys(source)
+	for _, err := range e {
+		err.File = file
+		if err.Line > 0 {
+			if err.Path == "" {
+				err.Path = keyAtLine(positions, err.Line, err.Column)
+			}
+			continue
+		}
+		hint := err.Path
+		if hint == "" {
+			err.Path, err.Message = splitKeyPath(err.Message, positions)
+			hint = err.Path
+			if match := keyPrefix.FindStringSubmatch(err.Message); match != nil {
+				hint = joinKey(err.Path, match[1])
+			}
+		}
+		if position, ok := lookupKey(positions, hint); ok {
+			err.Line, err.Column = position.Line, position.Column
+		}
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func keyAtLine(positions map[string]unstable.Position, line, column int) string {
+	best, bestColumn := "", 0
+	for path, position := range positions {
+		if position.Line != line || position.Column > column {
+			continue
+		}
+		if position.Column > bestColumn || (position.Column == bestColumn && len(path) > len(best)) {
+			best, bestColumn = path, position.Column
+		}
+	}
+	return best
+}
+
+var keyPrefix = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*(?:\[\d+\])?(?:\.[A-Za-z_][A-Za-z0-9_]*(?:\[\d+\])?)*)(: | )`)
+
+func splitKeyPath(message string, positions map[string]unstable.Position) (string, string) {
+	path := ""
+	for {
+		match := keyPrefix.FindStringSubmatch(message)
+		if match == nil {
+			break
+		}
+		candidate := joinKey(path, match[1])
+		if _, known := positions[candidate]; !known && (path != "" || match[2] != ": ") {
+			break
+		}
+		path, message = candidate, message[len(match[0]):]
+	}
+	return path, message
+}
+
+func lookupKey(positions map[string]unstable.Position, path string) (unstable.Position, bool) {
+	for path != "" {
+		if position, ok := positions[path]; ok {
+			return position, true
+		}
+		if strings.HasSuffix(path, "]") {
+			path = path[:strings.LastIndex(path, "[")]
+		} else if i := strings.LastIndex(path, "."); i >= 0 {
+			path = path[:i]
+		} else {
+			path = ""
+		}
+	}
+	return unstable.Position{}, false
+}
+
+func indexKeys(source []byte) map[string]unstable.Position {
+	positions := make(map[string]unstable.Position)
+	walkKeys(source, func(path string, _ unstable.Range, position unstable.Position) {
+		if _, ok := positions[path]; !ok {
+			positions[path] = position
+		}
+	})
+	return positions
+}
+
+type keyVisitor func(path string, raw unstable.Range, position unstable.Position)
+
+func walkKeys(source []byte, visit keyVisitor) {
+	tables := make(map[string]int)
+	var parser unstable.Parser
+	parser.Reset(source)
+	table := ""
+	for parser.NextExpression() {
+		node := parser.Expression()
+		switch node.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = ""
+			it := node.Key()
+			for it.Next() {
+				key := it.Node()
+				table = joinKey(table, string(key.Data))
+				if it.IsLast() && node.Kind == unstable.ArrayTable {
+					index := tables[table]
+					tables[table] = index + 1
+					table = fmt.Sprintf("%s[%d]", table, index)
+				} else if count, ok := tables[table]; ok {
+					table = fmt.Sprintf("%s[%d]", table, count-1)
+				}
+				visit(table, key.Raw, parser.Shape(key.Raw).Start)
+			}
+		case unstable.KeyValue:
+			walkKeyValue(&parser, visit, table, node)
+		}
+	}
+}
+
+func walkKeyValue(parser *unstable.Parser, visit keyVisitor, prefix string, node *unstable.Node) {
+	path := prefix
+	it := node.Key()
+	for it.Next() {
+		key := it.Node()
+		path = joinKey(path, string(key.Data))
+		visit(path, key.Raw, parser.Shape(key.Raw).Start)
+	}
+	walkValue(parser, visit, path, node.Value())
+}
+
+func walkValue(parser *unstable.Parser, visit keyVisitor, path string, value *unstable.Node) {
+	switch value.Kind {
+	case unstable.InlineTable:
+		children := value.Children()
+		for children.Next() {
+			walkKeyValue(parser, visit, path, children.Node())
+		}
+	case unstable.Array:
+		children := value.Children()
+		for i := 0; children.Next(); i++ {
+			child := children.Node()
+			if child.Kind != unstable.InlineTable {
+				continue
+			}
+			element := fmt.Sprintf("%s[%d]", path, i)
+			visit(element, child.Raw, parser.Shape(child.Raw).Start)
+			walkValue(parser, visit, element, child)
+		}
+	}
+}
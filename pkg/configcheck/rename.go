@@ -0,0 +1,86 @@
+package configcheck
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+type Rename struct {
+	Old string
+	New string
+}
+
+type Deprecation struct {
+	Old    string
+	New    string
+	Line   int
+	Column int
+}
+
+var keyIndex = regexp.MustCompile(`\[\d+\]`)
+
+func RenameKeys(source []byte, renames []Rename) ([]byte, []Deprecation, error) {
+	if len(renames) == 0 {
+		return source, nil, nil
+	}
+	byOld := make(map[string]Rename, len(renames))
+	for _, rename := range renames {
+		byOld[rename.Old] = rename
+	}
+
+	type edit struct {
+		raw unstable.Range
+		key string
+	}
+	var (
+		edits        []edit
+		deprecations []Deprecation
+		present      = make(map[string]bool)
+	)
+	walkKeys(source, func(path string, raw unstable.Range, position unstable.Position) {
+		present[path] = true
+		rename, ok := byOld[keyIndex.ReplaceAllString(path, "[]")]
+		if !ok {
+			return
+		}
+		newKey := lastKey(rename.New)
+		edits = append(edits, edit{raw: raw, key: newKey})
+		deprecations = append(deprecations, Deprecation{
+			Old:    path,
+			New:    path[:len(path)-len(lastKey(path))] + newKey,
+			Line:   position.Line,
+			Column: position.Column,
+		})
+	})
+
+	var errs Errors
+	for _, deprecation := range deprecations {
+		if present[deprecation.New] {
+			errs = append(errs, &Error{
+				Path:    deprecation.Old,
+				Line:    deprecation.Line,
+				Column:  deprecation.Column,
+				Message: fmt.Sprintf("is a deprecated name for %s, which is also set; remove one of them", deprecation.New),
+			})
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return source, nil, err
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].raw.Offset > edits[j].raw.Offset })
+	renamed := append([]byte(nil), source...)
+	for _, e := range edits {
+		end := e.raw.Offset + e.raw.Length
+		renamed = append(renamed[:e.raw.Offset], append([]byte(e.key), renamed[end:]...)...)
+	}
+	return renamed, deprecations, nil
+}
+
+func lastKey(path string) string {
+	return path[strings.LastIndex(path, ".")+1:]
+}
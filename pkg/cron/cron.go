@@ -0,0 +1,172 @@
+// Package cron parses five-field cron expressions and macros such as
+// @daily, and finds the next time a schedule fires.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type fieldMask uint64
+
+func (f fieldMask) has(value int) bool {
+	return f&(1<<uint(value)) != 0
+}
+
+type Schedule struct {
+	minute  fieldMask
+	hour    fieldMask
+	dom     fieldMask
+	month   fieldMask
+	dow     fieldMask
+	anyDom  bool
+	anyDow  bool
+	literal string
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+func Parse(expr string) (Schedule, error) {
+	literal := strings.TrimSpace(expr)
+	spec := literal
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("cron %q: expected 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+
+	schedule := Schedule{literal: literal}
+	var err error
+	if schedule.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return Schedule{}, fmt.Errorf("cron %q: minute: %w", expr, err)
+	}
+	if schedule.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return Schedule{}, fmt.Errorf("cron %q: hour: %w", expr, err)
+	}
+	if schedule.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return Schedule{}, fmt.Errorf("cron %q: day of month: %w", expr, err)
+	}
+	if schedule.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return Schedule{}, fmt.Errorf("cron %q: month: %w", expr, err)
+	}
+	if schedule.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return Schedule{}, fmt.Errorf("cron %q: day of week: %w", expr, err)
+	}
+	if schedule.dow.has(7) {
+		schedule.dow |= 1
+	}
+	schedule.anyDom = fields[2] == "*" || fields[2] == "?"
+	schedule.anyDow = fields[4] == "*" || fields[4] == "?"
+	return schedule, nil
+}
+
+func parseField(field string, min, max int, names map[string]int) (fieldMask, error) {
+	var result fieldMask
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if before, after, ok := strings.Cut(part, "/"); ok {
+			rangePart = before
+			value, err := strconv.Atoi(after)
+			if err != nil || value <= 0 {
+				return 0, fmt.Errorf("invalid step %q", after)
+			}
+			step = value
+		}
+
+		low, high := min, max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = parseValue(from, names); err != nil {
+				return 0, err
+			}
+			if high, err = parseValue(to, names); err != nil {
+				return 0, err
+			}
+		default:
+			value, err := parseValue(rangePart, names)
+			if err != nil {
+				return 0, err
+			}
+			low = value
+			if !strings.Contains(part, "/") {
+				high = value
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			result |= 1 << uint(value)
+		}
+	}
+	return result, nil
+}
+
+func parseValue(value string, names map[string]int) (int, error) {
+	if named, ok := names[strings.ToLower(value)]; ok {
+		return named, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return number, nil
+}
+
+func (c Schedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom.has(t.Day())
+	dowMatch := c.dow.has(int(t.Weekday()))
+	if c.anyDom || c.anyDow {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (c Schedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !c.hour.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !c.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c Schedule) String() string {
+	return c.literal
+}
@@ -0,0 +1,79 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Thursday.
+	after := time.Date(2026, 1, 1, 9, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 9-17 * * mon-fri", time.Date(2026, 1, 1, 9, 15, 0, 0, time.UTC)},
+		{"7 9 * * *", time.Date(2026, 1, 2, 9, 7, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@HOURLY", time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 12 13 * *", time.Date(2026, 1, 13, 12, 0, 0, 0, time.UTC)},
+		// Day of month and day of week both restricted: either one fires.
+		{"0 12 13 * fri", time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)},
+		{"30 9 * feb *", time.Date(2026, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 */3 *", time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.Next(after); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next(%s) = %s, want %s", tt.expr, after, got, tt.want)
+		}
+	}
+}
+
+func TestNextKeepsTheLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	schedule, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := schedule.Next(time.Date(2026, 1, 1, 10, 0, 0, 0, loc))
+	if want := time.Date(2026, 1, 2, 9, 0, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Fatalf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * * funday",
+		"@sometimes",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestStringIsTheExpression(t *testing.T) {
+	schedule, err := Parse("  @weekly ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := schedule.String(); got != "@weekly" {
+		t.Fatalf("String() = %q, want %q", got, "@weekly")
+	}
+}
@@ -0,0 +1,17 @@
+package windows
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var ErrNotBrowser = errors.New("not a supported browser")
+
+func Domain(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
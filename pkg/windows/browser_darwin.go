@@ -0,0 +1,69 @@
+//go:build darwin
+
+package windows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+const browserURLTimeout = 2 * time.Second
+
+var browserScripts = map[string]string{
+	"Safari":                    `tell application "Safari" to return URL of front document`,
+	"Safari Technology Preview": `tell application "Safari Technology Preview" to return URL of front document`,
+	"Google Chrome":             chromiumScript("Google Chrome"),
+	"Google Chrome Canary":      chromiumScript("Google Chrome Canary"),
+	"Chromium":                  chromiumScript("Chromium"),
+	"Brave Browser":             chromiumScript("Brave Browser"),
+	"Microsoft Edge":            chromiumScript("Microsoft Edge"),
+	"Vivaldi":                   chromiumScript("Vivaldi"),
+	"Opera":                     chromiumScript("Opera"),
+	"Arc":                       chromiumScript("Arc"),
+}
+
+func chromiumScript(app string) string {
+	return fmt.Sprintf(`tell application %q to return URL of active tab of front window`, app)
+}
+
+func SupportedBrowsers() []string {
+	names := make([]string, 0, len(browserScripts))
+	for name := range browserScripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func BrowserURL(app string) (string, error) {
+	var script string
+	for name, candidate := range browserScripts {
+		if strings.EqualFold(name, app) {
+			script = candidate
+			break
+		}
+	}
+	if script == "" {
+		return "", ErrNotBrowser
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), browserURLTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "osascript", "-e", script).Output()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("ask %s for its URL: timed out after %s", app, browserURLTimeout)
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("ask %s for its URL: %s", app, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("ask %s for its URL: %w", app, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
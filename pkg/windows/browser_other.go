@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package windows
+
+func SupportedBrowsers() []string {
+	return nil
+}
+
+func BrowserURL(app string) (string, error) {
+	return "", ErrUnavailable
+}
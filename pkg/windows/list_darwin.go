@@ -1,6 +1,6 @@
 //go:build darwin
 
-package main
+package windows
 
 /*
 #cgo CFLAGS: -x objective-c -fmodules -fobjc-arc
@@ -131,7 +131,9 @@ import (
 	"unsafe"
 )
 
-func captureWindowSnapshot() ([]windowSnapshot, error) {
+const Supported = true
+
+func List() ([]Window, error) {
 	array := C.ghostCopyWindowInfo()
 	if array == 0 {
 		return nil, fmt.Errorf("failed to copy window info")
@@ -139,7 +141,7 @@ func captureWindowSnapshot() ([]windowSnapshot, error) {
 	defer C.CFRelease(C.CFTypeRef(array))
 
 	count := int(C.CFArrayGetCount(array))
-	result := make([]windowSnapshot, 0, count)
+	result := make([]Window, 0, count)
 	for i := 0; i < count; i++ {
 		entry := C.CFArrayGetValueAtIndex(array, C.CFIndex(i))
 		if entry == nil {
@@ -160,13 +162,13 @@ func captureWindowSnapshot() ([]windowSnapshot, error) {
 		var onScreen C.int32_t
 		C.ghostReadBool(dict, C.kCGWindowIsOnscreen, &onScreen)
 
-		result = append(result, windowSnapshot{
-			ownerName:   owner,
-			windowTitle: title,
-			windowID:    uint64(windowID),
-			layer:       int(layer),
-			ownerPID:    int32(ownerPID),
-			onScreen:    onScreen != 0,
+		result = append(result, Window{
+			Owner:    owner,
+			Title:    title,
+			ID:       uint64(windowID),
+			Layer:    int(layer),
+			PID:      int32(ownerPID),
+			OnScreen: onScreen != 0,
 		})
 	}
 	return result, nil
@@ -184,7 +186,7 @@ func cfStringToGo(ref C.CFStringRef) string {
 	return C.GoString(cstr)
 }
 
-func fetchAXWindowTitle(pid int32, windowID uint64) (string, bool) {
+func AXTitle(pid int32, windowID uint64) (string, bool) {
 	if pid == 0 || windowID == 0 {
 		return "", false
 	}
@@ -196,3 +198,7 @@ func fetchAXWindowTitle(pid int32, windowID uint64) (string, bool) {
 	title := cfStringToGo(titleRef)
 	return title, title != ""
 }
+
+func AccessibilityTrusted() bool {
+	return C.AXIsProcessTrusted() != 0
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package windows
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const Supported = true
+
+func List() ([]Window, error) {
+	if strings.TrimSpace(os.Getenv("WAYLAND_DISPLAY")) != "" {
+		switch {
+		case os.Getenv("SWAYSOCK") != "":
+			return captureSwaySnapshot(os.Getenv("SWAYSOCK"))
+		case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
+			return captureHyprlandSnapshot(os.Getenv("HYPRLAND_INSTANCE_SIGNATURE"))
+		}
+	}
+	if strings.TrimSpace(os.Getenv("DISPLAY")) != "" {
+		return captureX11Snapshot()
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		return nil, fmt.Errorf("%w: this Wayland compositor does not expose a window list (supported: sway, Hyprland, or X11/XWayland via DISPLAY)", ErrUnavailable)
+	}
+	return nil, fmt.Errorf("%w: neither DISPLAY nor WAYLAND_DISPLAY is set", ErrUnavailable)
+}
+
+func AXTitle(pid int32, windowID uint64) (string, bool) {
+	return "", true
+}
+
+func AccessibilityTrusted() bool {
+	return false
+}
@@ -0,0 +1,17 @@
+//go:build !darwin && !linux
+
+package windows
+
+const Supported = false
+
+func List() ([]Window, error) {
+	return nil, ErrUnavailable
+}
+
+func AXTitle(pid int32, windowID uint64) (string, bool) {
+	return "", false
+}
+
+func AccessibilityTrusted() bool {
+	return false
+}
@@ -0,0 +1,84 @@
+package windows
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type TitleSource string
+
+const (
+	TitleFromWindow        TitleSource = "window"
+	TitleFromAccessibility TitleSource = "accessibility"
+	TitleFromApp           TitleSource = "app"
+)
+
+const DefaultTitleTTL = 30 * time.Second
+
+type TitleResolver struct {
+	TTL     time.Duration
+	Lookup  func(pid int32, windowID uint64) (string, bool)
+	Trusted func() bool
+
+	mu    sync.Mutex
+	cache map[titleKey]cachedTitle
+}
+
+type titleKey struct {
+	pid int32
+	id  uint64
+}
+
+type cachedTitle struct {
+	title   string
+	expires time.Time
+}
+
+func NewTitleResolver(ttl time.Duration) *TitleResolver {
+	return &TitleResolver{TTL: ttl, Lookup: AXTitle, Trusted: AccessibilityTrusted}
+}
+
+func (r *TitleResolver) Resolve(w Window, now time.Time) (string, TitleSource) {
+	key := titleKey{pid: w.PID, id: w.ID}
+	if title := strings.TrimSpace(w.Title); title != "" {
+		r.mu.Lock()
+		delete(r.cache, key)
+		r.mu.Unlock()
+		return title, TitleFromWindow
+	}
+	if w.PID == 0 || w.ID == 0 || r.Lookup == nil || (r.Trusted != nil && !r.Trusted()) {
+		return strings.TrimSpace(w.Owner), TitleFromApp
+	}
+
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if !ok || !now.Before(cached.expires) {
+		title, found := r.Lookup(w.PID, w.ID)
+		if !found {
+			title = ""
+		}
+		cached = cachedTitle{title: strings.TrimSpace(title), expires: now.Add(r.TTL)}
+		r.mu.Lock()
+		if r.cache == nil {
+			r.cache = make(map[titleKey]cachedTitle)
+		}
+		r.cache[key] = cached
+		r.mu.Unlock()
+	}
+	if cached.title != "" {
+		return cached.title, TitleFromAccessibility
+	}
+	return strings.TrimSpace(w.Owner), TitleFromApp
+}
+
+func (r *TitleResolver) Prune(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, cached := range r.cache {
+		if !now.Before(cached.expires) {
+			delete(r.cache, key)
+		}
+	}
+}
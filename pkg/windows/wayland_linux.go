@@ -0,0 +1,200 @@
+//go:build linux
+
+package windows
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	swayIPCMagic   = "i3-ipc"
+	swayGetTree    = 4
+	waylandTimeout = 2 * time.Second
+)
+
+type swayNode struct {
+	ID               int64      `json:"id"`
+	Type             string     `json:"type"`
+	Name             string     `json:"name"`
+	AppID            string     `json:"app_id"`
+	PID              int32      `json:"pid"`
+	Focused          bool       `json:"focused"`
+	Visible          *bool      `json:"visible"`
+	Nodes            []swayNode `json:"nodes"`
+	FloatingNodes    []swayNode `json:"floating_nodes"`
+	WindowProperties struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+}
+
+func captureSwaySnapshot(socket string) ([]Window, error) {
+	conn, err := net.DialTimeout("unix", socket, waylandTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect to sway: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(waylandTimeout))
+
+	header := make([]byte, len(swayIPCMagic)+8)
+	copy(header, swayIPCMagic)
+	binary.LittleEndian.PutUint32(header[len(swayIPCMagic):], 0)
+	binary.LittleEndian.PutUint32(header[len(swayIPCMagic)+4:], swayGetTree)
+	if _, err := conn.Write(header); err != nil {
+		return nil, fmt.Errorf("query sway tree: %w", err)
+	}
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, fmt.Errorf("read sway reply: %w", err)
+	}
+	if string(header[:len(swayIPCMagic)]) != swayIPCMagic {
+		return nil, fmt.Errorf("read sway reply: unexpected magic %q", header[:len(swayIPCMagic)])
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(header[len(swayIPCMagic):]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, fmt.Errorf("read sway reply: %w", err)
+	}
+
+	var root swayNode
+	if err := json.Unmarshal(payload, &root); err != nil {
+		return nil, fmt.Errorf("decode sway tree: %w", err)
+	}
+
+	var result []Window
+	var walk func(node swayNode)
+	walk = func(node swayNode) {
+		if (node.Type == "con" || node.Type == "floating_con") && len(node.Nodes) == 0 && node.PID != 0 {
+			owner := node.AppID
+			if owner == "" {
+				owner = node.WindowProperties.Class
+			}
+			if owner != "" {
+				snap := Window{
+					Owner:    owner,
+					Title:    node.Name,
+					ID:       uint64(node.ID),
+					PID:      node.PID,
+					OnScreen: node.Visible == nil || *node.Visible,
+				}
+				if node.Focused {
+					result = append([]Window{snap}, result...)
+				} else {
+					result = append(result, snap)
+				}
+			}
+		}
+		for _, child := range node.Nodes {
+			walk(child)
+		}
+		for _, child := range node.FloatingNodes {
+			walk(child)
+		}
+	}
+	walk(root)
+	return result, nil
+}
+
+type hyprlandClient struct {
+	Address   string `json:"address"`
+	Mapped    bool   `json:"mapped"`
+	Hidden    bool   `json:"hidden"`
+	Class     string `json:"class"`
+	Title     string `json:"title"`
+	PID       int32  `json:"pid"`
+	Workspace struct {
+		ID int `json:"id"`
+	} `json:"workspace"`
+	FocusHistoryID int `json:"focusHistoryID"`
+}
+
+type hyprlandMonitor struct {
+	ActiveWorkspace struct {
+		ID int `json:"id"`
+	} `json:"activeWorkspace"`
+	SpecialWorkspace struct {
+		ID int `json:"id"`
+	} `json:"specialWorkspace"`
+}
+
+func captureHyprlandSnapshot(signature string) ([]Window, error) {
+	socket := hyprlandSocketPath(signature)
+
+	var monitors []hyprlandMonitor
+	if err := hyprlandQuery(socket, "j/monitors", &monitors); err != nil {
+		return nil, err
+	}
+	visible := make(map[int]struct{}, len(monitors)*2)
+	for _, monitor := range monitors {
+		visible[monitor.ActiveWorkspace.ID] = struct{}{}
+		if monitor.SpecialWorkspace.ID != 0 {
+			visible[monitor.SpecialWorkspace.ID] = struct{}{}
+		}
+	}
+
+	var clients []hyprlandClient
+	if err := hyprlandQuery(socket, "j/clients", &clients); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(clients, func(i, j int) bool {
+		return clients[i].FocusHistoryID < clients[j].FocusHistoryID
+	})
+
+	result := make([]Window, 0, len(clients))
+	for _, client := range clients {
+		if client.Class == "" || !client.Mapped {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(client.Address, "0x"), 16, 64)
+		if err != nil {
+			continue
+		}
+		_, onWorkspace := visible[client.Workspace.ID]
+		result = append(result, Window{
+			Owner:    client.Class,
+			Title:    client.Title,
+			ID:       id,
+			PID:      client.PID,
+			OnScreen: onWorkspace && !client.Hidden,
+		})
+	}
+	return result, nil
+}
+
+func hyprlandSocketPath(signature string) string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		path := filepath.Join(runtimeDir, "hypr", signature, ".socket.sock")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join("/tmp", "hypr", signature, ".socket.sock")
+}
+
+func hyprlandQuery(socket, command string, out any) error {
+	conn, err := net.DialTimeout("unix", socket, waylandTimeout)
+	if err != nil {
+		return fmt.Errorf("connect to Hyprland: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(waylandTimeout))
+
+	if _, err := io.WriteString(conn, command); err != nil {
+		return fmt.Errorf("query Hyprland %s: %w", command, err)
+	}
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		return fmt.Errorf("read Hyprland %s: %w", command, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode Hyprland %s: %w", command, err)
+	}
+	return nil
+}
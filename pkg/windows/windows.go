@@ -0,0 +1,16 @@
+// Package windows lists the open windows on macOS and Linux and resolves
+// their titles the way the ghost window tracker records them.
+package windows
+
+import "errors"
+
+var ErrUnavailable = errors.New("window enumeration unavailable on this platform")
+
+type Window struct {
+	Owner    string
+	Title    string
+	ID       uint64
+	Layer    int
+	PID      int32
+	OnScreen bool
+}
@@ -0,0 +1,203 @@
+//go:build linux
+
+package windows
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+type x11Session struct {
+	conn  *xgb.Conn
+	root  xproto.Window
+	atoms map[string]xproto.Atom
+}
+
+var (
+	x11Mu      sync.Mutex
+	x11Current *x11Session
+)
+
+func captureX11Snapshot() ([]Window, error) {
+	x11Mu.Lock()
+	defer x11Mu.Unlock()
+
+	if x11Current == nil {
+		conn, err := xgb.NewConn()
+		if err != nil {
+			return nil, fmt.Errorf("connect to X server: %w", err)
+		}
+		x11Current = &x11Session{
+			conn:  conn,
+			root:  xproto.Setup(conn).DefaultScreen(conn).Root,
+			atoms: make(map[string]xproto.Atom),
+		}
+	}
+
+	snapshots, err := x11Current.snapshot()
+	if err != nil {
+		x11Current.conn.Close()
+		x11Current = nil
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (s *x11Session) snapshot() ([]Window, error) {
+	windows, err := s.windowList(s.root, "_NET_CLIENT_LIST_STACKING")
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) == 0 {
+		if windows, err = s.windowList(s.root, "_NET_CLIENT_LIST"); err != nil {
+			return nil, err
+		}
+		if len(windows) == 0 {
+			return nil, fmt.Errorf("%w: window manager does not publish _NET_CLIENT_LIST (EWMH)", ErrUnavailable)
+		}
+	}
+
+	currentDesktop, hasDesktop := s.cardinal(s.root, "_NET_CURRENT_DESKTOP")
+	hidden := s.atom("_NET_WM_STATE_HIDDEN")
+	normalTypes := map[xproto.Atom]struct{}{
+		s.atom("_NET_WM_WINDOW_TYPE_NORMAL"): {},
+		s.atom("_NET_WM_WINDOW_TYPE_DIALOG"): {},
+	}
+
+	result := make([]Window, 0, len(windows))
+	for i := len(windows) - 1; i >= 0; i-- {
+		window := windows[i]
+		owner := s.windowClass(window)
+		if owner == "" {
+			continue
+		}
+		snap := Window{
+			Owner:    owner,
+			Title:    s.windowTitle(window),
+			ID:       uint64(window),
+			OnScreen: true,
+		}
+		if pid, ok := s.cardinal(window, "_NET_WM_PID"); ok {
+			snap.PID = int32(pid)
+		}
+		if types, err := s.atomList(window, "_NET_WM_WINDOW_TYPE"); err == nil && len(types) > 0 {
+			if _, ok := normalTypes[types[0]]; !ok {
+				snap.Layer = 1
+			}
+		}
+		if states, err := s.atomList(window, "_NET_WM_STATE"); err == nil {
+			for _, state := range states {
+				if state == hidden {
+					snap.OnScreen = false
+				}
+			}
+		}
+		if desktop, ok := s.cardinal(window, "_NET_WM_DESKTOP"); ok && hasDesktop && desktop != 0xFFFFFFFF && desktop != currentDesktop {
+			snap.OnScreen = false
+		}
+		result = append(result, snap)
+	}
+	return result, nil
+}
+
+func (s *x11Session) atom(name string) xproto.Atom {
+	if atom, ok := s.atoms[name]; ok {
+		return atom
+	}
+	reply, err := xproto.InternAtom(s.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return xproto.AtomNone
+	}
+	s.atoms[name] = reply.Atom
+	return reply.Atom
+}
+
+func (s *x11Session) property(window xproto.Window, name string) (*xproto.GetPropertyReply, error) {
+	atom := s.atom(name)
+	if atom == xproto.AtomNone {
+		return nil, fmt.Errorf("intern atom %s", name)
+	}
+	reply, err := xproto.GetProperty(s.conn, false, window, atom, xproto.GetPropertyTypeAny, 0, 1<<16).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	return reply, nil
+}
+
+func (s *x11Session) windowList(window xproto.Window, name string) ([]xproto.Window, error) {
+	reply, err := s.property(window, name)
+	if err != nil {
+		return nil, err
+	}
+	values := uint32Values(reply)
+	windows := make([]xproto.Window, 0, len(values))
+	for _, value := range values {
+		windows = append(windows, xproto.Window(value))
+	}
+	return windows, nil
+}
+
+func (s *x11Session) atomList(window xproto.Window, name string) ([]xproto.Atom, error) {
+	reply, err := s.property(window, name)
+	if err != nil {
+		return nil, err
+	}
+	values := uint32Values(reply)
+	atoms := make([]xproto.Atom, 0, len(values))
+	for _, value := range values {
+		atoms = append(atoms, xproto.Atom(value))
+	}
+	return atoms, nil
+}
+
+func (s *x11Session) cardinal(window xproto.Window, name string) (uint32, bool) {
+	reply, err := s.property(window, name)
+	if err != nil {
+		return 0, false
+	}
+	values := uint32Values(reply)
+	if len(values) == 0 {
+		return 0, false
+	}
+	return values[0], true
+}
+
+func (s *x11Session) windowTitle(window xproto.Window) string {
+	for _, name := range []string{"_NET_WM_NAME", "WM_NAME"} {
+		reply, err := s.property(window, name)
+		if err == nil && reply.Format == 8 && len(reply.Value) > 0 {
+			return strings.TrimRight(string(reply.Value), "\x00")
+		}
+	}
+	return ""
+}
+
+func (s *x11Session) windowClass(window xproto.Window) string {
+	reply, err := s.property(window, "WM_CLASS")
+	if err != nil || reply.Format != 8 {
+		return ""
+	}
+	parts := strings.Split(strings.TrimRight(string(reply.Value), "\x00"), "\x00")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if parts[i] != "" {
+			return parts[i]
+		}
+	}
+	return ""
+}
+
+func uint32Values(reply *xproto.GetPropertyReply) []uint32 {
+	if reply == nil || reply.Format != 32 {
+		return nil
+	}
+	count := len(reply.Value) / 4
+	values := make([]uint32, 0, count)
+	for i := 0; i < count; i++ {
+		values = append(values, xgb.Get32(reply.Value[i*4:]))
+	}
+	return values
+}